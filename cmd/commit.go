@@ -0,0 +1,117 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+const commitCmdName = "commit"
+
+type commitFn func(c *cfg.Config, bucketName string) error
+
+// newCommitCmd returns the command that pushes the changes kept in a local
+// upper layer to the bucket beneath it. It shares the flags, and so the
+// config, of the root command.
+func newCommitCmd(c commitFn, configObj *cfg.Config, cfgErr *error) *cobra.Command {
+	return &cobra.Command{
+		Use:   commitCmdName + " [flags] bucket",
+		Short: "Write changes kept in a local upper layer to the bucket",
+		Long: `Mounting with --local-upper-dir keeps new and modified files, and records of
+deleted ones, in a local directory instead of writing them to the bucket. This
+command applies those changes to the bucket and clears them from the local
+directory. Changes to objects that have been modified in the bucket since they
+were copied up are not applied, but kept in the local directory and reported.
+The bucket must not be mounted over the same directory meanwhile.
+
+To mount a bucket named "commit", put -- before its name.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if *cfgErr != nil {
+				return fmt.Errorf("error while parsing config: %w", *cfgErr)
+			}
+			return c(configObj, args[0])
+		},
+	}
+}
+
+func commit(newConfig *cfg.Config, bucketName string) (err error) {
+	if newConfig.FileSystem.LocalUpperDir == "" {
+		return errors.New("--local-upper-dir must be set to the directory used when mounting")
+	}
+
+	ctx := context.Background()
+	local, err := storage.NewLocalBucket(gcsx.LocalUpperLayerDir(string(newConfig.FileSystem.LocalUpperDir), bucketName))
+	if err != nil {
+		return fmt.Errorf("NewLocalBucket: %w", err)
+	}
+
+	userAgent := getUserAgent(newConfig.AppName, getConfigForUserAgent(newConfig))
+	storageHandle, err := createStorageHandle(newConfig, userAgent)
+	if err != nil {
+		return fmt.Errorf("failed to create storage handle using createStorageHandle: %w", err)
+	}
+
+	b, err := openBucket(ctx, storageHandle, newConfig, bucketName)
+	if err != nil {
+		return err
+	}
+
+	committed, err := gcsx.CommitUpperLayer(ctx, local, b, tmpObjectPrefix)
+	if err != nil && !errors.Is(err, gcsx.ErrCommitConflict) {
+		return fmt.Errorf("CommitUpperLayer: %w", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Committed %d changes to bucket %q.\n", committed, bucketName)
+	if err != nil {
+		return fmt.Errorf("changes to objects modified in the bucket meanwhile were kept locally: %w", err)
+	}
+
+	return nil
+}
+
+// openBucket returns the named bucket as a mount with the supplied config sees
+// it beneath any local upper layer: limited to --only-dir, and, for the name
+// of a union, the union of its layers.
+func openBucket(ctx context.Context, storageHandle storage.StorageHandle, newConfig *cfg.Config, bucketName string) (gcs.Bucket, error) {
+	names := strings.Split(bucketName, gcsx.UnionBucketSeparator)
+	layers := make([]gcs.Bucket, len(names))
+	for i, name := range names {
+		b, err := storageHandle.BucketHandle(ctx, name, newConfig.GcsConnection.BillingProject)
+		if err != nil {
+			return nil, fmt.Errorf("BucketHandle(%q): %w", name, err)
+		}
+
+		if layers[i], err = gcsx.NewOnlyDirBucket(newConfig.OnlyDir, b); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+	return gcsx.NewUnionBucket(tmpObjectPrefix, layers[0], layers[1:]...), nil
+}
@@ -0,0 +1,75 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitCmd(t *testing.T) {
+	var configObj cfg.Config
+	var cfgErr error
+	var bucketName string
+	cmd := newCommitCmd(func(_ *cfg.Config, b string) error {
+		bucketName = b
+		return nil
+	}, &configObj, &cfgErr)
+	cmd.SetArgs([]string{"abc"})
+
+	err := cmd.Execute()
+
+	require.NoError(t, err)
+	assert.Equal(t, "abc", bucketName)
+}
+
+func TestCommitCmd_RequiresBucket(t *testing.T) {
+	var configObj cfg.Config
+	var cfgErr error
+	cmd := newCommitCmd(func(*cfg.Config, string) error { return nil }, &configObj, &cfgErr)
+	cmd.SetArgs([]string{})
+
+	err := cmd.Execute()
+
+	assert.Error(t, err)
+}
+
+func TestCommitCmd_ConfigError(t *testing.T) {
+	var configObj cfg.Config
+	cfgErr := errors.New("bad config")
+	called := false
+	cmd := newCommitCmd(func(*cfg.Config, string) error {
+		called = true
+		return nil
+	}, &configObj, &cfgErr)
+	cmd.SetArgs([]string{"abc"})
+
+	err := cmd.Execute()
+
+	assert.ErrorIs(t, err, cfgErr)
+	assert.False(t, called)
+}
+
+func TestCommit_RequiresLocalUpperDir(t *testing.T) {
+	var configObj cfg.Config
+
+	err := commit(&configObj, "abc")
+
+	assert.ErrorContains(t, err, "--local-upper-dir")
+}
@@ -0,0 +1,43 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+)
+
+// validateOptionCombinations rejects configurations that turn on options
+// which can't be used together, rather than silently ignoring one of them.
+func validateOptionCombinations(c *cfg.Config) error {
+	fileCache := &c.FileCache
+	if fileCache.ChunkSizeMb < 0 {
+		return errors.New("file-cache: chunk-size-mb can't be negative")
+	}
+	if fileCache.ChunkSizeMb > 0 && fileCache.EnableSharedCache {
+		return errors.New("file-cache: chunk-size-mb can't be used with enable-shared-cache")
+	}
+	if fileCache.ChunkSizeMb > 0 && fileCache.PersistIndex {
+		return errors.New("file-cache: chunk-size-mb can't be used with persist-index")
+	}
+	// Other processes sharing the cache directory leave markers for the files
+	// they have downloaded, and recovering an index would delete their files.
+	if fileCache.EnableSharedCache && fileCache.PersistIndex {
+		return errors.New("file-cache: enable-shared-cache can't be used with persist-index")
+	}
+
+	return nil
+}
@@ -517,7 +517,7 @@ func TestValidateConfigFile_FileSystemConfigSuccessful(t *testing.T) {
 					KernelListCacheTtlSecs: 0,
 					RenameDirLimit:         0,
 					TempDir:                "",
-					PreconditionErrors:     true,
+					PreconditionErrors:     "true",
 					Uid:                    -1,
 				},
 			},
@@ -536,7 +536,7 @@ func TestValidateConfigFile_FileSystemConfigSuccessful(t *testing.T) {
 					KernelListCacheTtlSecs: 0,
 					RenameDirLimit:         0,
 					TempDir:                "",
-					PreconditionErrors:     true,
+					PreconditionErrors:     "true",
 					Uid:                    -1,
 				},
 			},
@@ -555,7 +555,7 @@ func TestValidateConfigFile_FileSystemConfigSuccessful(t *testing.T) {
 					KernelListCacheTtlSecs: 300,
 					RenameDirLimit:         10,
 					TempDir:                cfg.ResolvedPath(path.Join(hd, "temp")),
-					PreconditionErrors:     false,
+					PreconditionErrors:     "false",
 					Uid:                    8,
 				},
 			},
@@ -849,3 +849,54 @@ func TestValidateConfigFile_MetricsConfigInvalid(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateOptionCombinations(t *testing.T) {
+	testCases := []struct {
+		name      string
+		fileCache cfg.FileCacheConfig
+		wantErr   bool
+	}{
+		{
+			name:      "defaults",
+			fileCache: defaultFileCacheConfig(t),
+			wantErr:   false,
+		},
+		{
+			name:      "chunks",
+			fileCache: cfg.FileCacheConfig{ChunkSizeMb: 8},
+			wantErr:   false,
+		},
+		{
+			name:      "negative_chunk_size",
+			fileCache: cfg.FileCacheConfig{ChunkSizeMb: -1},
+			wantErr:   true,
+		},
+		{
+			name:      "chunks_and_shared_cache",
+			fileCache: cfg.FileCacheConfig{ChunkSizeMb: 8, EnableSharedCache: true},
+			wantErr:   true,
+		},
+		{
+			name:      "chunks_and_persisted_index",
+			fileCache: cfg.FileCacheConfig{ChunkSizeMb: 8, PersistIndex: true},
+			wantErr:   true,
+		},
+		{
+			name:      "shared_cache_and_persisted_index",
+			fileCache: cfg.FileCacheConfig{EnableSharedCache: true, PersistIndex: true},
+			wantErr:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateOptionCombinations(&cfg.Config{FileCache: tc.fileCache})
+
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
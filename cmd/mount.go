@@ -15,8 +15,10 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
@@ -25,15 +27,23 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"golang.org/x/net/context"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	cacheutil "github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/changefeed"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/perms"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/policy"
 	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fsutil"
 	"github.com/jacobsa/timeutil"
 )
 
+// The prefix of the names of temporary objects written to the bucket.
+const tmpObjectPrefix = ".gcsfuse_tmp/"
+
 // Mount the file system based on the supplied arguments, returning a
 // fuse.MountedFileSystem that can be joined to wait for unmounting.
 func mountWithStorageHandle(
@@ -86,18 +96,63 @@ be interacting with the file system.`)
 		gid = uint32(newConfig.FileSystem.Gid)
 	}
 
+	for _, evictionPolicy := range []string{
+		newConfig.FileCache.EvictionPolicy,
+		newConfig.MetadataCache.StatCacheEvictionPolicy,
+		newConfig.MetadataCache.TypeCacheEvictionPolicy,
+	} {
+		if err = lru.CheckPolicy(evictionPolicy); err != nil {
+			return
+		}
+	}
+
 	bucketCfg := gcsx.BucketConfig{
 		BillingProject:                     newConfig.GcsConnection.BillingProject,
 		OnlyDir:                            newConfig.OnlyDir,
 		EgressBandwidthLimitBytesPerSecond: newConfig.GcsConnection.LimitBytesPerSec,
 		OpRateLimitHz:                      newConfig.GcsConnection.LimitOpsPerSec,
 		StatCacheMaxSizeMB:                 uint64(newConfig.MetadataCache.StatCacheMaxSizeMb),
+		StatCacheEvictionPolicy:            newConfig.MetadataCache.StatCacheEvictionPolicy,
 		StatCacheTTL:                       time.Duration(newConfig.MetadataCache.TtlSecs) * time.Second,
 		NegativeStatCacheTTL:               time.Duration(newConfig.MetadataCache.NegativeTtlSecs) * time.Second,
 		EnableMonitoring:                   cfg.IsMetricsEnabled(&newConfig.Metrics),
 		AppendThreshold:                    1 << 21, // 2 MiB, a total guess.
 		ChunkTransferTimeoutSecs:           newConfig.GcsRetries.ChunkTransferTimeoutSecs,
-		TmpObjectPrefix:                    ".gcsfuse_tmp/",
+		TmpObjectPrefix:                    tmpObjectPrefix,
+		EnableVersionsDir:                  newConfig.FileSystem.EnableVersionsDir,
+		EnableTrashDir:                     newConfig.FileSystem.EnableTrashDir,
+		LocalUpperDir:                      string(newConfig.FileSystem.LocalUpperDir),
+		MetricHandle:                       metricHandle,
+	}
+	if newConfig.SnapshotTime != "" {
+		bucketCfg.SnapshotTime, err = time.Parse(time.RFC3339, newConfig.SnapshotTime)
+		if err != nil {
+			err = fmt.Errorf("invalid snapshot time %q: %w", newConfig.SnapshotTime, err)
+			return
+		}
+	}
+	var policyRules *policy.Rules
+	if newConfig.FileSystem.PolicyRulesFile != "" {
+		policyRules, err = policy.Load(string(newConfig.FileSystem.PolicyRulesFile))
+		if err != nil {
+			err = fmt.Errorf("policy.Load: %w", err)
+			return
+		}
+		bucketCfg.PolicyRules = policyRules
+	}
+	var metadataDiskCache *metadata.DiskCache
+	if newConfig.MetadataCache.DiskCacheMaxSizeMb != 0 {
+		metadataDiskCache, err = openMetadataDiskCache(newConfig)
+		if errors.Is(err, metadata.ErrDiskCacheInUse) {
+			// Another mount has the same cache directory, so do without the
+			// disk tier rather than corrupt its log.
+			logger.Warnf("Not keeping the metadata cache on disk: %v", err)
+			metadataDiskCache, err = nil, nil
+		}
+		if err != nil {
+			return
+		}
+		bucketCfg.MetadataDiskCache = metadataDiskCache
 	}
 	bm := gcsx.NewBucketManager(bucketCfg, storageHandle)
 
@@ -120,11 +175,23 @@ be interacting with the file system.`)
 		EnableNonexistentTypeCache: newConfig.MetadataCache.EnableNonexistentTypeCache,
 		NewConfig:                  newConfig,
 		MetricHandle:               metricHandle,
+		PolicyRules:                policyRules,
+		ChangeSources:              changeSources(newConfig),
+		ChangePollInterval:         time.Duration(newConfig.MetadataCache.ChangePollIntervalSecs) * time.Second,
+		MetadataDiskCache:          metadataDiskCache,
+	}
+	if len(serverCfg.ChangeSources) > 0 || serverCfg.ChangePollInterval > 0 {
+		serverCfg.Notifier = fuse.NewNotifier()
 	}
 
 	logger.Infof("Creating a new server...\n")
 	server, err := fs.NewServer(ctx, serverCfg)
 	if err != nil {
+		if metadataDiskCache != nil {
+			if closeErr := metadataDiskCache.Close(); closeErr != nil {
+				logger.Warnf("Closing the metadata disk cache: %v", closeErr)
+			}
+		}
 		err = fmt.Errorf("fs.NewServer: %w", err)
 		return
 	}
@@ -148,6 +215,42 @@ be interacting with the file system.`)
 	return
 }
 
+// Open the disk tier of the metadata caches, in the cache directory.
+func openMetadataDiskCache(newConfig *cfg.Config) (*metadata.DiskCache, error) {
+	if newConfig.CacheDir == "" {
+		return nil, fmt.Errorf("a cache directory is required to keep the metadata cache on disk")
+	}
+
+	// -1 means unlimited, which the disk cache takes as zero.
+	var maxSizeBytes uint64
+	if newConfig.MetadataCache.DiskCacheMaxSizeMb > 0 {
+		maxSizeBytes = uint64(newConfig.MetadataCache.DiskCacheMaxSizeMb) * cacheutil.MiB
+	}
+
+	c, err := metadata.OpenDiskCache(path.Join(string(newConfig.CacheDir), cacheutil.MetadataCache), maxSizeBytes)
+	if err != nil {
+		return nil, fmt.Errorf("metadata.OpenDiskCache: %w", err)
+	}
+
+	return c, nil
+}
+
+// The interval at which a file of change notifications is checked for more.
+const changeNotificationFilePollInterval = time.Second
+
+// Return the configured sources of change notifications, other than polling.
+func changeSources(newConfig *cfg.Config) (sources []changefeed.Source) {
+	if addr := newConfig.MetadataCache.ChangeNotificationHttpAddress; addr != "" {
+		sources = append(sources, changefeed.NewHTTPSource(addr))
+	}
+
+	if f := string(newConfig.MetadataCache.ChangeNotificationFile); f != "" {
+		sources = append(sources, changefeed.NewFileSource(f, changeNotificationFilePollInterval))
+	}
+
+	return
+}
+
 func getFuseMountConfig(fsName string, newConfig *cfg.Config) *fuse.MountConfig {
 	// Handle the repeated "-o" flag.
 	parsedOptions := make(map[string]string)
@@ -0,0 +1,109 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+)
+
+const repairRenamesCmdName = "repair-renames"
+
+type repairRenamesFn func(c *cfg.Config, bucketName string, rollBack bool) error
+
+// newRepairRenamesCmd returns the command that resolves directory renames
+// left unfinished by a crash, which mounts only report. It shares the flags,
+// and so the config, of the root command.
+func newRepairRenamesCmd(r repairRenamesFn, configObj *cfg.Config, cfgErr *error) *cobra.Command {
+	var rollBack bool
+	cmd := &cobra.Command{
+		Use:   repairRenamesCmdName + " [flags] bucket",
+		Short: "Finish or undo directory renames interrupted by a crash",
+		Long: `Directory renames in buckets without hierarchical namespace move one object
+at a time, and are recorded in a journal so that they can be recovered if
+gcsfuse is interrupted part way through. A journal can't be told apart from a
+rename still in progress on another mount, so mounts only report them; once no
+mount is renaming in the bucket, this command recovers them, rolling the
+renames forward or, with --roll-back, undoing them. Exchanges of two names
+interrupted part way through are finished or undone as well, whichever puts
+everything back under one of the names.
+
+To mount a bucket named "repair-renames", put -- before its name.`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if *cfgErr != nil {
+				return fmt.Errorf("error while parsing config: %w", *cfgErr)
+			}
+			return r(configObj, args[0], rollBack)
+		},
+	}
+	cmd.Flags().BoolVar(&rollBack, "roll-back", false, "Undo the interrupted renames instead of finishing them.")
+	return cmd
+}
+
+// commandArgs returns the arguments to pass to the root command for the
+// supplied command line. The mount command treats the program name as its
+// first argument, but cobra only dispatches to a subcommand named first, so
+// the program name is dropped if cobra finds a subcommand in the rest. As
+// usual, -- ends the search, so that a bucket named like a subcommand can be
+// mounted with e.g. "gcsfuse -- commit /mnt".
+func commandArgs(rootCmd *cobra.Command, args []string) []string {
+	if len(args) < 2 {
+		return args
+	}
+
+	if c, _, err := rootCmd.Find(args[1:]); err == nil && c != rootCmd {
+		return args[1:]
+	}
+	return args
+}
+
+// repairRenames resolves every rename journal in the bucket, including those
+// written moments ago, so it must not be run while the bucket is mounted.
+func repairRenames(newConfig *cfg.Config, bucketName string, rollBack bool) (err error) {
+	ctx := context.Background()
+	userAgent := getUserAgent(newConfig.AppName, getConfigForUserAgent(newConfig))
+	storageHandle, err := createStorageHandle(newConfig, userAgent)
+	if err != nil {
+		return fmt.Errorf("failed to create storage handle using createStorageHandle: %w", err)
+	}
+
+	b, err := openBucket(ctx, storageHandle, newConfig, bucketName)
+	if err != nil {
+		return err
+	}
+
+	recovered, err := gcsx.RecoverRenames(ctx, b, tmpObjectPrefix, 0, rollBack, common.NewNoopMetrics())
+	if err != nil {
+		return fmt.Errorf("RecoverRenames: %w", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Recovered %d interrupted directory renames in bucket %q.\n", recovered, bucketName)
+
+	recovered, err = gcsx.RecoverExchanges(ctx, b, tmpObjectPrefix, 0)
+	if err != nil {
+		return fmt.Errorf("RecoverExchanges: %w", err)
+	}
+
+	fmt.Fprintf(os.Stdout, "Recovered %d interrupted exchanges in bucket %q.\n", recovered, bucketName)
+	return nil
+}
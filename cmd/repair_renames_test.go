@@ -0,0 +1,154 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name:     "Mount",
+			args:     []string{"gcsfuse", "abc", "pqr"},
+			expected: []string{"gcsfuse", "abc", "pqr"},
+		},
+		{
+			name:     "Repair renames",
+			args:     []string{"gcsfuse", "repair-renames", "abc"},
+			expected: []string{"repair-renames", "abc"},
+		},
+		{
+			name:     "Commit",
+			args:     []string{"gcsfuse", "commit", "abc"},
+			expected: []string{"commit", "abc"},
+		},
+		{
+			name:     "Commit after flags",
+			args:     []string{"gcsfuse", "--only-dir", "commit", "commit", "abc"},
+			expected: []string{"--only-dir", "commit", "commit", "abc"},
+		},
+		{
+			name:     "Mount bucket named like a command",
+			args:     []string{"gcsfuse", "--", "commit", "pqr"},
+			expected: []string{"gcsfuse", "--", "commit", "pqr"},
+		},
+		{
+			name:     "No args",
+			args:     []string{"gcsfuse"},
+			expected: []string{"gcsfuse"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rootCmd, err := newRootCmd(func(*cfg.Config, string, string) error { return nil })
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, commandArgs(rootCmd, tc.args))
+		})
+	}
+}
+
+func TestMountOfBucketNamedLikeACommand(t *testing.T) {
+	var bucketName string
+	rootCmd, err := newRootCmd(func(_ *cfg.Config, b string, _ string) error {
+		bucketName = b
+		return nil
+	})
+	require.NoError(t, err)
+	rootCmd.SetArgs(commandArgs(rootCmd, convertToPosixArgs([]string{"gcsfuse", "--", "repair-renames", "pqr"}, rootCmd)))
+
+	err = rootCmd.Execute()
+
+	require.NoError(t, err)
+	assert.Equal(t, "repair-renames", bucketName)
+}
+
+func TestRepairRenamesCmd(t *testing.T) {
+	tests := []struct {
+		name             string
+		args             []string
+		expectedRollBack bool
+	}{
+		{
+			name:             "Roll forward by default",
+			args:             []string{"abc"},
+			expectedRollBack: false,
+		},
+		{
+			name:             "Roll back",
+			args:             []string{"--roll-back", "abc"},
+			expectedRollBack: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var configObj cfg.Config
+			var cfgErr error
+			var bucketName string
+			var rollBack bool
+			cmd := newRepairRenamesCmd(func(_ *cfg.Config, b string, r bool) error {
+				bucketName = b
+				rollBack = r
+				return nil
+			}, &configObj, &cfgErr)
+			cmd.SetArgs(tc.args)
+
+			err := cmd.Execute()
+
+			require.NoError(t, err)
+			assert.Equal(t, "abc", bucketName)
+			assert.Equal(t, tc.expectedRollBack, rollBack)
+		})
+	}
+}
+
+func TestRepairRenamesCmd_RequiresBucket(t *testing.T) {
+	var configObj cfg.Config
+	var cfgErr error
+	cmd := newRepairRenamesCmd(func(*cfg.Config, string, bool) error { return nil }, &configObj, &cfgErr)
+	cmd.SetArgs([]string{})
+
+	err := cmd.Execute()
+
+	assert.Error(t, err)
+}
+
+func TestRepairRenamesCmd_ConfigError(t *testing.T) {
+	var configObj cfg.Config
+	cfgErr := errors.New("bad config")
+	called := false
+	cmd := newRepairRenamesCmd(func(*cfg.Config, string, bool) error {
+		called = true
+		return nil
+	}, &configObj, &cfgErr)
+	cmd.SetArgs([]string{"abc"})
+
+	err := cmd.Execute()
+
+	assert.ErrorIs(t, err, cfgErr)
+	assert.False(t, called)
+}
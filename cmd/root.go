@@ -86,6 +86,9 @@ of Cloud Storage FUSE, see https://cloud.google.com/storage/docs/gcs-fuse.`,
 		if cfgErr = cfg.ValidateConfig(v, &configObj); cfgErr != nil {
 			return
 		}
+		if cfgErr = validateOptionCombinations(&configObj); cfgErr != nil {
+			return
+		}
 		if cfgErr = cfg.Rationalize(v, &configObj); cfgErr != nil {
 			return
 		}
@@ -101,6 +104,8 @@ of Cloud Storage FUSE, see https://cloud.google.com/storage/docs/gcs-fuse.`,
 	if err := cfg.BindFlags(v, rootCmd.PersistentFlags()); err != nil {
 		return nil, fmt.Errorf("error while binding flags: %w", err)
 	}
+	rootCmd.AddCommand(newRepairRenamesCmd(repairRenames, &configObj, &cfgErr))
+	rootCmd.AddCommand(newCommitCmd(commit, &configObj, &cfgErr))
 	return rootCmd, nil
 }
 
@@ -151,7 +156,7 @@ var ExecuteMountCmd = func() {
 	if err != nil {
 		log.Fatalf("Error occurred while creating the root command: %v", err)
 	}
-	rootCmd.SetArgs(convertToPosixArgs(os.Args, rootCmd))
+	rootCmd.SetArgs(commandArgs(rootCmd, convertToPosixArgs(os.Args, rootCmd)))
 	if err := rootCmd.Execute(); err != nil {
 		log.Fatalf("Error occurred during command execution: %v", err)
 	}
@@ -657,7 +657,7 @@ func TestArgsParsing_FileSystemFlags(t *testing.T) {
 					KernelListCacheTtlSecs: 300,
 					RenameDirLimit:         10,
 					TempDir:                cfg.ResolvedPath(path.Join(hd, "temp")),
-					PreconditionErrors:     false,
+					PreconditionErrors:     "false",
 					Uid:                    8,
 				},
 			},
@@ -676,7 +676,7 @@ func TestArgsParsing_FileSystemFlags(t *testing.T) {
 					KernelListCacheTtlSecs: 0,
 					RenameDirLimit:         0,
 					TempDir:                "",
-					PreconditionErrors:     true,
+					PreconditionErrors:     "true",
 					Uid:                    -1,
 				},
 			},
@@ -695,7 +695,7 @@ func TestArgsParsing_FileSystemFlags(t *testing.T) {
 					KernelListCacheTtlSecs: 0,
 					RenameDirLimit:         0,
 					TempDir:                "",
-					PreconditionErrors:     true,
+					PreconditionErrors:     "true",
 					Uid:                    -1,
 				},
 			},
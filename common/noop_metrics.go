@@ -37,3 +37,10 @@ func (*noopMetrics) OpsErrorCount(_ context.Context, _ int64, _ []MetricAttr)
 func (*noopMetrics) FileCacheReadCount(_ context.Context, _ int64, _ []MetricAttr)         {}
 func (*noopMetrics) FileCacheReadBytesCount(_ context.Context, _ int64, _ []MetricAttr)    {}
 func (*noopMetrics) FileCacheReadLatency(_ context.Context, value float64, _ []MetricAttr) {}
+
+func (*noopMetrics) RenameObjectMoveCount(_ context.Context, _ int64, _ []MetricAttr)      {}
+func (*noopMetrics) RenameJournalRecoveryCount(_ context.Context, _ int64, _ []MetricAttr) {}
+
+func (*noopMetrics) ConflictCopyCount(_ context.Context, _ int64, _ []MetricAttr) {}
+
+func (*noopMetrics) CacheLookUpCount(_ context.Context, _ int64, _ []MetricAttr) {}
@@ -45,6 +45,15 @@ const (
 
 	// CacheHit annotates the read operation from file cache with true or false.
 	CacheHit = "cache_hit"
+
+	// RenamePhase annotates objects moved by a directory rename with whether the
+	// rename itself moved them or a recovery from its journal did.
+	RenamePhase = "rename_phase"
+
+	// CacheName annotates look-ups in the file info, stat and type caches with
+	// the cache looked in, and EvictionPolicy with its eviction policy.
+	CacheName      = "cache_name"
+	EvictionPolicy = "eviction_policy"
 )
 
 type ocMetrics struct {
@@ -65,6 +74,14 @@ type ocMetrics struct {
 	fileCacheReadCount      *stats.Int64Measure
 	fileCacheReadBytesCount *stats.Int64Measure
 	fileCacheReadLatency    *stats.Float64Measure
+
+	// Rename measures
+	renameObjectMoveCount      *stats.Int64Measure
+	renameJournalRecoveryCount *stats.Int64Measure
+
+	conflictCopyCount *stats.Int64Measure
+
+	cacheLookUpCount *stats.Int64Measure
 }
 
 func attrsToTags(attrs []MetricAttr) []tag.Mutator {
@@ -133,6 +150,21 @@ func (o *ocMetrics) FileCacheReadLatency(ctx context.Context, value float64, att
 	recordOCLatencyMetric(ctx, o.fileCacheReadLatency, value, attrs, "file cache read latency")
 }
 
+func (o *ocMetrics) RenameObjectMoveCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.renameObjectMoveCount, inc, attrs, "rename moved object count")
+}
+func (o *ocMetrics) RenameJournalRecoveryCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.renameJournalRecoveryCount, inc, attrs, "rename journal recovery count")
+}
+
+func (o *ocMetrics) ConflictCopyCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.conflictCopyCount, inc, attrs, "conflict copy count")
+}
+
+func (o *ocMetrics) CacheLookUpCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	recordOCMetric(ctx, o.cacheLookUpCount, inc, attrs, "cache look-up count")
+}
+
 func recordOCMetric(ctx context.Context, m *stats.Int64Measure, inc int64, attrs []MetricAttr, metricStr string) {
 	if err := stats.RecordWithTags(
 		ctx,
@@ -168,6 +200,13 @@ func NewOCMetrics() (MetricHandle, error) {
 	fileCacheReadCount := stats.Int64("file_cache/read_count", "Specifies the number of read requests made via file cache along with type - Sequential/Random and cache hit - true/false", stats.UnitDimensionless)
 	fileCacheReadBytesCount := stats.Int64("file_cache/read_bytes_count", "The cumulative number of bytes read from file cache along with read type - Sequential/Random", stats.UnitBytes)
 	fileCacheReadLatency := stats.Float64("file_cache/read_latency", "Latency of read from file cache along with cache hit - true/false", "us")
+
+	renameObjectMoveCount := stats.Int64("rename/moved_object_count", "The number of objects moved by directory renames in flat buckets along with phase - rename/roll_forward/roll_back", stats.UnitDimensionless)
+	renameJournalRecoveryCount := stats.Int64("rename/journal_recovery_count", "The number of unfinished directory renames recovered from their journal along with phase - roll_forward/roll_back", stats.UnitDimensionless)
+
+	conflictCopyCount := stats.Int64("fs/conflict_copy_count", "The number of files written to conflict copies because they were modified concurrently", stats.UnitDimensionless)
+
+	cacheLookUpCount := stats.Int64("cache/lookup_count", "The number of look-ups in the file info, stat and type caches along with cache name, eviction policy and cache hit - true/false", stats.UnitDimensionless)
 	// OpenCensus views (aggregated measures)
 	if err := view.Register(
 		&view.View{
@@ -253,6 +292,34 @@ func NewOCMetrics() (MetricHandle, error) {
 			Description: "The cumulative distribution of the file cache read latencies along with cache hit - true/false",
 			Aggregation: ochttp.DefaultLatencyDistribution,
 			TagKeys:     []tag.Key{tag.MustNewKey(CacheHit)},
+		},
+		// Rename related metrics
+		&view.View{
+			Name:        "rename/moved_object_count",
+			Measure:     renameObjectMoveCount,
+			Description: "The cumulative number of objects moved by directory renames in flat buckets along with phase - rename/roll_forward/roll_back",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tag.MustNewKey(RenamePhase)},
+		},
+		&view.View{
+			Name:        "rename/journal_recovery_count",
+			Measure:     renameJournalRecoveryCount,
+			Description: "The cumulative number of unfinished directory renames recovered from their journal along with phase - roll_forward/roll_back",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tag.MustNewKey(RenamePhase)},
+		},
+		&view.View{
+			Name:        "fs/conflict_copy_count",
+			Measure:     conflictCopyCount,
+			Description: "The cumulative number of files written to conflict copies because they were modified concurrently",
+			Aggregation: view.Sum(),
+		},
+		&view.View{
+			Name:        "cache/lookup_count",
+			Measure:     cacheLookUpCount,
+			Description: "The cumulative number of look-ups in the file info, stat and type caches along with cache name, eviction policy and cache hit - true/false",
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tag.MustNewKey(CacheName), tag.MustNewKey(EvictionPolicy), tag.MustNewKey(CacheHit)},
 		}); err != nil {
 		return nil, fmt.Errorf("failed to register OpenCensus metrics for GCS client library: %w", err)
 	}
@@ -271,5 +338,12 @@ func NewOCMetrics() (MetricHandle, error) {
 		fileCacheReadCount:      fileCacheReadCount,
 		fileCacheReadBytesCount: fileCacheReadBytesCount,
 		fileCacheReadLatency:    fileCacheReadLatency,
+
+		renameObjectMoveCount:      renameObjectMoveCount,
+		renameJournalRecoveryCount: renameJournalRecoveryCount,
+
+		conflictCopyCount: conflictCopyCount,
+
+		cacheLookUpCount: cacheLookUpCount,
 	}, nil
 }
@@ -27,6 +27,8 @@ var (
 	fsOpsMeter     = otel.Meter("fs_op")
 	gcsMeter       = otel.Meter("gcs")
 	fileCacheMeter = otel.Meter("file_cache")
+	renameMeter    = otel.Meter("rename")
+	cacheMeter     = otel.Meter("cache")
 )
 
 // otelMetrics maintains the list of all metrics computed in GCSFuse.
@@ -45,6 +47,13 @@ type otelMetrics struct {
 	fileCacheReadCount      metric.Int64Counter
 	fileCacheReadBytesCount metric.Int64Counter
 	fileCacheReadLatency    metric.Float64Histogram
+
+	renameObjectMoveCount      metric.Int64Counter
+	renameJournalRecoveryCount metric.Int64Counter
+
+	conflictCopyCount metric.Int64Counter
+
+	cacheLookUpCount metric.Int64Counter
 }
 
 func (o *otelMetrics) GCSReadBytesCount(_ context.Context, inc int64) {
@@ -95,6 +104,22 @@ func (o *otelMetrics) FileCacheReadLatency(ctx context.Context, value float64, a
 	o.fileCacheReadLatency.Record(ctx, value, attrsToRecordOption(attrs)...)
 }
 
+func (o *otelMetrics) RenameObjectMoveCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	o.renameObjectMoveCount.Add(ctx, inc, attrsToAddOption(attrs)...)
+}
+
+func (o *otelMetrics) RenameJournalRecoveryCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	o.renameJournalRecoveryCount.Add(ctx, inc, attrsToAddOption(attrs)...)
+}
+
+func (o *otelMetrics) ConflictCopyCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	o.conflictCopyCount.Add(ctx, inc, attrsToAddOption(attrs)...)
+}
+
+func (o *otelMetrics) CacheLookUpCount(ctx context.Context, inc int64, attrs []MetricAttr) {
+	o.cacheLookUpCount.Add(ctx, inc, attrsToAddOption(attrs)...)
+}
+
 func NewOTelMetrics() (MetricHandle, error) {
 	fsOpsCount, err1 := fsOpsMeter.Int64Counter("fs/ops_count", metric.WithDescription("The cumulative number of ops processed by the file system."))
 	fsOpsLatency, err2 := fsOpsMeter.Float64Histogram("fs/ops_latency", metric.WithDescription("The cumulative distribution of file system operation latencies"), metric.WithUnit("us"),
@@ -129,7 +154,18 @@ func NewOTelMetrics() (MetricHandle, error) {
 		metric.WithUnit("us"),
 		defaultLatencyDistribution)
 
-	if err := errors.Join(err1, err2, err3, err4, err5, err6, err7, err8, err9, err10, err11, err12); err != nil {
+	renameObjectMoveCount, err13 := renameMeter.Int64Counter("rename/moved_object_count",
+		metric.WithDescription("The cumulative number of objects moved by directory renames in flat buckets along with phase - rename/roll_forward/roll_back"))
+	renameJournalRecoveryCount, err14 := renameMeter.Int64Counter("rename/journal_recovery_count",
+		metric.WithDescription("The cumulative number of unfinished directory renames recovered from their journal along with phase - roll_forward/roll_back"))
+
+	conflictCopyCount, err15 := fsOpsMeter.Int64Counter("fs/conflict_copy_count",
+		metric.WithDescription("The cumulative number of files written to conflict copies because they were modified concurrently"))
+
+	cacheLookUpCount, err16 := cacheMeter.Int64Counter("cache/lookup_count",
+		metric.WithDescription("The cumulative number of look-ups in the file info, stat and type caches along with cache name, eviction policy and cache hit - true/false"))
+
+	if err := errors.Join(err1, err2, err3, err4, err5, err6, err7, err8, err9, err10, err11, err12, err13, err14, err15, err16); err != nil {
 		return nil, err
 	}
 
@@ -146,5 +182,12 @@ func NewOTelMetrics() (MetricHandle, error) {
 		fileCacheReadCount:      fileCacheReadCount,
 		fileCacheReadBytesCount: fileCacheReadBytesCount,
 		fileCacheReadLatency:    fileCacheReadLatency,
+
+		renameObjectMoveCount:      renameObjectMoveCount,
+		renameJournalRecoveryCount: renameJournalRecoveryCount,
+
+		conflictCopyCount: conflictCopyCount,
+
+		cacheLookUpCount: cacheLookUpCount,
 	}, nil
 }
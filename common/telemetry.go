@@ -18,6 +18,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 
 	"go.opentelemetry.io/otel/metric"
 )
@@ -71,13 +72,50 @@ type FileCacheMetricHandle interface {
 	FileCacheReadBytesCount(ctx context.Context, inc int64, attrs []MetricAttr)
 	FileCacheReadLatency(ctx context.Context, value float64, attrs []MetricAttr)
 }
+
+type RenameMetricHandle interface {
+	RenameObjectMoveCount(ctx context.Context, inc int64, attrs []MetricAttr)
+	RenameJournalRecoveryCount(ctx context.Context, inc int64, attrs []MetricAttr)
+}
+
+type ConflictMetricHandle interface {
+	ConflictCopyCount(ctx context.Context, inc int64, attrs []MetricAttr)
+}
+
+type CacheMetricHandle interface {
+	CacheLookUpCount(ctx context.Context, inc int64, attrs []MetricAttr)
+}
 type MetricHandle interface {
 	GCSMetricHandle
 	OpsMetricHandle
 	FileCacheMetricHandle
+	RenameMetricHandle
+	ConflictMetricHandle
+	CacheMetricHandle
 }
 
 func CaptureGCSReadMetrics(ctx context.Context, metricHandle MetricHandle, readType string, requestedDataSize int64) {
 	metricHandle.GCSReadCount(ctx, 1, []MetricAttr{{Key: ReadType, Value: readType}})
 	metricHandle.GCSDownloadBytesCount(ctx, requestedDataSize, []MetricAttr{{Key: ReadType, Value: readType}})
 }
+
+// CacheLookUpRecorder returns a function recording look-ups in the named cache,
+// which uses the named eviction policy, for lru.Cache.SetLookUpObserver.
+func CacheLookUpRecorder(metricHandle MetricHandle, cacheName string, evictionPolicy string) func(hit bool) {
+	attrs := func(hit bool) []MetricAttr {
+		return []MetricAttr{
+			{Key: CacheName, Value: cacheName},
+			{Key: EvictionPolicy, Value: evictionPolicy},
+			{Key: CacheHit, Value: strconv.FormatBool(hit)},
+		}
+	}
+	hitAttrs, missAttrs := attrs(true), attrs(false)
+
+	return func(hit bool) {
+		if hit {
+			metricHandle.CacheLookUpCount(context.Background(), 1, hitAttrs)
+		} else {
+			metricHandle.CacheLookUpCount(context.Background(), 1, missAttrs)
+		}
+	}
+}
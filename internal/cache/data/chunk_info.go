@@ -0,0 +1,36 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package data
+
+import "fmt"
+
+// ChunkInfo is the entry in the file info cache for a chunk of an object that
+// is cached chunk by chunk, rather than as a whole.
+type ChunkInfo struct {
+	Key              FileInfoKey
+	ObjectGeneration int64
+	Range            ObjectRange
+}
+
+// Size returns the length of the chunk.
+func (ci ChunkInfo) Size() uint64 {
+	return uint64(ci.Range.End - ci.Range.Start)
+}
+
+// GetChunkKeyName returns the key in the file info cache of the chunk starting
+// at the supplied offset of the object with the supplied key.
+func GetChunkKeyName(fileInfoKeyName string, start int64) string {
+	return fmt.Sprintf("%s#%d", fileInfoKeyName, start)
+}
@@ -1,6 +1,7 @@
 package data
 
-// ObjectRange specifies the range within the gcs object.
+// ObjectRange specifies the range within the gcs object, from Start up to but
+// not including End.
 type ObjectRange struct {
 	Start int64
 	End   int64
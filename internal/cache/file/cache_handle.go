@@ -26,6 +26,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	gcsfuseutil "github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 )
 
 type CacheHandle struct {
@@ -50,6 +51,11 @@ type CacheHandle struct {
 	// prevOffset stores the offset of previous cache handle read call. This is used
 	// to decide the type of read.
 	prevOffset int64
+
+	// chunks and sparseFile are set, instead of fileDownloadJob, when the object
+	// is cached chunk by chunk, in which case fileHandle is open on sparseFile.
+	chunks     *chunkCache
+	sparseFile *sparseFile
 }
 
 func NewCacheHandle(localFileHandle *os.File, fileDownloadJob *downloader.Job,
@@ -138,6 +144,8 @@ func (fch *CacheHandle) validateEntryInFileInfoCache(bucket gcs.Bucket, object *
 // if it is not already present. For random reads, it does not wait for
 // download. Additionally, for random reads, the download will not be
 // initiated if fch.cacheFileForRangeRead is false.
+// If the object is cached chunk by chunk, the chunks being read are downloaded
+// first if they are not already present, whatever the type of read.
 func (fch *CacheHandle) Read(ctx context.Context, bucket gcs.Bucket, object *gcs.MinObject, offset int64, dst []byte) (n int, cacheHit bool, err error) {
 	err = fch.validateCacheHandle()
 	if err != nil {
@@ -150,6 +158,16 @@ func (fch *CacheHandle) Read(ctx context.Context, bucket gcs.Bucket, object *gcs
 
 	// Checking before updating the previous offset.
 	isSequentialRead := fch.IsSequential(offset)
+	if fch.sparseFile != nil {
+		fch.isSequential = isSequentialRead
+		fch.prevOffset = offset
+		readType := gcsfuseutil.Random
+		if isSequentialRead {
+			readType = gcsfuseutil.Sequential
+		}
+		return fch.chunks.read(ctx, bucket, fch.sparseFile, fch.fileHandle, offset, dst, readType)
+	}
+
 	waitForDownload := true
 	if !isSequentialRead {
 		fch.isSequential = false
@@ -271,5 +289,10 @@ func (fch *CacheHandle) Close() (err error) {
 		fch.fileHandle = nil
 	}
 
+	if fch.sparseFile != nil {
+		fch.chunks.release(fch.sparseFile)
+		fch.sparseFile = nil
+	}
+
 	return
 }
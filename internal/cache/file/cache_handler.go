@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
@@ -51,6 +52,36 @@ type CacheHandler struct {
 
 	// mu guards the handling of insertion into and eviction from file cache.
 	mu locker.Locker
+
+	// persistIndex says whether the file info cache is written to the index in
+	// cacheDir periodically and on Destroy, so that RecoverCache can rebuild it
+	// at the next mount.
+	//
+	// GUARDED_BY(mu)
+	persistIndex bool
+
+	// Closed by Destroy to stop the periodic writing of the index.
+	stopIndexWriter chan struct{}
+
+	// verifyRecoveredCRC says whether the CRC32C checksums of recovered files
+	// are compared with those of their objects before the files are used.
+	//
+	// GUARDED_BY(mu)
+	verifyRecoveredCRC bool
+
+	// The keys of the entries recovered by RecoverCache that haven't been used
+	// since.
+	//
+	// GUARDED_BY(mu)
+	unverified map[string]struct{}
+
+	// shared coordinates with other processes using cacheDir, or is nil if the
+	// handler has cacheDir to itself. Constant after EnableSharing.
+	shared *sharedCache
+
+	// chunks caches objects chunk by chunk, or is nil if they are cached whole.
+	// Constant after EnableChunks.
+	chunks *chunkCache
 }
 
 func NewCacheHandler(fileInfoCache *lru.Cache, jobManager *downloader.JobManager, cacheDir string, filePerm os.FileMode, dirPerm os.FileMode) *CacheHandler {
@@ -86,6 +117,14 @@ func (chr *CacheHandler) cleanUpEvictedFile(fileInfo *data.FileInfo) error {
 
 	chr.jobManager.InvalidateAndRemoveJob(key.ObjectName, key.BucketName)
 
+	// Other processes may be reading a shared file, so it mustn't be truncated.
+	if chr.shared != nil {
+		if err = chr.shared.remove(key.ObjectName, key.BucketName, fileInfo.ObjectGeneration); err != nil {
+			return fmt.Errorf("cleanUpEvictedFile: error while removing shared file: %w", err)
+		}
+		return nil
+	}
+
 	localFilePath := util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(key.BucketName, key.ObjectName))
 	err = util.TruncateAndRemoveFile(localFilePath)
 	if err != nil {
@@ -124,10 +163,12 @@ func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObj
 		addEntryToCache = true
 	} else {
 		// Throw an error, if there is an entry in the file-info cache and cache file doesn't
-		// exist locally.
+		// exist locally, unless the cache is shared and so another process may
+		// have deleted it.
 		filePath := util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(bucket.Name(), object.Name))
 		_, err := os.Stat(filePath)
-		if err != nil && os.IsNotExist(err) {
+		fileMissing := err != nil && os.IsNotExist(err)
+		if fileMissing && chr.shared == nil {
 			return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: %s: %s", util.FileNotPresentInCacheErrMsg, filePath)
 		}
 
@@ -140,11 +181,22 @@ func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObj
 		// If offset in file info cache is less than object size and there is no
 		// reference to download job then it means the job has failed.
 		existingJob := chr.jobManager.GetJob(object.Name, bucket.Name())
-		shouldInvalidate := (existingJob == nil) && (fileInfoData.Offset < object.Size)
+		shouldInvalidate := fileMissing || ((existingJob == nil) && (fileInfoData.Offset < object.Size))
 		if (!shouldInvalidate) && (existingJob != nil) {
 			existingJobStatus := existingJob.GetStatus().Name
 			shouldInvalidate = (existingJobStatus == downloader.Failed) || (existingJobStatus == downloader.Invalid)
 		}
+		if !shouldInvalidate && (fileInfoData.ObjectGeneration == object.Generation || fileInfoData.ObjectGeneration == unknownGeneration) {
+			shouldInvalidate = !chr.verifyRecoveredFile(fileInfoKeyName, filePath, fileInfoData, object)
+			// A file recovered without its generation holds the object's
+			// contents, so adopt it for the object's generation.
+			if !shouldInvalidate && fileInfoData.ObjectGeneration == unknownGeneration {
+				fileInfoData.ObjectGeneration = object.Generation
+				if err = chr.fileInfoCache.UpdateWithoutChangingOrder(fileInfoKeyName, fileInfoData); err != nil {
+					return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while adopting recovered file: %w", err)
+				}
+			}
+		}
 		if (fileInfoData.ObjectGeneration != object.Generation) || shouldInvalidate {
 			erasedVal := chr.fileInfoCache.Erase(fileInfoKeyName)
 			if erasedVal != nil {
@@ -159,26 +211,82 @@ func (chr *CacheHandler) addFileInfoEntryAndCreateDownloadJob(object *gcs.MinObj
 	}
 
 	if addEntryToCache {
+		delete(chr.unverified, fileInfoKeyName)
+
+		// With a shared cache, use the file another process has downloaded if
+		// there is one, and otherwise download the object unless another
+		// process already is.
+		var offset uint64
+		downloading := chr.shared == nil
+		if chr.shared != nil {
+			if chr.shared.isComplete(object, bucket.Name()) {
+				offset = object.Size
+			} else {
+				downloading, err = chr.shared.startDownload(object, bucket.Name())
+				if err != nil {
+					return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while starting shared download: %w", err)
+				}
+				if !downloading {
+					return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: %s", util.SharedCacheBusyErrMsg)
+				}
+			}
+		}
+
 		fileInfo = data.FileInfo{
 			Key:              fileInfoKey,
 			ObjectGeneration: object.Generation,
-			Offset:           0,
+			Offset:           offset,
 			FileSize:         object.Size,
 		}
 
 		evictedValues, err := chr.fileInfoCache.Insert(fileInfoKeyName, fileInfo)
 		if err != nil {
+			if chr.shared != nil && downloading {
+				chr.shared.downloadDone(object, bucket.Name(), downloader.JobStatus{Name: downloader.Invalid})
+			}
 			return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while inserting into the cache: %w", err)
 		}
-		// Create download job for new entry added to cache.
-		_ = chr.jobManager.CreateJobIfNotExists(object, bucket)
+
+		// The eviction policy may not admit the entry at all, or may evict it
+		// along with the entries it displaced, in which case the object is read
+		// from GCS instead.
+		var rejected bool
+		for _, val := range evictedValues {
+			if val.(data.FileInfo).Key == fileInfoKey {
+				rejected = true
+			}
+		}
+		if rejected {
+			if chr.shared != nil && downloading {
+				chr.shared.downloadDone(object, bucket.Name(), downloader.JobStatus{Name: downloader.Invalid})
+			}
+		} else if downloading {
+			// Create download job for new entry added to cache.
+			_ = chr.jobManager.CreateJobIfNotExists(object, bucket)
+		}
+
 		for _, val := range evictedValues {
 			fileInfo := val.(data.FileInfo)
+			// A rejected entry was never downloaded.
+			if fileInfo.Key == fileInfoKey {
+				continue
+			}
+			// The processes sharing a cache directory evict files from it
+			// together, so an entry evicted from this process's cache is only
+			// forgotten.
+			if chr.shared != nil {
+				chr.jobManager.InvalidateAndRemoveJob(fileInfo.Key.ObjectName, fileInfo.Key.BucketName)
+				continue
+			}
 			err := chr.cleanUpEvictedFile(&fileInfo)
 			if err != nil {
 				return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: while performing post eviction of %s object error: %w", fileInfo.Key.ObjectName, err)
 			}
 		}
+
+		if rejected {
+			return fmt.Errorf("addFileInfoEntryAndCreateDownloadJob: %s", util.CacheAdmissionRejectedErrMsg)
+		}
 	} else {
 		// Move this entry on top of LRU.
 		_ = chr.fileInfoCache.LookUp(fileInfoKeyName)
@@ -202,6 +310,11 @@ func (chr *CacheHandler) GetCacheHandle(object *gcs.MinObject, bucket gcs.Bucket
 	chr.mu.Lock()
 	defer chr.mu.Unlock()
 
+	// Random reads are cached a chunk at a time, so they always get a handle.
+	if chr.chunks != nil {
+		return chr.getChunkCacheHandle(object, bucket, initialOffset)
+	}
+
 	// If cacheForRangeRead is set to False, initialOffset is non-zero (i.e. random read)
 	// and entry for file doesn't already exist in fileInfoCache then no need to
 	// create file in cache.
@@ -231,7 +344,46 @@ func (chr *CacheHandler) GetCacheHandle(object *gcs.MinObject, bucket gcs.Bucket
 		return nil, fmt.Errorf("GetCacheHandle: while creating local-file read handle: %w", err)
 	}
 
-	return NewCacheHandle(localFileReadHandle, chr.jobManager.GetJob(object.Name, bucket.Name()), chr.fileInfoCache, cacheForRangeRead, initialOffset), nil
+	job := chr.jobManager.GetJob(object.Name, bucket.Name())
+
+	// Unless this process is downloading it, a shared file may have been
+	// replaced by another process since it was last checked.
+	if chr.shared != nil && job == nil {
+		if err = chr.shared.validate(localFileReadHandle, object, bucket.Name()); err != nil {
+			localFileReadHandle.Close()
+			// Drop the entry, leaving the file to its new owner, so that the next
+			// read finds the file afresh.
+			fileInfoKey := data.FileInfoKey{BucketName: bucket.Name(), ObjectName: object.Name}
+			if fileInfoKeyName, keyErr := fileInfoKey.Key(); keyErr == nil {
+				chr.fileInfoCache.Erase(fileInfoKeyName)
+			}
+			return nil, fmt.Errorf("GetCacheHandle: %s: %w", util.SharedCacheBusyErrMsg, err)
+		}
+		chr.shared.touch(object, bucket.Name())
+	}
+
+	return NewCacheHandle(localFileReadHandle, job, chr.fileInfoCache, cacheForRangeRead, initialOffset), nil
+}
+
+// Return a CacheHandle on the sparse file of the supplied object.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) getChunkCacheHandle(object *gcs.MinObject, bucket gcs.Bucket, initialOffset int64) (*CacheHandle, error) {
+	sparseFile, err := chr.chunks.open(object, bucket.Name())
+	if err != nil {
+		return nil, fmt.Errorf("GetCacheHandle: while opening the sparse file: %w", err)
+	}
+
+	localFileReadHandle, err := chr.createLocalFileReadHandle(object.Name, bucket.Name())
+	if err != nil {
+		chr.chunks.release(sparseFile)
+		return nil, fmt.Errorf("GetCacheHandle: while creating local-file read handle: %w", err)
+	}
+
+	cacheHandle := NewCacheHandle(localFileReadHandle, nil, chr.fileInfoCache, true, initialOffset)
+	cacheHandle.chunks = chr.chunks
+	cacheHandle.sparseFile = sparseFile
+	return cacheHandle, nil
 }
 
 // InvalidateCache removes the file entry from the fileInfoCache and performs clean
@@ -251,6 +403,11 @@ func (chr *CacheHandler) InvalidateCache(objectName string, bucketName string) e
 	chr.mu.Lock()
 	defer chr.mu.Unlock()
 
+	if chr.chunks != nil {
+		chr.chunks.remove(fileInfoKeyName)
+		return nil
+	}
+
 	erasedVal := chr.fileInfoCache.Erase(fileInfoKeyName)
 	if erasedVal != nil {
 		fileInfo := erasedVal.(data.FileInfo)
@@ -262,9 +419,29 @@ func (chr *CacheHandler) InvalidateCache(objectName string, bucketName string) e
 	return nil
 }
 
+// EnableSharing lets other gcsfuse processes on the host use the cache
+// directory at the same time as this handler; see sharedCache. The files in
+// the directory are kept within the supplied size in total. It must be called
+// before the handler is used, and is incompatible with RecoverCache, which
+// would delete the files of the other processes.
+func (chr *CacheHandler) EnableSharing(maxSize uint64) {
+	chr.shared = newSharedCache(chr.cacheDir, chr.filePerm, chr.dirPerm, maxSize)
+	chr.jobManager.SetJobDoneCallback(chr.shared.downloadDone)
+}
+
+// EnableChunks makes the handler cache objects in chunks of the supplied size,
+// rather than whole; see chunkCache. It must be called before the handler is
+// used, and is incompatible with EnableSharing and RecoverCache.
+func (chr *CacheHandler) EnableChunks(chunkSize int64, metricHandle common.MetricHandle) {
+	chr.chunks = newChunkCache(chunkSize, chr.cacheDir, chr.filePerm, chr.dirPerm, chr.fileInfoCache, metricHandle)
+}
+
 // Destroy destroys the job manager (i.e. invalidate all the jobs).
 // Note: This method is expected to be called at the time of unmounting and
-// because file info cache is in-memory, it is not required to destroy it.
+// because file info cache is in-memory, it is not required to destroy it. If
+// RecoverCache was called, the file info cache is written to the index for the
+// next mount to recover, and is no longer written periodically. With
+// EnableChunks, the sparse files are deleted.
 //
 // Acquires and releases Lock(chr.mu)
 func (chr *CacheHandler) Destroy() (err error) {
@@ -272,5 +449,13 @@ func (chr *CacheHandler) Destroy() (err error) {
 	defer chr.mu.Unlock()
 
 	chr.jobManager.Destroy()
+	if chr.chunks != nil {
+		chr.chunks.destroy()
+	}
+	if chr.persistIndex {
+		close(chr.stopIndexWriter)
+		chr.persistIndex = false
+		err = chr.writeIndex()
+	}
 	return
 }
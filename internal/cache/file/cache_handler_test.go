@@ -1047,3 +1047,71 @@ func Test_Destroy(t *testing.T) {
 		})
 	}
 }
+
+func Test_GetCacheHandle_NotAdmittedByEvictionPolicy(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "cache/dir"))
+	policy, err := lru.NewPolicy(lru.TinyLFUPolicy, HandlerCacheMaxSize)
+	require.NoError(t, err)
+	cache := lru.NewCacheWithPolicy(HandlerCacheMaxSize, policy)
+	cacheDir := t.TempDir()
+	jobManager := downloader.NewJobManager(cache, util.DefaultFilePerm, util.DefaultDirPerm, cacheDir,
+		DefaultSequentialReadSizeMb, &cfg.FileCacheConfig{}, common.NewNoopMetrics())
+	cacheHandler := NewCacheHandler(cache, jobManager, cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	defer cacheHandler.Destroy()
+	// Use the first object several times, so that it is worth keeping.
+	for i := 0; i < 3; i++ {
+		cacheHandle, err := cacheHandler.GetCacheHandle(chTestArgs.object, chTestArgs.bucket, false, 0)
+		require.NoError(t, err)
+		require.NoError(t, cacheHandle.Close())
+	}
+	other := createObject(t, chTestArgs.bucket, "other", make([]byte, TestObjectSize))
+
+	_, err = cacheHandler.GetCacheHandle(other, chTestArgs.bucket, false, 0)
+
+	require.Error(t, err)
+	assert.ErrorContains(t, err, util.CacheAdmissionRejectedErrMsg)
+	values := cache.Values()
+	require.Len(t, values, 1)
+	assert.Equal(t, chTestArgs.object.Name, values[0].(data.FileInfo).Key.ObjectName)
+	assert.Nil(t, jobManager.GetJob(other.Name, chTestArgs.bucket.Name()))
+}
+
+func Test_GetCacheHandle_EvictedAlongWithDisplacedEntries(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "cache/dir"))
+	const cacheMaxSize = 100
+	policy, err := lru.NewPolicy(lru.SLRUPolicy, cacheMaxSize)
+	require.NoError(t, err)
+	cache := lru.NewCacheWithPolicy(cacheMaxSize, policy)
+	cacheDir := t.TempDir()
+	jobManager := downloader.NewJobManager(cache, util.DefaultFilePerm, util.DefaultDirPerm, cacheDir,
+		DefaultSequentialReadSizeMb, &cfg.FileCacheConfig{}, common.NewNoopMetrics())
+	cacheHandler := NewCacheHandler(cache, jobManager, cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	defer cacheHandler.Destroy()
+	// Use the first object twice, moving it to the protected segment, then use
+	// a second one once, leaving it on probation.
+	protected := createObject(t, chTestArgs.bucket, "protected", make([]byte, 60))
+	for i := 0; i < 2; i++ {
+		cacheHandle, err := cacheHandler.GetCacheHandle(protected, chTestArgs.bucket, false, 0)
+		require.NoError(t, err)
+		require.NoError(t, cacheHandle.Close())
+	}
+	probation := createObject(t, chTestArgs.bucket, "probation", make([]byte, 10))
+	cacheHandle, err := cacheHandler.GetCacheHandle(probation, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	require.NoError(t, cacheHandle.Close())
+	probationPath := util.GetDownloadPath(cacheDir, util.GetObjectPath(chTestArgs.bucket.Name(), probation.Name))
+	require.True(t, doesFileExist(t, probationPath))
+	// Evicting the second object doesn't make room for a third one, larger than
+	// a fifth of the cache, so it is evicted in turn.
+	large := createObject(t, chTestArgs.bucket, "large", make([]byte, 45))
+
+	_, err = cacheHandler.GetCacheHandle(large, chTestArgs.bucket, false, 0)
+
+	require.Error(t, err)
+	assert.ErrorContains(t, err, util.CacheAdmissionRejectedErrMsg)
+	values := cache.Values()
+	require.Len(t, values, 1)
+	assert.Equal(t, protected.Name, values[0].(data.FileInfo).Key.ObjectName)
+	assert.Nil(t, jobManager.GetJob(large.Name, chTestArgs.bucket.Name()))
+	assert.False(t, doesFileExist(t, probationPath))
+}
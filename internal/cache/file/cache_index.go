@@ -0,0 +1,332 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// IndexFileName is the name of the file in the cache directory to which the
+// file info cache is written periodically and at unmount. Bucket names can't
+// start with a dot, so it can't clash with the directory of a bucket.
+const IndexFileName = ".gcsfuse-file-cache-index.json"
+
+// The index is written this often while the file system is mounted, so that
+// little is lost if the mount doesn't end cleanly.
+const indexWriteInterval = time.Minute
+
+// The generation of the entries for files found in the cache directory without
+// a usable entry in the index. GCS never uses it.
+const unknownGeneration int64 = 0
+
+// An entry in the index. For a complete file, it also identifies the local
+// file as it was when the index was written, so that a file downloaded again
+// since then isn't mistaken for the one the entry describes.
+type indexEntry struct {
+	data.FileInfo
+	Inode   uint64
+	ModTime time.Time
+}
+
+// RecoverCache rebuilds the file info cache from the index written during the
+// previous mount, and arranges for the index to be written periodically and by
+// Destroy during this one.
+//
+// The files that the index records as fully downloaded and that are still
+// present unchanged are recovered, in their previous LRU order. The other
+// regular files laid out in the cache directory, such as those downloaded
+// since the index was last written, are recovered too, as less recently used
+// and with an unknown generation; they are kept at their first use only if
+// their size and CRC32C checksum match those of the object. So a crash, or a
+// missing or corrupt index, costs at most the order of the entries.
+//
+// As with any other entry, a recovered file is dropped when it is next used if
+// its generation isn't that of the object, and if verifyCRC is set its CRC32C
+// checksum must match the object's too.
+//
+// It must be called before the handler is used.
+//
+// Acquires and releases LOCK(CacheHandler.mu)
+func (chr *CacheHandler) RecoverCache(verifyCRC bool) error {
+	chr.mu.Lock()
+	defer chr.mu.Unlock()
+
+	chr.persistIndex = true
+	chr.verifyRecoveredCRC = verifyCRC
+	chr.unverified = make(map[string]struct{})
+
+	indexPath := path.Join(chr.cacheDir, IndexFileName)
+	entries, err := readIndex(indexPath)
+	if err != nil {
+		logger.Warnf("RecoverCache: discarding the file cache index: %v", err)
+		entries = nil
+	}
+
+	// The regular files laid out in the cache directory, by path, with the
+	// file info cache entries they would have if they had none in the index.
+	found := make(map[string]data.FileInfo)
+	err = filepath.WalkDir(chr.cacheDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(chr.cacheDir, p)
+		if err != nil {
+			return err
+		}
+		bucketName, objectName, ok := strings.Cut(rel, string(filepath.Separator))
+		if d.IsDir() {
+			// Leave out anything that can't be the directory of a bucket.
+			if rel != "." && !ok && strings.HasPrefix(rel, ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil || !fi.Mode().IsRegular() || !ok || bucketName == "" || strings.HasPrefix(bucketName, ".") {
+			return nil
+		}
+		found[p] = data.FileInfo{
+			Key:              data.FileInfoKey{BucketName: bucketName, ObjectName: filepath.ToSlash(objectName)},
+			ObjectGeneration: unknownGeneration,
+			Offset:           uint64(fi.Size()),
+			FileSize:         uint64(fi.Size()),
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("RecoverCache: while listing the cache directory: %w", err)
+	}
+
+	// Keep the index entries whose files are complete and unchanged.
+	var recovered []data.FileInfo
+	for _, entry := range entries {
+		localFilePath := util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(entry.Key.BucketName, entry.Key.ObjectName))
+		if _, ok := found[localFilePath]; !ok || !entry.describesFile(localFilePath) {
+			continue
+		}
+
+		recovered = append(recovered, entry.FileInfo)
+		delete(found, localFilePath)
+	}
+
+	// Insert the least recently used entries first, so that the order is
+	// restored, starting with the files that had no entry.
+	var insert []data.FileInfo
+	for _, fileInfo := range found {
+		insert = append(insert, fileInfo)
+	}
+	for i := len(recovered) - 1; i >= 0; i-- {
+		insert = append(insert, recovered[i])
+	}
+
+	// The local files of the recovered entries, which are to be kept.
+	keep := make(map[string]string)
+	for _, fileInfo := range insert {
+		fileInfoKeyName, err := fileInfo.Key.Key()
+		if err != nil {
+			continue
+		}
+
+		localFilePath := util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(fileInfo.Key.BucketName, fileInfo.Key.ObjectName))
+		evictedValues, err := chr.fileInfoCache.Insert(fileInfoKeyName, fileInfo)
+		if err != nil {
+			logger.Warnf("RecoverCache: not recovering %s: %v", localFilePath, err)
+			continue
+		}
+
+		keep[localFilePath] = fileInfoKeyName
+		chr.unverified[fileInfoKeyName] = struct{}{}
+		for _, val := range evictedValues {
+			evicted := val.(data.FileInfo)
+			evictedPath := util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(evicted.Key.BucketName, evicted.Key.ObjectName))
+			delete(chr.unverified, keep[evictedPath])
+			delete(keep, evictedPath)
+		}
+	}
+
+	for _, localFilePath := range slices.Sorted(maps.Keys(found)) {
+		if _, ok := keep[localFilePath]; ok {
+			continue
+		}
+		if err := util.TruncateAndRemoveFile(localFilePath); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("RecoverCache: while removing file that doesn't fit: %v", err)
+		}
+	}
+	for _, fileInfo := range recovered {
+		localFilePath := util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(fileInfo.Key.BucketName, fileInfo.Key.ObjectName))
+		if _, ok := keep[localFilePath]; ok {
+			continue
+		}
+		if err := util.TruncateAndRemoveFile(localFilePath); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("RecoverCache: while removing file that doesn't fit: %v", err)
+		}
+	}
+
+	chr.stopIndexWriter = make(chan struct{})
+	go chr.writeIndexPeriodically(chr.stopIndexWriter)
+
+	logger.Infof("Recovered %d files into the file cache at %s", len(keep), chr.cacheDir)
+	return nil
+}
+
+// Does the supplied entry describe a complete file that is at the supplied path
+// as it was when the entry was written?
+func (e *indexEntry) describesFile(localFilePath string) bool {
+	if e.Offset != e.FileSize || e.ObjectGeneration == unknownGeneration {
+		return false
+	}
+
+	fi, err := os.Stat(localFilePath)
+	return err == nil &&
+		uint64(fi.Size()) == e.FileSize &&
+		inodeOf(fi) == e.Inode &&
+		fi.ModTime().Equal(e.ModTime)
+}
+
+// Write the index every indexWriteInterval until the supplied channel is
+// closed.
+func (chr *CacheHandler) writeIndexPeriodically(stop chan struct{}) {
+	ticker := time.NewTicker(indexWriteInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		chr.mu.Lock()
+		var err error
+		if chr.persistIndex {
+			err = chr.writeIndex()
+		}
+		chr.mu.Unlock()
+		if err != nil {
+			logger.Warnf("Writing the file cache index: %v", err)
+		}
+	}
+}
+
+// verifyRecoveredFile returns false if the supplied entry was recovered by
+// RecoverCache and its local file is found not to hold the object's contents.
+// Either way, the entry is considered verified from now on. An entry of
+// unknown generation is verified whether or not CRC32C checksums are to be
+// compared, and can't be verified if the object has no checksum.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) verifyRecoveredFile(fileInfoKeyName string, localFilePath string, fileInfo data.FileInfo, object *gcs.MinObject) bool {
+	if _, ok := chr.unverified[fileInfoKeyName]; !ok {
+		return fileInfo.ObjectGeneration != unknownGeneration
+	}
+	delete(chr.unverified, fileInfoKeyName)
+
+	if fileInfo.ObjectGeneration == unknownGeneration {
+		if fileInfo.FileSize != object.Size || object.CRC32C == nil {
+			return false
+		}
+	} else if !chr.verifyRecoveredCRC || object.CRC32C == nil {
+		return true
+	}
+
+	crc32Val, err := util.CalculateFileCRC32(context.Background(), localFilePath)
+	if err != nil {
+		logger.Warnf("verifyRecoveredFile: while calculating CRC32C of %s: %v", localFilePath, err)
+		return false
+	}
+
+	if crc32Val != *object.CRC32C {
+		logger.Warnf("verifyRecoveredFile: checksum mismatch for %s. Actual: %d, expected: %d", localFilePath, crc32Val, *object.CRC32C)
+		return false
+	}
+
+	return true
+}
+
+// writeIndex writes the entries of the file info cache, the most recently used
+// first, to the index in the cache directory.
+//
+// Requires Lock(chr.mu)
+func (chr *CacheHandler) writeIndex() error {
+	values := chr.fileInfoCache.Values()
+	entries := make([]indexEntry, 0, len(values))
+	for _, val := range values {
+		entry := indexEntry{FileInfo: val.(data.FileInfo)}
+		// Complete files are no longer written to, and are replaced only under
+		// chr.mu.
+		if entry.Offset == entry.FileSize && entry.ObjectGeneration != unknownGeneration {
+			localFilePath := util.GetDownloadPath(chr.cacheDir, util.GetObjectPath(entry.Key.BucketName, entry.Key.ObjectName))
+			if fi, err := os.Stat(localFilePath); err == nil {
+				entry.Inode = inodeOf(fi)
+				entry.ModTime = fi.ModTime()
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	contents, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("writeIndex: while marshalling: %w", err)
+	}
+
+	// Write a temporary file and rename it, so that an index is never left
+	// half-written.
+	indexPath := path.Join(chr.cacheDir, IndexFileName)
+	tmpPath := indexPath + ".tmp"
+	if err = os.WriteFile(tmpPath, contents, chr.filePerm); err != nil {
+		return fmt.Errorf("writeIndex: %w", err)
+	}
+
+	if err = os.Rename(tmpPath, indexPath); err != nil {
+		return fmt.Errorf("writeIndex: %w", err)
+	}
+
+	return nil
+}
+
+// Read the entries of the index at the supplied path, returning no entries if
+// there is no index.
+func readIndex(indexPath string) (entries []indexEntry, err error) {
+	contents, err := os.ReadFile(indexPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(contents, &entries); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", indexPath, err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,266 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRecoveredCacheHandler(t *testing.T, cacheDir string, maxSize uint64, verifyCRC bool) (*CacheHandler, *lru.Cache) {
+	t.Helper()
+	cache := lru.NewCache(maxSize)
+	jobManager := downloader.NewJobManager(cache, util.DefaultFilePerm, util.DefaultDirPerm, cacheDir,
+		DefaultSequentialReadSizeMb, &cfg.FileCacheConfig{EnableCrc: verifyCRC}, common.NewNoopMetrics())
+	cacheHandler := NewCacheHandler(cache, jobManager, cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	require.NoError(t, cacheHandler.RecoverCache(verifyCRC))
+	return cacheHandler, cache
+}
+
+// Write a file to the cache and add its entry to the file info cache.
+func addCachedFile(t *testing.T, cacheDir string, cache *lru.Cache, bucketName string, objectName string, contents []byte, offset uint64) string {
+	t.Helper()
+	localFilePath := util.GetDownloadPath(cacheDir, util.GetObjectPath(bucketName, objectName))
+	require.NoError(t, os.MkdirAll(path.Dir(localFilePath), util.DefaultDirPerm))
+	require.NoError(t, os.WriteFile(localFilePath, contents, util.DefaultFilePerm))
+
+	fileInfoKey := data.FileInfoKey{BucketName: bucketName, ObjectName: objectName}
+	fileInfoKeyName, err := fileInfoKey.Key()
+	require.NoError(t, err)
+	_, err = cache.Insert(fileInfoKeyName, data.FileInfo{
+		Key:              fileInfoKey,
+		ObjectGeneration: 1,
+		Offset:           offset,
+		FileSize:         uint64(len(contents)),
+	})
+	require.NoError(t, err)
+	return fileInfoKeyName
+}
+
+func Test_RecoverCache_RestoresCompleteFiles(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cacheHandler, cache := newRecoveredCacheHandler(t, cacheDir, 100, false)
+	oldest := addCachedFile(t, cacheDir, cache, "bucket", "a", []byte("taco"), 4)
+	newest := addCachedFile(t, cacheDir, cache, "bucket", "dir/b", []byte("burrito"), 7)
+	addCachedFile(t, cacheDir, cache, "bucket", "partial", []byte("enchilada"), 3)
+	truncated := addCachedFile(t, cacheDir, cache, "bucket", "truncated", []byte("queso"), 5)
+	require.NoError(t, os.Truncate(util.GetDownloadPath(cacheDir, "bucket/truncated"), 2))
+	cache.LookUp(newest)
+	require.NoError(t, cacheHandler.Destroy())
+	orphan := util.GetDownloadPath(cacheDir, "bucket/orphan")
+	require.NoError(t, os.WriteFile(orphan, []byte("salsa"), util.DefaultFilePerm))
+
+	_, cache = newRecoveredCacheHandler(t, cacheDir, 100, false)
+
+	values := cache.Values()
+	require.Len(t, values, 5)
+	assert.Equal(t, "dir/b", values[0].(data.FileInfo).Key.ObjectName)
+	assert.Equal(t, "a", values[1].(data.FileInfo).Key.ObjectName)
+	assert.Equal(t, int64(1), cache.LookUpWithoutChangingOrder(oldest).(data.FileInfo).ObjectGeneration)
+	// The other files are kept, to be verified against their objects.
+	for _, fileInfo := range values[2:] {
+		assert.Equal(t, unknownGeneration, fileInfo.(data.FileInfo).ObjectGeneration)
+	}
+	assert.Equal(t, uint64(2), cache.LookUpWithoutChangingOrder(truncated).(data.FileInfo).FileSize)
+	assert.FileExists(t, util.GetDownloadPath(cacheDir, "bucket/partial"))
+	assert.FileExists(t, util.GetDownloadPath(cacheDir, "bucket/truncated"))
+	assert.FileExists(t, orphan)
+	assert.FileExists(t, path.Join(cacheDir, IndexFileName))
+}
+
+func Test_RecoverCache_AfterCrash(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cacheHandler, cache := newRecoveredCacheHandler(t, cacheDir, 100, false)
+	indexed := addCachedFile(t, cacheDir, cache, "bucket", "a", []byte("taco"), 4)
+	cacheHandler.mu.Lock()
+	require.NoError(t, cacheHandler.writeIndex())
+	cacheHandler.mu.Unlock()
+	notIndexed := addCachedFile(t, cacheDir, cache, "bucket", "b", []byte("burrito"), 7)
+
+	_, cache = newRecoveredCacheHandler(t, cacheDir, 100, false)
+
+	values := cache.Values()
+	require.Len(t, values, 2)
+	assert.Equal(t, int64(1), cache.LookUpWithoutChangingOrder(indexed).(data.FileInfo).ObjectGeneration)
+	assert.Equal(t, unknownGeneration, cache.LookUpWithoutChangingOrder(notIndexed).(data.FileInfo).ObjectGeneration)
+	assert.Equal(t, "a", values[0].(data.FileInfo).Key.ObjectName)
+}
+
+func Test_RecoverCache_DistrustsReplacedFile(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cacheHandler, cache := newRecoveredCacheHandler(t, cacheDir, 100, false)
+	fileInfoKeyName := addCachedFile(t, cacheDir, cache, "bucket", "a", []byte("taco"), 4)
+	require.NoError(t, cacheHandler.Destroy())
+	localFilePath := util.GetDownloadPath(cacheDir, "bucket/a")
+	require.NoError(t, os.Remove(localFilePath))
+	require.NoError(t, os.WriteFile(localFilePath, []byte("tako"), util.DefaultFilePerm))
+	require.NoError(t, os.Chtimes(localFilePath, time.Unix(0, 0), time.Unix(0, 0)))
+
+	_, cache = newRecoveredCacheHandler(t, cacheDir, 100, false)
+
+	assert.Equal(t, unknownGeneration, cache.LookUpWithoutChangingOrder(fileInfoKeyName).(data.FileInfo).ObjectGeneration)
+}
+
+func Test_RecoverCache_EvictsBeyondCapacity(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cacheHandler, cache := newRecoveredCacheHandler(t, cacheDir, 100, false)
+	addCachedFile(t, cacheDir, cache, "bucket", "a", []byte("taco"), 4)
+	addCachedFile(t, cacheDir, cache, "bucket", "b", []byte("burrito"), 7)
+	require.NoError(t, cacheHandler.Destroy())
+
+	_, cache = newRecoveredCacheHandler(t, cacheDir, 8, false)
+
+	values := cache.Values()
+	require.Len(t, values, 1)
+	assert.Equal(t, "b", values[0].(data.FileInfo).Key.ObjectName)
+	assert.NoFileExists(t, util.GetDownloadPath(cacheDir, "bucket/a"))
+}
+
+func Test_RecoverCache_CorruptIndex(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cacheFile := util.GetDownloadPath(cacheDir, "bucket/a")
+	require.NoError(t, os.MkdirAll(path.Dir(cacheFile), util.DefaultDirPerm))
+	require.NoError(t, os.WriteFile(cacheFile, []byte("taco"), util.DefaultFilePerm))
+	require.NoError(t, os.WriteFile(path.Join(cacheDir, IndexFileName), []byte("{"), util.DefaultFilePerm))
+
+	_, cache := newRecoveredCacheHandler(t, cacheDir, 100, false)
+
+	values := cache.Values()
+	require.Len(t, values, 1)
+	assert.Equal(t, unknownGeneration, values[0].(data.FileInfo).ObjectGeneration)
+	assert.FileExists(t, cacheFile)
+}
+
+func Test_RecoverCache_VerifiesFileWithoutIndexEntry(t *testing.T) {
+	tbl := []struct {
+		name           string
+		cachedContents []byte
+		expectedOffset uint64
+	}{
+		{
+			name:           "matching",
+			cachedContents: []byte("taco"),
+			expectedOffset: 4,
+		},
+		{
+			name:           "corrupt",
+			cachedContents: []byte("tako"),
+			expectedOffset: 0,
+		},
+		{
+			name:           "different size",
+			cachedContents: []byte("tacos"),
+			expectedOffset: 0,
+		},
+	}
+	for _, tc := range tbl {
+		t.Run(tc.name, func(t *testing.T) {
+			cacheDir := path.Join(os.Getenv("HOME"), "CacheIndexTest/dir")
+			chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, cacheDir)
+			object := createObject(t, chTestArgs.bucket, "bar", []byte("taco"))
+			require.NotNil(t, object.CRC32C)
+			recoveryDir := filepath.Join(t.TempDir(), "cache")
+			localFilePath := util.GetDownloadPath(recoveryDir, util.GetObjectPath(chTestArgs.bucket.Name(), object.Name))
+			require.NoError(t, os.MkdirAll(path.Dir(localFilePath), util.DefaultDirPerm))
+			require.NoError(t, os.WriteFile(localFilePath, tc.cachedContents, util.DefaultFilePerm))
+			// CRC32C checksums are compared for such files even if not asked to.
+			cacheHandler, cache := newRecoveredCacheHandler(t, recoveryDir, 100, false)
+
+			cacheHandle, err := cacheHandler.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+
+			require.NoError(t, err)
+			defer cacheHandle.Close()
+			fileInfoKeyName, err := data.FileInfoKey{BucketName: chTestArgs.bucket.Name(), ObjectName: object.Name}.Key()
+			require.NoError(t, err)
+			fileInfo := cache.LookUpWithoutChangingOrder(fileInfoKeyName).(data.FileInfo)
+			assert.Equal(t, object.Generation, fileInfo.ObjectGeneration)
+			assert.Equal(t, tc.expectedOffset, fileInfo.Offset)
+		})
+	}
+}
+
+func Test_RecoverCache_VerifiesCRCOnFirstUse(t *testing.T) {
+	tbl := []struct {
+		name           string
+		cachedContents []byte
+		expectedOffset uint64
+	}{
+		{
+			name:           "matching",
+			cachedContents: []byte("taco"),
+			expectedOffset: 4,
+		},
+		{
+			name:           "corrupt",
+			cachedContents: []byte("tako"),
+			expectedOffset: 0,
+		},
+	}
+	for _, tc := range tbl {
+		t.Run(tc.name, func(t *testing.T) {
+			cacheDir := path.Join(os.Getenv("HOME"), "CacheIndexTest/dir")
+			chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{EnableCrc: true}, cacheDir)
+			object := createObject(t, chTestArgs.bucket, "bar", []byte("taco"))
+			require.NotNil(t, object.CRC32C)
+			recoveryDir := filepath.Join(t.TempDir(), "cache")
+			cacheHandler, cache := newRecoveredCacheHandler(t, recoveryDir, 100, true)
+			fileInfoKeyName := addCachedFile(t, recoveryDir, cache, chTestArgs.bucket.Name(), object.Name, tc.cachedContents, 4)
+			fileInfo := cache.LookUp(fileInfoKeyName).(data.FileInfo)
+			fileInfo.ObjectGeneration = object.Generation
+			_, err := cache.Insert(fileInfoKeyName, fileInfo)
+			require.NoError(t, err)
+			require.NoError(t, cacheHandler.Destroy())
+			cacheHandler, cache = newRecoveredCacheHandler(t, recoveryDir, 100, true)
+
+			cacheHandle, err := cacheHandler.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+
+			require.NoError(t, err)
+			defer cacheHandle.Close()
+			assert.Equal(t, tc.expectedOffset, cache.LookUpWithoutChangingOrder(fileInfoKeyName).(data.FileInfo).Offset)
+		})
+	}
+}
+
+func Test_RecoverCache_NewGeneration(t *testing.T) {
+	cacheDir := path.Join(os.Getenv("HOME"), "CacheIndexTest/dir")
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, cacheDir)
+	object := createObject(t, chTestArgs.bucket, "bar", []byte("taco"))
+	recoveryDir := filepath.Join(t.TempDir(), "cache")
+	cacheHandler, cache := newRecoveredCacheHandler(t, recoveryDir, 100, false)
+	fileInfoKeyName := addCachedFile(t, recoveryDir, cache, chTestArgs.bucket.Name(), object.Name, []byte("taco"), 4)
+	require.NoError(t, cacheHandler.Destroy())
+	cacheHandler, cache = newRecoveredCacheHandler(t, recoveryDir, 100, false)
+
+	cacheHandle, err := cacheHandler.GetCacheHandle(&gcs.MinObject{Name: object.Name, Size: object.Size, Generation: object.Generation + 1}, chTestArgs.bucket, false, 0)
+
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+	fileInfo := cache.LookUpWithoutChangingOrder(fileInfoKeyName).(data.FileInfo)
+	assert.Equal(t, object.Generation+1, fileInfo.ObjectGeneration)
+	assert.Equal(t, uint64(0), fileInfo.Offset)
+}
@@ -0,0 +1,485 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/sys/unix"
+)
+
+// chunkCache caches objects chunk by chunk rather than as a whole, so that
+// random reads are cached too and only the parts of an object that are read
+// take up space.
+//
+// Each object has a sparse file in the cache directory, the size of the object,
+// and a bitmap of the chunks present in it. A chunk is downloaded when a read
+// needs it, and the file info cache holds a data.ChunkInfo entry for each chunk
+// present, so that chunks are evicted one at a time by the cache's policy.
+// Evicting a chunk punches a hole in its file, and a file with no chunks left
+// is deleted once no cache handle has it open.
+//
+// Lock ordering: chunkCache.mu, then sparseFile.mu, then the file info cache's.
+type chunkCache struct {
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	chunkSize     int64
+	cacheDir      string
+	filePerm      os.FileMode
+	dirPerm       os.FileMode
+	fileInfoCache *lru.Cache
+	metricHandle  common.MetricHandle
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	mu sync.Mutex
+
+	// The sparse file of each object with chunks in the cache, or with a cache
+	// handle open, by file info key.
+	//
+	// INVARIANT: Each file has chunks present or being downloaded, or handles > 0
+	//
+	// GUARDED_BY(mu)
+	files map[string]*sparseFile
+}
+
+// sparseFile is the cache file of one generation of an object.
+type sparseFile struct {
+	key     data.FileInfoKey
+	keyName string
+	object  gcs.MinObject
+	path    string
+
+	// Opened for writing, and closed when the file is discarded.
+	f *os.File
+
+	// The number of cache handles open on the file.
+	//
+	// GUARDED_BY(chunkCache.mu)
+	handles int
+
+	mu sync.RWMutex
+
+	// A bit for each chunk, set while the chunk is in the file.
+	//
+	// GUARDED_BY(mu)
+	present []uint64
+
+	// A channel for each chunk being downloaded, closed when the download ends.
+	//
+	// GUARDED_BY(mu)
+	downloading map[int64]chan struct{}
+
+	// Set once the file has been discarded, after which it mustn't be read.
+	//
+	// GUARDED_BY(mu)
+	removed bool
+}
+
+func newChunkCache(chunkSize int64, cacheDir string, filePerm os.FileMode, dirPerm os.FileMode, fileInfoCache *lru.Cache, metricHandle common.MetricHandle) *chunkCache {
+	return &chunkCache{
+		chunkSize:     chunkSize,
+		cacheDir:      cacheDir,
+		filePerm:      filePerm,
+		dirPerm:       dirPerm,
+		fileInfoCache: fileInfoCache,
+		metricHandle:  metricHandle,
+		files:         make(map[string]*sparseFile),
+	}
+}
+
+// LOCKS_REQUIRED(sf.mu)
+func (sf *sparseFile) isPresent(chunk int64) bool {
+	return sf.present[chunk/64]&(1<<(chunk%64)) != 0
+}
+
+// LOCKS_REQUIRED(sf.mu)
+func (sf *sparseFile) setPresent(chunk int64, present bool) {
+	if present {
+		sf.present[chunk/64] |= 1 << (chunk % 64)
+	} else {
+		sf.present[chunk/64] &^= 1 << (chunk % 64)
+	}
+}
+
+// LOCKS_REQUIRED(sf.mu)
+func (sf *sparseFile) isEmpty() bool {
+	for _, word := range sf.present {
+		if word != 0 {
+			return false
+		}
+	}
+
+	return len(sf.downloading) == 0
+}
+
+// Deallocate the supplied range of the file, leaving its size unchanged.
+//
+// LOCKS_REQUIRED(sf.mu)
+func (sf *sparseFile) punchHole(start int64, end int64) error {
+	return unix.Fallocate(int(sf.f.Fd()), unix.FALLOC_FL_PUNCH_HOLE|unix.FALLOC_FL_KEEP_SIZE, start, end-start)
+}
+
+// open returns the sparse file for the supplied object, creating it, and
+// discarding the file for any other generation of the object, if necessary.
+// Each call must be matched by a call to release.
+//
+// Acquires and releases LOCK(cc.mu)
+func (cc *chunkCache) open(object *gcs.MinObject, bucketName string) (*sparseFile, error) {
+	key := data.FileInfoKey{BucketName: bucketName, ObjectName: object.Name}
+	keyName, err := key.Key()
+	if err != nil {
+		return nil, fmt.Errorf("open: while creating key: %w", err)
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if sf, ok := cc.files[keyName]; ok {
+		if sf.object.Generation == object.Generation {
+			sf.handles++
+			return sf, nil
+		}
+		cc.discard(sf)
+	}
+
+	filePath := util.GetDownloadPath(cc.cacheDir, util.GetObjectPath(bucketName, object.Name))
+	f, err := util.CreateFile(data.FileSpec{Path: filePath, FilePerm: cc.filePerm, DirPerm: cc.dirPerm}, os.O_RDWR|os.O_TRUNC)
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+
+	// Size the file without allocating any of it.
+	if err = f.Truncate(int64(object.Size)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("open: while truncating %s: %w", filePath, err)
+	}
+
+	numChunks := (int64(object.Size) + cc.chunkSize - 1) / cc.chunkSize
+	sf := &sparseFile{
+		key:         key,
+		keyName:     keyName,
+		object:      *object,
+		path:        filePath,
+		f:           f,
+		handles:     1,
+		present:     make([]uint64, (numChunks+63)/64),
+		downloading: make(map[int64]chan struct{}),
+	}
+	cc.files[keyName] = sf
+	return sf, nil
+}
+
+// Erase the entries of the chunks of the supplied file from the file info
+// cache and delete the file. Cache handles open on it fail their next read.
+//
+// LOCKS_REQUIRED(cc.mu)
+func (cc *chunkCache) discard(sf *sparseFile) {
+	delete(cc.files, sf.keyName)
+
+	sf.mu.Lock()
+	sf.removed = true
+	for i := range sf.present {
+		for bit := int64(0); bit < 64; bit++ {
+			if sf.present[i]&(1<<bit) != 0 {
+				cc.fileInfoCache.Erase(data.GetChunkKeyName(sf.keyName, (int64(i)*64+bit)*cc.chunkSize))
+			}
+		}
+		sf.present[i] = 0
+	}
+	sf.mu.Unlock()
+
+	if err := sf.f.Close(); err != nil {
+		logger.Warnf("discard: while closing %s: %v", sf.path, err)
+	}
+	if err := os.Remove(sf.path); err != nil && !os.IsNotExist(err) {
+		logger.Warnf("discard: while removing %s: %v", sf.path, err)
+	}
+}
+
+// release is called when a cache handle on the supplied sparse file is closed,
+// and discards the file if it is no longer open and has no chunks.
+//
+// Acquires and releases LOCK(cc.mu)
+func (cc *chunkCache) release(sf *sparseFile) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	sf.handles--
+	cc.discardIfUnused(sf)
+}
+
+// Discard the supplied sparse file if it is still the current one for its
+// object and has neither open handles nor chunks.
+//
+// LOCKS_REQUIRED(cc.mu)
+func (cc *chunkCache) discardIfUnused(sf *sparseFile) {
+	if sf.handles > 0 || cc.files[sf.keyName] != sf {
+		return
+	}
+
+	sf.mu.RLock()
+	empty := sf.isEmpty()
+	sf.mu.RUnlock()
+
+	if empty {
+		cc.discard(sf)
+	}
+}
+
+// remove discards the sparse file of the object with the supplied file info
+// key, if there is one.
+//
+// Acquires and releases LOCK(cc.mu)
+func (cc *chunkCache) remove(keyName string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if sf, ok := cc.files[keyName]; ok {
+		cc.discard(sf)
+	}
+}
+
+// destroy discards all of the sparse files.
+//
+// Acquires and releases LOCK(cc.mu)
+func (cc *chunkCache) destroy() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	for _, sf := range cc.files {
+		cc.discard(sf)
+	}
+}
+
+// read reads into dst from the supplied offset of the sparse file, through the
+// supplied handle on it, first downloading the chunks it needs that aren't
+// present. cacheHit is false if any were downloaded.
+func (cc *chunkCache) read(ctx context.Context, bucket gcs.Bucket, sf *sparseFile, fileHandle *os.File, offset int64, dst []byte, readType string) (n int, cacheHit bool, err error) {
+	end := min(offset+int64(len(dst)), int64(sf.object.Size))
+	first, last := offset/cc.chunkSize, (end-1)/cc.chunkSize
+
+	cacheHit = true
+	for attempt := 0; ; attempt++ {
+		sf.mu.RLock()
+		if sf.removed {
+			sf.mu.RUnlock()
+			return 0, false, fmt.Errorf("read: %s: cache file of %s was discarded", util.InvalidFileInfoCacheErrMsg, sf.object.Name)
+		}
+
+		var missing []int64
+		for chunk := first; chunk <= last; chunk++ {
+			if !sf.isPresent(chunk) {
+				missing = append(missing, chunk)
+			}
+		}
+
+		if len(missing) == 0 {
+			// Make the chunks being read the most recently used.
+			for chunk := first; chunk <= last; chunk++ {
+				_ = cc.fileInfoCache.LookUp(data.GetChunkKeyName(sf.keyName, chunk*cc.chunkSize))
+			}
+
+			n, err = fileHandle.ReadAt(dst[:end-offset], offset)
+			sf.mu.RUnlock()
+			if err == io.EOF && int64(n) == end-offset {
+				err = nil
+			}
+			if err != nil {
+				return 0, false, fmt.Errorf("%s: while reading from %d offset of the local file: %w", util.ErrInReadingFileHandleMsg, offset, err)
+			}
+			return n, cacheHit, nil
+		}
+		sf.mu.RUnlock()
+
+		// Chunks downloaded for this read were evicted again before it could use
+		// them, or another read failed to download them.
+		if attempt > 0 {
+			return 0, false, fmt.Errorf("read: %s: %d chunks of %s are not in the cache", util.FallbackToGCSErrMsg, len(missing), sf.object.Name)
+		}
+
+		cacheHit = false
+		if err = cc.fetch(ctx, bucket, sf, missing, readType); err != nil {
+			return 0, false, err
+		}
+	}
+}
+
+// Download the supplied chunks, unless other reads are already downloading
+// them, in which case wait for those reads to finish.
+func (cc *chunkCache) fetch(ctx context.Context, bucket gcs.Bucket, sf *sparseFile, chunks []int64, readType string) error {
+	var owned []int64
+	var waits []chan struct{}
+	sf.mu.Lock()
+	for _, chunk := range chunks {
+		if done, ok := sf.downloading[chunk]; ok {
+			waits = append(waits, done)
+		} else if !sf.isPresent(chunk) {
+			sf.downloading[chunk] = make(chan struct{})
+			owned = append(owned, chunk)
+		}
+	}
+	sf.mu.Unlock()
+
+	var err error
+	for _, chunk := range owned {
+		// Once one download fails, give up the rest so that other reads can try
+		// them.
+		err = cc.fetchChunk(ctx, bucket, sf, chunk, readType, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, done := range waits {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return fmt.Errorf("fetch: %s: while waiting for chunk download: %w", util.FallbackToGCSErrMsg, ctx.Err())
+		}
+	}
+
+	return nil
+}
+
+// Download the supplied chunk into the sparse file and add its entry to the
+// file info cache, unless prevErr is non-nil, and then wake the reads waiting
+// for it. It returns prevErr, or the error downloading the chunk.
+func (cc *chunkCache) fetchChunk(ctx context.Context, bucket gcs.Bucket, sf *sparseFile, chunk int64, readType string, prevErr error) error {
+	start := chunk * cc.chunkSize
+	end := min(start+cc.chunkSize, int64(sf.object.Size))
+	err := prevErr
+	if err == nil {
+		err = cc.download(ctx, bucket, sf, start, end, readType)
+	}
+
+	sf.mu.Lock()
+	close(sf.downloading[chunk])
+	delete(sf.downloading, chunk)
+	if sf.removed {
+		sf.mu.Unlock()
+		if err == nil {
+			err = fmt.Errorf("fetchChunk: %s: cache file of %s was discarded", util.InvalidFileInfoCacheErrMsg, sf.object.Name)
+		}
+		return err
+	}
+
+	var evictedValues []lru.ValueType
+	if err == nil {
+		chunkKeyName := data.GetChunkKeyName(sf.keyName, start)
+		evictedValues, err = cc.fileInfoCache.Insert(chunkKeyName, data.ChunkInfo{
+			Key:              sf.key,
+			ObjectGeneration: sf.object.Generation,
+			Range:            data.ObjectRange{Start: start, End: end},
+		})
+		if err != nil {
+			err = fmt.Errorf("fetchChunk: %s: while inserting into the cache: %w", util.FallbackToGCSErrMsg, err)
+		} else {
+			sf.setPresent(chunk, true)
+		}
+	}
+	if err != nil && err != prevErr {
+		// Free whatever of the chunk was written.
+		if punchErr := sf.punchHole(start, end); punchErr != nil {
+			logger.Warnf("fetchChunk: while freeing chunk at %d of %s: %v", start, sf.path, punchErr)
+		}
+	}
+	sf.mu.Unlock()
+
+	// The eviction policy may not admit the chunk, in which case it comes back
+	// evicted.
+	for _, val := range evictedValues {
+		evicted := val.(data.ChunkInfo)
+		cc.evict(evicted)
+		if evicted.Key == sf.key && evicted.ObjectGeneration == sf.object.Generation && evicted.Range.Start == start {
+			err = fmt.Errorf("fetchChunk: %s: %s", util.FallbackToGCSErrMsg, util.CacheAdmissionRejectedErrMsg)
+		}
+	}
+
+	return err
+}
+
+// Copy the supplied range of the object into the sparse file.
+func (cc *chunkCache) download(ctx context.Context, bucket gcs.Bucket, sf *sparseFile, start int64, end int64, readType string) error {
+	reader, err := bucket.NewReaderWithReadHandle(ctx, &gcs.ReadObjectRequest{
+		Name:       sf.object.Name,
+		Generation: sf.object.Generation,
+		Range: &gcs.ByteRange{
+			Start: uint64(start),
+			Limit: uint64(end),
+		},
+		ReadCompressed: sf.object.HasContentEncodingGzip(),
+	})
+	if err != nil {
+		return fmt.Errorf("download: %s: error in creating NewReader with start %d and limit %d: %w", util.FallbackToGCSErrMsg, start, end, err)
+	}
+	common.CaptureGCSReadMetrics(ctx, cc.metricHandle, readType, end-start)
+
+	_, err = io.CopyN(io.NewOffsetWriter(sf.f, start), reader, end-start)
+	if closeErr := reader.Close(); closeErr != nil {
+		logger.Warnf("download: error while closing reader for %s: %v", sf.object.Name, closeErr)
+	}
+	if err != nil {
+		return fmt.Errorf("download: %s: error at the time of copying content to cache file: %w", util.FallbackToGCSErrMsg, err)
+	}
+
+	return nil
+}
+
+// Punch out the supplied chunk, which the file info cache has evicted, and
+// discard its file if no chunks are left in it and it isn't open.
+//
+// Acquires and releases LOCK(cc.mu)
+func (cc *chunkCache) evict(chunkInfo data.ChunkInfo) {
+	keyName, err := chunkInfo.Key.Key()
+	if err != nil {
+		logger.Warnf("evict: while creating key: %v", err)
+		return
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	sf, ok := cc.files[keyName]
+	if !ok || sf.object.Generation != chunkInfo.ObjectGeneration {
+		return
+	}
+
+	sf.mu.Lock()
+	chunk := chunkInfo.Range.Start / cc.chunkSize
+	if sf.isPresent(chunk) {
+		if err = sf.punchHole(chunkInfo.Range.Start, chunkInfo.Range.End); err != nil {
+			logger.Warnf("evict: while punching chunk at %d out of %s: %v", chunkInfo.Range.Start, sf.path, err)
+		}
+		sf.setPresent(chunk, false)
+	}
+	sf.mu.Unlock()
+
+	cc.discardIfUnused(sf)
+}
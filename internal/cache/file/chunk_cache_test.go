@@ -0,0 +1,214 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testChunkSize = 4
+
+// Return a handler caching objects in chunks of testChunkSize bytes, with room
+// for the supplied number of bytes.
+func newChunkCacheHandler(t *testing.T, cacheDir string, maxSize uint64) (*CacheHandler, *lru.Cache) {
+	t.Helper()
+	cache := lru.NewCache(maxSize)
+	jobManager := downloader.NewJobManager(cache, util.DefaultFilePerm, util.DefaultDirPerm, cacheDir,
+		DefaultSequentialReadSizeMb, &cfg.FileCacheConfig{}, common.NewNoopMetrics())
+	cacheHandler := NewCacheHandler(cache, jobManager, cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	cacheHandler.EnableChunks(testChunkSize, common.NewNoopMetrics())
+	t.Cleanup(func() {
+		_ = cacheHandler.Destroy()
+	})
+	return cacheHandler, cache
+}
+
+func readChunks(t *testing.T, cacheHandle *CacheHandle, bucket gcs.Bucket, object *gcs.MinObject, offset int64, length int) (string, bool) {
+	t.Helper()
+	buf := make([]byte, length)
+	n, cacheHit, err := cacheHandle.Read(context.Background(), bucket, object, offset, buf)
+	require.NoError(t, err)
+	return string(buf[:n]), cacheHit
+}
+
+func chunkPresent(cacheHandle *CacheHandle, chunk int64) bool {
+	cacheHandle.sparseFile.mu.RLock()
+	defer cacheHandle.sparseFile.mu.RUnlock()
+	return cacheHandle.sparseFile.isPresent(chunk)
+}
+
+func Test_ChunkCache_RandomReadCachesItsChunks(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "ChunkCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("tacoburritoqueso"))
+	cacheHandler, cache := newChunkCacheHandler(t, filepath.Join(t.TempDir(), "cache"), 100)
+	cacheHandle, err := cacheHandler.GetCacheHandle(object, chTestArgs.bucket, false, 9)
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+
+	contents, cacheHit := readChunks(t, cacheHandle, chTestArgs.bucket, object, 9, 4)
+
+	assert.Equal(t, "toqu", contents)
+	assert.False(t, cacheHit)
+	assert.False(t, chunkPresent(cacheHandle, 0))
+	assert.True(t, chunkPresent(cacheHandle, 2))
+	assert.True(t, chunkPresent(cacheHandle, 3))
+	values := cache.Values()
+	require.Len(t, values, 2)
+	assert.Equal(t, object.Generation, values[0].(data.ChunkInfo).ObjectGeneration)
+	// Reading the same range again is a hit.
+	contents, cacheHit = readChunks(t, cacheHandle, chTestArgs.bucket, object, 9, 4)
+	assert.Equal(t, "toqu", contents)
+	assert.True(t, cacheHit)
+}
+
+func Test_ChunkCache_ReadOfLastChunk(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "ChunkCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("enchilada"))
+	cacheHandler, cache := newChunkCacheHandler(t, filepath.Join(t.TempDir(), "cache"), 100)
+	cacheHandle, err := cacheHandler.GetCacheHandle(object, chTestArgs.bucket, false, 6)
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+
+	contents, cacheHit := readChunks(t, cacheHandle, chTestArgs.bucket, object, 6, 1024)
+
+	assert.Equal(t, "ada", contents)
+	assert.False(t, cacheHit)
+	values := cache.Values()
+	require.Len(t, values, 2)
+	assert.Equal(t, data.ObjectRange{Start: 8, End: 9}, values[0].(data.ChunkInfo).Range)
+	assert.Equal(t, uint64(1), values[0].(data.ChunkInfo).Size())
+}
+
+func Test_ChunkCache_EvictionPunchesOutChunks(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "ChunkCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("tacoburritoqueso"))
+	cacheHandler, cache := newChunkCacheHandler(t, filepath.Join(t.TempDir(), "cache"), 2*testChunkSize)
+	cacheHandle, err := cacheHandler.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+	readChunks(t, cacheHandle, chTestArgs.bucket, object, 0, 1)
+	readChunks(t, cacheHandle, chTestArgs.bucket, object, 4, 1)
+
+	contents, _ := readChunks(t, cacheHandle, chTestArgs.bucket, object, 12, 4)
+
+	assert.Equal(t, "ueso", contents)
+	assert.False(t, chunkPresent(cacheHandle, 0))
+	assert.True(t, chunkPresent(cacheHandle, 1))
+	assert.True(t, chunkPresent(cacheHandle, 3))
+	assert.Len(t, cache.Values(), 2)
+	// The evicted chunk is downloaded again.
+	contents, cacheHit := readChunks(t, cacheHandle, chTestArgs.bucket, object, 0, 4)
+	assert.Equal(t, "taco", contents)
+	assert.False(t, cacheHit)
+}
+
+func Test_ChunkCache_NewGenerationDiscardsFile(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "ChunkCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	cacheHandler, cache := newChunkCacheHandler(t, filepath.Join(t.TempDir(), "cache"), 100)
+	oldHandle, err := cacheHandler.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	defer oldHandle.Close()
+	readChunks(t, oldHandle, chTestArgs.bucket, object, 0, 4)
+	newObject := createObject(t, chTestArgs.bucket, "foo", []byte("salsa"))
+	require.NotEqual(t, object.Generation, newObject.Generation)
+
+	newHandle, err := cacheHandler.GetCacheHandle(newObject, chTestArgs.bucket, false, 0)
+
+	require.NoError(t, err)
+	defer newHandle.Close()
+	assert.Empty(t, cache.Values())
+	_, _, err = oldHandle.Read(context.Background(), chTestArgs.bucket, object, 0, make([]byte, 4))
+	require.Error(t, err)
+	assert.True(t, util.IsCacheHandleInvalid(err))
+	contents, cacheHit := readChunks(t, newHandle, chTestArgs.bucket, newObject, 0, 5)
+	assert.Equal(t, "salsa", contents)
+	assert.False(t, cacheHit)
+}
+
+func Test_ChunkCache_InvalidateCacheDeletesFile(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "ChunkCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cacheHandler, cache := newChunkCacheHandler(t, cacheDir, 100)
+	cacheHandle, err := cacheHandler.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+	readChunks(t, cacheHandle, chTestArgs.bucket, object, 0, 4)
+
+	err = cacheHandler.InvalidateCache(object.Name, chTestArgs.bucket.Name())
+
+	require.NoError(t, err)
+	assert.Empty(t, cache.Values())
+	assert.NoFileExists(t, util.GetDownloadPath(cacheDir, util.GetObjectPath(chTestArgs.bucket.Name(), object.Name)))
+}
+
+func Test_ChunkCache_ClosingHandleDiscardsEmptyFile(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "ChunkCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cacheHandler, _ := newChunkCacheHandler(t, cacheDir, 100)
+	cacheHandle, err := cacheHandler.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	filePath := util.GetDownloadPath(cacheDir, util.GetObjectPath(chTestArgs.bucket.Name(), object.Name))
+	require.FileExists(t, filePath)
+
+	require.NoError(t, cacheHandle.Close())
+
+	assert.NoFileExists(t, filePath)
+	assert.Empty(t, cacheHandler.chunks.files)
+}
+
+func Test_ChunkCache_EvictedFileIsKeptWhileOpen(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "ChunkCacheTest/dir"))
+	foo := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	bar := createObject(t, chTestArgs.bucket, "bar", []byte("fajita"))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cacheHandler, _ := newChunkCacheHandler(t, cacheDir, testChunkSize)
+	fooHandle, err := cacheHandler.GetCacheHandle(foo, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	barHandle, err := cacheHandler.GetCacheHandle(bar, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	defer barHandle.Close()
+	readChunks(t, fooHandle, chTestArgs.bucket, foo, 0, 4)
+
+	readChunks(t, barHandle, chTestArgs.bucket, bar, 0, 4)
+
+	assert.False(t, chunkPresent(fooHandle, 0))
+	fooPath := util.GetDownloadPath(cacheDir, util.GetObjectPath(chTestArgs.bucket.Name(), foo.Name))
+	assert.FileExists(t, fooPath)
+	contents, cacheHit := readChunks(t, fooHandle, chTestArgs.bucket, foo, 0, 4)
+	assert.Equal(t, "taco", contents)
+	assert.False(t, cacheHit)
+	// Once closed, the file goes when its last chunk is evicted.
+	require.NoError(t, fooHandle.Close())
+	assert.FileExists(t, fooPath)
+	readChunks(t, barHandle, chTestArgs.bucket, bar, 4, 2)
+	assert.NoFileExists(t, fooPath)
+}
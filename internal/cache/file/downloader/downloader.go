@@ -62,6 +62,12 @@ type JobManager struct {
 	mu                locker.Locker
 	maxParallelismSem *semaphore.Weighted
 	metricHandle      common.MetricHandle
+
+	// jobDoneCallback, if non-nil, is called with the final status of each job
+	// created from now on. See SetJobDoneCallback.
+	//
+	// GUARDED_BY(mu)
+	jobDoneCallback func(object *gcs.MinObject, bucketName string, status JobStatus)
 }
 
 func NewJobManager(fileInfoCache *lru.Cache, filePerm os.FileMode, dirPerm os.FileMode,
@@ -119,10 +125,29 @@ func (jm *JobManager) CreateJobIfNotExists(object *gcs.MinObject, bucket gcs.Buc
 		jm.removeJob(object.Name, bucket.Name())
 	}
 	job = NewJob(object, bucket, jm.fileInfoCache, jm.sequentialReadSizeMb, fileSpec, removeJobCallback, jm.fileCacheConfig, jm.maxParallelismSem, jm.metricHandle)
+	if jm.jobDoneCallback != nil {
+		jobDoneCallback := jm.jobDoneCallback
+		bucketName := bucket.Name()
+		job.doneCallback = func(status JobStatus) {
+			jobDoneCallback(object, bucketName, status)
+		}
+	}
 	jm.jobs[objectPath] = job
 	return job
 }
 
+// SetJobDoneCallback arranges for the supplied function to be called once for
+// each job created from now on, with the job's final status when it completes,
+// fails or is invalidated. It is called with the job's lock held, so must not
+// call the job's methods.
+//
+// Acquires and releases Lock(jm.mu)
+func (jm *JobManager) SetJobDoneCallback(f func(object *gcs.MinObject, bucketName string, status JobStatus)) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	jm.jobDoneCallback = f
+}
+
 // GetJob returns downloader.Job for given object and bucket if present. If the
 // job is not present, it returns nil.
 //
@@ -89,6 +89,10 @@ type Job struct {
 	// is responsibility of JobManager to pass this function.
 	removeJobCallback func()
 
+	// doneCallback, if non-nil, is called once with the final status of the job
+	// when it completes, fails or is invalidated, just after removeJobCallback.
+	doneCallback func(JobStatus)
+
 	mu locker.Locker
 	// This semaphore is shared across all jobs spawned by the job manager and is
 	// used to limit the download concurrency.
@@ -210,6 +214,7 @@ func (job *Job) Invalidate() {
 		job.removeJobCallback()
 		job.removeJobCallback = nil
 	}
+	job.callDoneCallback()
 	job.notifySubscribers()
 }
 
@@ -378,10 +383,22 @@ func (job *Job) cleanUpDownloadAsyncJob() {
 		job.removeJobCallback()
 		job.removeJobCallback = nil
 	}
+	job.callDoneCallback()
 	job.cancelCtx, job.cancelFunc = nil, nil
 	job.mu.Unlock()
 }
 
+// callDoneCallback calls job.doneCallback with the status of the job, if it
+// hasn't been called already.
+//
+// Requires LOCK(job.mu)
+func (job *Job) callDoneCallback() {
+	if job.doneCallback != nil {
+		job.doneCallback(job.status)
+		job.doneCallback = nil
+	}
+}
+
 // createCacheFile is a helper function which creates file in cache using
 // appropriate open file flags.
 func (job *Job) createCacheFile() (*os.File, error) {
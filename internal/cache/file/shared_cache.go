@@ -0,0 +1,498 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// SharedStateDirName is the name of the directory in a shared cache directory
+// that holds the lock and marker files through which the processes sharing it
+// coordinate. Bucket names can't start with a dot, so it can't clash with the
+// directory of a bucket.
+const SharedStateDirName = ".gcsfuse-shared"
+
+// The names of the ledger in the shared state directory, and of the file locked
+// while it is read or written.
+const (
+	sharedLedgerFileName     = "ledger.json"
+	sharedLedgerLockFileName = "ledger.lock"
+)
+
+// A process records that it used a shared file in the ledger at most this
+// often.
+const sharedTouchInterval = time.Minute
+
+// sharedCache coordinates the use of a file cache directory by several gcsfuse
+// processes, so that an object downloaded by one is served from disk to the
+// others.
+//
+// For each cached object there is a lock file and a marker file under
+// SharedStateDirName, at the object's path. A process holds an exclusive flock
+// on the lock file while it downloads the object or deletes its file, and so
+// only one process writes the file at a time. The lock file is deleted before
+// the lock is released, and a process that has locked a lock file checks that
+// it is still the one at its path, so lock files don't accumulate. A download
+// writes a fresh file, never overwriting one that other processes may have
+// open, and once it completes the marker records the generation and size of
+// the object and the inode of the file. Another process uses the file only
+// while the marker says it is complete and for the generation it wants,
+// checking the inode of the file it opens against the marker so that it can't
+// mistake a newer download in progress for the file the marker describes. The
+// kernel drops the locks of processes that die.
+//
+// The size of the complete files is accounted for in a ledger shared by the
+// processes, along with when each file was last used by any of them. A process
+// that completes a download evicts the least recently used files until their
+// total size is within its limit, so that the processes share one limit
+// rather than each counting the files against its own. Evicting a file from
+// the file info cache of a process only forgets it in that process. Deleting
+// a file only unlinks it, so that processes that have it open can carry on
+// reading; they download the object again the next time they open it.
+type sharedCache struct {
+	cacheDir string
+	stateDir string
+	filePerm os.FileMode
+	dirPerm  os.FileMode
+	maxSize  uint64
+
+	mu sync.Mutex
+
+	// The lock files this process holds exclusive locks on for the objects it
+	// is downloading, by object path.
+	//
+	// GUARDED_BY(mu)
+	downloading map[string]*os.File
+
+	// When this process last recorded the use of each file in the ledger, by
+	// object path.
+	//
+	// GUARDED_BY(mu)
+	touched map[string]time.Time
+}
+
+// The entry in the ledger for a complete file.
+type sharedLedgerEntry struct {
+	Generation int64
+	Size       uint64
+	LastUsed   time.Time
+}
+
+// The contents of the ledger, by object path.
+type sharedLedger map[string]sharedLedgerEntry
+
+// The contents of a marker file.
+type sharedMarker struct {
+	Generation int64
+	Size       uint64
+	Inode      uint64
+}
+
+func newSharedCache(cacheDir string, filePerm os.FileMode, dirPerm os.FileMode, maxSize uint64) *sharedCache {
+	return &sharedCache{
+		cacheDir:    cacheDir,
+		stateDir:    path.Join(cacheDir, SharedStateDirName),
+		filePerm:    filePerm,
+		dirPerm:     dirPerm,
+		maxSize:     maxSize,
+		downloading: make(map[string]*os.File),
+		touched:     make(map[string]time.Time),
+	}
+}
+
+func (s *sharedCache) lockPath(objectPath string) string {
+	return path.Join(s.stateDir, objectPath+".lock")
+}
+
+func (s *sharedCache) markerPath(objectPath string) string {
+	return path.Join(s.stateDir, objectPath+".done")
+}
+
+// Take an exclusive lock on the file at the supplied path, creating it if
+// necessary. Unless wait is set, it returns nil rather than waiting if another
+// process holds the lock.
+func (s *sharedCache) lockFile(lockPath string, wait bool) (*os.File, error) {
+	how := syscall.LOCK_EX
+	if !wait {
+		how |= syscall.LOCK_NB
+	}
+
+	for {
+		f, err := util.CreateFile(data.FileSpec{Path: lockPath, FilePerm: s.filePerm, DirPerm: s.dirPerm}, os.O_RDONLY)
+		if err != nil {
+			return nil, err
+		}
+
+		err = syscall.Flock(int(f.Fd()), how)
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			f.Close()
+			return nil, nil
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("flock: %w", err)
+		}
+
+		// The process that held the lock may have deleted the file before
+		// releasing it, in which case lock the one now at the path instead.
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("lockFile: %w", err)
+		}
+		pathFi, err := os.Stat(lockPath)
+		if err == nil && os.SameFile(fi, pathFi) {
+			return f, nil
+		}
+		f.Close()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("lockFile: %w", err)
+		}
+	}
+}
+
+// Try to take an exclusive lock for the supplied object without waiting,
+// returning nil if another process holds it.
+func (s *sharedCache) tryLock(objectPath string) (*os.File, error) {
+	return s.lockFile(s.lockPath(objectPath), false)
+}
+
+// Delete the lock file of the supplied object and then release the lock.
+func (s *sharedCache) unlock(objectPath string, lockFile *os.File) {
+	if err := os.Remove(s.lockPath(objectPath)); err != nil && !os.IsNotExist(err) {
+		logger.Warnf("unlock: while removing lock file for %s: %v", objectPath, err)
+	}
+	lockFile.Close()
+}
+
+// Delete the file and marker of the supplied object.
+//
+// LOCKS_REQUIRED(the lock of the object)
+func (s *sharedCache) deleteFile(objectPath string) error {
+	err := os.Remove(s.markerPath(objectPath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err = os.Remove(util.GetDownloadPath(s.cacheDir, objectPath))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// Read the ledger, apply the supplied function to it, and write it back if the
+// function returns true, all under the ledger's lock.
+func (s *sharedCache) updateLedger(f func(ledger sharedLedger) bool) error {
+	lockFile, err := s.lockFile(path.Join(s.stateDir, sharedLedgerLockFileName), true)
+	if err != nil {
+		return fmt.Errorf("updateLedger: %w", err)
+	}
+	defer lockFile.Close()
+
+	ledgerPath := path.Join(s.stateDir, sharedLedgerFileName)
+	ledger := make(sharedLedger)
+	contents, err := os.ReadFile(ledgerPath)
+	if err == nil {
+		if err = json.Unmarshal(contents, &ledger); err != nil {
+			logger.Warnf("Discarding corrupt shared cache ledger %s: %v", ledgerPath, err)
+			ledger = make(sharedLedger)
+		}
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("updateLedger: %w", err)
+	}
+
+	if !f(ledger) {
+		return nil
+	}
+
+	if contents, err = json.Marshal(ledger); err != nil {
+		return fmt.Errorf("updateLedger: %w", err)
+	}
+	tmpPath := ledgerPath + ".tmp"
+	if err = os.WriteFile(tmpPath, contents, s.filePerm); err != nil {
+		return fmt.Errorf("updateLedger: %w", err)
+	}
+	if err = os.Rename(tmpPath, ledgerPath); err != nil {
+		return fmt.Errorf("updateLedger: %w", err)
+	}
+
+	return nil
+}
+
+// Delete the least recently used files, other than the one for the supplied
+// object, until the files in the ledger fit in the size limit. Files that
+// another process has locked are skipped.
+//
+// LOCKS_REQUIRED(the lock of the ledger)
+func (s *sharedCache) evictLocked(ledger sharedLedger, keep string) {
+	var total uint64
+	var victims []string
+	for objectPath, entry := range ledger {
+		total += entry.Size
+		if objectPath != keep {
+			victims = append(victims, objectPath)
+		}
+	}
+	sort.Slice(victims, func(i, j int) bool {
+		return ledger[victims[i]].LastUsed.Before(ledger[victims[j]].LastUsed)
+	})
+
+	for _, objectPath := range victims {
+		if total <= s.maxSize {
+			return
+		}
+
+		lockFile, err := s.tryLock(objectPath)
+		if err != nil {
+			logger.Warnf("evictLocked: while locking %s: %v", objectPath, err)
+		}
+		if lockFile == nil {
+			continue
+		}
+
+		err = s.deleteFile(objectPath)
+		s.unlock(objectPath, lockFile)
+		if err != nil {
+			logger.Warnf("evictLocked: while deleting %s: %v", objectPath, err)
+			continue
+		}
+
+		total -= ledger[objectPath].Size
+		delete(ledger, objectPath)
+	}
+}
+
+// Forget the file for the supplied object in the ledger.
+func (s *sharedCache) forget(objectPath string) error {
+	s.mu.Lock()
+	delete(s.touched, objectPath)
+	s.mu.Unlock()
+
+	return s.updateLedger(func(ledger sharedLedger) bool {
+		_, ok := ledger[objectPath]
+		delete(ledger, objectPath)
+		return ok
+	})
+}
+
+// Return the marker of the supplied object, or nil if there is none.
+func (s *sharedCache) readMarker(objectPath string) *sharedMarker {
+	contents, err := os.ReadFile(s.markerPath(objectPath))
+	if err != nil {
+		return nil
+	}
+
+	var m sharedMarker
+	if err = json.Unmarshal(contents, &m); err != nil {
+		logger.Warnf("Ignoring shared cache marker for %s: %v", objectPath, err)
+		return nil
+	}
+
+	return &m
+}
+
+// Atomically replace the marker of the supplied object.
+func (s *sharedCache) writeMarker(objectPath string, m sharedMarker) error {
+	contents, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	markerPath := s.markerPath(objectPath)
+	tmpPath := markerPath + ".tmp"
+	if err = os.WriteFile(tmpPath, contents, s.filePerm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, markerPath)
+}
+
+func inodeOf(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return st.Ino
+	}
+
+	return 0
+}
+
+// Does the marker say that the supplied file, as found by stat, holds all of
+// the supplied object?
+func (m *sharedMarker) describes(fi os.FileInfo, object *gcs.MinObject) bool {
+	return m != nil &&
+		m.Generation == object.Generation &&
+		m.Size == object.Size &&
+		uint64(fi.Size()) == m.Size &&
+		m.Inode == inodeOf(fi)
+}
+
+// isComplete says whether another process has downloaded all of the supplied
+// object to its file in the cache.
+func (s *sharedCache) isComplete(object *gcs.MinObject, bucketName string) bool {
+	objectPath := util.GetObjectPath(bucketName, object.Name)
+	fi, err := os.Stat(util.GetDownloadPath(s.cacheDir, objectPath))
+	if err != nil {
+		return false
+	}
+
+	return s.readMarker(objectPath).describes(fi, object)
+}
+
+// touch records in the ledger that the file of the supplied object was used,
+// so that it is evicted after files used less recently by any process.
+func (s *sharedCache) touch(object *gcs.MinObject, bucketName string) {
+	objectPath := util.GetObjectPath(bucketName, object.Name)
+	now := time.Now()
+	s.mu.Lock()
+	recent := now.Sub(s.touched[objectPath]) < sharedTouchInterval
+	if !recent {
+		s.touched[objectPath] = now
+	}
+	s.mu.Unlock()
+	if recent {
+		return
+	}
+
+	err := s.updateLedger(func(ledger sharedLedger) bool {
+		entry, ok := ledger[objectPath]
+		if !ok || entry.Generation != object.Generation {
+			return false
+		}
+		entry.LastUsed = now
+		ledger[objectPath] = entry
+		return true
+	})
+	if err != nil {
+		logger.Warnf("touch: while recording the use of %s: %v", objectPath, err)
+	}
+}
+
+// validate returns an error unless the supplied file, opened from the cache,
+// is the complete file for the object that the marker describes.
+func (s *sharedCache) validate(f *os.File, object *gcs.MinObject, bucketName string) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("validate: %w", err)
+	}
+
+	if !s.readMarker(util.GetObjectPath(bucketName, object.Name)).describes(fi, object) {
+		return fmt.Errorf("validate: %s: file for %s was replaced by another process", util.InvalidFileInfoCacheErrMsg, object.Name)
+	}
+
+	return nil
+}
+
+// startDownload takes the lock for downloading the supplied object, and
+// deletes any previous file and marker for it. It returns false, rather than
+// waiting, if another process holds the lock. The lock is held until
+// downloadDone is called.
+func (s *sharedCache) startDownload(object *gcs.MinObject, bucketName string) (bool, error) {
+	objectPath := util.GetObjectPath(bucketName, object.Name)
+	lockFile, err := s.tryLock(objectPath)
+	if err != nil || lockFile == nil {
+		return false, err
+	}
+
+	// Other processes may still be reading the previous file, so unlink it
+	// rather than overwriting it.
+	err = s.deleteFile(objectPath)
+	if err == nil {
+		err = s.forget(objectPath)
+	}
+	if err != nil {
+		s.unlock(objectPath, lockFile)
+		return false, fmt.Errorf("startDownload: %w", err)
+	}
+
+	s.mu.Lock()
+	s.downloading[objectPath] = lockFile
+	s.mu.Unlock()
+	return true, nil
+}
+
+// downloadDone is called with the final status of the download job for an
+// object. It records the file as complete, if it is, evicting other files to
+// make room for it, and otherwise deletes what was downloaded. Either way, it
+// releases the lock taken by startDownload.
+func (s *sharedCache) downloadDone(object *gcs.MinObject, bucketName string, status downloader.JobStatus) {
+	objectPath := util.GetObjectPath(bucketName, object.Name)
+	s.mu.Lock()
+	lockFile, ok := s.downloading[objectPath]
+	delete(s.downloading, objectPath)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	defer s.unlock(objectPath, lockFile)
+
+	if status.Name != downloader.Completed {
+		if err := s.deleteFile(objectPath); err != nil {
+			logger.Warnf("downloadDone: while deleting incomplete %s: %v", objectPath, err)
+		}
+		return
+	}
+
+	fi, err := os.Stat(util.GetDownloadPath(s.cacheDir, objectPath))
+	if err == nil {
+		err = s.writeMarker(objectPath, sharedMarker{Generation: object.Generation, Size: object.Size, Inode: inodeOf(fi)})
+	}
+	if err == nil {
+		err = s.updateLedger(func(ledger sharedLedger) bool {
+			ledger[objectPath] = sharedLedgerEntry{Generation: object.Generation, Size: object.Size, LastUsed: time.Now()}
+			s.evictLocked(ledger, objectPath)
+			return true
+		})
+	}
+	if err != nil {
+		logger.Warnf("downloadDone: while marking %s as complete: %v", objectPath, err)
+	}
+}
+
+// remove deletes the file for the supplied generation of an object, unless
+// another process is downloading the object or has replaced the file with one
+// for another generation.
+func (s *sharedCache) remove(objectName string, bucketName string, generation int64) error {
+	objectPath := util.GetObjectPath(bucketName, objectName)
+	lockFile, err := s.tryLock(objectPath)
+	if err != nil || lockFile == nil {
+		return err
+	}
+	defer s.unlock(objectPath, lockFile)
+
+	if m := s.readMarker(objectPath); m != nil && m.Generation != generation {
+		return nil
+	}
+
+	if err = s.deleteFile(objectPath); err != nil {
+		return err
+	}
+
+	return s.forget(objectPath)
+}
@@ -0,0 +1,205 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/data"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Return a handler sharing cacheDir, standing in for another gcsfuse process,
+// that keeps the shared files within the supplied size.
+func newSharedCacheHandler(t *testing.T, cacheDir string, maxSize uint64) *CacheHandler {
+	t.Helper()
+	cache := lru.NewCache(HandlerCacheMaxSize)
+	jobManager := downloader.NewJobManager(cache, util.DefaultFilePerm, util.DefaultDirPerm, cacheDir,
+		DefaultSequentialReadSizeMb, &cfg.FileCacheConfig{}, common.NewNoopMetrics())
+	cacheHandler := NewCacheHandler(cache, jobManager, cacheDir, util.DefaultFilePerm, util.DefaultDirPerm)
+	cacheHandler.EnableSharing(maxSize)
+	t.Cleanup(func() {
+		_ = cacheHandler.Destroy()
+	})
+	return cacheHandler
+}
+
+// Download the whole object through the supplied handler and wait for other
+// handlers to see it as complete.
+func downloadShared(t *testing.T, cacheHandler *CacheHandler, object *gcs.MinObject, bucket gcs.Bucket) {
+	t.Helper()
+	cacheHandle, err := cacheHandler.GetCacheHandle(object, bucket, false, 0)
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+	job := cacheHandler.jobManager.GetJob(object.Name, bucket.Name())
+	require.NotNil(t, job)
+	_, err = job.Download(context.Background(), int64(object.Size), true)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return cacheHandler.shared.isComplete(object, bucket.Name())
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_SharedCache_AdoptsCompleteDownload(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "SharedCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	first := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	second := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	downloadShared(t, first, object, chTestArgs.bucket)
+
+	cacheHandle, err := second.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+	assert.Nil(t, second.jobManager.GetJob(object.Name, chTestArgs.bucket.Name()))
+	buf := make([]byte, 4)
+	n, cacheHit, err := cacheHandle.Read(context.Background(), chTestArgs.bucket, object, 0, buf)
+	require.NoError(t, err)
+	assert.True(t, cacheHit)
+	assert.Equal(t, "taco", string(buf[:n]))
+}
+
+func Test_SharedCache_BusyWhileAnotherDownloads(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "SharedCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	first := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	second := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	cacheHandle, err := first.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+
+	_, err = second.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+
+	require.Error(t, err)
+	assert.ErrorContains(t, err, util.SharedCacheBusyErrMsg)
+	assert.Empty(t, second.fileInfoCache.Values())
+	// Once the first gives up, the second can download the object itself.
+	require.NoError(t, first.InvalidateCache(object.Name, chTestArgs.bucket.Name()))
+	cacheHandle, err = second.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+	assert.NotNil(t, second.jobManager.GetJob(object.Name, chTestArgs.bucket.Name()))
+}
+
+func Test_SharedCache_EvictionUnlinksFile(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "SharedCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	first := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	second := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	downloadShared(t, first, object, chTestArgs.bucket)
+	cacheHandle, err := second.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+
+	require.NoError(t, first.InvalidateCache(object.Name, chTestArgs.bucket.Name()))
+
+	assert.NoFileExists(t, util.GetDownloadPath(cacheDir, util.GetObjectPath(chTestArgs.bucket.Name(), object.Name)))
+	assert.False(t, second.shared.isComplete(object, chTestArgs.bucket.Name()))
+	// The second can still read the file it has open.
+	buf := make([]byte, 4)
+	n, _, err := cacheHandle.Read(context.Background(), chTestArgs.bucket, object, 0, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "taco", string(buf[:n]))
+}
+
+func Test_SharedCache_ReplacedFileIsNotUsed(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "SharedCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	first := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	second := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	downloadShared(t, first, object, chTestArgs.bucket)
+	cacheHandle, err := second.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	cacheHandle.Close()
+	// The first downloads the object afresh, replacing the file.
+	require.NoError(t, first.InvalidateCache(object.Name, chTestArgs.bucket.Name()))
+	cacheHandle, err = first.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+
+	_, err = second.GetCacheHandle(object, chTestArgs.bucket, false, 0)
+
+	require.Error(t, err)
+	assert.ErrorContains(t, err, util.SharedCacheBusyErrMsg)
+	assert.Empty(t, second.fileInfoCache.Values())
+}
+
+func Test_SharedCache_EvictionIsCoordinated(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "SharedCacheTest/dir"))
+	foo := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	bar := createObject(t, chTestArgs.bucket, "bar", []byte("salsa"))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	first := newSharedCacheHandler(t, cacheDir, 6)
+	second := newSharedCacheHandler(t, cacheDir, 6)
+	downloadShared(t, first, foo, chTestArgs.bucket)
+
+	downloadShared(t, second, bar, chTestArgs.bucket)
+
+	// Each process has room for either object, but not both.
+	assert.False(t, first.shared.isComplete(foo, chTestArgs.bucket.Name()))
+	assert.NoFileExists(t, util.GetDownloadPath(cacheDir, util.GetObjectPath(chTestArgs.bucket.Name(), foo.Name)))
+	assert.True(t, first.shared.isComplete(bar, chTestArgs.bucket.Name()))
+}
+
+func Test_SharedCache_LocalEvictionKeepsFile(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "SharedCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	big := createObject(t, chTestArgs.bucket, "big", make([]byte, HandlerCacheMaxSize-2))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	first := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	second := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	downloadShared(t, first, object, chTestArgs.bucket)
+
+	// Opening the big object crowds the small one out of the first's own
+	// cache.
+	cacheHandle, err := first.GetCacheHandle(big, chTestArgs.bucket, false, 0)
+
+	require.NoError(t, err)
+	defer cacheHandle.Close()
+	fileInfoKeyName, err := data.FileInfoKey{BucketName: chTestArgs.bucket.Name(), ObjectName: object.Name}.Key()
+	require.NoError(t, err)
+	assert.Nil(t, first.fileInfoCache.LookUpWithoutChangingOrder(fileInfoKeyName))
+	assert.True(t, second.shared.isComplete(object, chTestArgs.bucket.Name()))
+}
+
+func Test_SharedCache_LockFilesAreRemoved(t *testing.T) {
+	chTestArgs := initializeCacheHandlerTestArgs(t, &cfg.FileCacheConfig{}, path.Join(os.Getenv("HOME"), "SharedCacheTest/dir"))
+	object := createObject(t, chTestArgs.bucket, "foo", []byte("taco"))
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	cacheHandler := newSharedCacheHandler(t, cacheDir, HandlerCacheMaxSize)
+	lockPath := cacheHandler.shared.lockPath(util.GetObjectPath(chTestArgs.bucket.Name(), object.Name))
+
+	downloadShared(t, cacheHandler, object, chTestArgs.bucket)
+
+	assert.NoFileExists(t, lockPath)
+	require.NoError(t, cacheHandler.InvalidateCache(object.Name, chTestArgs.bucket.Name()))
+	assert.NoFileExists(t, lockPath)
+}
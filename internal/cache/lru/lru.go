@@ -15,10 +15,8 @@
 package lru
 
 import (
-	"container/list"
 	"errors"
 	"fmt"
-	"reflect"
 	"strings"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
@@ -33,7 +31,8 @@ const (
 )
 
 // Cache is a LRU cache for any lru.ValueType indexed by string keys.
-// That means entry's value should be a lru.ValueType.
+// That means entry's value should be a lru.ValueType. The eviction policy can
+// be changed from LRU with NewCacheWithPolicy.
 type Cache struct {
 	/////////////////////////
 	// Constant data
@@ -42,24 +41,25 @@ type Cache struct {
 	// INVARIANT: maxSize > 0
 	maxSize uint64
 
+	// Called with the result of each LookUp, if non-nil. See SetLookUpObserver.
+	lookUpObserver func(hit bool)
+
 	/////////////////////////
 	// Mutable state
 	/////////////////////////
 
 	// Sum of entry.Value.Size() of all the entries in the cache.
-	currentSize uint64
-
-	// List of cache entries, with least recently used at the tail.
 	//
 	// INVARIANT: currentSize <= maxSize
-	// INVARIANT: Each element is of type entry
-	entries list.List
+	currentSize uint64
+
+	// The entries, by key.
+	index map[string]ValueType
 
-	// Index of elements by name.
+	// Decides which entries to evict.
 	//
-	// INVARIANT: For each k, v: v.Value.(entry).Key == k
-	// INVARIANT: Contains all and only the elements of entries
-	index map[string]*list.Element
+	// INVARIANT: policy.Keys() contains all and only the keys of index
+	policy Policy
 
 	// All public methods of this Cache uses this RW mutex based locker while
 	// accessing/updating Cache's data.
@@ -70,17 +70,19 @@ type ValueType interface {
 	Size() uint64
 }
 
-type entry struct {
-	Key   string
-	Value ValueType
-}
-
 // NewCache returns the reference of cache object by initialising the cache with
 // the supplied maxSize, which must be greater than zero.
 func NewCache(maxSize uint64) *Cache {
+	return NewCacheWithPolicy(maxSize, newLRUPolicy())
+}
+
+// NewCacheWithPolicy is like NewCache, but evicts entries according to the
+// supplied policy, which must be new. See NewPolicy.
+func NewCacheWithPolicy(maxSize uint64, policy Policy) *Cache {
 	c := &Cache{
 		maxSize: maxSize,
-		index:   make(map[string]*list.Element),
+		index:   make(map[string]ValueType),
+		policy:  policy,
 	}
 
 	// Set up invariant checking.
@@ -100,51 +102,47 @@ func (c *Cache) checkInvariants() {
 		panic(fmt.Sprintf("CurrentSize %v over maxSize %v", c.currentSize, c.maxSize))
 	}
 
-	// INVARIANT: Each element is of type entry
-	for e := c.entries.Front(); e != nil; e = e.Next() {
-		switch e.Value.(type) {
-		case entry:
-		default:
-			panic(fmt.Sprintf("Unexpected element type: %v", reflect.TypeOf(e.Value)))
-		}
-	}
-
-	// INVARIANT: For each k, v: v.Value.(entry).Key == k
-	// INVARIANT: Contains all and only the elements of entries
-	if c.entries.Len() != len(c.index) {
+	// INVARIANT: policy.Keys() contains all and only the keys of index
+	if c.policy.Len() != len(c.index) {
 		panic(fmt.Sprintf(
 			"Length mismatch: %v vs. %v",
-			c.entries.Len(),
+			c.policy.Len(),
 			len(c.index)))
 	}
 
-	for e := c.entries.Front(); e != nil; e = e.Next() {
-		if c.index[e.Value.(entry).Key] != e {
-			panic(fmt.Sprintf("Mismatch for key %v", e.Value.(entry).Key))
+	for _, key := range c.policy.Keys() {
+		if _, ok := c.index[key]; !ok {
+			panic(fmt.Sprintf("Mismatch for key %v", key))
 		}
 	}
 }
 
-func (c *Cache) evictOne() ValueType {
-	e := c.entries.Back()
-	key := e.Value.(entry).Key
-
-	evictedEntry := e.Value.(entry).Value
+func (c *Cache) evict(key string) ValueType {
+	evictedEntry := c.index[key]
 	c.currentSize -= evictedEntry.Size()
 
-	c.entries.Remove(e)
+	c.policy.Remove(key)
 	delete(c.index, key)
 
 	return evictedEntry
 }
 
+// SetLookUpObserver arranges for the supplied function to be called with
+// whether each LookUp found an entry, for measuring the hit rate of the cache.
+// It must be called before the cache is used.
+func (c *Cache) SetLookUpObserver(f func(hit bool)) {
+	c.lookUpObserver = f
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Cache interface
 ////////////////////////////////////////////////////////////////////////
 
 // Insert the supplied value into the cache, overwriting any previous entry for
 // the given key. The value must be non-nil.
-// Also returns a slice of ValueType evicted by the new inserted entry.
+// Also returns a slice of ValueType evicted by the new inserted entry. If the
+// policy doesn't admit a new entry, or evicts it after the entries it
+// displaced, the slice holds the supplied value itself, possibly among others.
 func (c *Cache) Insert(
 	key string,
 	value ValueType) ([]ValueType, error) {
@@ -160,24 +158,31 @@ func (c *Cache) Insert(
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	e, ok := c.index[key]
+	existing, ok := c.index[key]
 	if ok {
 		// Update an entry if already exist.
-		c.currentSize -= e.Value.(entry).Value.Size()
+		c.currentSize -= existing.Size()
 		c.currentSize += valueSize
-		e.Value = entry{key, value}
-		c.entries.MoveToFront(e)
+		c.index[key] = value
+		c.policy.Access(key, valueSize)
 	} else {
 		// Add the entry if already doesn't exist.
-		e := c.entries.PushFront(entry{key, value})
-		c.index[key] = e
+		c.index[key] = value
 		c.currentSize += valueSize
+		c.policy.Add(key, valueSize)
 	}
 
 	var evictedValues []ValueType
+	// A new entry that would cause an eviction may not be admitted at all.
+	if !ok && c.currentSize > c.maxSize {
+		if victim := c.policy.Victim(); victim != key && !c.policy.Admit(key, victim) {
+			return append(evictedValues, c.evict(key)), nil
+		}
+	}
+
 	// Evict until we're at or below maxSize.
 	for c.currentSize > c.maxSize {
-		evictedValues = append(evictedValues, c.evictOne())
+		evictedValues = append(evictedValues, c.evict(c.policy.Victim()))
 	}
 
 	return evictedValues, nil
@@ -188,18 +193,11 @@ func (c *Cache) Erase(key string) (value ValueType) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	e, ok := c.index[key]
-	if !ok {
+	if _, ok := c.index[key]; !ok {
 		return
 	}
 
-	deletedEntry := e.Value.(entry).Value
-	c.currentSize -= deletedEntry.Size()
-
-	delete(c.index, key)
-	c.entries.Remove(e)
-
-	return deletedEntry
+	return c.evict(key)
 }
 
 // LookUp a previously-inserted value for the given key. Return nil if no
@@ -209,15 +207,18 @@ func (c *Cache) LookUp(key string) (value ValueType) {
 	defer c.mu.Unlock()
 
 	// Consult the index.
-	e, ok := c.index[key]
+	value, ok := c.index[key]
+	if c.lookUpObserver != nil {
+		c.lookUpObserver(ok)
+	}
 	if !ok {
 		return
 	}
 	// This is now the most recently used entry.
-	c.entries.MoveToFront(e)
+	c.policy.Access(key, value.Size())
 
 	// Return the value.
-	return e.Value.(entry).Value
+	return value
 }
 
 // LookUpWithoutChangingOrder looks up previously-inserted value for a given key
@@ -231,13 +232,7 @@ func (c *Cache) LookUpWithoutChangingOrder(key string) (value ValueType) {
 	defer c.mu.RUnlock()
 
 	// Consult the index.
-	e, ok := c.index[key]
-	if !ok {
-		return
-	}
-
-	// Return the value.
-	return e.Value.(entry).Value
+	return c.index[key]
 }
 
 // UpdateWithoutChangingOrder updates entry with the given key in cache with
@@ -254,21 +249,34 @@ func (c *Cache) UpdateWithoutChangingOrder(
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	e, ok := c.index[key]
+	existing, ok := c.index[key]
 	if !ok {
 		return errors.New(EntryNotExistErrMsg)
 	}
 
-	if value.Size() != e.Value.(entry).Value.Size() {
+	if value.Size() != existing.Size() {
 		return errors.New(InvalidUpdateEntrySizeErrorMsg)
 	}
 
-	e.Value = entry{key, value}
-	c.index[key] = e
+	c.index[key] = value
 
 	return nil
 }
 
+// Values returns the values of all the entries in the cache, with the most
+// recently used, or for policies other than LRU the most worth keeping, first.
+func (c *Cache) Values() []ValueType {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	values := make([]ValueType, 0, len(c.index))
+	for _, key := range c.policy.Keys() {
+		values = append(values, c.index[key])
+	}
+
+	return values
+}
+
 func (c *Cache) EraseEntriesWithGivenPrefix(prefix string) {
 	for key := range c.index {
 		if strings.HasPrefix(key, prefix) {
@@ -314,6 +314,20 @@ func (t *CacheTest) TestLookUpWithoutChangingOrder_NotChangeOrder() {
 
 // This will detect race if we run the test with `-race` flag.
 // We get the race condition failure if we remove lock from Insert or Erase method.
+func (t *CacheTest) TestValues() {
+	t.insertAndAssert("burrito1", testData{Value: 1, DataSize: 4}, []int64{}, nil)
+	t.insertAndAssert("burrito2", testData{Value: 2, DataSize: 4}, []int64{}, nil)
+	t.insertAndAssert("burrito3", testData{Value: 3, DataSize: 4}, []int64{}, nil)
+	t.cache.LookUp("burrito1")
+
+	values := t.cache.Values()
+
+	AssertEq(3, len(values))
+	ExpectEq(1, values[0].(testData).Value)
+	ExpectEq(3, values[1].(testData).Value)
+	ExpectEq(2, values[2].(testData).Value)
+}
+
 func (t *CacheTest) TestRaceCondition() {
 	var wg sync.WaitGroup
 	wg.Add(5)
@@ -0,0 +1,264 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import (
+	"container/list"
+	"fmt"
+)
+
+// Names of the eviction policies, as accepted by NewPolicy.
+const (
+	// LRUPolicy evicts the least recently used entry.
+	LRUPolicy = "lru"
+
+	// SLRUPolicy is segmented LRU: entries start in a probationary segment and
+	// move to a protected one, holding most of the cache, when they are used
+	// again. Evictions come from the probationary segment first, so a scan
+	// through more data than fits in the cache evicts only entries that were
+	// used once.
+	SLRUPolicy = "slru"
+
+	// TinyLFUPolicy is SLRU with TinyLFU admission: a new entry that would
+	// cause an eviction is only kept if it has been used more often, recently,
+	// than the entry it would evict.
+	TinyLFUPolicy = "tinylfu"
+)
+
+// The share of the cache's maximum size given to the protected segment of
+// SLRU.
+const slruProtectedShare = 0.8
+
+// Policy decides which entries a Cache evicts. A Cache calls its policy with
+// its lock held, so a policy needn't be safe for concurrent use.
+type Policy interface {
+	// Add records a new entry of the given size.
+	Add(key string, size uint64)
+
+	// Access records a use of an entry, whose size is now the given one.
+	Access(key string, size uint64)
+
+	// Remove forgets an entry that has been erased or evicted.
+	Remove(key string)
+
+	// Victim returns the entry to evict next. There is at least one entry.
+	Victim() string
+
+	// Admit says whether a new entry should be kept at the cost of evicting the
+	// supplied victim, rather than being evicted itself.
+	Admit(candidate string, victim string) bool
+
+	// Keys returns the keys of the entries, those most worth keeping first.
+	Keys() []string
+
+	// Len returns the number of entries.
+	Len() int
+}
+
+// CheckPolicy returns an error if there is no eviction policy with the
+// supplied name.
+func CheckPolicy(name string) error {
+	switch name {
+	case "", LRUPolicy, SLRUPolicy, TinyLFUPolicy:
+		return nil
+	default:
+		return fmt.Errorf("unknown eviction policy %q", name)
+	}
+}
+
+// NewPolicy returns the eviction policy with the supplied name for a cache of
+// the supplied maximum size. The empty name means LRUPolicy.
+func NewPolicy(name string, maxSize uint64) (Policy, error) {
+	if err := CheckPolicy(name); err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case SLRUPolicy:
+		return newSLRUPolicy(maxSize), nil
+	case TinyLFUPolicy:
+		return newTinyLFUPolicy(maxSize), nil
+	default:
+		return newLRUPolicy(), nil
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+// LRU
+////////////////////////////////////////////////////////////////////////
+
+type lruPolicy struct {
+	// Keys, with the least recently used at the back.
+	//
+	// INVARIANT: Each element is of type string
+	entries list.List
+
+	// INVARIANT: Contains all and only the elements of entries
+	index map[string]*list.Element
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{index: make(map[string]*list.Element)}
+}
+
+func (p *lruPolicy) Add(key string, _ uint64) {
+	p.index[key] = p.entries.PushFront(key)
+}
+
+func (p *lruPolicy) Access(key string, _ uint64) {
+	if e, ok := p.index[key]; ok {
+		p.entries.MoveToFront(e)
+	}
+}
+
+func (p *lruPolicy) Remove(key string) {
+	if e, ok := p.index[key]; ok {
+		p.entries.Remove(e)
+		delete(p.index, key)
+	}
+}
+
+func (p *lruPolicy) Victim() string {
+	return p.entries.Back().Value.(string)
+}
+
+func (p *lruPolicy) Admit(string, string) bool {
+	return true
+}
+
+func (p *lruPolicy) Keys() []string {
+	keys := make([]string, 0, len(p.index))
+	for e := p.entries.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(string))
+	}
+
+	return keys
+}
+
+func (p *lruPolicy) Len() int {
+	return len(p.index)
+}
+
+////////////////////////////////////////////////////////////////////////
+// SLRU
+////////////////////////////////////////////////////////////////////////
+
+type slruEntry struct {
+	key       string
+	size      uint64
+	protected bool
+}
+
+type slruPolicy struct {
+	// The maximum total size of the entries in the protected segment.
+	protectedMaxSize uint64
+
+	// The segments, with the least recently used entries at the back.
+	//
+	// INVARIANT: Each element is of type *slruEntry
+	// INVARIANT: protectedSize is the total size of the entries in protected
+	probation     list.List
+	protected     list.List
+	protectedSize uint64
+
+	// INVARIANT: Contains all and only the elements of probation and protected
+	index map[string]*list.Element
+}
+
+func newSLRUPolicy(maxSize uint64) *slruPolicy {
+	return &slruPolicy{
+		protectedMaxSize: uint64(float64(maxSize) * slruProtectedShare),
+		index:            make(map[string]*list.Element),
+	}
+}
+
+func (p *slruPolicy) Add(key string, size uint64) {
+	p.index[key] = p.probation.PushFront(&slruEntry{key: key, size: size})
+}
+
+func (p *slruPolicy) Access(key string, size uint64) {
+	e, ok := p.index[key]
+	if !ok {
+		return
+	}
+
+	se := e.Value.(*slruEntry)
+	if se.protected {
+		p.protectedSize = p.protectedSize - se.size + size
+		se.size = size
+		p.protected.MoveToFront(e)
+	} else {
+		// A second use promotes the entry to the protected segment.
+		p.probation.Remove(e)
+		se.size = size
+		se.protected = true
+		p.protectedSize += size
+		p.index[key] = p.protected.PushFront(se)
+	}
+
+	// Demote the least recently used protected entries back to probation, but
+	// never the one just used.
+	for p.protectedSize > p.protectedMaxSize && p.protected.Len() > 1 {
+		e = p.protected.Back()
+		se = e.Value.(*slruEntry)
+		p.protected.Remove(e)
+		p.protectedSize -= se.size
+		se.protected = false
+		p.index[se.key] = p.probation.PushFront(se)
+	}
+}
+
+func (p *slruPolicy) Remove(key string) {
+	e, ok := p.index[key]
+	if !ok {
+		return
+	}
+
+	se := e.Value.(*slruEntry)
+	if se.protected {
+		p.protected.Remove(e)
+		p.protectedSize -= se.size
+	} else {
+		p.probation.Remove(e)
+	}
+	delete(p.index, key)
+}
+
+func (p *slruPolicy) Victim() string {
+	if e := p.probation.Back(); e != nil {
+		return e.Value.(*slruEntry).key
+	}
+
+	return p.protected.Back().Value.(*slruEntry).key
+}
+
+func (p *slruPolicy) Admit(string, string) bool {
+	return true
+}
+
+func (p *slruPolicy) Keys() []string {
+	keys := make([]string, 0, len(p.index))
+	for _, l := range []*list.List{&p.protected, &p.probation} {
+		for e := l.Front(); e != nil; e = e.Next() {
+			keys = append(keys, e.Value.(*slruEntry).key)
+		}
+	}
+
+	return keys
+}
+
+func (p *slruPolicy) Len() int {
+	return len(p.index)
+}
@@ -0,0 +1,175 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru_test
+
+import (
+	"fmt"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
+	. "github.com/jacobsa/ogletest"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Boilerplate
+////////////////////////////////////////////////////////////////////////
+
+// Entries of this size fill a cache of MaxSize ten at a time.
+const EntrySize = MaxSize / 10
+
+type PolicyTest struct {
+}
+
+func init() { RegisterTestSuite(&PolicyTest{}) }
+
+func (t *PolicyTest) SetUp(*TestInfo) {
+	locker.EnableInvariantsCheck()
+}
+
+func newCacheWithPolicy(name string) *lru.Cache {
+	policy, err := lru.NewPolicy(name, MaxSize)
+	AssertEq(nil, err)
+	return lru.NewCacheWithPolicy(MaxSize, policy)
+}
+
+// Insert entries hot0 to hot9, filling the cache, and use each of them the
+// supplied number of times.
+func fillWithHotEntries(cache *lru.Cache, uses int) {
+	for i := 0; i < 10; i++ {
+		_, err := cache.Insert(fmt.Sprintf("hot%d", i), testData{Value: int64(i), DataSize: EntrySize})
+		AssertEq(nil, err)
+	}
+
+	for u := 0; u < uses; u++ {
+		for i := 0; i < 10; i++ {
+			AssertNe(nil, cache.LookUp(fmt.Sprintf("hot%d", i)))
+		}
+	}
+}
+
+// Insert the supplied number of entries, each used only once, as a scan does.
+func scan(cache *lru.Cache, n int) {
+	for i := 0; i < n; i++ {
+		_, err := cache.Insert(fmt.Sprintf("scan%d", i), testData{Value: int64(100 + i), DataSize: EntrySize})
+		AssertEq(nil, err)
+	}
+}
+
+// Return the number of entries hot0 to hot9 still in the cache.
+func hotEntriesLeft(cache *lru.Cache) (n int) {
+	for i := 0; i < 10; i++ {
+		if cache.LookUpWithoutChangingOrder(fmt.Sprintf("hot%d", i)) != nil {
+			n++
+		}
+	}
+
+	return
+}
+
+////////////////////////////////////////////////////////////////////////
+// Test functions
+////////////////////////////////////////////////////////////////////////
+
+func (t *PolicyTest) UnknownPolicy() {
+	_, err := lru.NewPolicy("fifo", MaxSize)
+
+	ExpectNe(nil, err)
+}
+
+func (t *PolicyTest) LRUIsFlushedByScan() {
+	cache := newCacheWithPolicy(lru.LRUPolicy)
+	fillWithHotEntries(cache, 3)
+
+	scan(cache, 20)
+
+	ExpectEq(0, hotEntriesLeft(cache))
+}
+
+func (t *PolicyTest) SLRUKeepsProtectedEntriesThroughScan() {
+	cache := newCacheWithPolicy(lru.SLRUPolicy)
+	fillWithHotEntries(cache, 3)
+
+	scan(cache, 20)
+
+	// The protected segment holds 80% of the cache.
+	ExpectEq(8, hotEntriesLeft(cache))
+}
+
+func (t *PolicyTest) SLRUValuesListProtectedFirst() {
+	cache := newCacheWithPolicy(lru.SLRUPolicy)
+	scan(cache, 2)
+	_, err := cache.Insert("hot", testData{Value: 1, DataSize: EntrySize})
+	AssertEq(nil, err)
+	cache.LookUp("hot")
+
+	values := cache.Values()
+
+	AssertEq(3, len(values))
+	ExpectEq(1, values[0].(testData).Value)
+	ExpectEq(101, values[1].(testData).Value)
+	ExpectEq(100, values[2].(testData).Value)
+}
+
+func (t *PolicyTest) TinyLFURejectsScan() {
+	cache := newCacheWithPolicy(lru.TinyLFUPolicy)
+	fillWithHotEntries(cache, 3)
+
+	evicted, err := cache.Insert("scan", testData{Value: 100, DataSize: EntrySize})
+
+	AssertEq(nil, err)
+	AssertEq(1, len(evicted))
+	ExpectEq(100, evicted[0].(testData).Value)
+	ExpectEq(nil, cache.LookUpWithoutChangingOrder("scan"))
+	scan(cache, 20)
+	ExpectEq(10, hotEntriesLeft(cache))
+}
+
+func (t *PolicyTest) TinyLFUAdmitsFrequentlyUsedEntry() {
+	cache := newCacheWithPolicy(lru.TinyLFUPolicy)
+	fillWithHotEntries(cache, 3)
+
+	// Each attempt to insert the entry counts as a use of it.
+	admitted := false
+	for i := 0; i < 10 && !admitted; i++ {
+		_, err := cache.Insert("new", testData{Value: 100, DataSize: EntrySize})
+		AssertEq(nil, err)
+		admitted = cache.LookUpWithoutChangingOrder("new") != nil
+	}
+
+	ExpectTrue(admitted)
+	ExpectEq(9, hotEntriesLeft(cache))
+}
+
+func (t *PolicyTest) LookUpObserver() {
+	cache := lru.NewCache(MaxSize)
+	var hits, misses int
+	cache.SetLookUpObserver(func(hit bool) {
+		if hit {
+			hits++
+		} else {
+			misses++
+		}
+	})
+	_, err := cache.Insert("taco", testData{Value: 1, DataSize: EntrySize})
+	AssertEq(nil, err)
+
+	cache.LookUp("taco")
+	cache.LookUp("taco")
+	cache.LookUp("burrito")
+	cache.LookUpWithoutChangingOrder("burrito")
+
+	ExpectEq(2, hits)
+	ExpectEq(1, misses)
+}
@@ -0,0 +1,131 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lru
+
+import (
+	"hash/maphash"
+)
+
+// The bounds on the number of counters in each row of the frequency sketch.
+// The sketch starts small, since many caches, such as those of the types of
+// the entries of a directory, hold only a few entries, and grows with the
+// number of entries.
+const (
+	minSketchWidth = 64
+	maxSketchWidth = 1 << 16
+)
+
+// The number of rows of the frequency sketch, and the largest count it keeps.
+const (
+	sketchDepth    = 4
+	maxSketchCount = 15
+)
+
+// frequencySketch is a count-min sketch estimating how often each key has been
+// used recently. The counts are halved each time the number of uses recorded
+// reaches ten times the width, so that keys that were popular long ago don't
+// stay ahead of newly popular ones.
+type frequencySketch struct {
+	seed      maphash.Seed
+	width     uint32
+	rows      [sketchDepth][]uint8
+	additions uint32
+}
+
+func newFrequencySketch(width uint32) *frequencySketch {
+	s := &frequencySketch{
+		seed:  maphash.MakeSeed(),
+		width: width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+
+	return s
+}
+
+// Return the index of the key's counter in each row.
+func (s *frequencySketch) indexes(key string) (idx [sketchDepth]uint32) {
+	h := maphash.String(s.seed, key)
+	lo, hi := uint32(h), uint32(h>>32)
+	for i := range idx {
+		idx[i] = (lo + uint32(i)*hi) & (s.width - 1)
+	}
+
+	return
+}
+
+func (s *frequencySketch) increment(key string) {
+	for i, j := range s.indexes(key) {
+		if s.rows[i][j] < maxSketchCount {
+			s.rows[i][j]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= 10*s.width {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] /= 2
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *frequencySketch) estimate(key string) uint8 {
+	est := uint8(maxSketchCount)
+	for i, j := range s.indexes(key) {
+		est = min(est, s.rows[i][j])
+	}
+
+	return est
+}
+
+// tinyLFUPolicy is an SLRU policy that only admits a new entry if the sketch
+// estimates that it is used more often than the entry it would evict, so that
+// entries used once, as in a scan, don't displace those in regular use.
+type tinyLFUPolicy struct {
+	*slruPolicy
+	sketch *frequencySketch
+}
+
+func newTinyLFUPolicy(maxSize uint64) *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		slruPolicy: newSLRUPolicy(maxSize),
+		sketch:     newFrequencySketch(minSketchWidth),
+	}
+}
+
+func (p *tinyLFUPolicy) Add(key string, size uint64) {
+	p.slruPolicy.Add(key, size)
+
+	// Grow the sketch to keep its estimates accurate as the number of entries
+	// grows, starting its counts afresh.
+	if n := uint32(p.Len()); 4*n > p.sketch.width && p.sketch.width < maxSketchWidth {
+		p.sketch = newFrequencySketch(2 * p.sketch.width)
+	}
+
+	p.sketch.increment(key)
+}
+
+func (p *tinyLFUPolicy) Access(key string, size uint64) {
+	p.slruPolicy.Access(key, size)
+	p.sketch.increment(key)
+}
+
+func (p *tinyLFUPolicy) Admit(candidate string, victim string) bool {
+	return p.sketch.estimate(candidate) > p.sketch.estimate(victim)
+}
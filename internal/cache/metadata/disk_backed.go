@@ -0,0 +1,177 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// NewDiskBackedStatCache returns a stat cache that writes the entries of the
+// wrapped one through to the disk cache, keyed under the supplied bucket name
+// by their names in the bucket, which are those the wrapped cache has with the
+// supplied prefix (that of --only-dir, if any), and that falls back to the disk cache when the wrapped one misses, copying
+// the entry found there back into the wrapped one. Entries keep the expiration
+// time they were inserted with.
+//
+// As in the wrapped cache, an entry for an object is never replaced by one for
+// an older generation, or metadata generation, of the object, so a stale
+// listing can't undo what a later mount learned.
+func NewDiskBackedStatCache(wrapped StatCache, disk *DiskCache, bucketName string, objectPrefix string) StatCache {
+	return &diskBackedStatCache{
+		wrapped:      wrapped,
+		disk:         disk,
+		prefix:       "s:" + bucketName + "/" + objectPrefix,
+		objectPrefix: objectPrefix,
+	}
+}
+
+type diskBackedStatCache struct {
+	wrapped      StatCache
+	disk         *DiskCache
+	prefix       string
+	objectPrefix string
+}
+
+func (sc *diskBackedStatCache) Insert(m *gcs.MinObject, expiration time.Time) {
+	sc.wrapped.Insert(m, expiration)
+
+	// Records hold the names in the bucket too.
+	stored := *m
+	stored.Name = sc.objectPrefix + m.Name
+	sc.disk.put(diskRecord{Key: sc.prefix + m.Name, Expiration: expiration, Object: &stored})
+}
+
+func (sc *diskBackedStatCache) AddNegativeEntry(name string, expiration time.Time) {
+	sc.wrapped.AddNegativeEntry(name, expiration)
+	sc.disk.put(diskRecord{Key: sc.prefix + name, Expiration: expiration})
+}
+
+func (sc *diskBackedStatCache) Erase(name string) {
+	sc.wrapped.Erase(name)
+	sc.disk.erase(sc.prefix + name)
+}
+
+func (sc *diskBackedStatCache) LookUp(name string, now time.Time) (bool, *gcs.MinObject) {
+	if hit, m := sc.wrapped.LookUp(name, now); hit {
+		return hit, m
+	}
+
+	rec, ok := sc.lookUpOnDisk(name, now)
+	return ok, rec.Object
+}
+
+func (sc *diskBackedStatCache) InsertFolder(f *gcs.Folder, expiration time.Time) {
+	sc.wrapped.InsertFolder(f, expiration)
+
+	stored := *f
+	stored.Name = sc.objectPrefix + f.Name
+	sc.disk.put(diskRecord{Key: sc.prefix + f.Name, Expiration: expiration, Folder: &stored})
+}
+
+func (sc *diskBackedStatCache) LookUpFolder(folderName string, now time.Time) (bool, *gcs.Folder) {
+	if hit, f := sc.wrapped.LookUpFolder(folderName, now); hit {
+		return hit, f
+	}
+
+	rec, ok := sc.lookUpOnDisk(folderName, now)
+	return ok, rec.Folder
+}
+
+func (sc *diskBackedStatCache) AddNegativeEntryForFolder(folderName string, expiration time.Time) {
+	sc.wrapped.AddNegativeEntryForFolder(folderName, expiration)
+	sc.disk.put(diskRecord{Key: sc.prefix + folderName, Expiration: expiration})
+}
+
+func (sc *diskBackedStatCache) EraseEntriesWithGivenPrefix(prefix string) {
+	sc.wrapped.EraseEntriesWithGivenPrefix(prefix)
+	sc.disk.eraseWithPrefix(sc.prefix + prefix)
+}
+
+// Return the unexpired record on disk for the supplied name, if any, with the
+// names in it made relative to the object prefix, after copying it into the
+// wrapped cache.
+func (sc *diskBackedStatCache) lookUpOnDisk(name string, now time.Time) (rec diskRecord, ok bool) {
+	rec, ok = sc.disk.get(sc.prefix + name)
+	if !ok || rec.Expiration.Before(now) {
+		return diskRecord{}, false
+	}
+
+	if rec.Object != nil {
+		rec.Object.Name = name
+	}
+	if rec.Folder != nil {
+		rec.Folder.Name = name
+	}
+
+	switch {
+	case rec.Folder != nil:
+		sc.wrapped.InsertFolder(rec.Folder, rec.Expiration)
+	case rec.Object != nil:
+		sc.wrapped.Insert(rec.Object, rec.Expiration)
+	default:
+		sc.wrapped.AddNegativeEntry(name, rec.Expiration)
+	}
+
+	return rec, true
+}
+
+// NewDiskBackedTypeCache returns a type cache that writes the entries of the
+// wrapped one, which has the supplied TTL, through to the disk cache, keyed
+// under the supplied prefix, which should be the bucket name and the name in
+// the bucket of the directory, and that falls back to the disk cache when the
+// wrapped one misses.
+//
+// Entries found on disk aren't copied back into the wrapped cache, since that
+// would extend their expiration.
+func NewDiskBackedTypeCache(wrapped TypeCache, disk *DiskCache, prefix string, ttl time.Duration) TypeCache {
+	return &diskBackedTypeCache{
+		wrapped: wrapped,
+		disk:    disk,
+		prefix:  "t:" + prefix,
+		ttl:     ttl,
+	}
+}
+
+type diskBackedTypeCache struct {
+	wrapped TypeCache
+	disk    *DiskCache
+	prefix  string
+	ttl     time.Duration
+}
+
+func (tc *diskBackedTypeCache) Insert(now time.Time, name string, it Type) {
+	tc.wrapped.Insert(now, name, it)
+	tc.disk.put(diskRecord{Key: tc.prefix + name, Expiration: now.Add(tc.ttl), Type: it})
+}
+
+func (tc *diskBackedTypeCache) Erase(name string) {
+	tc.wrapped.Erase(name)
+	tc.disk.erase(tc.prefix + name)
+}
+
+func (tc *diskBackedTypeCache) Get(now time.Time, name string) Type {
+	if it := tc.wrapped.Get(now, name); it != UnknownType {
+		return it
+	}
+
+	rec, ok := tc.disk.get(tc.prefix + name)
+	if !ok || rec.Expiration.Before(now) {
+		return UnknownType
+	}
+
+	return rec.Type
+}
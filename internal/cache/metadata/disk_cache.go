@@ -0,0 +1,553 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// DiskCacheFileName is the name of the file in which a DiskCache keeps its
+// entries.
+const DiskCacheFileName = "metadata.log"
+
+// DiskCacheLockFileName is the name of the file that a DiskCache keeps locked
+// while it is open, so that no two mounts use the same log.
+const DiskCacheLockFileName = "metadata.lock"
+
+// ErrDiskCacheInUse is returned by OpenDiskCache if another process has the
+// disk cache open.
+var ErrDiskCacheInUse = errors.New("the metadata disk cache is in use by another process")
+
+// The log isn't compacted until it has grown at least this large.
+const minCompactionBytes = 1 << 20
+
+// Records are written to the log in batches, when this many bytes of them are
+// pending or, failing that, this often.
+const (
+	maxPendingBytes   = 64 << 10
+	diskFlushInterval = time.Second
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// DiskCache is a second tier for the stat and type caches, which keeps their
+// entries in a file on local disk so that they survive the mount and the next
+// mount starts warm. See NewDiskBackedStatCache and NewDiskBackedTypeCache.
+//
+// The file is a log of records, one per line, each prefixed with its CRC32C
+// checksum. The log is replayed when the cache is opened, stopping at the first
+// record that is torn or corrupt, so a crash loses at most the records written
+// last. Records are appended in batches, in the background, so writing an
+// entry through doesn't wait for the disk. The log is compacted into a new file, which is then renamed over the
+// old one, when it has grown to twice its size after the last compaction.
+//
+// The live records are indexed in memory, by location only, and the least
+// recently used of them are dropped when their total size would exceed the
+// supplied maximum.
+//
+// Only one process at a time can have the cache open.
+//
+// DiskCache is safe for concurrent use.
+type DiskCache struct {
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	path    string
+	maxSize uint64
+
+	// The lock file, held until the cache is closed.
+	lock *os.File
+
+	// Closed by Close to stop writing pending records in the background.
+	stopFlusher chan struct{}
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	mu sync.Mutex
+
+	// The log, or nil once closed.
+	//
+	// GUARDED_BY(mu)
+	f *os.File
+
+	// The size of the log, counting the pending records, and its size after
+	// the last compaction.
+	//
+	// GUARDED_BY(mu)
+	size          int64
+	compactedSize int64
+
+	// The records appended to the log that are yet to be written to the file,
+	// which holds the first written bytes of the log.
+	//
+	// INVARIANT: written + len(pending) == size
+	//
+	// GUARDED_BY(mu)
+	pending []byte
+	written int64
+
+	// The location of the live record for each key.
+	//
+	// INVARIANT: Each value is of type recordLocation
+	//
+	// GUARDED_BY(mu)
+	index *lru.Cache
+}
+
+// The location of a record in the log, and the generations of the object if
+// it is a record of one.
+type recordLocation struct {
+	key    string
+	offset int64
+	length int64
+
+	object         bool
+	generation     int64
+	metaGeneration int64
+}
+
+func (l recordLocation) Size() uint64 {
+	return uint64(l.length)
+}
+
+// A record in the log. Depending on the key, a positive stat record has an
+// object or a folder and a type record has a type. A stat record with neither
+// is a negative entry.
+type diskRecord struct {
+	Key        string         `json:"k"`
+	Expiration time.Time      `json:"e"`
+	Object     *gcs.MinObject `json:"o,omitempty"`
+	Folder     *gcs.Folder    `json:"f,omitempty"`
+	Type       Type           `json:"t,omitempty"`
+
+	// Set for a record erasing the entry for the key, or for all keys with the
+	// key as a prefix.
+	Erased      bool `json:"x,omitempty"`
+	ErasePrefix bool `json:"p,omitempty"`
+}
+
+// OpenDiskCache opens the disk cache in the supplied directory, creating it if
+// necessary, and loads the index of the entries it holds. A maxSizeBytes of
+// zero means no limit. It returns ErrDiskCacheInUse if another process has the
+// cache open.
+func OpenDiskCache(dir string, maxSizeBytes uint64) (c *DiskCache, err error) {
+	if maxSizeBytes == 0 {
+		maxSizeBytes = math.MaxUint64
+	}
+
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		err = fmt.Errorf("MkdirAll: %w", err)
+		return
+	}
+
+	c = &DiskCache{
+		path:        path.Join(dir, DiskCacheFileName),
+		maxSize:     maxSizeBytes,
+		stopFlusher: make(chan struct{}),
+		index:       lru.NewCache(maxSizeBytes),
+	}
+
+	// The lock file is never deleted, so that whoever holds its lock holds the
+	// lock of the one at the path.
+	c.lock, err = os.OpenFile(path.Join(dir, DiskCacheLockFileName), os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		err = fmt.Errorf("OpenFile: %w", err)
+		return
+	}
+
+	err = syscall.Flock(int(c.lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		c.lock.Close()
+		err = ErrDiskCacheInUse
+		return
+	}
+	if err != nil {
+		c.lock.Close()
+		err = fmt.Errorf("flock: %w", err)
+		return
+	}
+
+	c.f, err = os.OpenFile(c.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		c.lock.Close()
+		err = fmt.Errorf("OpenFile: %w", err)
+		return
+	}
+
+	if err = c.replay(); err != nil {
+		c.f.Close()
+		c.lock.Close()
+		err = fmt.Errorf("replay: %w", err)
+		return
+	}
+
+	c.compactedSize = c.size
+	go c.flushPeriodically()
+
+	logger.Infof("Loaded the metadata cache from %s (%d bytes)", c.path, c.size)
+	return
+}
+
+// Close writes the pending records and closes the log. Later operations on the
+// cache do nothing.
+func (c *DiskCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil {
+		return nil
+	}
+
+	close(c.stopFlusher)
+	c.flush()
+	err := c.f.Close()
+	c.f = nil
+
+	// Closing the lock file releases the lock.
+	if lockErr := c.lock.Close(); err == nil {
+		err = lockErr
+	}
+
+	return err
+}
+
+// Write the pending records every diskFlushInterval until the cache is closed.
+func (c *DiskCache) flushPeriodically() {
+	ticker := time.NewTicker(diskFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopFlusher:
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.Lock()
+		if c.f != nil {
+			c.flush()
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Write the pending records to the file. If that fails they are dropped, and
+// their offsets are reused by later records; get notices when a location in
+// the index no longer holds the record for its key.
+//
+// LOCKS_REQUIRED(c.mu)
+func (c *DiskCache) flush() {
+	if len(c.pending) == 0 {
+		return
+	}
+
+	if _, err := c.f.WriteAt(c.pending, c.written); err != nil {
+		logger.Warnf("Writing metadata cache records: %v", err)
+		c.size = c.written
+	} else {
+		c.written = c.size
+	}
+
+	c.pending = c.pending[:0]
+}
+
+// Build the index from the log, truncating the log after the last good record.
+func (c *DiskCache) replay() error {
+	r := bufio.NewReader(c.f)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		rec, ok := decodeRecord(line)
+		if !ok {
+			logger.Warnf("Discarding metadata cache records from offset %d of %s", offset, c.path)
+			break
+		}
+
+		c.apply(rec, offset, int64(len(line)))
+		offset += int64(len(line))
+	}
+
+	c.size = offset
+	c.written = offset
+	return c.f.Truncate(offset)
+}
+
+// Update the index for the supplied record, which is at the supplied location.
+//
+// LOCKS_REQUIRED(c.mu), unless called before c is shared
+func (c *DiskCache) apply(rec diskRecord, offset int64, length int64) {
+	switch {
+	case rec.ErasePrefix:
+		c.index.EraseEntriesWithGivenPrefix(rec.Key)
+	case rec.Erased:
+		c.index.Erase(rec.Key)
+	default:
+		loc := recordLocation{key: rec.Key, offset: offset, length: length}
+		if rec.Object != nil {
+			loc.object = true
+			loc.generation = rec.Object.Generation
+			loc.metaGeneration = rec.Object.MetaGeneration
+		}
+
+		// A record larger than the whole cache is simply not indexed.
+		_, _ = c.index.Insert(rec.Key, loc)
+	}
+}
+
+// Would the supplied record replace the one in the index for its key? An
+// object is never replaced by an older generation, or metadata generation, of
+// itself.
+//
+// LOCKS_REQUIRED(c.mu)
+func (c *DiskCache) replaces(rec diskRecord) bool {
+	if rec.Object == nil {
+		return true
+	}
+
+	val := c.index.LookUpWithoutChangingOrder(rec.Key)
+	if val == nil {
+		return true
+	}
+
+	loc := val.(recordLocation)
+	if !loc.object {
+		return true
+	}
+
+	return shouldReplace(rec.Object, entry{m: &gcs.MinObject{Generation: loc.generation, MetaGeneration: loc.metaGeneration}})
+}
+
+func encodeRecord(rec diskRecord) ([]byte, error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	line := fmt.Sprintf("%08x %s\n", crc32.Checksum(data, crcTable), data)
+	return []byte(line), nil
+}
+
+func decodeRecord(line []byte) (rec diskRecord, ok bool) {
+	if len(line) < 10 || line[8] != ' ' || line[len(line)-1] != '\n' {
+		return
+	}
+
+	var checksum uint32
+	if _, err := fmt.Sscanf(string(line[:8]), "%08x", &checksum); err != nil {
+		return
+	}
+
+	data := line[9 : len(line)-1]
+	if crc32.Checksum(data, crcTable) != checksum {
+		return
+	}
+
+	ok = json.Unmarshal(data, &rec) == nil
+	return
+}
+
+// Return the record for the supplied key, if any.
+func (c *DiskCache) get(key string) (rec diskRecord, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil {
+		return
+	}
+
+	val := c.index.LookUp(key)
+	if val == nil {
+		return
+	}
+
+	loc := val.(recordLocation)
+	line, err := c.read(loc)
+	if err != nil {
+		logger.Warnf("Reading metadata cache record: %v", err)
+		c.index.Erase(key)
+		return
+	}
+
+	rec, ok = decodeRecord(line)
+	if !ok || rec.Key != key {
+		logger.Warnf("Discarding corrupt metadata cache record for %q", key)
+		c.index.Erase(key)
+		ok = false
+	}
+
+	return
+}
+
+// Return the record at the supplied location, whether or not it has been
+// written yet.
+//
+// LOCKS_REQUIRED(c.mu)
+func (c *DiskCache) read(loc recordLocation) ([]byte, error) {
+	if loc.offset >= c.written {
+		start := loc.offset - c.written
+		if start+loc.length > int64(len(c.pending)) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return c.pending[start : start+loc.length], nil
+	}
+
+	line := make([]byte, loc.length)
+	if _, err := c.f.ReadAt(line, loc.offset); err != nil {
+		return nil, err
+	}
+
+	return line, nil
+}
+
+// Append the supplied record to the log and apply it, unless it is of an object
+// and the log has a newer generation of the object.
+func (c *DiskCache) put(rec diskRecord) {
+	line, err := encodeRecord(rec)
+	if err != nil {
+		logger.Warnf("Encoding metadata cache record: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.f == nil || !c.replaces(rec) {
+		return
+	}
+
+	c.pending = append(c.pending, line...)
+	c.apply(rec, c.size, int64(len(line)))
+	c.size += int64(len(line))
+	if len(c.pending) >= maxPendingBytes {
+		c.flush()
+	}
+
+	if c.size >= minCompactionBytes && c.size >= 2*c.compactedSize {
+		if err = c.compact(); err != nil {
+			logger.Warnf("Compacting metadata cache: %v", err)
+		}
+	}
+}
+
+func (c *DiskCache) erase(key string) {
+	c.mu.Lock()
+	indexed := c.index.LookUpWithoutChangingOrder(key) != nil
+	c.mu.Unlock()
+
+	// Erasing is frequent, so don't log it for keys that have no record.
+	if indexed {
+		c.put(diskRecord{Key: key, Erased: true})
+	}
+}
+
+func (c *DiskCache) eraseWithPrefix(prefix string) {
+	c.put(diskRecord{Key: prefix, ErasePrefix: true})
+}
+
+// Write the live, unexpired records to a new log, least recently used first so
+// that replaying it restores their order, and rename it over the old one.
+//
+// LOCKS_REQUIRED(c.mu)
+func (c *DiskCache) compact() (err error) {
+	c.flush()
+
+	tmpPath := c.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	index := lru.NewCache(c.maxSize)
+	w := bufio.NewWriter(tmp)
+	now := time.Now()
+	values := c.index.Values()
+	var offset int64
+	for i := len(values) - 1; i >= 0; i-- {
+		loc := values[i].(recordLocation)
+		// Drop the records that can't be read back, as get would.
+		line, readErr := c.read(loc)
+		if readErr != nil {
+			continue
+		}
+
+		rec, ok := decodeRecord(line)
+		if !ok || rec.Key != loc.key || rec.Expiration.Before(now) {
+			continue
+		}
+
+		if _, err = w.Write(line); err != nil {
+			return
+		}
+
+		newLoc := loc
+		newLoc.offset = offset
+		_, _ = index.Insert(loc.key, newLoc)
+		offset += loc.length
+	}
+
+	if err = w.Flush(); err != nil {
+		return
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return
+	}
+
+	if err = os.Rename(tmpPath, c.path); err != nil {
+		return
+	}
+
+	// The new log is in place, so switch to it even if closing the old one
+	// fails.
+	closeErr := c.f.Close()
+	c.f = tmp
+	c.size = offset
+	c.written = offset
+	c.compactedSize = offset
+	c.index = index
+
+	return closeErr
+}
@@ -0,0 +1,234 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metadata_test
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type DiskCacheTest struct {
+	suite.Suite
+	dir  string
+	now  time.Time
+	disk *metadata.DiskCache
+}
+
+func TestDiskCacheSuite(t *testing.T) {
+	suite.Run(t, new(DiskCacheTest))
+}
+
+func (t *DiskCacheTest) SetupTest() {
+	t.dir = t.T().TempDir()
+	t.now = time.Date(2025, 3, 4, 5, 6, 7, 0, time.UTC)
+	t.reopen(0)
+}
+
+func (t *DiskCacheTest) TearDownTest() {
+	assert.NoError(t.T(), t.disk.Close())
+}
+
+// Close the disk cache and open it again, as a new mount would.
+func (t *DiskCacheTest) reopen(maxSizeBytes uint64) {
+	if t.disk != nil {
+		require.NoError(t.T(), t.disk.Close())
+	}
+
+	var err error
+	t.disk, err = metadata.OpenDiskCache(t.dir, maxSizeBytes)
+	require.NoError(t.T(), err)
+}
+
+// Return a stat cache with an empty memory tier backed by the disk cache.
+func (t *DiskCacheTest) statCache() metadata.StatCache {
+	return metadata.NewDiskBackedStatCache(metadata.NewStatCacheBucketView(lru.NewCache(1<<20), ""), t.disk, "some_bucket", "")
+}
+
+func (t *DiskCacheTest) object(name string, generation int64) *gcs.MinObject {
+	return &gcs.MinObject{
+		Name:           name,
+		Size:           17,
+		Generation:     generation,
+		MetaGeneration: 1,
+		Updated:        t.now,
+		Metadata:       map[string]string{"foo": "bar"},
+	}
+}
+
+func (t *DiskCacheTest) TestStatEntriesSurviveReopening() {
+	sc := t.statCache()
+	sc.Insert(t.object("foo", 1), t.now.Add(time.Hour))
+	sc.AddNegativeEntry("bar", t.now.Add(time.Hour))
+	sc.InsertFolder(&gcs.Folder{Name: "dir/", UpdateTime: t.now}, t.now.Add(time.Hour))
+
+	t.reopen(0)
+	sc = t.statCache()
+
+	hit, m := sc.LookUp("foo", t.now)
+	assert.True(t.T(), hit)
+	assert.Equal(t.T(), t.object("foo", 1), m)
+	hit, m = sc.LookUp("bar", t.now)
+	assert.True(t.T(), hit)
+	assert.Nil(t.T(), m)
+	hit, f := sc.LookUpFolder("dir/", t.now)
+	assert.True(t.T(), hit)
+	assert.Equal(t.T(), &gcs.Folder{Name: "dir/", UpdateTime: t.now}, f)
+	hit, _ = sc.LookUp("baz", t.now)
+	assert.False(t.T(), hit)
+}
+
+func (t *DiskCacheTest) TestExpiredEntriesMiss() {
+	t.statCache().Insert(t.object("foo", 1), t.now.Add(time.Minute))
+
+	t.reopen(0)
+
+	hit, _ := t.statCache().LookUp("foo", t.now.Add(time.Hour))
+	assert.False(t.T(), hit)
+}
+
+func (t *DiskCacheTest) TestOlderGenerationDoesNotReplaceNewer() {
+	t.statCache().Insert(t.object("foo", 2), t.now.Add(time.Hour))
+	// A fresh memory tier, as after a remount, still doesn't let the older
+	// generation in.
+	t.statCache().Insert(t.object("foo", 1), t.now.Add(time.Hour))
+
+	t.reopen(0)
+
+	_, m := t.statCache().LookUp("foo", t.now)
+	require.NotNil(t.T(), m)
+	assert.Equal(t.T(), int64(2), m.Generation)
+}
+
+func (t *DiskCacheTest) TestErasuresSurviveReopening() {
+	sc := t.statCache()
+	sc.Insert(t.object("foo", 1), t.now.Add(time.Hour))
+	sc.Insert(t.object("dir/a", 1), t.now.Add(time.Hour))
+	sc.Insert(t.object("dir/b", 1), t.now.Add(time.Hour))
+	sc.Insert(t.object("other", 1), t.now.Add(time.Hour))
+	sc.Erase("foo")
+	sc.EraseEntriesWithGivenPrefix("dir/")
+
+	t.reopen(0)
+	sc = t.statCache()
+
+	for _, name := range []string{"foo", "dir/a", "dir/b"} {
+		hit, _ := sc.LookUp(name, t.now)
+		assert.False(t.T(), hit, name)
+	}
+	hit, _ := sc.LookUp("other", t.now)
+	assert.True(t.T(), hit)
+}
+
+func (t *DiskCacheTest) TestTornRecordIsDiscarded() {
+	t.statCache().Insert(t.object("foo", 1), t.now.Add(time.Hour))
+	require.NoError(t.T(), t.disk.Close())
+	f, err := os.OpenFile(path.Join(t.dir, metadata.DiskCacheFileName), os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t.T(), err)
+	_, err = f.WriteString(`0badf00d {"k":"s:some_bucket/bar",`)
+	require.NoError(t.T(), err)
+	require.NoError(t.T(), f.Close())
+
+	t.reopen(0)
+	t.statCache().Insert(t.object("baz", 1), t.now.Add(time.Hour))
+	t.reopen(0)
+
+	sc := t.statCache()
+	for _, name := range []string{"foo", "baz"} {
+		hit, m := sc.LookUp(name, t.now)
+		assert.True(t.T(), hit, name)
+		assert.NotNil(t.T(), m, name)
+	}
+}
+
+func (t *DiskCacheTest) TestSizeIsBounded() {
+	t.reopen(1024)
+	sc := t.statCache()
+	for i := 0; i < 100; i++ {
+		sc.Insert(t.object(fmt.Sprintf("foo%d", i), 1), t.now.Add(time.Hour))
+	}
+
+	t.reopen(1024)
+	sc = t.statCache()
+
+	hit, _ := sc.LookUp("foo0", t.now)
+	assert.False(t.T(), hit)
+	hit, _ = sc.LookUp("foo99", t.now)
+	assert.True(t.T(), hit)
+}
+
+func (t *DiskCacheTest) TestLogIsCompacted() {
+	sc := metadata.NewDiskBackedStatCache(metadata.NewStatCacheBucketView(lru.NewCache(1<<20), ""), t.disk, "some_bucket", "")
+	for i := int64(1); i <= 20000; i++ {
+		sc.Insert(t.object("foo", i), t.now.Add(time.Hour))
+	}
+
+	fi, err := os.Stat(path.Join(t.dir, metadata.DiskCacheFileName))
+	require.NoError(t.T(), err)
+	assert.Less(t.T(), fi.Size(), int64(2<<20))
+	t.reopen(0)
+	_, m := t.statCache().LookUp("foo", t.now)
+	require.NotNil(t.T(), m)
+	assert.Equal(t.T(), int64(20000), m.Generation)
+}
+
+func (t *DiskCacheTest) TestTypeEntriesSurviveReopening() {
+	tc := metadata.NewDiskBackedTypeCache(metadata.NewTypeCache(1, time.Minute), t.disk, "some_bucket/dir/", time.Minute)
+	tc.Insert(t.now, "foo", metadata.RegularFileType)
+	tc.Insert(t.now, "bar", metadata.ExplicitDirType)
+	tc.Erase("bar")
+
+	t.reopen(0)
+	tc = metadata.NewDiskBackedTypeCache(metadata.NewTypeCache(1, time.Minute), t.disk, "some_bucket/dir/", time.Minute)
+
+	assert.Equal(t.T(), metadata.RegularFileType, tc.Get(t.now, "foo"))
+	assert.Equal(t.T(), metadata.UnknownType, tc.Get(t.now, "bar"))
+	assert.Equal(t.T(), metadata.UnknownType, tc.Get(t.now.Add(time.Hour), "foo"))
+	// Another directory's entries are separate.
+	other := metadata.NewDiskBackedTypeCache(metadata.NewTypeCache(1, time.Minute), t.disk, "some_bucket/other/", time.Minute)
+	assert.Equal(t.T(), metadata.UnknownType, other.Get(t.now, "foo"))
+}
+
+func (t *DiskCacheTest) TestStatEntriesAreKeyedByNameInBucket() {
+	onlyDir := metadata.NewDiskBackedStatCache(metadata.NewStatCacheBucketView(lru.NewCache(1<<20), ""), t.disk, "some_bucket", "dir/")
+	onlyDir.Insert(t.object("foo", 1), t.now.Add(time.Hour))
+
+	t.reopen(0)
+
+	hit, _ := t.statCache().LookUp("foo", t.now)
+	assert.False(t.T(), hit)
+	hit, m := t.statCache().LookUp("dir/foo", t.now)
+	assert.True(t.T(), hit)
+	require.NotNil(t.T(), m)
+	assert.Equal(t.T(), "dir/foo", m.Name)
+	assert.Equal(t.T(), int64(1), m.Generation)
+}
+
+func (t *DiskCacheTest) TestOpenedOnlyOnce() {
+	_, err := metadata.OpenDiskCache(t.dir, 0)
+
+	assert.ErrorIs(t.T(), err, metadata.ErrDiskCacheInUse)
+	// Once closed, it can be opened again.
+	t.reopen(0)
+}
@@ -32,6 +32,7 @@ const (
 	ExplicitDirType Type = 3
 	ImplicitDirType Type = 4
 	NonexistentType Type = 5
+	SpecialFileType Type = 6
 )
 
 // TypeCache is a (name -> Type) map.
@@ -129,20 +130,45 @@ type typeCache struct {
 	entries *lru.Cache
 }
 
+// TypeCacheOptions selects the eviction policy of a type cache, and where
+// look-ups in it are reported.
+type TypeCacheOptions struct {
+	// The name of the eviction policy; see lru.NewPolicy. Empty means LRU.
+	EvictionPolicy string
+
+	// If non-nil, called with whether each look-up found an entry.
+	OnLookUp func(hit bool)
+}
+
 // NewTypeCache creates an LRU-policy-based cache with given parameters.
 // Any entry whose TTL has expired, is removed from the cache on next access (Get).
 // When insertion of next entry would cause size of cache > maxSizeMB,
 // older entries are evicted according to the LRU-policy.
 // If either of TTL or maxSizeMB is zero, nothing is ever cached.
 func NewTypeCache(maxSizeMB int64, ttl time.Duration) TypeCache {
+	return NewTypeCacheWithOptions(maxSizeMB, ttl, TypeCacheOptions{})
+}
+
+// NewTypeCacheWithOptions is like NewTypeCache, but evicts entries according to
+// the policy named in the options, falling back to LRU if there is no such
+// policy.
+func NewTypeCacheWithOptions(maxSizeMB int64, ttl time.Duration, opts TypeCacheOptions) TypeCache {
 	if ttl > 0 && maxSizeMB != 0 {
 		var lruSizeInBytesToUse uint64 = math.MaxUint64 // default for when maxSizeMB = -1
 		if maxSizeMB > 0 {
 			lruSizeInBytesToUse = util.MiBsToBytes(uint64(maxSizeMB))
 		}
+		policy, err := lru.NewPolicy(opts.EvictionPolicy, lruSizeInBytesToUse)
+		if err != nil {
+			policy, _ = lru.NewPolicy(lru.LRUPolicy, lruSizeInBytesToUse)
+		}
+		entries := lru.NewCacheWithPolicy(lruSizeInBytesToUse, policy)
+		if opts.OnLookUp != nil {
+			entries.SetLookUpObserver(opts.OnLookUp)
+		}
 		return &typeCache{
 			ttl:     ttl,
-			entries: lru.NewCache(lruSizeInBytesToUse),
+			entries: entries,
 		}
 	}
 	return &typeCache{}
@@ -40,6 +40,8 @@ const (
 	FallbackToGCSErrMsg                       = "read via gcs"
 	FileNotPresentInCacheErrMsg               = "file is not present in cache"
 	CacheHandleNotRequiredForRandomReadErrMsg = "cacheFileForRangeRead is false, read type random read and fileInfo entry is absent"
+	SharedCacheBusyErrMsg                     = "object is being cached by another process"
+	CacheAdmissionRejectedErrMsg              = "object was not admitted to the cache by its eviction policy"
 )
 
 const (
@@ -48,6 +50,7 @@ const (
 	DefaultFilePerm  = os.FileMode(0600)
 	DefaultDirPerm   = os.FileMode(0700)
 	FileCache        = "gcsfuse-file-cache"
+	MetadataCache    = "gcsfuse-metadata-cache"
 	BufferSizeForCRC = 65536
 )
 
@@ -0,0 +1,140 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Notifications of changes made to objects by other writers, so that what is
+// cached about them can be dropped without waiting for TTLs to expire.
+package changefeed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Change describes a change to an object made by some writer.
+type Change struct {
+	Bucket string
+	Name   string
+
+	// The generation the change produced, or zero if unknown or if the object
+	// was deleted.
+	Generation int64
+
+	// Whether the object, or the generation named by the notification, no
+	// longer exists.
+	Deleted bool
+}
+
+// Consumer is told about changes by a Source.
+type Consumer interface {
+	ObjectChanged(ctx context.Context, c Change)
+}
+
+// Source delivers changes to a consumer until the supplied context is
+// cancelled, returning nil in that case, or until it fails.
+type Source interface {
+	Run(ctx context.Context, consumer Consumer) error
+}
+
+// The event types of Cloud Storage Pub/Sub notifications.
+const (
+	eventFinalize       = "OBJECT_FINALIZE"
+	eventMetadataUpdate = "OBJECT_METADATA_UPDATE"
+	eventDelete         = "OBJECT_DELETE"
+	eventArchive        = "OBJECT_ARCHIVE"
+)
+
+// A Pub/Sub message, as found in pull responses and files of notifications.
+type pubsubMessage struct {
+	Attributes map[string]string `json:"attributes"`
+	Data       []byte            `json:"data"`
+}
+
+// The body of a Pub/Sub push request.
+type pushRequest struct {
+	Message *pubsubMessage `json:"message"`
+}
+
+// The JSON_API_V1 payload of a notification, which is the object resource.
+type objectPayload struct {
+	Bucket     string `json:"bucket"`
+	Name       string `json:"name"`
+	Generation string `json:"generation"`
+}
+
+// ParseNotification parses a Cloud Storage Pub/Sub notification, either as the
+// body of a push request, as a bare message or as just the object resource.
+// The change is taken from the message attributes, falling back to the object
+// resource in the payload.
+func ParseNotification(data []byte) (c Change, err error) {
+	var push pushRequest
+	if err = json.Unmarshal(data, &push); err != nil {
+		err = fmt.Errorf("parsing notification: %w", err)
+		return
+	}
+
+	msg := push.Message
+	if msg == nil {
+		msg = new(pubsubMessage)
+		if err = json.Unmarshal(data, msg); err != nil {
+			err = fmt.Errorf("parsing notification: %w", err)
+			return
+		}
+	}
+
+	attrs := msg.Attributes
+	c.Bucket = attrs["bucketId"]
+	c.Name = attrs["objectId"]
+	generation := attrs["objectGeneration"]
+	if c.Bucket == "" || c.Name == "" {
+		payloadJSON := msg.Data
+		if len(payloadJSON) == 0 {
+			payloadJSON = data
+		}
+
+		var payload objectPayload
+		if err = json.Unmarshal(payloadJSON, &payload); err != nil {
+			err = fmt.Errorf("parsing notification payload: %w", err)
+			return
+		}
+
+		c.Bucket = payload.Bucket
+		c.Name = payload.Name
+		generation = payload.Generation
+	}
+
+	if c.Bucket == "" || c.Name == "" {
+		err = errors.New("notification names no object")
+		return
+	}
+
+	switch attrs["eventType"] {
+	case eventDelete, eventArchive:
+		c.Deleted = true
+	case eventFinalize, eventMetadataUpdate, "":
+		if generation != "" {
+			c.Generation, err = strconv.ParseInt(generation, 10, 64)
+			if err != nil {
+				err = fmt.Errorf("parsing generation %q: %w", generation, err)
+				return
+			}
+		}
+	default:
+		err = fmt.Errorf("unknown event type %q", attrs["eventType"])
+	}
+
+	return
+}
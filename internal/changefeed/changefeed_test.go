@@ -0,0 +1,208 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package changefeed_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/changefeed"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// A consumer that passes on the changes it is told about.
+type chanConsumer chan changefeed.Change
+
+func (c chanConsumer) ObjectChanged(_ context.Context, change changefeed.Change) {
+	c <- change
+}
+
+func receive(t *testing.T, changes chanConsumer) changefeed.Change {
+	t.Helper()
+	select {
+	case c := <-changes:
+		return c
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a change")
+		return changefeed.Change{}
+	}
+}
+
+const pushBody = `{
+  "message": {
+    "attributes": {
+      "bucketId": "some_bucket",
+      "objectId": "dir/foo",
+      "objectGeneration": "1234",
+      "eventType": "OBJECT_FINALIZE",
+      "payloadFormat": "JSON_API_V1"
+    },
+    "data": "e30=",
+    "messageId": "1"
+  },
+  "subscription": "projects/p/subscriptions/s"
+}`
+
+func TestParseNotification(t *testing.T) {
+	testCases := []struct {
+		name     string
+		data     string
+		expected changefeed.Change
+	}{
+		{
+			name:     "PushRequest",
+			data:     pushBody,
+			expected: changefeed.Change{Bucket: "some_bucket", Name: "dir/foo", Generation: 1234},
+		},
+		{
+			name:     "Delete",
+			data:     `{"attributes": {"bucketId": "b", "objectId": "foo", "objectGeneration": "7", "eventType": "OBJECT_DELETE"}}`,
+			expected: changefeed.Change{Bucket: "b", Name: "foo", Deleted: true},
+		},
+		{
+			// The data is base64 for {"bucket":"b","name":"foo","generation":"9"}.
+			name:     "PayloadOnly",
+			data:     `{"data": "eyJidWNrZXQiOiJiIiwibmFtZSI6ImZvbyIsImdlbmVyYXRpb24iOiI5In0="}`,
+			expected: changefeed.Change{Bucket: "b", Name: "foo", Generation: 9},
+		},
+		{
+			name:     "ObjectResource",
+			data:     `{"bucket": "b", "name": "foo", "generation": "3"}`,
+			expected: changefeed.Change{Bucket: "b", Name: "foo", Generation: 3},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := changefeed.ParseNotification([]byte(tc.data))
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, c)
+		})
+	}
+}
+
+func TestParseNotification_Invalid(t *testing.T) {
+	for _, data := range []string{
+		`not json`,
+		`{}`,
+		`{"attributes": {"bucketId": "b", "objectId": "foo", "eventType": "SOMETHING_ELSE"}}`,
+	} {
+		_, err := changefeed.ParseNotification([]byte(data))
+
+		assert.Error(t, err, data)
+	}
+}
+
+func TestHTTPHandler(t *testing.T) {
+	changes := make(chanConsumer, 1)
+	server := httptest.NewServer(changefeed.NewHTTPHandler(context.Background(), changes))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL, "application/json", strings.NewReader(pushBody))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "dir/foo", receive(t, changes).Name)
+
+	resp, err = http.Post(server.URL, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notifications")
+	require.NoError(t, os.WriteFile(path, []byte(`{"bucket": "b", "name": "old"}`+"\n"), 0600))
+	changes := make(chanConsumer, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- changefeed.NewFileSource(path, time.Millisecond).Run(ctx, changes) }()
+	// Give the source time to skip the existing notification.
+	time.Sleep(50 * time.Millisecond)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"bucket": "b", "name": "new"}` + "\n" + `{"bucket": "b", "na`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	assert.Equal(t, "new", receive(t, changes).Name)
+	cancel()
+	assert.NoError(t, <-done)
+	// The incomplete line isn't consumed.
+	assert.Empty(t, changes)
+}
+
+func TestPollingSource(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+	require.NoError(t, storageutil.CreateObjects(ctx, bucket, map[string][]byte{
+		"deleted":   []byte("taco"),
+		"unchanged": []byte("taco"),
+	}))
+	changes := make(chanConsumer, 10)
+	dirs := func() []string { return []string{""} }
+	go func() { _ = changefeed.NewPollingSource(bucket, "", dirs, 10*time.Millisecond).Run(ctx, changes) }()
+	// Give the source time to take its first listing.
+	time.Sleep(50 * time.Millisecond)
+
+	created, err := storageutil.CreateObject(ctx, bucket, "created", []byte("burrito"))
+	require.NoError(t, err)
+	require.NoError(t, bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: "deleted"}))
+
+	got := map[string]changefeed.Change{}
+	for len(got) < 2 {
+		c := receive(t, changes)
+		got[c.Name] = c
+	}
+	assert.Equal(t, changefeed.Change{Bucket: "some_bucket", Name: "created", Generation: created.Generation}, got["created"])
+	assert.Equal(t, changefeed.Change{Bucket: "some_bucket", Name: "deleted", Deleted: true}, got["deleted"])
+}
+
+func TestPollingSourceListsOnlyItsDirectories(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bucket := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+	changes := make(chanConsumer, 10)
+	dirs := func() []string { return []string{"dir/"} }
+	go func() { _ = changefeed.NewPollingSource(bucket, "mnt/", dirs, 10*time.Millisecond).Run(ctx, changes) }()
+	// Give the source time to take its first listing.
+	time.Sleep(50 * time.Millisecond)
+
+	_, err := storageutil.CreateObject(ctx, bucket, "other/foo", []byte("taco"))
+	require.NoError(t, err)
+	_, err = storageutil.CreateObject(ctx, bucket, "dir/sub/foo", []byte("taco"))
+	require.NoError(t, err)
+
+	// The new child directory is reported, under the name it has in the
+	// bucket, but nothing outside the directory is.
+	assert.Equal(t, changefeed.Change{Bucket: "some_bucket", Name: "mnt/dir/sub/"}, receive(t, changes))
+	time.Sleep(50 * time.Millisecond)
+	assert.Empty(t, changes)
+}
@@ -0,0 +1,111 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package changefeed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+)
+
+// NewFileSource returns a source that follows a local file to which another
+// process appends notifications, one JSON document per line, checking for
+// more at the supplied interval. Notifications already in the file when the
+// source starts are skipped, and the file is read from the start again if it
+// is truncated.
+func NewFileSource(path string, pollInterval time.Duration) Source {
+	return &fileSource{path: path, pollInterval: pollInterval}
+}
+
+type fileSource struct {
+	path         string
+	pollInterval time.Duration
+}
+
+func (s *fileSource) Run(ctx context.Context, consumer Consumer) error {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("Seek: %w", err)
+	}
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		offset, err = readNotifications(ctx, f, offset, consumer)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Pass the complete lines of the file after the supplied offset to the
+// consumer, returning the offset of the first byte not consumed.
+func readNotifications(ctx context.Context, f *os.File, offset int64, consumer Consumer) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return offset, fmt.Errorf("Stat: %w", err)
+	}
+
+	if fi.Size() < offset {
+		offset = 0
+	}
+
+	data := make([]byte, fi.Size()-offset)
+	n, err := f.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return offset, fmt.Errorf("ReadAt: %w", err)
+	}
+
+	data = data[:n]
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return offset, nil
+		}
+
+		line := bytes.TrimSpace(data[:i])
+		data = data[i+1:]
+		offset += int64(i + 1)
+		if len(line) == 0 {
+			continue
+		}
+
+		c, err := ParseNotification(line)
+		if err != nil {
+			logger.Warnf("Ignoring change notification: %v", err)
+			continue
+		}
+
+		consumer.ObjectChanged(ctx, c)
+	}
+}
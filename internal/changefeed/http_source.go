@@ -0,0 +1,102 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+)
+
+// The largest notification body accepted over HTTP.
+const maxNotificationBytes = 1 << 20
+
+// NewHTTPSource returns a source that listens on the supplied address for
+// notifications POSTed to it, as by a Pub/Sub push subscription.
+//
+// Notifications aren't authenticated, so unless the address names a host the
+// source listens on the loopback interface only, for a relay on the same
+// machine to forward them to. Listening on any other interface is warned about.
+func NewHTTPSource(addr string) Source {
+	return &httpSource{addr: addr}
+}
+
+type httpSource struct {
+	addr string
+}
+
+func (s *httpSource) Run(ctx context.Context, consumer Consumer) error {
+	host, port, err := net.SplitHostPort(s.addr)
+	if err != nil {
+		return err
+	}
+
+	if host == "" {
+		host = "127.0.0.1"
+	} else if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		logger.Warnf("Accepting unauthenticated change notifications from the network on %s", s.addr)
+	}
+
+	l, err := net.Listen("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: NewHTTPHandler(ctx, consumer)}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	logger.Infof("Listening for change notifications on %s", l.Addr())
+	err = server.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	return err
+}
+
+// NewHTTPHandler returns a handler that passes the notification POSTed in each
+// request to the consumer. Notifications that can't be parsed are rejected
+// with 400 Bad Request.
+func NewHTTPHandler(ctx context.Context, consumer Consumer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxNotificationBytes))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		c, err := ParseNotification(body)
+		if err != nil {
+			logger.Warnf("Ignoring change notification: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		consumer.ObjectChanged(ctx, c)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
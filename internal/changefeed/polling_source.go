@@ -0,0 +1,121 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package changefeed
+
+import (
+	"context"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// NewPollingSource returns a source for buckets without notifications, which
+// at the supplied interval lists the directories returned by dirs, one level
+// deep, and reports the objects and child directories in them that were
+// created, modified or deleted since the previous listing of the directory.
+// Nothing is reported for the first listing of a directory. A listing that
+// fails is logged and retried at the next interval.
+//
+// dirs should return the directories that something is cached about, as
+// prefixes ending in a slash or the empty string for the root, so that the
+// rest of the bucket isn't listed needlessly. The names reported have the
+// supplied objectPrefix, that of the bucket's view the directories are in, so
+// that, as in notifications, they are names in the bucket.
+func NewPollingSource(bucket gcs.Bucket, objectPrefix string, dirs func() []string, interval time.Duration) Source {
+	return &pollingSource{bucket: bucket, objectPrefix: objectPrefix, dirs: dirs, interval: interval}
+}
+
+type pollingSource struct {
+	bucket       gcs.Bucket
+	objectPrefix string
+	dirs         func() []string
+	interval     time.Duration
+}
+
+// The version of an object seen by a listing. Child directories have the zero
+// version.
+type objectVersion struct {
+	generation     int64
+	metaGeneration int64
+}
+
+func (s *pollingSource) Run(ctx context.Context, consumer Consumer) error {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	// The previous listing of each directory.
+	prev := make(map[string]map[string]objectVersion)
+	for {
+		cur := make(map[string]map[string]objectVersion)
+		for _, dir := range s.dirs() {
+			versions, err := s.list(ctx, dir)
+			if err != nil {
+				logger.Warnf("Polling %q for changes: %v", s.bucket.Name(), err)
+				versions = prev[dir]
+			} else if prevVersions, ok := prev[dir]; ok {
+				s.diff(ctx, prevVersions, versions, consumer)
+			}
+
+			if versions != nil {
+				cur[dir] = versions
+			}
+		}
+		prev = cur
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *pollingSource) list(ctx context.Context, dir string) (map[string]objectVersion, error) {
+	versions := make(map[string]objectVersion)
+	req := &gcs.ListObjectsRequest{Prefix: dir, Delimiter: "/"}
+	for {
+		listing, err := s.bucket.ListObjects(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, o := range listing.MinObjects {
+			versions[o.Name] = objectVersion{generation: o.Generation, metaGeneration: o.MetaGeneration}
+		}
+		for _, p := range listing.CollapsedRuns {
+			versions[p] = objectVersion{}
+		}
+
+		if listing.ContinuationToken == "" {
+			return versions, nil
+		}
+		req.ContinuationToken = listing.ContinuationToken
+	}
+}
+
+func (s *pollingSource) diff(ctx context.Context, prev map[string]objectVersion, cur map[string]objectVersion, consumer Consumer) {
+	for name, v := range cur {
+		if old, ok := prev[name]; !ok || old != v {
+			consumer.ObjectChanged(ctx, Change{Bucket: s.bucket.Name(), Name: s.objectPrefix + name, Generation: v.generation})
+		}
+	}
+
+	for name := range prev {
+		if _, ok := cur[name]; !ok {
+			consumer.ObjectChanged(ctx, Change{Bucket: s.bucket.Name(), Name: s.objectPrefix + name, Deleted: true})
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/changefeed"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// A source that hands over the consumer it is run with, so that tests can
+// deliver changes directly.
+type captureSource struct {
+	consumers chan changefeed.Consumer
+}
+
+func (s *captureSource) Run(ctx context.Context, consumer changefeed.Consumer) error {
+	s.consumers <- consumer
+	<-ctx.Done()
+	return nil
+}
+
+// A notifier that records the invalidations sent to the kernel.
+type recordingNotifier struct {
+	calls chan string
+}
+
+func (n *recordingNotifier) InvalidateEntry(parent fuseops.InodeID, name string) error {
+	n.calls <- fmt.Sprintf("entry %d %s", parent, name)
+	return nil
+}
+
+func (n *recordingNotifier) InvalidateInode(inode fuseops.InodeID, offset int64, length int64) error {
+	n.calls <- fmt.Sprintf("inode %d", inode)
+	return nil
+}
+
+type ChangeFeedTest struct {
+	suite.Suite
+	ctx           context.Context
+	bucket        gcs.Bucket
+	bucketManager *fakeBucketManager
+	notifier      *recordingNotifier
+	consumer      changefeed.Consumer
+	fs            fuseutil.FileSystem
+}
+
+func TestChangeFeedSuite(t *testing.T) {
+	suite.Run(t, new(ChangeFeedTest))
+}
+
+func (t *ChangeFeedTest) SetupTest() {
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+	t.bucketManager = &fakeBucketManager{
+		buckets:                  map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+		chunkTransferTimeoutSecs: 10,
+		tmpObjectPrefix:          ".gcsfuse_tmp/",
+	}
+	t.mount("")
+}
+
+// Create the file system, mounting the supplied directory of the bucket, or all
+// of it if empty. The fake bucket manager doesn't hide the rest of the bucket,
+// so the objects to be seen under the directory are to be created without its
+// prefix.
+func (t *ChangeFeedTest) mount(onlyDir string) {
+	var err error
+	t.notifier = &recordingNotifier{calls: make(chan string, 10)}
+	source := &captureSource{consumers: make(chan changefeed.Consumer, 1)}
+
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	serverCfg := &fs.ServerConfig{
+		CacheClock:             &clock,
+		BucketManager:          t.bucketManager,
+		BucketName:             t.bucket.Name(),
+		RenameDirLimit:         RenameDirLimit,
+		SequentialReadSizeMb:   SequentialReadSizeMb,
+		InodeAttributeCacheTTL: time.Minute,
+		DirTypeCacheTTL:        time.Minute,
+		NewConfig: &cfg.Config{
+			OnlyDir:   onlyDir,
+			FileCache: defaultFileCacheConfig(),
+			MetadataCache: cfg.MetadataCacheConfig{
+				StatCacheMaxSizeMb: 32,
+				TtlSecs:            60,
+				TypeCacheMaxSizeMb: 4,
+			},
+		},
+		MetricHandle:  common.NewNoopMetrics(),
+		FilePerms:     filePerms,
+		DirPerms:      dirPerms,
+		ChangeSources: []changefeed.Source{source},
+		Notifier:      t.notifier,
+	}
+
+	t.fs, err = fs.NewFileSystem(t.ctx, serverCfg)
+	require.NoError(t.T(), err)
+	t.consumer = <-source.consumers
+}
+
+func (t *ChangeFeedTest) TearDownTest() {
+	t.fs.Destroy()
+}
+
+func (t *ChangeFeedTest) lookUp(parent fuseops.InodeID, name string) (*fuseops.LookUpInodeOp, error) {
+	op := &fuseops.LookUpInodeOp{Parent: parent, Name: name}
+	err := t.fs.LookUpInode(t.ctx, op)
+	return op, err
+}
+
+func (t *ChangeFeedTest) TestDeletedObjectIsForgotten() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("taco"))
+	require.NoError(t.T(), err)
+	op, err := t.lookUp(fuseops.RootInodeID, "foo")
+	require.NoError(t.T(), err)
+	require.NoError(t.T(), t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "foo"}))
+
+	t.consumer.ObjectChanged(t.ctx, changefeed.Change{Bucket: t.bucket.Name(), Name: "foo", Deleted: true})
+
+	assert.Equal(t.T(), []string{"some_bucket/foo"}, t.bucketManager.statCacheInvalidations)
+	assert.Equal(t.T(), fmt.Sprintf("entry %d foo", fuseops.RootInodeID), <-t.notifier.calls)
+	assert.Equal(t.T(), fmt.Sprintf("inode %d", op.Entry.Child), <-t.notifier.calls)
+	_, err = t.lookUp(fuseops.RootInodeID, "foo")
+	assert.ErrorIs(t.T(), err, syscall.ENOENT)
+}
+
+func (t *ChangeFeedTest) TestNewObjectInDirectory() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "dir/", nil)
+	require.NoError(t.T(), err)
+	dirOp, err := t.lookUp(fuseops.RootInodeID, "dir")
+	require.NoError(t.T(), err)
+
+	t.consumer.ObjectChanged(t.ctx, changefeed.Change{Bucket: t.bucket.Name(), Name: "dir/foo", Generation: 1})
+
+	// Only the entry in the object's own directory is dropped from the kernel.
+	assert.Equal(t.T(), fmt.Sprintf("entry %d foo", dirOp.Entry.Child), <-t.notifier.calls)
+	assert.Empty(t.T(), t.notifier.calls)
+}
+
+func (t *ChangeFeedTest) TestOtherBucketIgnored() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("taco"))
+	require.NoError(t.T(), err)
+	_, err = t.lookUp(fuseops.RootInodeID, "foo")
+	require.NoError(t.T(), err)
+
+	t.consumer.ObjectChanged(t.ctx, changefeed.Change{Bucket: "other_bucket", Name: "foo", Deleted: true})
+
+	assert.Empty(t.T(), t.notifier.calls)
+}
+
+func (t *ChangeFeedTest) TestOnlyDirPrefixIsStripped() {
+	t.fs.Destroy()
+	t.mount("dir")
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("taco"))
+	require.NoError(t.T(), err)
+	op, err := t.lookUp(fuseops.RootInodeID, "foo")
+	require.NoError(t.T(), err)
+
+	// Outside the mounted directory.
+	t.consumer.ObjectChanged(t.ctx, changefeed.Change{Bucket: t.bucket.Name(), Name: "foo", Deleted: true})
+	assert.Empty(t.T(), t.notifier.calls)
+	assert.Empty(t.T(), t.bucketManager.statCacheInvalidations)
+
+	t.consumer.ObjectChanged(t.ctx, changefeed.Change{Bucket: t.bucket.Name(), Name: "dir/foo", Generation: 2})
+
+	assert.Equal(t.T(), []string{"some_bucket/foo"}, t.bucketManager.statCacheInvalidations)
+	assert.Equal(t.T(), fmt.Sprintf("entry %d foo", fuseops.RootInodeID), <-t.notifier.calls)
+	assert.Equal(t.T(), fmt.Sprintf("inode %d", op.Entry.Child), <-t.notifier.calls)
+}
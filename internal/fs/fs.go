@@ -19,29 +19,33 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	iofs "io/fs"
 	"math"
 	"os"
 	"path"
 	"reflect"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
 	"golang.org/x/sync/semaphore"
+	"golang.org/x/sys/unix"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file/downloader"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	cacheutil "github.com/googlecloudplatform/gcsfuse/v2/internal/cache/util"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/changefeed"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/handle"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/locker"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/policy"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/util"
 	"github.com/jacobsa/fuse"
@@ -50,6 +54,15 @@ import (
 	"github.com/jacobsa/timeutil"
 )
 
+const (
+	// How long a lock lasts unless it is renewed, when not configured.
+	defaultLockLeaseTTL = 30 * time.Second
+
+	// How often a blocking lock request retries while the lock is held by
+	// someone else.
+	lockRetryInterval = time.Second
+)
+
 type ServerConfig struct {
 	// A clock used for cache expiration. It is *not* used for inode times, for
 	// which we use the wall clock.
@@ -129,6 +142,35 @@ type ServerConfig struct {
 	NewConfig *cfg.Config
 
 	MetricHandle common.MetricHandle
+
+	// If non-nil, per-path rules overriding the stat TTL, file cache, streaming
+	// writes and read-only settings of the files they match.
+	PolicyRules *policy.Rules
+
+	// Sources of notifications of changes made by other writers, which drop
+	// what is cached about the objects changed. See fileSystem.ObjectChanged.
+	ChangeSources []changefeed.Source
+
+	// If non-zero, also poll a single mounted bucket for changes at this
+	// interval, for buckets without notifications. Only the directories that
+	// have inodes are listed.
+	ChangePollInterval time.Duration
+
+	// If non-nil, used to tell the kernel to drop its cached entries and
+	// attributes for changed objects. Pass a *fuse.Notifier to have NewServer
+	// connect it to the mount.
+	Notifier KernelNotifier
+
+	// If non-nil, directory type caches are also kept here, so that they
+	// survive the mount. It is closed when the file system is destroyed.
+	MetadataDiskCache *metadata.DiskCache
+}
+
+// KernelNotifier tells the kernel to drop what it has cached about directory
+// entries and inodes. *fuse.Notifier satisfies it.
+type KernelNotifier interface {
+	InvalidateEntry(parent fuseops.InodeID, name string) error
+	InvalidateInode(inode fuseops.InodeID, offset int64, length int64) error
 }
 
 // Create a fuse file system server according to the supplied configuration.
@@ -189,20 +231,30 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 		implicitDirInodes:          make(map[inode.Name]inode.DirInode),
 		folderInodes:               make(map[inode.Name]inode.DirInode),
 		localFileInodes:            make(map[inode.Name]inode.Inode),
+		inodesByObjectName:         make(map[string]map[fuseops.InodeID]inode.Inode),
 		handles:                    make(map[fuseops.HandleID]interface{}),
+		handleLocks:                make(map[fuseops.HandleID][]heldLock),
 		newConfig:                  serverCfg.NewConfig,
 		fileCacheHandler:           fileCacheHandler,
 		cacheFileForRangeRead:      serverCfg.NewConfig.FileCache.CacheFileForRangeRead,
 		metricHandle:               serverCfg.MetricHandle,
 		enableAtomicRenameObject:   serverCfg.NewConfig.EnableAtomicRenameObject,
 		globalMaxWriteBlocksSem:    semaphore.NewWeighted(serverCfg.NewConfig.Write.GlobalMaxBlocks),
+		policyRules:                serverCfg.PolicyRules,
+		notifier:                   serverCfg.Notifier,
+		metadataDiskCache:          serverCfg.MetadataDiskCache,
 	}
+	changeSources := serverCfg.ChangeSources
 
 	// Set up root bucket
 	var root inode.DirInode
 	if serverCfg.BucketName == "" || serverCfg.BucketName == "_" {
 		logger.Info("Set up root directory for all accessible buckets")
 		root = makeRootForAllBuckets(fs)
+
+		if serverCfg.ChangePollInterval > 0 {
+			logger.Warnf("Polling for changes isn't supported when mounting all accessible buckets.")
+		}
 	} else {
 		logger.Info("Set up root directory for bucket " + serverCfg.BucketName)
 		syncerBucket, err := fs.bucketManager.SetUpBucket(ctx, serverCfg.BucketName, false, fs.metricHandle)
@@ -210,16 +262,57 @@ func NewFileSystem(ctx context.Context, serverCfg *ServerConfig) (fuseutil.FileS
 			return nil, fmt.Errorf("SetUpBucket: %w", err)
 		}
 		root = makeRootForBucket(ctx, fs, syncerBucket)
+
+		if refresh := serverCfg.NewConfig.FileSystem.UsageRefreshIntervalSecs; refresh > 0 {
+			var usageCtx context.Context
+			usageCtx, fs.stopTrackingUsage = context.WithCancel(context.Background())
+			fs.usageTracker = gcsx.NewUsageTracker(syncerBucket)
+			go fs.usageTracker.Run(usageCtx, time.Duration(refresh)*time.Second)
+		}
+
+		if serverCfg.NewConfig.FileSystem.EnableLocks {
+			ttl := defaultLockLeaseTTL
+			if ttlSecs := serverCfg.NewConfig.FileSystem.LockLeaseTtlSecs; ttlSecs > 0 {
+				ttl = time.Duration(ttlSecs) * time.Second
+			}
+
+			fs.lockManager, err = gcsx.NewLockManager(syncerBucket, syncerBucket.TmpObjectPrefix(), ttl, timeutil.RealClock())
+			if err != nil {
+				return nil, fmt.Errorf("NewLockManager: %w", err)
+			}
+
+			var lockCtx context.Context
+			lockCtx, fs.stopRenewingLocks = context.WithCancel(context.Background())
+			go fs.lockManager.Run(lockCtx)
+		}
+
+		if serverCfg.ChangePollInterval > 0 {
+			changeSources = append(changeSources, changefeed.NewPollingSource(syncerBucket, gcsx.OnlyDirPrefix(serverCfg.NewConfig.OnlyDir), fs.dirsToPoll, serverCfg.ChangePollInterval))
+		}
 	}
 	root.Lock()
 	root.IncrementLookupCount()
 	fs.inodes[fuseops.RootInodeID] = root
+	fs.indexInodeByObjectName(root)
 	fs.implicitDirInodes[root.Name()] = root
 	fs.folderInodes[root.Name()] = root
 	root.Unlock()
 
 	// Set up invariant checking.
 	fs.mu = locker.New("FS", fs.checkInvariants)
+
+	if len(changeSources) > 0 {
+		var changeCtx context.Context
+		changeCtx, fs.stopFollowingChanges = context.WithCancel(context.Background())
+		for _, source := range changeSources {
+			go func(source changefeed.Source) {
+				if err := source.Run(changeCtx, fs); err != nil {
+					logger.Errorf("Stopped following changes: %v", err)
+				}
+			}(source)
+		}
+	}
+
 	return fs, nil
 }
 
@@ -232,12 +325,18 @@ func createFileCacheHandler(serverCfg *ServerConfig) (fileCacheHandler *file.Cac
 	} else {
 		sizeInBytes = uint64(serverCfg.NewConfig.FileCache.MaxSizeMb) * cacheutil.MiB
 	}
-	fileInfoCache := lru.NewCache(sizeInBytes)
+	evictionPolicy, err := lru.NewPolicy(serverCfg.NewConfig.FileCache.EvictionPolicy, sizeInBytes)
+	if err != nil {
+		return nil, fmt.Errorf("createFileCacheHandler: %w", err)
+	}
+	fileInfoCache := lru.NewCacheWithPolicy(sizeInBytes, evictionPolicy)
+	if serverCfg.MetricHandle != nil {
+		fileInfoCache.SetLookUpObserver(common.CacheLookUpRecorder(serverCfg.MetricHandle, "file_info", serverCfg.NewConfig.FileCache.EvictionPolicy))
+	}
 
 	cacheDir := string(serverCfg.NewConfig.CacheDir)
 	// Adding a new directory inside cacheDir to keep file-cache separate from
-	// metadata cache if and when we support storing metadata cache on disk in
-	// the future.
+	// the metadata disk cache.
 	cacheDir = path.Join(cacheDir, cacheutil.FileCache)
 
 	filePerm := cacheutil.DefaultFilePerm
@@ -250,16 +349,60 @@ func createFileCacheHandler(serverCfg *ServerConfig) (fileCacheHandler *file.Cac
 
 	jobManager := downloader.NewJobManager(fileInfoCache, filePerm, dirPerm, cacheDir, serverCfg.SequentialReadSizeMb, &serverCfg.NewConfig.FileCache, serverCfg.MetricHandle)
 	fileCacheHandler = file.NewCacheHandler(fileInfoCache, jobManager, cacheDir, filePerm, dirPerm)
+	// The options below are mutually exclusive; see validateOptionCombinations
+	// in cmd.
+	if serverCfg.NewConfig.FileCache.ChunkSizeMb > 0 {
+		fileCacheHandler.EnableChunks(serverCfg.NewConfig.FileCache.ChunkSizeMb*cacheutil.MiB, serverCfg.MetricHandle)
+	} else if serverCfg.NewConfig.FileCache.EnableSharedCache {
+		fileCacheHandler.EnableSharing(sizeInBytes)
+	} else if serverCfg.NewConfig.FileCache.PersistIndex {
+		if err = fileCacheHandler.RecoverCache(serverCfg.NewConfig.FileCache.EnableCrc); err != nil {
+			return nil, fmt.Errorf("createFileCacheHandler: %w", err)
+		}
+	}
 	return
 }
 
+// Return the name of the root inode, encoding the local names of its
+// descendants if configured to.
+func (fs *fileSystem) rootName() inode.Name {
+	if fs.newConfig.FileSystem.EncodeUnsupportedNames {
+		return inode.NewEncodedRootName("")
+	}
+
+	return inode.NewRootName("")
+}
+
+// Return how directories match names without an exact match.
+func (fs *fileSystem) nameNormalization() inode.NameNormalization {
+	switch {
+	case fs.newConfig.FileSystem.CaseInsensitiveLookup:
+		return inode.NormalizeUnicodeAndCase
+
+	case fs.newConfig.FileSystem.NormalizeUnicodeLookup:
+		return inode.NormalizeUnicode
+	}
+
+	return inode.NoNameNormalization
+}
+
+// Return the options for the type caches of directories.
+func (fs *fileSystem) typeCacheOptions() metadata.TypeCacheOptions {
+	opts := metadata.TypeCacheOptions{EvictionPolicy: fs.newConfig.MetadataCache.TypeCacheEvictionPolicy}
+	if fs.metricHandle != nil {
+		opts.OnLookUp = common.CacheLookUpRecorder(fs.metricHandle, "type", opts.EvictionPolicy)
+	}
+
+	return opts
+}
+
 func makeRootForBucket(
 	ctx context.Context,
 	fs *fileSystem,
 	syncerBucket gcsx.SyncerBucket) inode.DirInode {
 	return inode.NewDirInode(
 		fuseops.RootInodeID,
-		inode.NewRootName(""),
+		fs.rootName(),
 		fuseops.InodeAttributes{
 			Uid:  fs.uid,
 			Gid:  fs.gid,
@@ -279,13 +422,17 @@ func makeRootForBucket(
 		fs.cacheClock,
 		fs.newConfig.MetadataCache.TypeCacheMaxSizeMb,
 		fs.newConfig.EnableHns,
+		fs.nameNormalization(),
+		fs.metadataDiskCache,
+		gcsx.OnlyDirPrefix(fs.newConfig.OnlyDir),
+		fs.typeCacheOptions(),
 	)
 }
 
 func makeRootForAllBuckets(fs *fileSystem) inode.DirInode {
 	return inode.NewBaseDirInode(
 		fuseops.RootInodeID,
-		inode.NewRootName(""),
+		fs.rootName(),
 		fuseops.InodeAttributes{
 			Uid:  fs.uid,
 			Gid:  fs.gid,
@@ -460,6 +607,17 @@ type fileSystem struct {
 	// GUARDED_BY(mu)
 	localFileInodes map[inode.Name]inode.Inode
 
+	// The inodes, keyed by their names in their buckets, so that those for a
+	// changed object are found without a walk through them all. See
+	// ObjectChanged.
+	//
+	// INVARIANT: For each k/v and each value in in v, in.Name().GcsObjectName() == k
+	// INVARIANT: For each k/v and each value in in v, inodes[in.ID()] == in
+	// INVARIANT: For each in in inodes, inodesByObjectName[in.Name().GcsObjectName()][in.ID()] == in
+	//
+	// GUARDED_BY(mu)
+	inodesByObjectName map[string]map[fuseops.InodeID]inode.Inode
+
 	// The collection of live handles, keyed by handle ID.
 	//
 	// INVARIANT: All values are of type *dirHandle or *handle.FileHandle
@@ -487,11 +645,52 @@ type fileSystem struct {
 
 	metricHandle common.MetricHandle
 
+	// Per-path rules, or nil if there are none.
+	policyRules *policy.Rules
+
+	// The disk tier of the metadata caches, or nil if there is none.
+	metadataDiskCache *metadata.DiskCache
+
 	enableAtomicRenameObject bool
 
 	// Limits the max number of blocks that can be created across file system when
 	// streaming writes are enabled.
 	globalMaxWriteBlocksSem *semaphore.Weighted
+
+	// Aggregates the space used by the mounted bucket for StatFS, or nil if
+	// usage isn't tracked (the default, and always for dynamic mounts).
+	//
+	// Constant after construction; safe for concurrent access.
+	usageTracker      *gcsx.UsageTracker
+	stopTrackingUsage context.CancelFunc
+
+	// Takes advisory locks shared with other mounts of the bucket, or nil if
+	// locking isn't enabled (the default, and always for dynamic mounts).
+	//
+	// Constant after construction; safe for concurrent access.
+	lockManager       *gcsx.LockManager
+	stopRenewingLocks context.CancelFunc
+
+	// Stops the goroutines passing changes from the configured sources to
+	// ObjectChanged, or nil if there are none.
+	stopFollowingChanges context.CancelFunc
+
+	// Tells the kernel to drop its cached entries for changed objects, or nil.
+	//
+	// Constant after construction; safe for concurrent access.
+	notifier KernelNotifier
+
+	// The locks taken through each file handle, released along with the handle
+	// in case the kernel doesn't unlock them explicitly.
+	//
+	// GUARDED_BY(mu)
+	handleLocks map[fuseops.HandleID][]heldLock
+}
+
+// A lock taken through a file handle.
+type heldLock struct {
+	name  string
+	owner uint64
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -547,6 +746,48 @@ func (fs *fileSystem) checkInvariantsForLocalFileInodes() {
 	}
 }
 
+func (fs *fileSystem) checkInvariantsForInodesByObjectName() {
+	// INVARIANT: For each k/v and each value in in v, in.Name().GcsObjectName() == k
+	// INVARIANT: For each k/v and each value in in v, inodes[in.ID()] == in
+	for k, v := range fs.inodesByObjectName {
+		for _, in := range v {
+			if in.Name().GcsObjectName() != k {
+				panic(fmt.Sprintf("Unexpected name: %q vs. %q", in.Name().GcsObjectName(), k))
+			}
+
+			if fs.inodes[in.ID()] != in {
+				panic(fmt.Sprintf("Mismatch for ID %v: %v %v", in.ID(), fs.inodes[in.ID()], in))
+			}
+		}
+	}
+
+	// INVARIANT: For each in in inodes, inodesByObjectName[in.Name().GcsObjectName()][in.ID()] == in
+	for _, in := range fs.inodes {
+		if fs.inodesByObjectName[in.Name().GcsObjectName()][in.ID()] != in {
+			panic(fmt.Sprintf("inodesByObjectName mismatch: %q %v", in.Name().GcsObjectName(), in))
+		}
+	}
+}
+
+// LOCKS_REQUIRED(fs.mu)
+func (fs *fileSystem) indexInodeByObjectName(in inode.Inode) {
+	name := in.Name().GcsObjectName()
+	if fs.inodesByObjectName[name] == nil {
+		fs.inodesByObjectName[name] = make(map[fuseops.InodeID]inode.Inode)
+	}
+
+	fs.inodesByObjectName[name][in.ID()] = in
+}
+
+// LOCKS_REQUIRED(fs.mu)
+func (fs *fileSystem) unindexInodeByObjectName(in inode.Inode) {
+	name := in.Name().GcsObjectName()
+	delete(fs.inodesByObjectName[name], in.ID())
+	if len(fs.inodesByObjectName[name]) == 0 {
+		delete(fs.inodesByObjectName, name)
+	}
+}
+
 func (fs *fileSystem) checkInvariantsForFolderInodes() {
 	// INVARIANT: For each k/v, v.Name() == k
 	for k, v := range fs.folderInodes {
@@ -690,6 +931,7 @@ func (fs *fileSystem) checkInvariants() {
 	fs.checkInvariantsForImplicitDirs()
 	fs.checkInvariantsForFolderInodes()
 	fs.checkInvariantsForLocalFileInodes()
+	fs.checkInvariantsForInodesByObjectName()
 
 	//////////////////////////////////
 	// handles
@@ -718,20 +960,25 @@ func (fs *fileSystem) checkInvariants() {
 }
 
 func (fs *fileSystem) createExplicitDirInode(inodeID fuseops.InodeID, ic inode.Core) inode.Inode {
+	attrs := fuseops.InodeAttributes{
+		Uid:  fs.uid,
+		Gid:  fs.gid,
+		Mode: fs.dirMode,
+
+		// We guarantee only that directory times be "reasonable".
+		Atime: fs.mtimeClock.Now(),
+		Ctime: fs.mtimeClock.Now(),
+		Mtime: fs.mtimeClock.Now(),
+	}
+	if fs.newConfig.FileSystem.PersistPosixAttributes && ic.MinObject != nil {
+		inode.ApplyPosixMetadata(&attrs, ic.MinObject.Metadata)
+	}
+
 	in := inode.NewExplicitDirInode(
 		inodeID,
 		ic.FullName,
 		ic.MinObject,
-		fuseops.InodeAttributes{
-			Uid:  fs.uid,
-			Gid:  fs.gid,
-			Mode: fs.dirMode,
-
-			// We guarantee only that directory times be "reasonable".
-			Atime: fs.mtimeClock.Now(),
-			Ctime: fs.mtimeClock.Now(),
-			Mtime: fs.mtimeClock.Now(),
-		},
+		attrs,
 		fs.implicitDirs,
 		fs.newConfig.List.EnableEmptyManagedFolders,
 		fs.enableNonexistentTypeCache,
@@ -740,7 +987,11 @@ func (fs *fileSystem) createExplicitDirInode(inodeID fuseops.InodeID, ic inode.C
 		fs.mtimeClock,
 		fs.cacheClock,
 		fs.newConfig.MetadataCache.TypeCacheMaxSizeMb,
-		fs.newConfig.EnableHns)
+		fs.newConfig.EnableHns,
+		fs.nameNormalization(),
+		fs.metadataDiskCache,
+		gcsx.OnlyDirPrefix(fs.newConfig.OnlyDir),
+		fs.typeCacheOptions())
 
 	return in
 }
@@ -784,18 +1035,42 @@ func (fs *fileSystem) mintInode(ic inode.Core) (in inode.Inode) {
 			fs.cacheClock,
 			fs.newConfig.MetadataCache.TypeCacheMaxSizeMb,
 			fs.newConfig.EnableHns,
+			fs.nameNormalization(),
+			fs.metadataDiskCache,
+			gcsx.OnlyDirPrefix(fs.newConfig.OnlyDir),
+			fs.typeCacheOptions(),
 		)
 
 	case inode.IsSymlink(ic.MinObject):
+		attrs := fuseops.InodeAttributes{
+			Uid:  fs.uid,
+			Gid:  fs.gid,
+			Mode: fs.fileMode | os.ModeSymlink,
+		}
+		if fs.newConfig.FileSystem.PersistPosixAttributes {
+			inode.ApplyPosixMetadata(&attrs, ic.MinObject.Metadata)
+		}
 		in = inode.NewSymlinkInode(
 			id,
 			ic.FullName,
 			ic.MinObject,
-			fuseops.InodeAttributes{
-				Uid:  fs.uid,
-				Gid:  fs.gid,
-				Mode: fs.fileMode | os.ModeSymlink,
-			})
+			attrs)
+
+	case inode.IsSpecialFile(ic.MinObject):
+		attrs := fuseops.InodeAttributes{
+			Uid:  fs.uid,
+			Gid:  fs.gid,
+			Mode: fs.fileMode,
+		}
+		if fs.newConfig.FileSystem.PersistPosixAttributes {
+			inode.ApplyPosixMetadata(&attrs, ic.MinObject.Metadata)
+		}
+		in = inode.NewSpecialFileInode(
+			id,
+			ic.FullName,
+			ic.MinObject,
+			attrs,
+			ic.Bucket)
 
 	default:
 		in = inode.NewFileInode(
@@ -813,11 +1088,14 @@ func (fs *fileSystem) mintInode(ic inode.Core) (in inode.Inode) {
 			fs.mtimeClock,
 			ic.Local,
 			fs.newConfig,
-			fs.globalMaxWriteBlocksSem)
+			fs.globalMaxWriteBlocksSem,
+			fs.metricHandle)
+		in.(*inode.FileInode).SetStreamingWritesRule(fs.streamingWritesEnabled)
 	}
 
 	// Place it in our map of IDs to inodes.
 	fs.inodes[in.ID()] = in
+	fs.indexInodeByObjectName(in)
 
 	return
 }
@@ -1022,6 +1300,14 @@ func (fs *fileSystem) lookUpOrCreateChildInode(
 			return
 		}
 
+		// All links to a hard linked file share the inode of its content.
+		if fs.newConfig.FileSystem.EnableHardLinks && inode.IsHardLink(core.MinObject) {
+			core, err = fs.resolveHardLink(ctx, core)
+			if err != nil {
+				return
+			}
+		}
+
 		// Attempt to create the inode. Return if successful.
 		child = fs.lookUpOrCreateInodeIfNotStale(*core)
 		if child != nil {
@@ -1033,6 +1319,33 @@ func (fs *fileSystem) lookUpOrCreateChildInode(
 	return
 }
 
+// Return a record for the content object that the supplied hard link pointer
+// refers to.
+//
+// REQUIRES: inode.IsHardLink(link.MinObject)
+func (fs *fileSystem) resolveHardLink(
+	ctx context.Context,
+	link *inode.Core) (*inode.Core, error) {
+	target := inode.HardLinkTarget(link.MinObject)
+	m, _, err := link.Bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: target})
+
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		logger.Warnf("Hard link %q refers to missing object %q", link.FullName, target)
+		return nil, fuse.ENOENT
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("StatObject: %w", err)
+	}
+
+	return &inode.Core{
+		Bucket:    link.Bucket,
+		FullName:  inode.NewHardLinkContentName(link.FullName, target),
+		MinObject: m,
+	}, nil
+}
+
 // Look up the localFileInodes to check if a file with given name exists.
 // Return inode if it exists, else return nil.
 // LOCKS_EXCLUDED(fs.mu)
@@ -1235,6 +1548,7 @@ func (fs *fileSystem) unlockAndDecrementLookupCount(in inode.Inode, N uint64) {
 	if shouldDestroy {
 		fs.mu.Lock()
 		delete(fs.inodes, in.ID())
+		fs.unindexInodeByObjectName(in)
 
 		// Update indexes if necessary.
 		if fs.generationBackedInodes[name] == in {
@@ -1315,13 +1629,31 @@ func (fs *fileSystem) getAttributes(
 	}
 
 	// Set up the expiration time.
-	if fs.inodeAttributeCacheTTL > 0 {
-		expiration = time.Now().Add(fs.inodeAttributeCacheTTL)
+	ttl := fs.policyRules.Match(in.Name().GcsObjectName()).StatCacheTTL(fs.inodeAttributeCacheTTL)
+	if ttl > 0 {
+		expiration = time.Now().Add(ttl)
 	}
 
 	return
 }
 
+// streamingWritesEnabled reports whether writes to the named object are
+// streamed to GCS, which is the mount-wide setting unless a per-path rule
+// matching the name says otherwise.
+func (fs *fileSystem) streamingWritesEnabled(objectName string) bool {
+	return policy.Bool(fs.policyRules.Match(objectName).StreamingWrites, fs.newConfig.Write.EnableStreamingWrites)
+}
+
+// checkWritable returns EROFS if a per-path rule makes the named file
+// read-only.
+func (fs *fileSystem) checkWritable(name inode.Name) error {
+	if policy.Bool(fs.policyRules.Match(name.GcsObjectName()).ReadOnly, false) {
+		return syscall.EROFS
+	}
+
+	return nil
+}
+
 // inodeOrDie returns the inode with the given ID, panicking with a helpful
 // error message if it doesn't exist.
 //
@@ -1400,31 +1732,195 @@ func (fs *fileSystem) invalidateChildFileCacheIfExist(parentInode inode.DirInode
 	return nil
 }
 
+// Return whether an object in the named bucket may be in the named mounted
+// bucket, either of which may be a union: whether they share a layer.
+func changeInBucket(changedBucketName string, mountedBucketName string) bool {
+	for _, name := range strings.Split(mountedBucketName, gcsx.UnionBucketSeparator) {
+		for _, changed := range strings.Split(changedBucketName, gcsx.UnionBucketSeparator) {
+			if name == changed {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Return the names in the mounted bucket of the directories that have inodes,
+// which are those whose entries the kernel and the type caches may hold, for
+// polling for changes.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) dirsToPoll() (dirs []string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for name, inodes := range fs.inodesByObjectName {
+		for _, in := range inodes {
+			if _, ok := in.(inode.BucketOwnedInode); ok && in.Name().IsDir() {
+				dirs = append(dirs, name)
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// ObjectChanged drops what is cached about an object that another writer has
+// changed, so that the next lookup finds the object as it now is: its stat
+// cache and file cache entries, the type cache entries of the directories
+// leading to it, and the kernel's directory entry and attributes for it.
+//
+// The change names the object by its name in the bucket, so with --only-dir it
+// is ignored unless the object is in the mounted directory.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) ObjectChanged(ctx context.Context, c changefeed.Change) {
+	logger.Tracef("Object %q in bucket %q changed", c.Name, c.Bucket)
+
+	// Names in the file system are relative to the mounted directory.
+	name, ok := strings.CutPrefix(c.Name, gcsx.OnlyDirPrefix(fs.newConfig.OnlyDir))
+	if !ok || name == "" {
+		return
+	}
+
+	// The prefix of each directory leading to the object, mapped to the name
+	// of its child on the way, and the prefix of the object's own directory.
+	childOf := make(map[string]string)
+	var parent string
+	for prefix, rest := "", name; rest != ""; {
+		child, after, isDir := strings.Cut(rest, "/")
+		childOf[prefix] = child
+		parent = prefix
+		if isDir {
+			child += "/"
+		}
+		prefix, rest = prefix+child, after
+	}
+
+	// Find the inodes for the object and for the directories leading to it,
+	// along with the names of the mounted buckets it may be in.
+	var objectInodes []inode.Inode
+	var dirInodes []inode.DirInode
+	bucketNames := map[string]bool{c.Bucket: true}
+
+	inBucket := func(in inode.Inode) bool {
+		bucketOwned, ok := in.(inode.BucketOwnedInode)
+		if !ok || !changeInBucket(c.Bucket, bucketOwned.Bucket().Name()) {
+			return false
+		}
+
+		bucketNames[bucketOwned.Bucket().Name()] = true
+		return true
+	}
+
+	fs.mu.Lock()
+	for _, in := range fs.inodesByObjectName[name] {
+		if inBucket(in) {
+			objectInodes = append(objectInodes, in)
+		}
+	}
+	for prefix := range childOf {
+		for _, in := range fs.inodesByObjectName[prefix] {
+			if in.Name().IsDir() && inBucket(in) {
+				dirInodes = append(dirInodes, in.(inode.DirInode))
+			}
+		}
+	}
+	fs.mu.Unlock()
+
+	fs.bucketManager.InvalidateStatCache(c.Bucket, name)
+
+	if fs.fileCacheHandler != nil {
+		for bucketName := range bucketNames {
+			if err := fs.fileCacheHandler.InvalidateCache(name, bucketName); err != nil {
+				logger.Warnf("ObjectChanged: %v", err)
+			}
+		}
+	}
+
+	for _, d := range dirInodes {
+		child := childOf[d.Name().GcsObjectName()]
+		d.Lock()
+		d.EraseFromTypeCache(child)
+		d.InvalidateKernelListCache()
+		d.Unlock()
+
+		// Only the entry in the object's own directory is dropped from the
+		// kernel; dropping those of the directories above would force needless
+		// lookups of them.
+		if fs.notifier != nil && d.Name().GcsObjectName() == parent {
+			if err := fs.notifier.InvalidateEntry(d.ID(), child); err != nil {
+				logger.Tracef("InvalidateEntry(%d, %q): %v", d.ID(), child, err)
+			}
+		}
+	}
+
+	if fs.notifier != nil {
+		for _, in := range objectInodes {
+			if err := fs.notifier.InvalidateInode(in.ID(), 0, 0); err != nil {
+				logger.Tracef("InvalidateInode(%d): %v", in.ID(), err)
+			}
+		}
+	}
+}
+
 ////////////////////////////////////////////////////////////////////////
 // fuse.FileSystem methods
 ////////////////////////////////////////////////////////////////////////
 
 func (fs *fileSystem) Destroy() {
+	if fs.stopTrackingUsage != nil {
+		fs.stopTrackingUsage()
+	}
+	if fs.stopRenewingLocks != nil {
+		fs.stopRenewingLocks()
+	}
+	if fs.stopFollowingChanges != nil {
+		fs.stopFollowingChanges()
+	}
 	fs.bucketManager.ShutDown()
 	if fs.fileCacheHandler != nil {
-		_ = fs.fileCacheHandler.Destroy()
+		if err := fs.fileCacheHandler.Destroy(); err != nil {
+			logger.Warnf("Destroying the file cache: %v", err)
+		}
+	}
+	if fs.metadataDiskCache != nil {
+		if err := fs.metadataDiskCache.Close(); err != nil {
+			logger.Warnf("Closing the metadata disk cache: %v", err)
+		}
 	}
 }
 
 func (fs *fileSystem) StatFS(
 	ctx context.Context,
 	op *fuseops.StatFSOp) (err error) {
-	// Simulate a large amount of free space so that the Finder doesn't refuse to
-	// copy in files. (See issue #125.) Use 2^17 as the block size because that
-	// is the largest that OS X will pass on.
+	// Unless a capacity is configured, simulate a large amount of free space so
+	// that the Finder doesn't refuse to copy in files. (See issue #125.) Use
+	// 2^17 as the block size because that is the largest that OS X will pass
+	// on.
 	op.BlockSize = 1 << 17
 	op.Blocks = 1 << 33
-	op.BlocksFree = op.Blocks
-	op.BlocksAvailable = op.Blocks
+	if capacityMb := fs.newConfig.FileSystem.CapacityMb; capacityMb > 0 {
+		op.Blocks = max(uint64(capacityMb)*cacheutil.MiB/uint64(op.BlockSize), 1)
+	}
 
 	// Similarly with inodes.
 	op.Inodes = 1 << 50
-	op.InodesFree = op.Inodes
+
+	// Report the usage found by the most recent listing, if tracked. The free
+	// counts bottom out at zero when the usage exceeds the capacity.
+	var usedBlocks, usedInodes uint64
+	if fs.usageTracker != nil {
+		usage := fs.usageTracker.Usage()
+		usedBlocks = min((usage.Bytes+uint64(op.BlockSize)-1)/uint64(op.BlockSize), op.Blocks)
+		usedInodes = min(usage.Objects, op.Inodes)
+	}
+
+	op.BlocksFree = op.Blocks - usedBlocks
+	op.BlocksAvailable = op.BlocksFree
+	op.InodesFree = op.Inodes - usedInodes
 
 	// Prefer large transfers. This is the largest value that OS X will
 	// faithfully pass on, according to fuseops/ops.go.
@@ -1535,7 +2031,29 @@ func (fs *fileSystem) SetInodeAttributes(
 		}
 	}
 
-	// We silently ignore updates to mode and atime.
+	// Persist mode, ownership and atime if configured to. Otherwise, we silently
+	// ignore them.
+	posixAttrs := inode.PosixAttributes{
+		Mode:  op.Mode,
+		Uid:   op.Uid,
+		Gid:   op.Gid,
+		Atime: op.Atime,
+	}
+	if fs.newConfig.FileSystem.PersistPosixAttributes && !posixAttrs.IsEmpty() {
+		pin, ok := in.(inode.PosixAttributesInode)
+		switch {
+		case ok:
+			err = pin.SetPosixAttributes(ctx, posixAttrs)
+		case posixAttrs.ChangesOwnershipOrMode():
+			// Implicit directories, symlinks and special files have nowhere to
+			// keep these.
+			err = syscall.ENOTSUP
+		}
+		if err != nil {
+			err = fmt.Errorf("SetPosixAttributes: %w", err)
+			return err
+		}
+	}
 
 	// Fill in the response.
 	op.Attributes, op.AttributesExpiration, err = fs.getAttributes(ctx, in)
@@ -1633,12 +2151,14 @@ func (fs *fileSystem) MkNode(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
-	if (op.Mode & (iofs.ModeNamedPipe | iofs.ModeSocket)) != 0 {
-		return syscall.ENOTSUP
-	}
 
 	// Create the child.
-	child, err := fs.createFile(ctx, op.Parent, op.Name, op.Mode)
+	var child inode.Inode
+	if inode.IsSpecialFileMode(op.Mode) {
+		child, err = fs.createSpecialFile(ctx, op.Parent, op.Name, op.Mode, op.Rdev)
+	} else {
+		child, err = fs.createFile(ctx, op.Parent, op.Name, op.Mode)
+	}
 	if err != nil {
 		return err
 	}
@@ -1704,6 +2224,52 @@ func (fs *fileSystem) createFile(
 	return
 }
 
+// Create a special file child of the parent with the given ID, returning the
+// child locked and with its lookup count incremented.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCK_FUNCTION(child)
+func (fs *fileSystem) createSpecialFile(
+	ctx context.Context,
+	parentID fuseops.InodeID,
+	name string,
+	mode os.FileMode,
+	rdev uint32) (child inode.Inode, err error) {
+	// Find the parent.
+	fs.mu.Lock()
+	parent := fs.dirInodeOrDie(parentID)
+	fs.mu.Unlock()
+
+	// Create the backing object, failing if it already exists.
+	parent.Lock()
+	result, err := parent.CreateChildSpecialFile(ctx, name, mode, rdev)
+	parent.Unlock()
+
+	// Special case: *gcs.PreconditionError means the name already exists.
+	var preconditionErr *gcs.PreconditionError
+	if errors.As(err, &preconditionErr) {
+		err = fuse.EEXIST
+		return
+	}
+
+	// Propagate other errors.
+	if err != nil {
+		err = fmt.Errorf("CreateChildSpecialFile: %w", err)
+		return
+	}
+
+	// Attempt to create a child inode using the object we created. If we fail to
+	// do so, it means someone beat us to the punch with a newer generation
+	// (unlikely, so we're probably okay with failing here).
+	child = fs.lookUpOrCreateInodeIfNotStale(*result)
+	if child == nil {
+		err = fmt.Errorf("newly-created record is already stale")
+		return
+	}
+
+	return
+}
+
 // Creates localFileInode with the given name under the parent inode.
 // LOCKS_EXCLUDED(fs.mu)
 // UNLOCK_FUNCTION(fs.mu)
@@ -1772,10 +2338,17 @@ func (fs *fileSystem) CreateFile(
 		ctx, cancel = util.IsolateContextFromParentContext(ctx)
 		defer cancel()
 	}
-	// Create the child.
-	var child inode.Inode
-	if fs.newConfig.Write.CreateEmptyFile {
-		child, err = fs.createFile(ctx, op.Parent, op.Name, op.Mode)
+	fs.mu.Lock()
+	parent := fs.dirInodeOrDie(op.Parent)
+	fs.mu.Unlock()
+	if err = fs.checkWritable(inode.NewFileName(parent.Name(), op.Name)); err != nil {
+		return err
+	}
+
+	// Create the child.
+	var child inode.Inode
+	if fs.newConfig.Write.CreateEmptyFile {
+		child, err = fs.createFile(ctx, op.Parent, op.Name, op.Mode)
 	} else {
 		child, err = fs.createLocalFile(ctx, op.Parent, op.Name)
 	}
@@ -1793,7 +2366,8 @@ func (fs *fileSystem) CreateFile(
 	fs.nextHandleID++
 
 	// Creating new file is always a write operation, hence passing readOnly as false.
-	fs.handles[handleID] = handle.NewFileHandle(child.(*inode.FileInode), fs.fileCacheHandler, fs.cacheFileForRangeRead, fs.metricHandle, false)
+	overrides := fs.policyRules.Match(child.Name().GcsObjectName())
+	fs.handles[handleID] = handle.NewFileHandle(child.(*inode.FileInode), fs.fileCacheHandler, fs.cacheFileForRangeRead, fs.metricHandle, false, overrides)
 	op.Handle = handleID
 
 	fs.mu.Unlock()
@@ -1869,6 +2443,174 @@ func (fs *fileSystem) CreateSymlink(
 	return
 }
 
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) CreateLink(
+	ctx context.Context,
+	op *fuseops.CreateLinkOp) (err error) {
+	if !fs.newConfig.FileSystem.EnableHardLinks {
+		return syscall.ENOSYS
+	}
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+	// Find the parent and the target.
+	fs.mu.Lock()
+	parent := fs.dirInodeOrDie(op.Parent)
+	target := fs.inodeOrDie(op.Target)
+	fs.mu.Unlock()
+
+	// Only regular files can be hard linked, and only within a bucket.
+	file, ok := target.(*inode.FileInode)
+	if !ok {
+		return syscall.EPERM
+	}
+	if bucketOwned, ok := parent.(inode.BucketOwnedInode); !ok || bucketOwned.Bucket().Name() != file.Bucket().Name() {
+		return syscall.EXDEV
+	}
+
+	// Write out any pending content, then make sure the content lives in a
+	// shared content object that accounts for the new link.
+	file.Lock()
+	err = fs.flushFile(ctx, file)
+	var contentObjectName string
+	if err == nil {
+		contentObjectName, err = file.ShareContentForHardLink(ctx)
+	}
+	file.Unlock()
+
+	if err != nil {
+		err = fmt.Errorf("ShareContentForHardLink: %w", err)
+		return err
+	}
+
+	// The first link replaces the file's object with a pointer, after which
+	// its name must resolve to the inode of the content object instead.
+	if !inode.IsHardLinkContent(file.Name()) {
+		fs.evictInode(file)
+	}
+
+	// Create the pointer object, failing if the name already exists.
+	parent.Lock()
+	result, err := parent.CreateChildHardLink(ctx, op.Name, contentObjectName)
+	parent.Unlock()
+
+	if err != nil {
+		// Give back the link accounted for above.
+		if releaseErr := fs.releaseHardLinkContent(ctx, file.Bucket(), file.Name(), contentObjectName); releaseErr != nil {
+			logger.Errorf("CreateLink: releasing link to %q: %v", contentObjectName, releaseErr)
+		}
+
+		// Special case: *gcs.PreconditionError means the name already exists.
+		var preconditionErr *gcs.PreconditionError
+		if errors.As(err, &preconditionErr) {
+			err = fuse.EEXIST
+			return
+		}
+
+		err = fmt.Errorf("CreateChildHardLink: %w", err)
+		return err
+	}
+
+	// The new link resolves to the inode of the content object.
+	core, err := fs.resolveHardLink(ctx, result)
+	if err != nil {
+		return err
+	}
+
+	child := fs.lookUpOrCreateInodeIfNotStale(*core)
+	if child == nil {
+		err = fmt.Errorf("newly-created record is already stale")
+		return err
+	}
+
+	defer fs.unlockAndMaybeDisposeOfInode(child, &err)
+
+	// Fill out the response.
+	e := &op.Entry
+	e.Child = child.ID()
+	e.Attributes, e.AttributesExpiration, err = fs.getAttributes(ctx, child)
+
+	if err != nil {
+		err = fmt.Errorf("getAttributes: %w", err)
+		return err
+	}
+
+	return
+}
+
+// Drop the supplied inode from the index consulted by lookups, and have the
+// kernel forget the directory entries for its name, so that the name is looked
+// up afresh. The inode itself lives on, still indexed by object name so that
+// changes to the object reach it, until the kernel forgets it.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) evictInode(in inode.Inode) {
+	name := in.Name()
+	objectName := name.GcsObjectName()
+	parentObjectName := objectName[:strings.LastIndex(strings.TrimSuffix(objectName, "/"), "/")+1]
+
+	var parents []inode.DirInode
+	fs.mu.Lock()
+	if fs.generationBackedInodes[name] == in {
+		delete(fs.generationBackedInodes, name)
+	}
+	for _, p := range fs.inodesByObjectName[parentObjectName] {
+		if d, ok := p.(inode.DirInode); ok && name.IsDirectChildOf(d.Name()) {
+			parents = append(parents, d)
+		}
+	}
+	fs.mu.Unlock()
+
+	if fs.notifier == nil {
+		return
+	}
+
+	// The kernel may hold locks on the parents for the op in progress, so the
+	// entries are invalidated once it has finished.
+	base := path.Base(name.LocalName())
+	go func() {
+		for _, d := range parents {
+			if err := fs.notifier.InvalidateEntry(d.ID(), base); err != nil {
+				logger.Tracef("InvalidateEntry(%d, %q): %v", d.ID(), base, err)
+			}
+		}
+	}()
+}
+
+// Drop a link to the named hard link content object, deleting it when no
+// links remain. link is the name of any link in the same bucket.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) releaseHardLinkContent(
+	ctx context.Context,
+	bucket *gcsx.SyncerBucket,
+	link inode.Name,
+	contentObjectName string) error {
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{
+		Name:              contentObjectName,
+		ForceFetchFromGcs: true,
+	})
+	if err != nil {
+		return fmt.Errorf("StatObject: %w", err)
+	}
+
+	in := fs.lookUpOrCreateInodeIfNotStale(inode.Core{
+		Bucket:    bucket,
+		FullName:  inode.NewHardLinkContentName(link, contentObjectName),
+		MinObject: m,
+	})
+	if in == nil {
+		return fmt.Errorf("record for %q is already stale", contentObjectName)
+	}
+	defer fs.unlockAndDecrementLookupCount(in, 1)
+
+	return in.(*inode.FileInode).DropLink(ctx)
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) RmDir(
 	// When rm -r or os.RemoveAll call is made, the following calls are made in order
@@ -2019,6 +2761,30 @@ func (fs *fileSystem) Rename(
 		}
 	}
 
+	const supportedFlags = unix.RENAME_NOREPLACE | unix.RENAME_EXCHANGE
+	if op.Flags&^supportedFlags != 0 || op.Flags&supportedFlags == supportedFlags {
+		return fmt.Errorf("rename flags %#x: %w", op.Flags, syscall.EINVAL)
+	}
+
+	// With RENAME_NOREPLACE, the target is checked up front, and every write
+	// to it is preconditioned on it not existing in case it is created in the
+	// meantime.
+	noReplace := op.Flags&unix.RENAME_NOREPLACE != 0
+	var dstGenerationPrecondition *int64
+	if noReplace {
+		dstGenerationPrecondition = new(int64)
+		defer func() {
+			var preconditionErr *gcs.PreconditionError
+			if errors.As(err, &preconditionErr) {
+				err = fmt.Errorf("rename to %q: %w", op.NewName, syscall.EEXIST)
+			}
+		}()
+
+		if err = fs.checkRenameTargetDoesNotExist(ctx, newParent, op.NewName); err != nil {
+			return err
+		}
+	}
+
 	child, err := fs.lookUpOrCreateChildInode(ctx, oldParent, op.OldName)
 	if err != nil {
 		return err
@@ -2034,13 +2800,55 @@ func (fs *fileSystem) Rename(
 		return fmt.Errorf("child inode (id %v) is not owned by any bucket", child.ID())
 	}
 
+	if op.Flags&unix.RENAME_EXCHANGE != 0 {
+		return fs.renameExchange(ctx, op, child, childBktOwned.Bucket(), oldParent, newParent)
+	}
+
 	if child.Name().IsDir() {
 		// If 'enable-hns' flag is false, the bucket type is set to 'NonHierarchical' even for HNS buckets because the control client is nil.
 		// Therefore, an additional 'enable hns' check is not required here.
 		if childBktOwned.Bucket().BucketType().Hierarchical {
-			return fs.renameHierarchicalDir(ctx, oldParent, op.OldName, newParent, op.NewName)
+			return fs.renameHierarchicalDir(ctx, oldParent, op.OldName, newParent, op.NewName, noReplace)
+		}
+		return fs.renameNonHierarchicalDir(ctx, oldParent, op.OldName, newParent, op.NewName, noReplace)
+	}
+
+	// Overwriting a hard link pointer drops the link it accounts for from its
+	// content object. Renaming a link onto another link to the same file does
+	// nothing, as with any rename between two links to the same inode.
+	if fs.newConfig.FileSystem.EnableHardLinks && !noReplace {
+		var replacedLink *inode.Core
+		if replacedLink, err = fs.lookUpHardLinkPointer(ctx, newParent, op.NewName); err != nil {
+			return err
+		}
+
+		if replacedLink != nil {
+			contentObjectName := inode.HardLinkTarget(replacedLink.MinObject)
+			if inode.IsHardLinkContent(child.Name()) && child.Name().GcsObjectName() == contentObjectName {
+				return nil
+			}
+
+			// Overwrite exactly the pointer we looked at.
+			dstGenerationPrecondition = &replacedLink.MinObject.Generation
+			defer func() {
+				if err != nil {
+					return
+				}
+				err = fs.releaseHardLinkContent(ctx, childBktOwned.Bucket(), replacedLink.FullName, contentObjectName)
+				if err != nil {
+					err = fmt.Errorf("releaseHardLinkContent: %w", err)
+				}
+			}()
 		}
-		return fs.renameNonHierarchicalDir(ctx, oldParent, op.OldName, newParent, op.NewName)
+	}
+
+	// Special files have no content, so there is nothing to flush before moving
+	// their object.
+	if special, ok := child.(*inode.SpecialFileInode); ok {
+		if (special.Bucket().BucketType().Hierarchical && fs.enableAtomicRenameObject) || special.Bucket().BucketType().Zonal {
+			return fs.renameHierarchicalFile(ctx, oldParent, op.OldName, special.Source(), newParent, op.NewName, dstGenerationPrecondition)
+		}
+		return fs.renameNonHierarchicalFile(ctx, oldParent, op.OldName, special.Source(), newParent, op.NewName, dstGenerationPrecondition)
 	}
 	childFileInode, ok := child.(*inode.FileInode)
 	if !ok {
@@ -2048,23 +2856,255 @@ func (fs *fileSystem) Rename(
 	}
 	// TODO(b/402335988): Fix rename flow for local files when streaming writes is disabled.
 	// If object to be renamed is a local file inode and streaming writes are disabled, rename operation is not supported.
-	if childFileInode.IsLocal() && !fs.newConfig.Write.EnableStreamingWrites {
+	childFileInode.Lock()
+	streamingWrites := childFileInode.StreamingWritesEnabled()
+	childFileInode.Unlock()
+	if childFileInode.IsLocal() && !streamingWrites {
 		return fmt.Errorf("cannot rename open file %q: %w", op.OldName, syscall.ENOTSUP)
 	}
-	return fs.renameFile(ctx, op, childFileInode, oldParent, newParent)
+	// The inode of a hard linked file is that of its content, which stays put.
+	// Only the pointer object for the old name moves.
+	if inode.IsHardLinkContent(childFileInode.Name()) {
+		return fs.renameHardLink(ctx, op, oldParent, newParent, dstGenerationPrecondition)
+	}
+	return fs.renameFile(ctx, op, childFileInode, oldParent, newParent, dstGenerationPrecondition)
+}
+
+// Return the record for the named child of the parent if it is a hard link
+// pointer, or nil otherwise.
+//
+// LOCKS_EXCLUDED(parent)
+func (fs *fileSystem) lookUpHardLinkPointer(ctx context.Context, parent inode.DirInode, name string) (*inode.Core, error) {
+	parent.Lock()
+	core, err := parent.LookUpChild(ctx, name)
+	parent.Unlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("LookUpChild: %w", err)
+	}
+	if core == nil || !core.FullName.IsFile() || !inode.IsHardLink(core.MinObject) {
+		return nil, nil
+	}
+
+	return core, nil
+}
+
+// Return EEXIST if the parent has a child with the supplied name, whether
+// backed by GCS or local.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(parent)
+func (fs *fileSystem) checkRenameTargetDoesNotExist(ctx context.Context, parent inode.DirInode, name string) error {
+	fs.mu.Lock()
+	_, isLocalFile := fs.localFileInodes[inode.NewFileName(parent.Name(), name)]
+	fs.mu.Unlock()
+
+	if isLocalFile {
+		return fmt.Errorf("rename to open file %q: %w", name, syscall.EEXIST)
+	}
+
+	parent.Lock()
+	core, err := parent.LookUpChild(ctx, name)
+	parent.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("LookUpChild: %w", err)
+	}
+	if core != nil {
+		return fmt.Errorf("rename to %q: %w", name, syscall.EEXIST)
+	}
+
+	return nil
+}
+
+// Swap the children named by op, which must both exist. Files are swapped
+// object by object under generation preconditions. Directories can only be
+// swapped in hierarchical buckets, where whole folders can be renamed.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(oldParent)
+// LOCKS_EXCLUDED(newParent)
+func (fs *fileSystem) renameExchange(
+	ctx context.Context,
+	op *fuseops.RenameOp,
+	oldChild inode.Inode,
+	bucket *gcsx.SyncerBucket,
+	oldParent inode.DirInode,
+	newParent inode.DirInode) error {
+	newChild, err := fs.lookUpOrCreateChildInode(ctx, newParent, op.NewName)
+	if err != nil {
+		return err
+	}
+	if newChild == nil {
+		return fuse.ENOENT
+	}
+	newChild.DecrementLookupCount(1)
+	newChild.Unlock()
+
+	if oldChild.Name().IsDir() != newChild.Name().IsDir() {
+		return fmt.Errorf("exchange file and directory: %w", syscall.ENOTSUP)
+	}
+
+	if oldChild.Name().IsDir() {
+		if !bucket.BucketType().Hierarchical {
+			return fmt.Errorf("exchange directories in a flat bucket: %w", syscall.ENOTSUP)
+		}
+		return fs.exchangeHierarchicalDirs(ctx, bucket, oldParent, op.OldName, newParent, op.NewName)
+	}
+
+	oldObject, err := fs.exchangeSource(ctx, oldChild, op.OldName)
+	if err != nil {
+		return err
+	}
+	newObject, err := fs.exchangeSource(ctx, newChild, op.NewName)
+	if err != nil {
+		return err
+	}
+
+	// Moves don't copy the contents, but are only available in the buckets
+	// that rename files atomically.
+	move := (bucket.BucketType().Hierarchical && fs.enableAtomicRenameObject) || bucket.BucketType().Zonal
+
+	oldParent.Lock()
+	defer oldParent.Unlock()
+
+	if newParent != oldParent {
+		newParent.Lock()
+		defer newParent.Unlock()
+	}
+
+	if err = gcsx.ExchangeObjects(ctx, bucket, bucket.TmpObjectPrefix(), oldObject, newObject, move); err != nil {
+		return fmt.Errorf("ExchangeObjects: %w", err)
+	}
+
+	if err = fs.invalidateChildFileCacheIfExist(oldParent, oldObject.Name); err != nil {
+		return fmt.Errorf("renameExchange: while invalidating cache for exchanged file: %w", err)
+	}
+	if err = fs.invalidateChildFileCacheIfExist(newParent, newObject.Name); err != nil {
+		return fmt.Errorf("renameExchange: while invalidating cache for exchanged file: %w", err)
+	}
+
+	return nil
+}
+
+// Return the object backing a file that is to be exchanged, flushing any
+// pending writes first.
+//
+// LOCKS_EXCLUDED(in)
+func (fs *fileSystem) exchangeSource(ctx context.Context, in inode.Inode, name string) (*gcs.MinObject, error) {
+	switch typed := in.(type) {
+	case *inode.SpecialFileInode:
+		return typed.Source(), nil
+
+	case *inode.FileInode:
+		// Hard links and local files have no object of their own under the
+		// name to exchange.
+		if typed.IsLocal() || inode.IsHardLinkContent(typed.Name()) {
+			return nil, fmt.Errorf("exchange %q: %w", name, syscall.ENOTSUP)
+		}
+
+		minObject, err := fs.flushPendingWrites(ctx, typed)
+		if err != nil {
+			return nil, fmt.Errorf("flushPendingWrites: %w", err)
+		}
+		return minObject, nil
+
+	default:
+		return nil, fmt.Errorf("exchange %q: %w", name, syscall.ENOTSUP)
+	}
+}
+
+// Swap two folders in a hierarchical bucket. If either of them has open
+// files then return ENOTSUP.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(oldParent)
+// LOCKS_EXCLUDED(newParent)
+func (fs *fileSystem) exchangeHierarchicalDirs(
+	ctx context.Context,
+	bucket *gcsx.SyncerBucket,
+	oldParent inode.DirInode,
+	oldName string,
+	newParent inode.DirInode,
+	newName string) error {
+	var pendingInodes []inode.DirInode
+	defer fs.releaseInodes(&pendingInodes)
+
+	oldDir, err := fs.getBucketDirInode(ctx, oldParent, oldName)
+	if err != nil {
+		return err
+	}
+	pendingInodes = append(pendingInodes, oldDir)
+
+	if err = fs.ensureNoLocalFilesInDirectory(oldDir, oldName); err != nil {
+		return err
+	}
+
+	newDir, err := fs.getBucketDirInode(ctx, newParent, newName)
+	if err != nil {
+		return err
+	}
+	pendingInodes = append(pendingInodes, newDir)
+
+	if err = fs.ensureNoLocalFilesInDirectory(newDir, newName); err != nil {
+		return err
+	}
+
+	oldParent.Lock()
+	defer oldParent.Unlock()
+
+	if newParent != oldParent {
+		newParent.Lock()
+		defer newParent.Unlock()
+	}
+
+	err = gcsx.ExchangeFolders(ctx, bucket, bucket.TmpObjectPrefix(), oldDir.Name().GcsObjectName(), newDir.Name().GcsObjectName())
+
+	// The stat cache is kept up to date by the bucket, but the parents' type
+	// caches must be told, even if the exchange failed part way through.
+	oldParent.EraseFromTypeCache(oldName)
+	oldParent.InvalidateKernelListCache()
+	newParent.EraseFromTypeCache(newName)
+	newParent.InvalidateKernelListCache()
+
+	if err != nil {
+		return fmt.Errorf("ExchangeFolders: %w", err)
+	}
+
+	return nil
 }
 
 // LOCKS_EXCLUDED(oldParent)
 // LOCKS_EXCLUDED(newParent)
-func (fs *fileSystem) renameFile(ctx context.Context, op *fuseops.RenameOp, oldObject *inode.FileInode, oldParent, newParent inode.DirInode) error {
+func (fs *fileSystem) renameHardLink(ctx context.Context, op *fuseops.RenameOp, oldParent, newParent inode.DirInode, dstGenerationPrecondition *int64) error {
+	oldParent.Lock()
+	core, err := oldParent.LookUpChild(ctx, op.OldName)
+	oldParent.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("LookUpChild: %w", err)
+	}
+	if core == nil || !inode.IsHardLink(core.MinObject) {
+		return fuse.ENOENT
+	}
+
+	if (core.Bucket.BucketType().Hierarchical && fs.enableAtomicRenameObject) || core.Bucket.BucketType().Zonal {
+		return fs.renameHierarchicalFile(ctx, oldParent, op.OldName, core.MinObject, newParent, op.NewName, dstGenerationPrecondition)
+	}
+	return fs.renameNonHierarchicalFile(ctx, oldParent, op.OldName, core.MinObject, newParent, op.NewName, dstGenerationPrecondition)
+}
+
+// LOCKS_EXCLUDED(oldParent)
+// LOCKS_EXCLUDED(newParent)
+func (fs *fileSystem) renameFile(ctx context.Context, op *fuseops.RenameOp, oldObject *inode.FileInode, oldParent, newParent inode.DirInode, dstGenerationPrecondition *int64) error {
 	updatedMinObject, err := fs.flushPendingWrites(ctx, oldObject)
 	if err != nil {
 		return fmt.Errorf("flushPendingWrites: %w", err)
 	}
 	if (oldObject.Bucket().BucketType().Hierarchical && fs.enableAtomicRenameObject) || oldObject.Bucket().BucketType().Zonal {
-		return fs.renameHierarchicalFile(ctx, oldParent, op.OldName, updatedMinObject, newParent, op.NewName)
+		return fs.renameHierarchicalFile(ctx, oldParent, op.OldName, updatedMinObject, newParent, op.NewName, dstGenerationPrecondition)
 	}
-	return fs.renameNonHierarchicalFile(ctx, oldParent, op.OldName, updatedMinObject, newParent, op.NewName)
+	return fs.renameNonHierarchicalFile(ctx, oldParent, op.OldName, updatedMinObject, newParent, op.NewName, dstGenerationPrecondition)
 }
 
 // LOCKS_EXCLUDED(fileInode)
@@ -2074,7 +3114,7 @@ func (fs *fileSystem) flushPendingWrites(ctx context.Context, fileInode *inode.F
 	fileInode.Lock()
 	defer fileInode.Unlock()
 	minObject = fileInode.Source()
-	if !fs.newConfig.Write.EnableStreamingWrites {
+	if !fileInode.StreamingWritesEnabled() {
 		return
 	}
 	// Try to flush if there are any pending writes.
@@ -2085,7 +3125,7 @@ func (fs *fileSystem) flushPendingWrites(ctx context.Context, fileInode *inode.F
 
 // LOCKS_EXCLUDED(oldParent)
 // LOCKS_EXCLUDED(newParent)
-func (fs *fileSystem) renameHierarchicalFile(ctx context.Context, oldParent inode.DirInode, oldName string, oldObject *gcs.MinObject, newParent inode.DirInode, newName string) error {
+func (fs *fileSystem) renameHierarchicalFile(ctx context.Context, oldParent inode.DirInode, oldName string, oldObject *gcs.MinObject, newParent inode.DirInode, newName string, dstGenerationPrecondition *int64) error {
 	oldParent.Lock()
 	defer oldParent.Unlock()
 
@@ -2096,7 +3136,7 @@ func (fs *fileSystem) renameHierarchicalFile(ctx context.Context, oldParent inod
 
 	newFileName := inode.NewFileName(newParent.Name(), newName)
 
-	if _, err := oldParent.RenameFile(ctx, oldObject, newFileName.GcsObjectName()); err != nil {
+	if _, err := oldParent.RenameFile(ctx, oldObject, newFileName.GcsObjectName(), dstGenerationPrecondition); err != nil {
 		return fmt.Errorf("renameFile: while renaming file: %w", err)
 	}
 
@@ -2118,10 +3158,11 @@ func (fs *fileSystem) renameNonHierarchicalFile(
 	oldName string,
 	oldObject *gcs.MinObject,
 	newParent inode.DirInode,
-	newFileName string) error {
+	newFileName string,
+	dstGenerationPrecondition *int64) error {
 	// Clone into the new location.
 	newParent.Lock()
-	_, err := newParent.CloneToChildFile(ctx, newFileName, oldObject)
+	_, err := newParent.CloneToChildFile(ctx, newFileName, oldObject, dstGenerationPrecondition)
 	newParent.Unlock()
 
 	if err != nil {
@@ -2191,13 +3232,13 @@ func (fs *fileSystem) checkDirNotEmpty(dir inode.BucketOwnedDirInode, name strin
 }
 
 // Rename an old folder to a new folder in a hierarchical bucket. If the new folder already
-// exists and is non-empty, return ENOTEMPTY. If old folder have open files then return
-// ENOTSUP.
+// exists and is non-empty, return ENOTEMPTY, or EEXIST if noReplace is set. If old folder
+// have open files then return ENOTSUP.
 //
 // LOCKS_EXCLUDED(fs.mu)
 // LOCKS_EXCLUDED(oldParent)
 // LOCKS_EXCLUDED(newParent)
-func (fs *fileSystem) renameHierarchicalDir(ctx context.Context, oldParent inode.DirInode, oldName string, newParent inode.DirInode, newName string) (err error) {
+func (fs *fileSystem) renameHierarchicalDir(ctx context.Context, oldParent inode.DirInode, oldName string, newParent inode.DirInode, newName string, noReplace bool) (err error) {
 	// Set up a function that throws away the lookup count increment from
 	// lookUpOrCreateChildInode (since the pending inodes are not sent back to
 	// the kernel) and unlocks the pending inodes, but only once.
@@ -2220,6 +3261,11 @@ func (fs *fileSystem) renameHierarchicalDir(ctx context.Context, oldParent inode
 	// If the call for getBucketDirInode fails it means directory does not exist.
 	newDirInode, err := fs.getBucketDirInode(ctx, newParent, newName)
 	if err == nil {
+		if noReplace {
+			pendingInodes = append(pendingInodes, newDirInode)
+			return fmt.Errorf("rename to %q: %w", newName, syscall.EEXIST)
+		}
+
 		// If the directory exists, then check if it is empty or not.
 		if err = fs.checkDirNotEmpty(newDirInode, newName); err != nil {
 			return err
@@ -2253,7 +3299,7 @@ func (fs *fileSystem) renameHierarchicalDir(ctx context.Context, oldParent inode
 }
 
 // Rename an old directory to a new directory in a non-hierarchical bucket. If the new directory already
-// exists and is non-empty, return ENOTEMPTY.
+// exists and is non-empty, return ENOTEMPTY, or EEXIST if noReplace is set.
 //
 // LOCKS_EXCLUDED(fs.mu)
 // LOCKS_EXCLUDED(oldParent)
@@ -2263,7 +3309,8 @@ func (fs *fileSystem) renameNonHierarchicalDir(
 	oldParent inode.DirInode,
 	oldName string,
 	newParent inode.DirInode,
-	newName string) error {
+	newName string,
+	noReplace bool) error {
 
 	// Set up a function that throws away the lookup count increment from
 	// lookUpOrCreateChildInode (since the pending inodes are not sent back to
@@ -2291,16 +3338,21 @@ func (fs *fileSystem) renameNonHierarchicalDir(
 	}
 
 	// Create the backing object of the new directory.
+	createdNewDir := true
 	newParent.Lock()
 	_, err = newParent.CreateChildDir(ctx, newName)
 	newParent.Unlock()
 	if err != nil {
 		var preconditionErr *gcs.PreconditionError
-		if errors.As(err, &preconditionErr) {
+		switch {
+		case !errors.As(err, &preconditionErr):
+			return fmt.Errorf("CreateChildDir: %w", err)
+		case noReplace:
+			return fmt.Errorf("rename to %q: %w", newName, syscall.EEXIST)
+		default:
 			// This means the new directory already exists, which is OK if
 			// it is empty (checked below).
-		} else {
-			return fmt.Errorf("CreateChildDir: %w", err)
+			createdNewDir = false
 		}
 	}
 
@@ -2314,20 +3366,52 @@ func (fs *fileSystem) renameNonHierarchicalDir(
 		return err
 	}
 
-	// Move all the files from the old directory to the new directory, keeping both directories locked.
-	for _, descendant := range descendants {
+	fs.mu.Lock()
+	_, isImplicitDir := fs.implicitDirInodes[oldDir.Name()]
+	fs.mu.Unlock()
+
+	// Record the planned moves, so that the rename can be recovered if we are
+	// interrupted part way through.
+	journal := &gcsx.RenameJournal{
+		OldDir:         oldDir.Name().GcsObjectName(),
+		NewDir:         newDir.Name().GcsObjectName(),
+		OldDirImplicit: isImplicitDir,
+		CreatedNewDir:  createdNewDir,
+	}
+	nameDiffs := make([]string, len(descendants))
+	for i, descendant := range descendants {
 		nameDiff := strings.TrimPrefix(descendant.FullName.GcsObjectName(), oldDir.Name().GcsObjectName())
 		if nameDiff == descendant.FullName.GcsObjectName() {
 			return fmt.Errorf("unwanted descendant %q not from dir %q", descendant.FullName, oldDir.Name())
 		}
 
+		// The child file methods of the directories take local names.
+		nameDiffs[i] = strings.TrimPrefix(descendant.FullName.LocalName(), oldDir.Name().LocalName())
+		journal.Moves = append(journal.Moves, gcsx.RenameJournalMove{
+			Src:        descendant.MinObject.Name,
+			Dst:        newDir.Name().GcsObjectName() + nameDiff,
+			Generation: descendant.MinObject.Generation,
+		})
+	}
+
+	bucket := oldDir.Bucket()
+	journalName, err := gcsx.BeginRename(ctx, bucket, bucket.TmpObjectPrefix(), journal)
+	if err != nil {
+		return fmt.Errorf("BeginRename: %w", err)
+	}
+	logger.Infof("Renaming %d objects from %q to %q, journalled in %q", len(descendants), journal.OldDir, journal.NewDir, journalName)
+
+	// Move all the files from the old directory to the new directory, keeping both directories locked.
+	for i, descendant := range descendants {
+		nameDiff := nameDiffs[i]
 		o := descendant.MinObject
-		if _, err := newDir.CloneToChildFile(ctx, nameDiff, o); err != nil {
+		if _, err := newDir.CloneToChildFile(ctx, nameDiff, o, nil); err != nil {
 			return fmt.Errorf("copy file %q: %w", o.Name, err)
 		}
 		if err := oldDir.DeleteChildFile(ctx, nameDiff, o.Generation, &o.MetaGeneration); err != nil {
 			return fmt.Errorf("delete file %q: %w", o.Name, err)
 		}
+		fs.metricHandle.RenameObjectMoveCount(ctx, 1, []common.MetricAttr{{Key: common.RenamePhase, Value: gcsx.RenamePhaseRename}})
 
 		if err = fs.invalidateChildFileCacheIfExist(oldDir, o.Name); err != nil {
 			return fmt.Errorf("unlink: while invalidating cache for delete file: %w", err)
@@ -2337,9 +3421,6 @@ func (fs *fileSystem) renameNonHierarchicalDir(
 	fs.releaseInodes(&pendingInodes)
 
 	// Delete the backing object of the old directory.
-	fs.mu.Lock()
-	_, isImplicitDir := fs.implicitDirInodes[oldDir.Name()]
-	fs.mu.Unlock()
 	oldParent.Lock()
 	err = oldParent.DeleteChildDir(ctx, oldName, isImplicitDir, oldDir)
 	oldParent.Unlock()
@@ -2347,6 +3428,12 @@ func (fs *fileSystem) renameNonHierarchicalDir(
 		return fmt.Errorf("DeleteChildDir: %w", err)
 	}
 
+	// The rename is complete, so a leftover journal would only cause a
+	// redundant recovery later.
+	if err = gcsx.CommitRename(ctx, bucket, journalName); err != nil {
+		logger.Warnf("Failed to delete rename journal %q: %v", journalName, err)
+	}
+
 	return nil
 }
 
@@ -2394,6 +3481,10 @@ func (fs *fileSystem) Unlink(
 		return
 	}
 
+	if fs.newConfig.FileSystem.EnableHardLinks {
+		return fs.unlinkMaybeHardLink(ctx, parent, op.Name)
+	}
+
 	// Delete the backing object present on GCS.
 	parent.Lock()
 	defer parent.Unlock()
@@ -2416,6 +3507,61 @@ func (fs *fileSystem) Unlink(
 	return
 }
 
+// Delete the backing object of the named child file. If it is a hard link
+// pointer, also drop the link it accounts for from the content object.
+//
+// LOCKS_EXCLUDED(fs.mu)
+// LOCKS_EXCLUDED(parent)
+func (fs *fileSystem) unlinkMaybeHardLink(
+	ctx context.Context,
+	parent inode.DirInode,
+	name string) (err error) {
+	parent.Lock()
+
+	// Delete exactly the generation we looked at, so that we know whether it
+	// was a hard link.
+	var generation int64
+	var metaGeneration *int64
+	var contentObjectName string
+	core, err := parent.LookUpChild(ctx, name)
+	if err != nil {
+		parent.Unlock()
+		err = fmt.Errorf("LookUpChild: %w", err)
+		return err
+	}
+	if core != nil && core.FullName.IsFile() && core.MinObject != nil {
+		generation = core.MinObject.Generation
+		metaGeneration = &core.MinObject.MetaGeneration
+		if inode.IsHardLink(core.MinObject) {
+			contentObjectName = inode.HardLinkTarget(core.MinObject)
+		}
+	}
+
+	err = parent.DeleteChildFile(ctx, name, generation, metaGeneration)
+	if err == nil {
+		err = fs.invalidateChildFileCacheIfExist(parent, inode.NewFileName(parent.Name(), name).GcsObjectName())
+	}
+	parent.Unlock()
+
+	if err != nil {
+		err = fmt.Errorf("DeleteChildFile: %w", err)
+		return err
+	}
+
+	if contentObjectName == "" {
+		return
+	}
+
+	bucketOwned := parent.(inode.BucketOwnedInode)
+	err = fs.releaseHardLinkContent(ctx, bucketOwned.Bucket(), core.FullName, contentObjectName)
+	if err != nil {
+		err = fmt.Errorf("releaseHardLinkContent: %w", err)
+		return err
+	}
+
+	return
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) OpenDir(
 	ctx context.Context,
@@ -2507,6 +3653,11 @@ func (fs *fileSystem) OpenFile(
 	in.Lock()
 	defer in.Unlock()
 
+	overrides := fs.policyRules.Match(in.Name().GcsObjectName())
+	if !op.OpenFlags.IsReadOnly() && policy.Bool(overrides.ReadOnly, false) {
+		return syscall.EROFS
+	}
+
 	// Get the fs lock again.
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
@@ -2515,7 +3666,7 @@ func (fs *fileSystem) OpenFile(
 	handleID := fs.nextHandleID
 	fs.nextHandleID++
 
-	fs.handles[handleID] = handle.NewFileHandle(in, fs.fileCacheHandler, fs.cacheFileForRangeRead, fs.metricHandle, op.OpenFlags.IsReadOnly())
+	fs.handles[handleID] = handle.NewFileHandle(in, fs.fileCacheHandler, fs.cacheFileForRangeRead, fs.metricHandle, op.OpenFlags.IsReadOnly(), overrides)
 	op.Handle = handleID
 
 	// When we observe object generations that we didn't create, we assign them
@@ -2605,6 +3756,33 @@ func (fs *fileSystem) WriteFile(
 	return
 }
 
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) Fallocate(
+	ctx context.Context,
+	op *fuseops.FallocateOp) (err error) {
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+	// Find the inode.
+	fs.mu.Lock()
+	in := fs.fileInodeOrDie(op.Inode)
+	fs.mu.Unlock()
+
+	in.Lock()
+	defer in.Unlock()
+
+	// Serve the request.
+	if err := in.Fallocate(ctx, op.Mode, int64(op.Offset), int64(op.Length)); err != nil {
+		return err
+	}
+
+	return
+}
+
 // LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) SyncFile(
 	ctx context.Context,
@@ -2675,8 +3853,17 @@ func (fs *fileSystem) ReleaseFileHandle(
 	// Update the map. We are okay updating the map before destroy is called
 	// since destroy is doing only internal cleanup.
 	delete(fs.handles, op.Handle)
+	locks := fs.handleLocks[op.Handle]
+	delete(fs.handleLocks, op.Handle)
 	fs.mu.Unlock()
 
+	// Don't leave locks behind for other mounts to wait on until they expire.
+	for _, l := range locks {
+		if unlockErr := fs.lockManager.Unlock(ctx, l.name, l.owner); unlockErr != nil {
+			logger.Warnf("Failed to release lock on %q: %v", l.name, unlockErr)
+		}
+	}
+
 	// Destroy the handle.
 	fileHandle.Lock()
 	defer fileHandle.Unlock()
@@ -2685,20 +3872,322 @@ func (fs *fileSystem) ReleaseFileHandle(
 	return
 }
 
+// Find the inode with the given ID and return it if it supports extended
+// attributes.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) xattrInode(id fuseops.InodeID) (in inode.XattrInode, ok bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	in, ok = fs.inodeOrDie(id).(inode.XattrInode)
+	return
+}
+
+// LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) GetXattr(
 	ctx context.Context,
 	op *fuseops.GetXattrOp) (err error) {
-	return syscall.ENOSYS
+	if !fs.newConfig.FileSystem.EnableXattrs {
+		return syscall.ENOSYS
+	}
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+
+	// Only files carry extended attributes.
+	in, ok := fs.xattrInode(op.Inode)
+	if !ok {
+		return fuse.ENOATTR
+	}
+
+	in.Lock()
+	defer in.Unlock()
+
+	value, err := in.GetXattr(ctx, op.Name)
+	if err != nil {
+		return err
+	}
+
+	// An empty destination buffer asks for the size of the value.
+	op.BytesRead = len(value)
+	if len(op.Dst) == 0 {
+		return
+	}
+
+	if len(op.Dst) < len(value) {
+		return syscall.ERANGE
+	}
+
+	copy(op.Dst, value)
+	return
 }
 
+// LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) ListXattr(
 	ctx context.Context,
-	op *fuseops.ListXattrOp) error {
-	return syscall.ENOSYS
+	op *fuseops.ListXattrOp) (err error) {
+	if !fs.newConfig.FileSystem.EnableXattrs {
+		return syscall.ENOSYS
+	}
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+
+	var names []string
+	if in, ok := fs.xattrInode(op.Inode); ok {
+		in.Lock()
+		names, err = in.ListXattr(ctx)
+		in.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+
+	// The list is a sequence of NUL-terminated names. As with GetXattr, an
+	// empty destination buffer asks for the size of the list.
+	for _, name := range names {
+		op.BytesRead += len(name) + 1
+	}
+	if len(op.Dst) == 0 {
+		return
+	}
+
+	if len(op.Dst) < op.BytesRead {
+		return syscall.ERANGE
+	}
+
+	dst := op.Dst
+	for _, name := range names {
+		n := copy(dst, name)
+		dst[n] = 0
+		dst = dst[n+1:]
+	}
+	return
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) SetXattr(
+	ctx context.Context,
+	op *fuseops.SetXattrOp) (err error) {
+	if !fs.newConfig.FileSystem.EnableXattrs {
+		return syscall.ENOSYS
+	}
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+
+	in, ok := fs.xattrInode(op.Inode)
+	if !ok {
+		return syscall.ENOTSUP
+	}
+
+	in.Lock()
+	defer in.Unlock()
+
+	err = in.SetXattr(ctx, op.Name, op.Value, op.Flags)
+	if err != nil {
+		return err
+	}
+
+	return
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) RemoveXattr(
+	ctx context.Context,
+	op *fuseops.RemoveXattrOp) (err error) {
+	if !fs.newConfig.FileSystem.EnableXattrs {
+		return syscall.ENOSYS
+	}
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+
+	in, ok := fs.xattrInode(op.Inode)
+	if !ok {
+		return fuse.ENOATTR
+	}
+
+	in.Lock()
+	defer in.Unlock()
+
+	err = in.RemoveXattr(ctx, op.Name)
+	if err != nil {
+		return err
+	}
+
+	return
 }
 
+// LOCKS_EXCLUDED(fs.mu)
 func (fs *fileSystem) SyncFS(
 	ctx context.Context,
-	op *fuseops.SyncFSOp) error {
-	return syscall.ENOSYS
+	op *fuseops.SyncFSOp) (err error) {
+	if fs.newConfig.FileSystem.IgnoreInterrupts {
+		// When ignore interrupts config is set, we are creating a new context not
+		// cancellable by parent context.
+		var cancel context.CancelFunc
+		ctx, cancel = util.IsolateContextFromParentContext(ctx)
+		defer cancel()
+	}
+
+	// Take a snapshot of the file inodes. Syncing involves round trips to GCS,
+	// which we don't want to make while holding fs.mu.
+	fs.mu.Lock()
+	var files []*inode.FileInode
+	for _, in := range fs.inodes {
+		if file, ok := in.(*inode.FileInode); ok {
+			files = append(files, file)
+		}
+	}
+	fs.mu.Unlock()
+
+	// Sync each dirty file, carrying on past failures so that one bad file
+	// doesn't hold back the others.
+	for _, file := range files {
+		if ctx.Err() != nil {
+			err = errors.Join(err, ctx.Err())
+			break
+		}
+
+		file.Lock()
+		if file.IsDirty() {
+			if syncErr := fs.syncFile(ctx, file); syncErr != nil {
+				err = errors.Join(err, fmt.Errorf("%s: %w", file.Name(), syncErr))
+			}
+		}
+		file.Unlock()
+	}
+
+	return
+}
+
+// Return the name under which locks on the inode with the given ID are taken.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) lockName(id fuseops.InodeID) string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return fs.inodeOrDie(id).Name().GcsObjectName()
+}
+
+// Locks are taken on whole files, whatever range is asked for, so a
+// conflicting lock is reported as covering the whole file.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) GetLk(
+	ctx context.Context,
+	op *fuseops.GetLkOp) (err error) {
+	if fs.lockManager == nil {
+		return syscall.ENOSYS
+	}
+
+	free, conflictExclusive, err := fs.lockManager.Test(ctx, fs.lockName(op.Inode), op.Owner, op.Lock.Type == unix.F_WRLCK)
+	if err != nil {
+		return fmt.Errorf("Test: %w", err)
+	}
+
+	if free {
+		op.Lock.Type = unix.F_UNLCK
+		return
+	}
+
+	// The holder may be on another host, so there is no pid to report.
+	op.Lock.Start = 0
+	op.Lock.End = math.MaxUint64
+	op.Lock.Pid = 0
+	op.Lock.Type = unix.F_RDLCK
+	if conflictExclusive {
+		op.Lock.Type = unix.F_WRLCK
+	}
+
+	return
+}
+
+// Take or release a whole-file lock. Interrupts are never ignored here, since
+// they are the only way out of a blocking wait for a lock.
+//
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) SetLk(
+	ctx context.Context,
+	op *fuseops.SetLkOp) (err error) {
+	if fs.lockManager == nil {
+		return syscall.ENOSYS
+	}
+
+	name := fs.lockName(op.Inode)
+	switch op.Lock.Type {
+	case unix.F_UNLCK:
+		if err = fs.lockManager.Unlock(ctx, name, op.Owner); err != nil {
+			return fmt.Errorf("Unlock: %w", err)
+		}
+		fs.forgetHandleLock(op.Handle, heldLock{name: name, owner: op.Owner})
+		return
+
+	case unix.F_RDLCK, unix.F_WRLCK:
+	default:
+		return fmt.Errorf("lock type %d: %w", op.Lock.Type, syscall.EINVAL)
+	}
+
+	exclusive := op.Lock.Type == unix.F_WRLCK
+	for {
+		err = fs.lockManager.Lock(ctx, name, op.Owner, exclusive)
+		if !errors.Is(err, gcsx.ErrLockConflict) || !op.Sleep {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return syscall.EINTR
+
+		case <-time.After(lockRetryInterval):
+		}
+	}
+
+	if errors.Is(err, gcsx.ErrLockConflict) {
+		return syscall.EWOULDBLOCK
+	}
+	if err != nil {
+		return fmt.Errorf("Lock: %w", err)
+	}
+
+	fs.mu.Lock()
+	l := heldLock{name: name, owner: op.Owner}
+	if !slices.Contains(fs.handleLocks[op.Handle], l) {
+		fs.handleLocks[op.Handle] = append(fs.handleLocks[op.Handle], l)
+	}
+	fs.mu.Unlock()
+
+	return
+}
+
+// LOCKS_EXCLUDED(fs.mu)
+func (fs *fileSystem) forgetHandleLock(h fuseops.HandleID, l heldLock) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	locks := slices.DeleteFunc(fs.handleLocks[h], func(held heldLock) bool { return held == l })
+	if len(locks) == 0 {
+		delete(fs.handleLocks, h)
+		return
+	}
+	fs.handleLocks[h] = locks
 }
@@ -164,7 +164,7 @@ func (t *fsTest) SetUpTestSuite() {
 				TypeCacheMaxSizeMb: 4,
 			},
 			FileSystem: cfg.FileSystemConfig{
-				PreconditionErrors: false,
+				PreconditionErrors: "false",
 			},
 		}
 	}
@@ -365,6 +365,13 @@ type fakeBucketManager struct {
 	appendThreshold          int64
 	chunkTransferTimeoutSecs int64
 	tmpObjectPrefix          string
+
+	// The "bucket/object" names passed to InvalidateStatCache.
+	statCacheInvalidations []string
+}
+
+func (bm *fakeBucketManager) InvalidateStatCache(bucketName string, objectName string) {
+	bm.statCacheInvalidations = append(bm.statCacheInvalidations, bucketName+"/"+objectName)
 }
 
 func (bm *fakeBucketManager) ShutDown() {}
@@ -21,6 +21,8 @@ import (
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
@@ -83,7 +85,11 @@ func (t *DirHandleTest) resetDirHandle() {
 		&t.clock,
 		&t.clock,
 		0,
-		false)
+		false,
+		inode.NoNameNormalization,
+		nil,
+		"",
+		metadata.TypeCacheOptions{})
 
 	t.dh = NewDirHandle(
 		dirInode,
@@ -107,7 +113,8 @@ func (t *DirHandleTest) createLocalFileInode(name string, id fuseops.InodeID) (i
 		&t.clock,
 		true, // localFile
 		&cfg.Config{},
-		semaphore.NewWeighted(math.MaxInt64))
+		semaphore.NewWeighted(math.MaxInt64),
+		common.NewNoopMetrics())
 	return
 }
 
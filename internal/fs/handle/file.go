@@ -23,6 +23,7 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/file"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/policy"
 	"github.com/jacobsa/syncutil"
 	"golang.org/x/net/context"
 )
@@ -54,12 +55,19 @@ type FileHandle struct {
 	readOnly bool
 }
 
+// The supplied per-path overrides can turn the file cache off for this handle
+// and change whether it caches files for range reads.
+//
 // LOCKS_REQUIRED(fh.inode.mu)
-func NewFileHandle(inode *inode.FileInode, fileCacheHandler *file.CacheHandler, cacheFileForRangeRead bool, metricHandle common.MetricHandle, readOnly bool) (fh *FileHandle) {
+func NewFileHandle(inode *inode.FileInode, fileCacheHandler *file.CacheHandler, cacheFileForRangeRead bool, metricHandle common.MetricHandle, readOnly bool, overrides policy.Overrides) (fh *FileHandle) {
+	if !policy.Bool(overrides.FileCache, true) {
+		fileCacheHandler = nil
+	}
+
 	fh = &FileHandle{
 		inode:                 inode,
 		fileCacheHandler:      fileCacheHandler,
-		cacheFileForRangeRead: cacheFileForRangeRead,
+		cacheFileForRangeRead: policy.Bool(overrides.CacheFileForRangeRead, cacheFileForRangeRead),
 		metricHandle:          metricHandle,
 		readOnly:              readOnly,
 	}
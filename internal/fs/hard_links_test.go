@@ -0,0 +1,162 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// These tests call the file system ops directly, so that the objects behind
+// hard links can be checked in between.
+
+package fs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/inode"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type HardLinksTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcs.Bucket
+	fs     fuseutil.FileSystem
+}
+
+func TestHardLinksSuite(t *testing.T) {
+	suite.Run(t, new(HardLinksTest))
+}
+
+func (t *HardLinksTest) SetupTest() {
+	var err error
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	serverCfg := &fs.ServerConfig{
+		CacheClock: &clock,
+		BucketManager: &fakeBucketManager{
+			buckets:                  map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			chunkTransferTimeoutSecs: 10,
+			tmpObjectPrefix:          ".gcsfuse_tmp/",
+		},
+		BucketName:           t.bucket.Name(),
+		RenameDirLimit:       RenameDirLimit,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		NewConfig: &cfg.Config{
+			FileCache: defaultFileCacheConfig(),
+			FileSystem: cfg.FileSystemConfig{
+				EnableHardLinks: true,
+			},
+			MetadataCache: cfg.MetadataCacheConfig{
+				StatCacheMaxSizeMb: 32,
+				TtlSecs:            60,
+				TypeCacheMaxSizeMb: 4,
+			},
+		},
+		MetricHandle: common.NewNoopMetrics(),
+		FilePerms:    filePerms,
+		DirPerms:     dirPerms,
+	}
+
+	t.fs, err = fs.NewFileSystem(t.ctx, serverCfg)
+	require.NoError(t.T(), err)
+}
+
+func (t *HardLinksTest) TearDownTest() {
+	t.fs.Destroy()
+}
+
+func (t *HardLinksTest) createObject(name string, contents string) {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, name, []byte(contents))
+	require.NoError(t.T(), err)
+}
+
+func (t *HardLinksTest) readObject(name string) string {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, name)
+	require.NoError(t.T(), err)
+	return string(contents)
+}
+
+func (t *HardLinksTest) statObject(name string) *gcs.MinObject {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	require.NoError(t.T(), err)
+	return m
+}
+
+// Create a hard link with the supplied name to the named file in the root.
+func (t *HardLinksTest) link(target string, name string) {
+	lookUpOp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: target}
+	require.NoError(t.T(), t.fs.LookUpInode(t.ctx, lookUpOp))
+
+	err := t.fs.CreateLink(t.ctx, &fuseops.CreateLinkOp{
+		Parent: fuseops.RootInodeID,
+		Name:   name,
+		Target: lookUpOp.Entry.Child,
+	})
+	require.NoError(t.T(), err)
+}
+
+func (t *HardLinksTest) rename(oldName string, newName string) error {
+	return t.fs.Rename(t.ctx, &fuseops.RenameOp{
+		OldParent: fuseops.RootInodeID,
+		OldName:   oldName,
+		NewParent: fuseops.RootInodeID,
+		NewName:   newName,
+	})
+}
+
+// Return the link count recorded in the content object the named hard link
+// pointer refers to.
+func (t *HardLinksTest) contentLinkCount(pointer string) string {
+	m := t.statObject(pointer)
+	require.True(t.T(), inode.IsHardLink(m))
+	return t.statObject(inode.HardLinkTarget(m)).Metadata[inode.LinkCountMetadataKey]
+}
+
+func (t *HardLinksTest) TestRenameOverLinkReleasesContent() {
+	t.createObject("foo", "taco")
+	t.createObject("bar", "burrito")
+	t.link("foo", "baz")
+	require.Equal(t.T(), "2", t.contentLinkCount("foo"))
+
+	err := t.rename("bar", "baz")
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "burrito", t.readObject("baz"))
+	assert.False(t.T(), inode.IsHardLink(t.statObject("baz")))
+	assert.Equal(t.T(), "1", t.contentLinkCount("foo"))
+}
+
+func (t *HardLinksTest) TestRenameLinkOntoLinkToSameFile() {
+	t.createObject("foo", "taco")
+	t.link("foo", "baz")
+
+	err := t.rename("baz", "foo")
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "2", t.contentLinkCount("foo"))
+	assert.Equal(t.T(), "2", t.contentLinkCount("baz"))
+}
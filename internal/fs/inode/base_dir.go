@@ -15,7 +15,7 @@
 package inode
 
 import (
-	"syscall"
+	"os"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
@@ -33,7 +33,8 @@ import (
 // An inode that
 //
 //	(1) represents a base directory which contains a list of
-//	    subdirectories as the roots of different GCS buckets;
+//	    subdirectories as the roots of different GCS buckets, or of unions
+//	    of them named like "upper+lower" (see gcsx.NewUnionBucket);
 //	(2) implements BaseDirInode, allowing read only ops.
 type baseDirInode struct {
 	/////////////////////////
@@ -75,7 +76,7 @@ func NewBaseDirInode(
 	metricHandle common.MetricHandle) (d DirInode) {
 	typed := &baseDirInode{
 		id:            id,
-		name:          NewRootName(""),
+		name:          name,
 		attrs:         attrs,
 		bucketManager: bm,
 		buckets:       make(map[string]gcsx.SyncerBucket),
@@ -167,9 +168,15 @@ func (d *baseDirInode) LookUpChild(ctx context.Context, name string) (*Core, err
 		d.buckets[name] = bucket
 	}
 
+	// Encode names in all buckets, or none.
+	rootName := NewRootName(bucket.Name())
+	if d.name.encoded {
+		rootName = NewEncodedRootName(bucket.Name())
+	}
+
 	return &Core{
 		Bucket:    &bucket,
-		FullName:  NewRootName(bucket.Name()),
+		FullName:  rootName,
 		MinObject: nil,
 	}, nil
 }
@@ -183,12 +190,19 @@ func (d *baseDirInode) ReadDescendants(ctx context.Context, limit int) (map[Name
 func (d *baseDirInode) ReadEntries(
 	ctx context.Context,
 	tok string) (entries []fuseutil.Dirent, newTok string, err error) {
-
 	// The subdirectories of the base directory should be all the accessible
-	// buckets. Although the user is allowed to visit each individual
-	// subdirectory, listing all the subdirectories (i.e. the buckets) can be
-	// very expensive and currently not supported.
-	return nil, "", syscall.ENOTSUP
+	// buckets and all the unions of them. Listing all the buckets can be very
+	// expensive and is currently not supported, and there is no end to the
+	// unions, so list those the user has visited, including the unions they
+	// have set up.
+	for name := range d.buckets {
+		entries = append(entries, fuseutil.Dirent{
+			Name: name,
+			Type: fuseutil.DT_Directory,
+		})
+	}
+
+	return
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -212,7 +226,7 @@ func (d *baseDirInode) CreateLocalChildFileCore(_ string) (Core, error) {
 	return Core{}, fuse.ENOSYS
 }
 
-func (d *baseDirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject) (*Core, error) {
+func (d *baseDirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject, dstGenerationPrecondition *int64) (*Core, error) {
 	return nil, fuse.ENOSYS
 }
 
@@ -220,6 +234,14 @@ func (d *baseDirInode) CreateChildSymlink(ctx context.Context, name string, targ
 	return nil, fuse.ENOSYS
 }
 
+func (d *baseDirInode) CreateChildSpecialFile(ctx context.Context, name string, mode os.FileMode, rdev uint32) (*Core, error) {
+	return nil, fuse.ENOSYS
+}
+
+func (d *baseDirInode) CreateChildHardLink(ctx context.Context, name string, contentObjectName string) (*Core, error) {
+	return nil, fuse.ENOSYS
+}
+
 func (d *baseDirInode) CreateChildDir(ctx context.Context, name string) (*Core, error) {
 	return nil, fuse.ENOSYS
 }
@@ -248,15 +270,14 @@ func (d *baseDirInode) LocalFileEntries(localFileInodes map[Name]Inode) (localEn
 }
 
 func (d *baseDirInode) ShouldInvalidateKernelListCache(ttl time.Duration) bool {
-	// Keeping the default behavior although list operation is not supported
-	// for baseDirInode.
+	// The listing grows as buckets are visited, so never keep it.
 	return true
 }
 
-// List operation is not supported for baseDirInode.
+// The kernel list cache is never kept for baseDirInode.
 func (d *baseDirInode) InvalidateKernelListCache() {}
 
-func (d *baseDirInode) RenameFile(ctx context.Context, fileToRename *gcs.MinObject, destinationFileName string) (*gcs.Object, error) {
+func (d *baseDirInode) RenameFile(ctx context.Context, fileToRename *gcs.MinObject, destinationFileName string, dstGenerationPrecondition *int64) (*gcs.Object, error) {
 	err := fuse.ENOSYS
 	return nil, err
 }
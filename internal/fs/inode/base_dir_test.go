@@ -17,6 +17,7 @@ package inode
 import (
 	"fmt"
 	"os"
+	"sort"
 	"testing"
 	"time"
 
@@ -28,6 +29,8 @@ import (
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	. "github.com/jacobsa/oglematchers"
 	. "github.com/jacobsa/ogletest"
 	"github.com/jacobsa/timeutil"
 )
@@ -72,6 +75,15 @@ func (t *BaseDirTest) SetUp(ti *TestInfo) {
 		".gcsfuse_tmp/",
 		fake.NewFakeBucket(&t.clock, "bucketB", gcs.BucketType{}),
 	)
+	t.bm.buckets["bucketA+bucketB"] = gcsx.NewSyncerBucket(
+		1, // Append threshold
+		ChunkTransferTimeoutSecs,
+		".gcsfuse_tmp/",
+		gcsx.NewUnionBucket(
+			".gcsfuse_tmp/",
+			fake.NewFakeBucket(&t.clock, "bucketA", gcs.BucketType{}),
+			fake.NewFakeBucket(&t.clock, "bucketB", gcs.BucketType{})),
+	)
 
 	// Create the inode. No implicit dirs by default.
 	t.resetInode()
@@ -104,6 +116,8 @@ func (bm *fakeBucketManager) SetUpBucket(
 	return
 }
 
+func (bm *fakeBucketManager) InvalidateStatCache(bucketName string, objectName string) {}
+
 func (bm *fakeBucketManager) ShutDown() {}
 
 func (bm *fakeBucketManager) SetUpTimes() int {
@@ -207,6 +221,30 @@ func (t *BaseDirTest) LookUpChild_BucketCached() {
 	ExpectEq(3, t.bm.SetUpTimes())
 }
 
+func (t *BaseDirTest) ReadEntries_ListsVisitedBucketsAndUnions() {
+	entries, tok, err := t.in.ReadEntries(t.ctx, "")
+	AssertEq(nil, err)
+	ExpectEq("", tok)
+	ExpectEq(0, len(entries))
+
+	_, err = t.in.LookUpChild(t.ctx, "bucketA")
+	AssertEq(nil, err)
+	_, err = t.in.LookUpChild(t.ctx, "bucketA+bucketB")
+	AssertEq(nil, err)
+	_, _ = t.in.LookUpChild(t.ctx, "missing_bucket")
+
+	entries, tok, err = t.in.ReadEntries(t.ctx, "")
+
+	AssertEq(nil, err)
+	ExpectEq("", tok)
+	AssertEq(2, len(entries))
+	names := []string{entries[0].Name, entries[1].Name}
+	sort.Strings(names)
+	ExpectThat(names, ElementsAre("bucketA", "bucketA+bucketB"))
+	ExpectEq(fuseutil.DT_Directory, entries[0].Type)
+	ExpectEq(fuseutil.DT_Directory, entries[1].Type)
+}
+
 func (t *BaseDirTest) Test_ShouldInvalidateKernelListCache() {
 	ttl := time.Second
 	AssertEq(true, t.in.ShouldInvalidateKernelListCache(ttl))
@@ -57,6 +57,8 @@ func (c *Core) Type() metadata.Type {
 		return metadata.ExplicitDirType
 	case IsSymlink(c.MinObject):
 		return metadata.SymlinkType
+	case IsSpecialFile(c.MinObject):
+		return metadata.SpecialFileType
 	default:
 		return metadata.RegularFileType
 	}
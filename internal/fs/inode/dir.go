@@ -17,8 +17,11 @@ package inode
 import (
 	"errors"
 	"fmt"
+	"os"
 	"path"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
@@ -63,10 +66,16 @@ type DirInode interface {
 	// named "foo/bar/baz" and this is the directory "foo", a child directory
 	// named "bar" will be implied. In this case, result.ImplicitDir will be
 	// true.
+	//
+	// With name normalization, a name with no exact match is matched against
+	// the normalized names of the children. If several match, the lookup fails
+	// with ENOTUNIQ.
 	LookUpChild(ctx context.Context, name string) (*Core, error)
 
-	// Rename the file.
-	RenameFile(ctx context.Context, fileToRename *gcs.MinObject, destinationFileName string) (*gcs.Object, error)
+	// Rename the file. dstGenerationPrecondition may be set to a non-nil pointer
+	// giving the generation the destination must have, with zero meaning that
+	// it must not exist, failing with *gcs.PreconditionError otherwise.
+	RenameFile(ctx context.Context, fileToRename *gcs.MinObject, destinationFileName string, dstGenerationPrecondition *int64) (*gcs.Object, error)
 
 	// Rename the directiory/folder.
 	RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error)
@@ -106,9 +115,12 @@ type DirInode interface {
 	EraseFromTypeCache(name string)
 
 	// Like CreateChildFile, except clone the supplied source object instead of
-	// creating an empty object.
+	// creating an empty object, over anything that might already exist unless
+	// dstGenerationPrecondition is non-nil. In that case the existing object
+	// must have the given generation, or not exist if it is zero, failing with
+	// *gcs.PreconditionError otherwise.
 	// Return the full name of the child and the GCS object it backs up.
-	CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject) (*Core, error)
+	CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject, dstGenerationPrecondition *int64) (*Core, error)
 
 	// Create a symlink object with the supplied (relative) name and the supplied
 	// target, failing with *gcs.PreconditionError if a backing object already
@@ -116,6 +128,18 @@ type DirInode interface {
 	// Return the full name of the child and the GCS object it backs up.
 	CreateChildSymlink(ctx context.Context, name string, target string) (*Core, error)
 
+	// Create a special file object with the supplied (relative) name, whose
+	// type is given by the type bits of mode and device number by rdev, failing
+	// with *gcs.PreconditionError if a backing object already exists in GCS.
+	// Return the full name of the child and the GCS object it backs up.
+	CreateChildSpecialFile(ctx context.Context, name string, mode os.FileMode, rdev uint32) (*Core, error)
+
+	// Create a hard link pointer object with the supplied (relative) name that
+	// refers to the supplied content object, failing with
+	// *gcs.PreconditionError if a backing object already exists in GCS.
+	// Return the full name of the child and the GCS object it backs up.
+	CreateChildHardLink(ctx context.Context, name string, contentObjectName string) (*Core, error)
+
 	// Create a backing object for a child directory with the supplied (relative)
 	// name, failing with *gcs.PreconditionError if a backing object already
 	// exists in GCS.
@@ -202,6 +226,11 @@ type dirInode struct {
 
 	attrs fuseops.InodeAttributes
 
+	// How names without an exact match are looked up, and for how long an
+	// index of normalized names may be used to do so.
+	nameNormalization  NameNormalization
+	normalizedIndexTTL time.Duration
+
 	/////////////////////////
 	// Mutable state
 	/////////////////////////
@@ -228,6 +257,22 @@ type dirInode struct {
 	// Represents if folder has been unlinked in hierarchical bucket. This is not getting used in
 	// non-hierarchical bucket.
 	unlinked bool
+
+	indexMu sync.Mutex
+
+	// Only with name normalization: the index of the names of the children as
+	// of the last complete listing, and the time it was made. Lookups hold only
+	// a read lock on the inode, so these have a lock of their own.
+	//
+	// GUARDED_BY(indexMu)
+	index     normalizedIndex
+	indexTime time.Time
+
+	// Set once names that are ambiguous once normalized have been reported,
+	// so that they are reported once rather than with every listing.
+	//
+	// GUARDED_BY(indexMu)
+	ambiguityReported bool
 }
 
 var _ DirInode = &dirInode{}
@@ -248,6 +293,15 @@ var _ DirInode = &dirInode{}
 // child is removed and recreated with a different type before the expiration,
 // we may fail to find it.
 //
+// Unless nameNormalization is NoNameNormalization, a name that isn't found by
+// LookUpChild is looked up again by its normalized form, in an index of the
+// names of the children that is kept for typeCacheTTL.
+//
+// If metadataDiskCache is non-nil, the type cache is backed by it, so that its
+// entries survive the mount. They are keyed by the name of the directory in the
+// bucket, which is its name with the supplied objectPrefix, that of --only-dir. typeCacheOptions selects the eviction policy of
+// the type cache.
+//
 // The initial lookup count is zero.
 //
 // REQUIRES: name.IsDir()
@@ -264,6 +318,10 @@ func NewDirInode(
 	cacheClock timeutil.Clock,
 	typeCacheMaxSizeMB int64,
 	isHNSEnabled bool,
+	nameNormalization NameNormalization,
+	metadataDiskCache *metadata.DiskCache,
+	objectPrefix string,
+	typeCacheOptions metadata.TypeCacheOptions,
 ) (d DirInode) {
 
 	if !name.IsDir() {
@@ -280,9 +338,15 @@ func NewDirInode(
 		enableNonexistentTypeCache: enableNonexistentTypeCache,
 		name:                       name,
 		attrs:                      attrs,
-		cache:                      metadata.NewTypeCache(typeCacheMaxSizeMB, typeCacheTTL),
+		cache:                      metadata.NewTypeCacheWithOptions(typeCacheMaxSizeMB, typeCacheTTL, typeCacheOptions),
 		isHNSEnabled:               isHNSEnabled,
 		unlinked:                   false,
+		nameNormalization:          nameNormalization,
+		normalizedIndexTTL:         typeCacheTTL,
+	}
+
+	if metadataDiskCache != nil && typeCacheTTL > 0 && typeCacheMaxSizeMB != 0 {
+		typed.cache = metadata.NewDiskBackedTypeCache(typed.cache, metadataDiskCache, bucket.Name()+"/"+objectPrefix+name.GcsObjectName(), typeCacheTTL)
 	}
 
 	typed.lc.Init(id)
@@ -534,6 +598,16 @@ const ConflictingFileNameSuffix = "\n"
 
 // LOCKS_REQUIRED(d)
 func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error) {
+	result, err := d.lookUpChildExact(ctx, name)
+	if err != nil || result != nil || d.nameNormalization == NoNameNormalization {
+		return result, err
+	}
+
+	return d.lookUpNormalized(ctx, name)
+}
+
+// Look up the child with exactly the supplied name. See LookUpChild.
+func (d *dirInode) lookUpChildExact(ctx context.Context, name string) (*Core, error) {
 	// Is this a conflict marker name?
 	if strings.HasSuffix(name, ConflictingFileNameSuffix) {
 		return d.lookUpConflicting(ctx, name)
@@ -574,7 +648,7 @@ func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error)
 		} else {
 			group.Go(lookUpExplicitDir)
 		}
-	case metadata.RegularFileType, metadata.SymlinkType:
+	case metadata.RegularFileType, metadata.SymlinkType, metadata.SpecialFileType:
 		group.Go(lookUpFile)
 	case metadata.NonexistentType:
 		return nil, nil
@@ -612,6 +686,121 @@ func (d *dirInode) LookUpChild(ctx context.Context, name string) (*Core, error)
 	return result, nil
 }
 
+// Look up the single child whose name matches the supplied one once
+// normalized. It is an error for several to match.
+func (d *dirInode) lookUpNormalized(ctx context.Context, name string) (*Core, error) {
+	// Local changes update the index in place, so match against it under its
+	// lock.
+	d.indexMu.Lock()
+	fresh := d.index != nil && !d.cacheClock.Now().After(d.indexTime.Add(d.normalizedIndexTTL))
+	var matches []string
+	if fresh {
+		matches = d.index.matches(d.nameNormalization, name)
+	}
+	d.indexMu.Unlock()
+
+	if !fresh {
+		index, err := d.buildNormalizedIndex(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("buildNormalizedIndex: %w", err)
+		}
+
+		matches = index.matches(d.nameNormalization, name)
+		d.installIndex(index)
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, nil
+
+	case 1:
+		return d.lookUpChildExact(ctx, matches[0])
+	}
+
+	return nil, fmt.Errorf("%q in %q is ambiguous, matching each of %q: %w", name, d.name, matches, syscall.ENOTUNIQ)
+}
+
+// List all the children to index their names.
+func (d *dirInode) buildNormalizedIndex(ctx context.Context) (index normalizedIndex, err error) {
+	index = make(normalizedIndex)
+	var tok string
+	for {
+		var cores map[Name]*Core
+		cores, tok, err = d.readObjects(ctx, tok)
+		if err != nil {
+			err = fmt.Errorf("read objects: %w", err)
+			return
+		}
+
+		d.addToIndex(index, cores)
+		if tok == "" {
+			break
+		}
+	}
+
+	return
+}
+
+func (d *dirInode) addToIndex(index normalizedIndex, cores map[Name]*Core) {
+	for fullName := range cores {
+		index.add(d.nameNormalization, path.Base(fullName.LocalName()))
+	}
+}
+
+// Make the supplied complete index the one used for lookups, reporting the
+// first time there are names that it can't resolve.
+func (d *dirInode) installIndex(index normalizedIndex) {
+	var ambiguous [][]string
+	for _, names := range index {
+		if len(names) > 1 {
+			ambiguous = append(ambiguous, names)
+		}
+	}
+
+	d.indexMu.Lock()
+	d.index = index
+	d.indexTime = d.cacheClock.Now()
+	report := len(ambiguous) > 0 && !d.ambiguityReported
+	if report {
+		d.ambiguityReported = true
+	}
+	d.indexMu.Unlock()
+
+	if report {
+		logger.Warnf("Names in %q are ambiguous once normalized, so can only be looked up exactly: %q", d.name, ambiguous)
+	}
+}
+
+// Add the named child, created through this inode, to the index of
+// normalized names if there is one. A name further down stands for the child
+// containing it.
+func (d *dirInode) indexChild(name string) {
+	if d.nameNormalization == NoNameNormalization {
+		return
+	}
+
+	name, _, _ = strings.Cut(name, "/")
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	if d.index != nil {
+		d.index.add(d.nameNormalization, name)
+	}
+}
+
+// Remove the named child, deleted or renamed through this inode, from the
+// index of normalized names if there is one.
+func (d *dirInode) unindexChild(name string) {
+	if d.nameNormalization == NoNameNormalization || strings.Contains(name, "/") {
+		return
+	}
+
+	d.indexMu.Lock()
+	defer d.indexMu.Unlock()
+	if d.index != nil {
+		d.index.remove(d.nameNormalization, name)
+	}
+}
+
 func (d *dirInode) IsUnlinked() bool {
 	return d.unlinked
 }
@@ -699,7 +888,7 @@ func (d *dirInode) readObjects(
 			continue
 		}
 
-		nameBase := path.Base(o.Name) // ie. "bar" from "foo/bar/" or "foo/bar"
+		nameBase := d.Name().childLocalName(o.Name)
 
 		// Given the alphabetical order of the objects, if a file "foo" and
 		// directory "foo/" coexist, the directory would eventually occupy
@@ -738,8 +927,13 @@ func (d *dirInode) readObjects(
 	// Add implicit directories into the result.
 	unsupportedPrefixes := []string{}
 	for _, p := range listing.CollapsedRuns {
-		pathBase := path.Base(p)
-		if storageutil.IsUnsupportedObjectName(p) {
+		// The content of hard linked files is an implementation detail.
+		if p == HardLinkContentPrefix {
+			continue
+		}
+
+		pathBase := d.Name().childLocalName(p)
+		if !d.Name().encoded && storageutil.IsUnsupportedObjectName(p) {
 			unsupportedPrefixes = append(unsupportedPrefixes, p)
 		}
 		dirName := NewDirName(d.Name(), pathBase)
@@ -781,6 +975,14 @@ func (d *dirInode) ReadEntries(
 		return
 	}
 
+	// Listings of a single page are complete, so can stand in for an index.
+	// Pages of longer ones may interleave with those of other listings.
+	if d.nameNormalization != NoNameNormalization && tok == "" && newTok == "" {
+		index := make(normalizedIndex)
+		d.addToIndex(index, cores)
+		d.installIndex(index)
+	}
+
 	for fullName, core := range cores {
 		entry := fuseutil.Dirent{
 			Name: path.Base(fullName.LocalName()),
@@ -791,6 +993,8 @@ func (d *dirInode) ReadEntries(
 			entry.Type = fuseutil.DT_Link
 		case metadata.RegularFileType:
 			entry.Type = fuseutil.DT_File
+		case metadata.SpecialFileType:
+			entry.Type = SpecialFileDirentType(core.MinObject)
 		case metadata.ImplicitDirType, metadata.ExplicitDirType:
 			entry.Type = fuseutil.DT_Directory
 		}
@@ -815,6 +1019,7 @@ func (d *dirInode) CreateChildFile(ctx context.Context, name string) (*Core, err
 	m := storageutil.ConvertObjToMinObject(o)
 
 	d.cache.Insert(d.cacheClock.Now(), name, metadata.RegularFileType)
+	d.indexChild(name)
 	return &Core{
 		Bucket:    d.Bucket(),
 		FullName:  fullName,
@@ -834,6 +1039,7 @@ func (d *dirInode) CreateLocalChildFileCore(name string) (Core, error) {
 // LOCKS_REQUIRED(d)
 func (d *dirInode) InsertFileIntoTypeCache(name string) {
 	d.cache.Insert(d.cacheClock.Now(), name, metadata.RegularFileType)
+	d.indexChild(name)
 }
 
 // LOCKS_REQUIRED(d)
@@ -842,12 +1048,13 @@ func (d *dirInode) EraseFromTypeCache(name string) {
 }
 
 // LOCKS_REQUIRED(d)
-func (d *dirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject) (*Core, error) {
+func (d *dirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.MinObject, dstGenerationPrecondition *int64) (*Core, error) {
 	// Erase any existing type information for this name.
 	d.cache.Erase(name)
 	fullName := NewFileName(d.Name(), name)
 
-	// Clone over anything that might already exist for the name.
+	// Clone over anything that might already exist for the name, unless told
+	// otherwise.
 	o, err := d.bucket.CopyObject(
 		ctx,
 		&gcs.CopyObjectRequest{
@@ -855,6 +1062,7 @@ func (d *dirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.M
 			SrcGeneration:                 src.Generation,
 			SrcMetaGenerationPrecondition: &src.MetaGeneration,
 			DstName:                       fullName.GcsObjectName(),
+			DstGenerationPrecondition:     dstGenerationPrecondition,
 		})
 	if err != nil {
 		return nil, err
@@ -867,6 +1075,7 @@ func (d *dirInode) CloneToChildFile(ctx context.Context, name string, src *gcs.M
 		MinObject: m,
 	}
 	d.cache.Insert(d.cacheClock.Now(), name, c.Type())
+	d.indexChild(name)
 	return c, nil
 }
 
@@ -884,6 +1093,52 @@ func (d *dirInode) CreateChildSymlink(ctx context.Context, name string, target s
 	m := storageutil.ConvertObjToMinObject(o)
 
 	d.cache.Insert(d.cacheClock.Now(), name, metadata.SymlinkType)
+	d.indexChild(name)
+
+	return &Core{
+		Bucket:    d.Bucket(),
+		FullName:  fullName,
+		MinObject: m,
+	}, nil
+}
+
+// LOCKS_REQUIRED(d)
+func (d *dirInode) CreateChildSpecialFile(ctx context.Context, name string, mode os.FileMode, rdev uint32) (*Core, error) {
+	fullName := NewFileName(d.Name(), name)
+	childMetadata := specialFileMetadata(mode, rdev)
+	childMetadata[FileMtimeMetadataKey] = d.mtimeClock.Now().UTC().Format(time.RFC3339Nano)
+
+	o, err := d.createNewObject(ctx, fullName, childMetadata)
+	if err != nil {
+		return nil, err
+	}
+	m := storageutil.ConvertObjToMinObject(o)
+
+	d.cache.Insert(d.cacheClock.Now(), name, metadata.SpecialFileType)
+	d.indexChild(name)
+
+	return &Core{
+		Bucket:    d.Bucket(),
+		FullName:  fullName,
+		MinObject: m,
+	}, nil
+}
+
+// LOCKS_REQUIRED(d)
+func (d *dirInode) CreateChildHardLink(ctx context.Context, name string, contentObjectName string) (*Core, error) {
+	fullName := NewFileName(d.Name(), name)
+	childMetadata := map[string]string{
+		HardLinkMetadataKey: contentObjectName,
+	}
+
+	o, err := d.createNewObject(ctx, fullName, childMetadata)
+	if err != nil {
+		return nil, err
+	}
+	m := storageutil.ConvertObjToMinObject(o)
+
+	d.cache.Insert(d.cacheClock.Now(), name, metadata.RegularFileType)
+	d.indexChild(name)
 
 	return &Core{
 		Bucket:    d.Bucket(),
@@ -920,6 +1175,7 @@ func (d *dirInode) CreateChildDir(ctx context.Context, name string) (*Core, erro
 
 	// Insert the new directory into the type cache.
 	d.cache.Insert(d.cacheClock.Now(), name, metadata.ExplicitDirType)
+	d.indexChild(name)
 
 	return &Core{
 		Bucket:    d.Bucket(),
@@ -951,6 +1207,7 @@ func (d *dirInode) DeleteChildFile(
 		return
 	}
 	d.cache.Erase(name)
+	d.unindexChild(name)
 
 	return
 }
@@ -967,6 +1224,7 @@ func (d *dirInode) DeleteChildDir(
 	// exists in the gcs bucket, so returning from here.
 	// Hierarchical buckets don't have implicit dirs so this will be always false in hierarchical bucket case.
 	if isImplicitDir {
+		d.unindexChild(name)
 		return nil
 	}
 
@@ -986,6 +1244,7 @@ func (d *dirInode) DeleteChildDir(
 			return fmt.Errorf("DeleteObject: %w", err)
 		}
 		d.cache.Erase(name)
+		d.unindexChild(name)
 		return nil
 	}
 
@@ -1001,6 +1260,7 @@ func (d *dirInode) DeleteChildDir(
 	}
 
 	d.cache.Erase(name)
+	d.unindexChild(name)
 	return nil
 }
 
@@ -1043,18 +1303,25 @@ func (d *dirInode) ShouldInvalidateKernelListCache(ttl time.Duration) bool {
 
 // LOCKS_REQUIRED(d)
 // LOCKS_REQUIRED(parent of destinationFileName)
-func (d *dirInode) RenameFile(ctx context.Context, fileToRename *gcs.MinObject, destinationFileName string) (*gcs.Object, error) {
+func (d *dirInode) RenameFile(ctx context.Context, fileToRename *gcs.MinObject, destinationFileName string, dstGenerationPrecondition *int64) (*gcs.Object, error) {
 	req := &gcs.MoveObjectRequest{
 		SrcName:                       fileToRename.Name,
 		DstName:                       destinationFileName,
 		SrcGeneration:                 fileToRename.Generation,
 		SrcMetaGenerationPrecondition: &fileToRename.MetaGeneration,
+		DstGenerationPrecondition:     dstGenerationPrecondition,
 	}
 
 	o, err := d.bucket.MoveObject(ctx, req)
 
 	// Invalidate the cache entry for the old object name.
 	d.cache.Erase(fileToRename.Name)
+	if err == nil {
+		d.unindexChild(d.Name().childLocalName(fileToRename.Name))
+		if path.Dir(destinationFileName) == path.Dir(fileToRename.Name) {
+			d.indexChild(d.Name().childLocalName(destinationFileName))
+		}
+	}
 
 	return o, err
 }
@@ -1068,6 +1335,10 @@ func (d *dirInode) RenameFolder(ctx context.Context, folderName string, destinat
 	// TODO: Cache updates won't be necessary once type cache usage is removed from HNS.
 	// Remove old entry from type cache.
 	d.cache.Erase(folderName)
+	d.unindexChild(d.Name().childLocalName(folderName))
+	if path.Dir(strings.TrimSuffix(destinationFolderName, "/")) == path.Dir(strings.TrimSuffix(folderName, "/")) {
+		d.indexChild(d.Name().childLocalName(destinationFolderName))
+	}
 
 	return folder, nil
 }
@@ -20,10 +20,12 @@ import (
 	"os"
 	"path"
 	"sort"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
@@ -122,6 +124,10 @@ func (t *DirTest) resetInodeWithTypeCacheConfigs(implicitDirs, enableNonexistent
 		&t.clock,
 		typeCacheMaxSizeMB,
 		false,
+		NoNameNormalization,
+		nil,
+		"",
+		metadata.TypeCacheOptions{},
 	)
 
 	d := t.in.(*dirInode)
@@ -150,6 +156,10 @@ func (t *DirTest) createDirInode(dirInodeName string) DirInode {
 		&t.clock,
 		4,
 		false,
+		NoNameNormalization,
+		nil,
+		"",
+		metadata.TypeCacheOptions{},
 	)
 }
 
@@ -208,7 +218,8 @@ func (t *DirTest) createLocalFileInode(parent Name, name string, id fuseops.Inod
 		&t.clock,
 		true, //localFile
 		&cfg.Config{},
-		semaphore.NewWeighted(math.MaxInt64))
+		semaphore.NewWeighted(math.MaxInt64),
+		common.NewNoopMetrics())
 	return
 }
 
@@ -745,6 +756,147 @@ func (t *DirTest) LookUpChild_TypeCacheDisabled() {
 	}
 }
 
+func (t *DirTest) resetInodeWithNameNormalization(n NameNormalization) {
+	t.in.Unlock()
+	t.in = NewDirInode(
+		dirInodeID,
+		NewDirName(NewRootName(""), dirInodeName),
+		fuseops.InodeAttributes{
+			Uid:  uid,
+			Gid:  gid,
+			Mode: dirMode,
+		},
+		false,
+		true,
+		false,
+		typeCacheTTL,
+		&t.bucket,
+		&t.clock,
+		&t.clock,
+		4,
+		false,
+		n,
+		nil,
+		"",
+		metadata.TypeCacheOptions{},
+	)
+	t.in.Lock()
+}
+
+func (t *DirTest) LookUpChild_NormalizedUnicode() {
+	t.resetInodeWithNameNormalization(NormalizeUnicode)
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"caf\u00e9", []byte("taco"))
+	AssertEq(nil, err)
+
+	// NFD, as written by macOS.
+	result, err := t.in.LookUpChild(t.ctx, "cafe\u0301")
+
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(dirInodeName+"caf\u00e9", result.FullName.GcsObjectName())
+
+	// Case still matters.
+	result, err = t.in.LookUpChild(t.ctx, "CAFE\u0301")
+	AssertEq(nil, err)
+	ExpectEq(nil, result)
+}
+
+func (t *DirTest) LookUpChild_NormalizedUnicodeAndCase() {
+	t.resetInodeWithNameNormalization(NormalizeUnicodeAndCase)
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"caf\u00e9", []byte("taco"))
+	AssertEq(nil, err)
+
+	result, err := t.in.LookUpChild(t.ctx, "CAFE\u0301")
+
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(dirInodeName+"caf\u00e9", result.FullName.GcsObjectName())
+}
+
+func (t *DirTest) LookUpChild_NormalizedNamesCollide() {
+	t.resetInodeWithNameNormalization(NormalizeUnicodeAndCase)
+	err := storageutil.CreateEmptyObjects(t.ctx, t.bucket, []string{dirInodeName + "Foo", dirInodeName + "foo/"})
+	AssertEq(nil, err)
+
+	_, err = t.in.LookUpChild(t.ctx, "FOO")
+	ExpectTrue(errors.Is(err, syscall.ENOTUNIQ), "err: %v", err)
+
+	// Exact matches are unaffected.
+	result, err := t.in.LookUpChild(t.ctx, "Foo")
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(dirInodeName+"Foo", result.FullName.GcsObjectName())
+}
+
+func (t *DirTest) LookUpChild_NormalizedIndexFromListing() {
+	t.resetInodeWithNameNormalization(NormalizeUnicodeAndCase)
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"foo", []byte("taco"))
+	AssertEq(nil, err)
+	_, err = t.readAllEntries()
+	AssertEq(nil, err)
+
+	// A name added behind the back of the listing isn't in its index until it
+	// expires.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"bar", []byte("taco"))
+	AssertEq(nil, err)
+
+	result, err := t.in.LookUpChild(t.ctx, "BAR")
+	AssertEq(nil, err)
+	ExpectEq(nil, result)
+
+	result, err = t.in.LookUpChild(t.ctx, "FOO")
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+
+	t.clock.AdvanceTime(typeCacheTTL + time.Second)
+	result, err = t.in.LookUpChild(t.ctx, "BAR")
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(dirInodeName+"bar", result.FullName.GcsObjectName())
+}
+
+func (t *DirTest) LookUpChild_NormalizedIndexFollowsLocalChanges() {
+	t.resetInodeWithNameNormalization(NormalizeUnicodeAndCase)
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"foo", []byte("taco"))
+	AssertEq(nil, err)
+	_, err = t.readAllEntries()
+	AssertEq(nil, err)
+
+	_, err = t.in.CreateChildFile(t.ctx, "bar")
+	AssertEq(nil, err)
+	err = t.in.DeleteChildFile(t.ctx, "foo", 0, nil)
+	AssertEq(nil, err)
+
+	result, err := t.in.LookUpChild(t.ctx, "BAR")
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(dirInodeName+"bar", result.FullName.GcsObjectName())
+
+	result, err = t.in.LookUpChild(t.ctx, "FOO")
+	AssertEq(nil, err)
+	ExpectEq(nil, result)
+}
+
+func (t *DirTest) LookUpChild_NormalizedIndexFollowsRename() {
+	t.resetInodeWithNameNormalization(NormalizeUnicodeAndCase)
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, dirInodeName+"foo", []byte("taco"))
+	AssertEq(nil, err)
+	_, err = t.readAllEntries()
+	AssertEq(nil, err)
+
+	_, err = t.in.RenameFile(t.ctx, storageutil.ConvertObjToMinObject(o), dirInodeName+"bar", nil)
+	AssertEq(nil, err)
+
+	result, err := t.in.LookUpChild(t.ctx, "BAR")
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	ExpectEq(dirInodeName+"bar", result.FullName.GcsObjectName())
+
+	result, err = t.in.LookUpChild(t.ctx, "FOO")
+	AssertEq(nil, err)
+	ExpectEq(nil, result)
+}
+
 func (t *DirTest) ReadDescendants_Empty() {
 	descendants, err := t.in.ReadDescendants(t.ctx, 10)
 
@@ -910,6 +1062,75 @@ func (t *DirTest) ReadEntries_NonEmpty_ImplicitDirsEnabled() {
 	AssertFalse(d.prevDirListingTimeStamp.IsZero())
 }
 
+func (t *DirTest) ReadEntries_EncodedNames() {
+	t.in.Unlock()
+	t.in = NewDirInode(
+		dirInodeID,
+		NewDirName(NewEncodedRootName(""), dirInodeName),
+		fuseops.InodeAttributes{
+			Uid:  uid,
+			Gid:  gid,
+			Mode: dirMode,
+		},
+		true,
+		true,
+		false,
+		typeCacheTTL,
+		&t.bucket,
+		&t.clock,
+		&t.clock,
+		4,
+		false,
+		NoNameNormalization,
+		nil,
+		"",
+		metadata.TypeCacheOptions{},
+	)
+	t.in.Lock()
+
+	// Set up contents whose names can't be used as they are.
+	objs := []string{
+		dirInodeName + "%",
+		dirInodeName + "%.",
+		dirInodeName + ".",
+		dirInodeName + "/blah",
+		dirInodeName + "a",
+	}
+	err := storageutil.CreateEmptyObjects(t.ctx, t.bucket, objs)
+	AssertEq(nil, err)
+
+	// Look the entries up by their local names.
+	lookUps := []struct {
+		localName  string
+		objectName string
+	}{
+		{"%.", dirInodeName + "."},
+		{"%%.", dirInodeName + "%."},
+		{"%", dirInodeName + "/"},
+		{"%" + ConflictingFileNameSuffix, dirInodeName + "%"},
+	}
+	for _, l := range lookUps {
+		core, err := t.in.LookUpChild(t.ctx, l.localName)
+		AssertEq(nil, err)
+		AssertNe(nil, core)
+		ExpectEq(l.objectName, core.FullName.GcsObjectName())
+	}
+
+	// Read entries. The empty directory and the file named "%" have the same
+	// local name.
+	entries, err := t.readAllEntries()
+
+	AssertEq(nil, err)
+	AssertEq(5, len(entries))
+	ExpectEq("%", entries[0].Name)
+	ExpectEq("%", entries[1].Name)
+	ExpectEq("%%.", entries[2].Name)
+	ExpectEq(fuseutil.DT_File, entries[2].Type)
+	ExpectEq("%.", entries[3].Name)
+	ExpectEq(fuseutil.DT_File, entries[3].Type)
+	ExpectEq("a", entries[4].Name)
+}
+
 func (t *DirTest) ReadEntries_TypeCaching() {
 	const name = "qux"
 	fileObjName := path.Join(dirInodeName, name)
@@ -1055,7 +1276,7 @@ func (t *DirTest) CloneToChildFile_SourceDoesntExist() {
 
 	// Call the inode.
 	srcMinObject := storageutil.ConvertObjToMinObject(src)
-	_, err = t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject)
+	_, err = t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject, nil)
 	var notFoundErr *gcs.NotFoundError
 	ExpectTrue(errors.As(err, &notFoundErr))
 	ExpectEq(metadata.UnknownType, t.getTypeFromCache(dstName))
@@ -1071,7 +1292,7 @@ func (t *DirTest) CloneToChildFile_DestinationDoesntExist() {
 
 	// Call the inode.
 	srcMinObject := storageutil.ConvertObjToMinObject(src)
-	result, err := t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject)
+	result, err := t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject, nil)
 	AssertEq(nil, err)
 	AssertNe(nil, result)
 	AssertNe(nil, result.MinObject)
@@ -1103,7 +1324,7 @@ func (t *DirTest) CloneToChildFile_DestinationExists() {
 
 	// Call the inode.
 	srcMinObject := storageutil.ConvertObjToMinObject(src)
-	result, err := t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject)
+	result, err := t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject, nil)
 	AssertEq(nil, err)
 	AssertNe(nil, result)
 	AssertNe(nil, result.MinObject)
@@ -1122,6 +1343,30 @@ func (t *DirTest) CloneToChildFile_DestinationExists() {
 	ExpectEq(metadata.RegularFileType, t.getTypeFromCache("qux"))
 }
 
+func (t *DirTest) CloneToChildFile_DestinationExistsWithDoesNotExistPrecondition() {
+	const srcName = "blah/baz"
+	dstName := path.Join(dirInodeName, "qux")
+
+	// Create the source.
+	src, err := storageutil.CreateObject(t.ctx, t.bucket, srcName, []byte("taco"))
+	AssertEq(nil, err)
+
+	// And a destination object that must not be overwritten.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, dstName, []byte("burrito"))
+	AssertEq(nil, err)
+
+	// Call the inode.
+	srcMinObject := storageutil.ConvertObjToMinObject(src)
+	var precondition int64
+	_, err = t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject, &precondition)
+
+	var preconditionErr *gcs.PreconditionError
+	ExpectTrue(errors.As(err, &preconditionErr))
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, dstName)
+	AssertEq(nil, err)
+	ExpectEq("burrito", string(contents))
+}
+
 func (t *DirTest) CloneToChildFile_TypeCaching() {
 	const srcName = "blah/baz"
 	dstName := path.Join(dirInodeName, "qux")
@@ -1134,7 +1379,7 @@ func (t *DirTest) CloneToChildFile_TypeCaching() {
 
 	// Clone to the destination.
 	srcMinObject := storageutil.ConvertObjToMinObject(src)
-	_, err = t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject)
+	_, err = t.in.CloneToChildFile(t.ctx, path.Base(dstName), srcMinObject, nil)
 	AssertEq(nil, err)
 
 	// Create a backing object for a directory.
@@ -1200,6 +1445,73 @@ func (t *DirTest) CreateChildSymlink_Exists() {
 	ExpectEq(metadata.UnknownType, t.getTypeFromCache(name))
 }
 
+func (t *DirTest) CreateChildSpecialFile_DoesntExist() {
+	const name = "qux"
+	objName := path.Join(dirInodeName, name)
+
+	// Call the inode.
+	result, err := t.in.CreateChildSpecialFile(t.ctx, name, os.ModeDevice|os.ModeCharDevice|0600, 0x0103)
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	AssertNe(nil, result.MinObject)
+	ExpectEq(metadata.SpecialFileType, t.getTypeFromCache(name))
+	ExpectEq(metadata.SpecialFileType, result.Type())
+
+	ExpectEq(objName, result.MinObject.Name)
+	ExpectEq(0, result.MinObject.Size)
+	ExpectEq(NodeTypeChar, result.MinObject.Metadata[NodeTypeMetadataKey])
+	ExpectEq("259", result.MinObject.Metadata[RdevMetadataKey])
+}
+
+func (t *DirTest) CreateChildSpecialFile_Exists() {
+	const name = "qux"
+	objName := path.Join(dirInodeName, name)
+
+	var err error
+
+	// Create an existing backing object.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, objName, []byte("taco"))
+	AssertEq(nil, err)
+
+	// Call the inode.
+	_, err = t.in.CreateChildSpecialFile(t.ctx, name, os.ModeNamedPipe|0600, 0)
+	ExpectThat(err, Error(HasSubstr("Precondition")))
+}
+
+func (t *DirTest) CreateChildHardLink_DoesntExist() {
+	const name = "qux"
+	const content = HardLinkContentPrefix + "taco"
+	objName := path.Join(dirInodeName, name)
+
+	// Call the inode.
+	result, err := t.in.CreateChildHardLink(t.ctx, name, content)
+	AssertEq(nil, err)
+	AssertNe(nil, result)
+	AssertNe(nil, result.MinObject)
+	ExpectEq(metadata.RegularFileType, t.getTypeFromCache(name))
+
+	ExpectEq(objName, result.MinObject.Name)
+	ExpectEq(0, result.MinObject.Size)
+	ExpectTrue(IsHardLink(result.MinObject))
+	ExpectEq(content, HardLinkTarget(result.MinObject))
+}
+
+func (t *DirTest) CreateChildHardLink_Exists() {
+	const name = "qux"
+	objName := path.Join(dirInodeName, name)
+
+	var err error
+
+	// Create an existing backing object.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, objName, []byte(""))
+	AssertEq(nil, err)
+
+	// Call the inode.
+	_, err = t.in.CreateChildHardLink(t.ctx, name, HardLinkContentPrefix+"taco")
+	ExpectThat(err, Error(HasSubstr("Precondition")))
+	ExpectThat(err, Error(HasSubstr("exists")))
+}
+
 func (t *DirTest) CreateChildSymlink_TypeCaching() {
 	const name = "qux"
 	linkObjName := path.Join(dirInodeName, name)
@@ -15,12 +15,18 @@
 package inode
 
 import (
+	"errors"
+	"fmt"
+	"syscall"
 	"time"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
 )
 
 // An inode representing a directory backed by an object in GCS with a specific
@@ -45,7 +51,11 @@ func NewExplicitDirInode(
 	mtimeClock timeutil.Clock,
 	cacheClock timeutil.Clock,
 	typeCacheMaxSizeMB int64,
-	enableHNS bool) (d ExplicitDirInode) {
+	enableHNS bool,
+	nameNormalization NameNormalization,
+	metadataDiskCache *metadata.DiskCache,
+	objectPrefix string,
+	typeCacheOptions metadata.TypeCacheOptions) (d ExplicitDirInode) {
 	wrapped := NewDirInode(
 		id,
 		name,
@@ -58,7 +68,11 @@ func NewExplicitDirInode(
 		mtimeClock,
 		cacheClock,
 		typeCacheMaxSizeMB,
-		enableHNS)
+		enableHNS,
+		nameNormalization,
+		metadataDiskCache,
+		objectPrefix,
+		typeCacheOptions)
 
 	dirInode := &explicitDirInode{
 		dirInode: wrapped.(*dirInode),
@@ -76,6 +90,8 @@ func NewExplicitDirInode(
 	return
 }
 
+var _ PosixAttributesInode = &explicitDirInode{}
+
 type explicitDirInode struct {
 	*dirInode
 	generation Generation
@@ -85,3 +101,46 @@ func (d *explicitDirInode) SourceGeneration() (gen Generation) {
 	gen = d.generation
 	return
 }
+
+// SetPosixAttributes persists mode, ownership and atime changes in the
+// metadata of the directory's backing object. Folders in hierarchical buckets
+// have no such object, so for them this returns syscall.ENOTSUP.
+//
+// LOCKS_REQUIRED(d)
+func (d *explicitDirInode) SetPosixAttributes(ctx context.Context, p PosixAttributes) (err error) {
+	if p.IsEmpty() {
+		return
+	}
+
+	if d.generation.Object == 0 {
+		err = syscall.ENOTSUP
+		return
+	}
+
+	req := &gcs.UpdateObjectRequest{
+		Name:                       d.Name().GcsObjectName(),
+		Generation:                 d.generation.Object,
+		MetaGenerationPrecondition: &d.generation.Metadata,
+		Metadata:                   p.metadata(),
+	}
+
+	o, err := d.bucket.UpdateObject(ctx, req)
+
+	var notFoundErr *gcs.NotFoundError
+	var preconditionErr *gcs.PreconditionError
+	if errors.As(err, &notFoundErr) || errors.As(err, &preconditionErr) {
+		err = &gcsfuse_errors.FileClobberedError{
+			Err: fmt.Errorf("UpdateObject: %w", err),
+		}
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("UpdateObject: %w", err)
+		return
+	}
+
+	d.generation.Metadata = o.MetaGeneration
+	ApplyPosixMetadata(&d.attrs, o.Metadata)
+	return
+}
@@ -18,11 +18,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/bufferedwrites"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
@@ -30,17 +33,39 @@ import (
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse"
 	"github.com/jacobsa/fuse/fuseops"
 	"github.com/jacobsa/syncutil"
 	"github.com/jacobsa/timeutil"
 	"golang.org/x/net/context"
 	"golang.org/x/sync/semaphore"
+	"golang.org/x/sys/unix"
 )
 
 // A GCS object metadata key for file mtimes. mtimes are UTC, and are stored in
 // the format defined by time.RFC3339Nano.
 const FileMtimeMetadataKey = gcs.MtimeMetadataKey
 
+// PreconditionErrorsConflictCopy is the value of the precondition-errors
+// setting under which our contents for an object clobbered by a concurrent
+// writer are written to a conflict copy (see ConflictCopyName), rather than
+// being dropped ("false") or reported as ESTALE ("true").
+const PreconditionErrorsConflictCopy = "conflict-copy"
+
+// The number of names tried for a conflict copy before giving up.
+const maxConflictCopyAttempts = 10
+
+// ConflictCopyName returns the name of the sibling object to which our
+// contents for the named object are written when a concurrent writer clobbers
+// the given generation of it and conflict copies are enabled. Should the name
+// be taken, a non-zero attempt gives a different one.
+func ConflictCopyName(objectName string, host string, generation int64, attempt int) string {
+	if attempt == 0 {
+		return fmt.Sprintf("%s.conflict-%s-%d", objectName, host, generation)
+	}
+	return fmt.Sprintf("%s.conflict-%s-%d-%d", objectName, host, generation, attempt)
+}
+
 type FileInode struct {
 	/////////////////////////
 	// Dependencies
@@ -104,6 +129,14 @@ type FileInode struct {
 	bwh    bufferedwrites.BufferedWriteHandler
 	config *cfg.Config
 
+	// If set, reports whether writes to the named object are streamed to GCS,
+	// in place of config.Write.EnableStreamingWrites. It is consulted whenever
+	// the answer is needed rather than once at creation, so that it reflects
+	// the rules in force for the object the inode is backed by at the time.
+	streamingWritesFor func(objectName string) bool
+
+	metricHandle common.MetricHandle
+
 	// Once write is started on the file i.e, bwh is initialized, any fileHandles
 	// opened in write mode before or after this and not yet closed are considered
 	// as writing to the file even though they are not writing.
@@ -116,9 +149,19 @@ type FileInode struct {
 	// Limits the max number of blocks that can be created across file system when
 	// streaming writes are enabled.
 	globalMaxWriteBlocksSem *semaphore.Weighted
+
+	// Custom metadata updates made through extended attributes that could not
+	// yet be applied to the backing object, because it doesn't exist yet (local
+	// files) or is being written by the buffered write handler. They are
+	// applied after the next successful flush. Nil values denote deletions.
+	//
+	// GUARDED_BY(mu)
+	pendingMetadata map[string]*string
 }
 
 var _ Inode = &FileInode{}
+var _ XattrInode = &FileInode{}
+var _ PosixAttributesInode = &FileInode{}
 
 // Create a file inode for the given min object in GCS. The initial lookup count is
 // zero.
@@ -139,7 +182,8 @@ func NewFileInode(
 	mtimeClock timeutil.Clock,
 	localFile bool,
 	cfg *cfg.Config,
-	globalMaxBlocksSem *semaphore.Weighted) (f *FileInode) {
+	globalMaxBlocksSem *semaphore.Weighted,
+	metricHandle common.MetricHandle) (f *FileInode) {
 	// Set up the basic struct.
 	var minObj gcs.MinObject
 	if m != nil {
@@ -158,6 +202,7 @@ func NewFileInode(
 		unlinked:                false,
 		config:                  cfg,
 		globalMaxWriteBlocksSem: globalMaxBlocksSem,
+		metricHandle:            metricHandle,
 	}
 	var err error
 	f.MRDWrapper, err = gcsx.NewMultiRangeDownloaderWrapper(bucket, &f.src)
@@ -311,7 +356,7 @@ func (f *FileInode) ensureContent(ctx context.Context) (err error) {
 			return err
 		}
 
-		tf, err := f.contentCache.NewTempFile(rc)
+		tf, err := f.newContent(rc)
 		if err != nil {
 			err = fmt.Errorf("NewTempFile: %w", err)
 			return err
@@ -323,6 +368,18 @@ func (f *FileInode) ensureContent(ctx context.Context) (err error) {
 	return
 }
 
+// Create a temp file for the content of the inode with the supplied initial
+// contents. If the bucket keeps changes in a local upper layer, the file is
+// created in the layer's staging directory, so that the copy up goes straight
+// to the layer and syncing moves the file into it.
+func (f *FileInode) newContent(rc io.ReadCloser) (gcsx.TempFile, error) {
+	if ul := f.bucket.UpperLayer(); ul != nil {
+		return gcsx.NewStagedTempFile(rc, ul.StagingDir(), f.mtimeClock)
+	}
+
+	return f.contentCache.NewTempFile(rc)
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Public interface
 ////////////////////////////////////////////////////////////////////////
@@ -347,6 +404,49 @@ func (f *FileInode) IsLocal() bool {
 	return f.local
 }
 
+// StreamingWritesEnabled reports whether writes to the file are streamed to
+// GCS, which may differ from the mount-wide setting if a per-path rule says so.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) StreamingWritesEnabled() bool {
+	// Writes already under way carry on the way they started.
+	if f.bwh != nil {
+		return true
+	}
+	if f.content != nil {
+		return false
+	}
+	if f.streamingWritesFor != nil {
+		return f.streamingWritesFor(f.objectName())
+	}
+	return f.config.Write.EnableStreamingWrites
+}
+
+// SetStreamingWritesRule sets the function consulted by
+// StreamingWritesEnabled.
+func (f *FileInode) SetStreamingWritesRule(streamingWritesFor func(objectName string) bool) {
+	f.streamingWritesFor = streamingWritesFor
+}
+
+// objectName returns the name of the object backing the inode, which is that
+// of the inode itself for a local file.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) objectName() string {
+	if f.src.Name != "" {
+		return f.src.Name
+	}
+	return f.name.GcsObjectName()
+}
+
+// IsDirty returns true if the inode has writes that have not yet been
+// persisted to GCS, including local files that don't yet exist in GCS.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) IsDirty() bool {
+	return !f.destroyed && (f.content != nil || f.bwh != nil)
+}
+
 func (f *FileInode) IsUnlinked() bool {
 	return f.unlinked
 }
@@ -507,6 +607,12 @@ func (f *FileInode) Attributes(
 	attrs.Atime = attrs.Mtime
 	attrs.Ctime = attrs.Mtime
 
+	// Persisted mode, ownership and atime take precedence over the mount-wide
+	// defaults.
+	if f.config.FileSystem.PersistPosixAttributes {
+		ApplyPosixMetadata(&attrs, f.effectiveMetadata())
+	}
+
 	// If the object has been clobbered, we reflect that as the inode being
 	// unlinked.
 	_, clobbered, err := f.clobbered(ctx, false, false)
@@ -516,6 +622,9 @@ func (f *FileInode) Attributes(
 	}
 
 	attrs.Nlink = 1
+	if IsHardLinkContent(f.name) {
+		attrs.Nlink = f.LinkCount()
+	}
 
 	// For local files, also checking if file is unlinked locally.
 	if clobbered || (f.IsLocal() && f.IsUnlinked()) {
@@ -765,6 +874,353 @@ func (f *FileInode) SetMtime(
 	return
 }
 
+// Return the custom metadata as seen through extended attributes, i.e. the
+// metadata of the source object with any pending updates applied.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) effectiveMetadata() map[string]string {
+	if len(f.pendingMetadata) == 0 {
+		return f.src.Metadata
+	}
+
+	m := make(map[string]string, len(f.src.Metadata)+len(f.pendingMetadata))
+	for k, v := range f.src.Metadata {
+		m[k] = v
+	}
+	for k, v := range f.pendingMetadata {
+		if v == nil {
+			delete(m, k)
+			continue
+		}
+		m[k] = *v
+	}
+	return m
+}
+
+// GetXattr returns the value of the named extended attribute. Attributes in
+// the gcs namespace involve a round trip to GCS.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) GetXattr(ctx context.Context, name string) (value string, err error) {
+	if strings.HasPrefix(name, GcsXattrPrefix) {
+		if f.IsLocal() {
+			err = fuse.ENOATTR
+			return
+		}
+
+		var o *gcs.Object
+		o, err = f.fetchLatestGcsObject(ctx)
+		if err != nil {
+			return
+		}
+
+		return gcsXattr(
+			name,
+			storageutil.ConvertObjToMinObject(o),
+			storageutil.ConvertObjToExtendedObjectAttributes(o))
+	}
+
+	key, err := metadataKeyForXattr(name)
+	if err != nil {
+		err = fuse.ENOATTR
+		return
+	}
+
+	value, ok := f.effectiveMetadata()[key]
+	if !ok {
+		err = fuse.ENOATTR
+	}
+	return
+}
+
+// ListXattr returns the names of the user namespace extended attributes of
+// the file.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) ListXattr(ctx context.Context) (names []string, err error) {
+	names = userXattrNames(f.effectiveMetadata())
+	return
+}
+
+// SetXattr sets a user namespace extended attribute. May involve a round trip
+// to GCS.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) SetXattr(
+	ctx context.Context,
+	name string,
+	value []byte,
+	flags uint32) (err error) {
+	key, err := metadataKeyForXattr(name)
+	if err != nil {
+		return
+	}
+
+	if err = validateXattrValue(value); err != nil {
+		return
+	}
+
+	_, exists := f.effectiveMetadata()[key]
+	if err = checkXattrFlags(flags, exists); err != nil {
+		return
+	}
+
+	v := string(value)
+	return f.updateMetadata(ctx, map[string]*string{key: &v})
+}
+
+// RemoveXattr removes a user namespace extended attribute. May involve a round
+// trip to GCS.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) RemoveXattr(ctx context.Context, name string) (err error) {
+	key, err := metadataKeyForXattr(name)
+	if err != nil {
+		return
+	}
+
+	if _, ok := f.effectiveMetadata()[key]; !ok {
+		err = fuse.ENOATTR
+		return
+	}
+
+	return f.updateMetadata(ctx, map[string]*string{key: nil})
+}
+
+// Update custom metadata keys of the backing object, or record the updates to
+// be applied after the next flush if the object can't be updated right now.
+// Nil values delete the key.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) updateMetadata(ctx context.Context, metadata map[string]*string) (err error) {
+	if f.IsLocal() || f.bwh != nil {
+		if f.pendingMetadata == nil {
+			f.pendingMetadata = make(map[string]*string)
+		}
+		for k, v := range metadata {
+			f.pendingMetadata[k] = v
+		}
+		return
+	}
+
+	return f.applyMetadata(ctx, metadata)
+}
+
+// SetPosixAttributes persists mode, ownership and atime changes in the
+// metadata of the backing object. May involve a round trip to GCS.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) SetPosixAttributes(ctx context.Context, p PosixAttributes) (err error) {
+	if f.IsUnlinked() || p.IsEmpty() {
+		return
+	}
+
+	return f.updateMetadata(ctx, p.metadata())
+}
+
+// Apply any metadata updates recorded while the backing object couldn't be
+// updated. This is a no-op if there are none or the object still can't be
+// updated.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) syncPendingMetadata(ctx context.Context) (err error) {
+	if len(f.pendingMetadata) == 0 || f.IsLocal() || f.bwh != nil {
+		return
+	}
+
+	err = f.applyMetadata(ctx, f.pendingMetadata)
+	if err != nil {
+		return
+	}
+
+	f.pendingMetadata = nil
+	return
+}
+
+// Update the custom metadata of the source generation of the backing object,
+// failing with FileClobberedError if it has been modified concurrently.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) applyMetadata(ctx context.Context, metadata map[string]*string) (err error) {
+	srcGen := f.SourceGeneration()
+	req := &gcs.UpdateObjectRequest{
+		Name:                       f.src.Name,
+		Generation:                 srcGen.Object,
+		MetaGenerationPrecondition: &srcGen.Metadata,
+		Metadata:                   metadata,
+	}
+
+	o, err := f.bucket.UpdateObject(ctx, req)
+
+	var notFoundErr *gcs.NotFoundError
+	var preconditionErr *gcs.PreconditionError
+	if errors.As(err, &notFoundErr) || errors.As(err, &preconditionErr) {
+		err = &gcsfuse_errors.FileClobberedError{
+			Err: fmt.Errorf("UpdateObject: %w", err),
+		}
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("UpdateObject: %w", err)
+		return
+	}
+
+	if minObj := storageutil.ConvertObjToMinObject(o); minObj != nil {
+		f.src = *minObj
+		f.updateMRDWrapper()
+	}
+	return
+}
+
+// LinkCount returns the number of hard links to the file.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) LinkCount() uint32 {
+	return linkCount(f.src.Metadata)
+}
+
+// ShareContentForHardLink prepares the file for one more hard link and returns
+// the name of the content object the new link should point at.
+//
+// If the file is already hard linked, this just increments the link count of
+// its content object. Otherwise, its contents are copied to a fresh content
+// object with two links, and the file's own object is replaced by a pointer
+// to it, after which this inode is obsolete, and the caller must make sure
+// that lookups no longer find it.
+//
+// REQUIRES: !f.IsLocal() and the file has no unflushed content.
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) ShareContentForHardLink(ctx context.Context) (contentObjectName string, err error) {
+	if IsHardLinkContent(f.name) {
+		if _, err = f.AddLinks(ctx, 1); err != nil {
+			return
+		}
+		contentObjectName = f.src.Name
+		return
+	}
+
+	contentObjectName, err = NewHardLinkContentObjectName()
+	if err != nil {
+		err = fmt.Errorf("NewHardLinkContentObjectName: %w", err)
+		return
+	}
+
+	// Copy the contents, along with the object's metadata, to the content
+	// object. Its name is random, so there is no need for a precondition on the
+	// destination.
+	content, err := f.bucket.CopyObject(ctx, &gcs.CopyObjectRequest{
+		SrcName:                       f.src.Name,
+		DstName:                       contentObjectName,
+		SrcGeneration:                 f.src.Generation,
+		SrcMetaGenerationPrecondition: &f.src.MetaGeneration,
+	})
+	if err != nil {
+		err = f.clobberedOr(fmt.Errorf("CopyObject: %w", err))
+		return
+	}
+
+	deleteContent := func() {
+		deleteErr := f.bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{
+			Name:       content.Name,
+			Generation: content.Generation,
+		})
+		if deleteErr != nil {
+			logger.Errorf("Leaked hard link content object %q: %v", content.Name, deleteErr)
+		}
+	}
+
+	two := "2"
+	content, err = f.bucket.UpdateObject(ctx, &gcs.UpdateObjectRequest{
+		Name:                       content.Name,
+		Generation:                 content.Generation,
+		MetaGenerationPrecondition: &content.MetaGeneration,
+		Metadata: map[string]*string{
+			LinkCountMetadataKey: &two,
+		},
+	})
+	if err != nil {
+		err = fmt.Errorf("UpdateObject: %w", err)
+		deleteContent()
+		return
+	}
+
+	// Replace the file's object with a pointer, failing if it has changed since
+	// we copied it.
+	_, err = f.bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:                       f.src.Name,
+		Contents:                   strings.NewReader(""),
+		Metadata:                   map[string]string{HardLinkMetadataKey: contentObjectName},
+		GenerationPrecondition:     &f.src.Generation,
+		MetaGenerationPrecondition: &f.src.MetaGeneration,
+	})
+	if err != nil {
+		err = f.clobberedOr(fmt.Errorf("CreateObject: %w", err))
+		deleteContent()
+		return
+	}
+
+	return
+}
+
+// AddLinks adjusts the link count of the hard link content object backing
+// this inode by delta, and returns the new count.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) AddLinks(ctx context.Context, delta int) (n uint32, err error) {
+	count := int64(f.LinkCount()) + int64(delta)
+	if count < 0 {
+		count = 0
+	}
+
+	v := strconv.FormatInt(count, 10)
+	if err = f.applyMetadata(ctx, map[string]*string{LinkCountMetadataKey: &v}); err != nil {
+		return
+	}
+
+	n = uint32(count)
+	return
+}
+
+// DropLink records that a hard link to the file has been removed. When the
+// last link is gone, the content object is deleted and the inode is marked as
+// unlinked.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) DropLink(ctx context.Context) (err error) {
+	n, err := f.AddLinks(ctx, -1)
+	if err != nil {
+		return
+	}
+
+	if n > 0 {
+		return
+	}
+
+	err = f.bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{
+		Name:       f.src.Name,
+		Generation: f.src.Generation,
+	})
+	if err != nil {
+		err = fmt.Errorf("DeleteObject: %w", err)
+		return
+	}
+
+	f.Unlink()
+	return
+}
+
+// Return FileClobberedError wrapping err if it is a precondition or not found
+// error, and err otherwise.
+func (f *FileInode) clobberedOr(err error) error {
+	var notFoundErr *gcs.NotFoundError
+	var preconditionErr *gcs.PreconditionError
+	if errors.As(err, &notFoundErr) || errors.As(err, &preconditionErr) {
+		return &gcsfuse_errors.FileClobberedError{Err: err}
+	}
+	return err
+}
+
 func (f *FileInode) fetchLatestGcsObject(ctx context.Context) (*gcs.Object, error) {
 	// When listObjects call is made, we fetch data with projection set as noAcl
 	// which means acls and owner properties are not returned. So the f.src object
@@ -819,6 +1275,10 @@ func (f *FileInode) Sync(ctx context.Context) (gcsSynced bool, err error) {
 	if err != nil {
 		return false, err
 	}
+	err = f.syncPendingMetadata(ctx)
+	if err != nil {
+		return true, err
+	}
 	return true, nil
 }
 
@@ -832,20 +1292,26 @@ func (f *FileInode) syncUsingContent(ctx context.Context) error {
 		var err error
 		latestGcsObj, err = f.fetchLatestGcsObject(ctx)
 		if err != nil {
-			return err
+			return f.writeConflictCopyOr(ctx, err)
 		}
 	}
 
 	// Write out the contents if they are dirty.
 	// Object properties are also synced as part of content sync. Hence, passing
 	// the latest object fetched from gcs which has all the properties populated.
-	newObj, err := f.bucket.SyncObject(ctx, f.Name().GcsObjectName(), latestGcsObj, f.content)
+	var newObj *gcs.Object
+	var err error
+	if ul := f.bucket.UpperLayer(); ul != nil && !f.localFileCache {
+		newObj, err = f.syncToUpperLayer(ctx, ul, latestGcsObj)
+	} else {
+		newObj, err = f.bucket.SyncObject(ctx, f.Name().GcsObjectName(), latestGcsObj, f.content)
+	}
 
 	var preconditionErr *gcs.PreconditionError
 	if errors.As(err, &preconditionErr) {
-		return &gcsfuse_errors.FileClobberedError{
+		return f.writeConflictCopyOr(ctx, &gcsfuse_errors.FileClobberedError{
 			Err: fmt.Errorf("SyncObject: %w", err),
-		}
+		})
 	}
 
 	// Propagate other errors.
@@ -858,6 +1324,98 @@ func (f *FileInode) syncUsingContent(ctx context.Context) error {
 	return nil
 }
 
+// Sync the content, which was created in the staging directory of the
+// supplied upper layer (see newContent), by moving it into the layer, unless
+// it is unchanged from the supplied object.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) syncToUpperLayer(ctx context.Context, ul gcsx.UpperLayer, latestGcsObj *gcs.Object) (*gcs.Object, error) {
+	sr, err := f.content.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("Stat: %w", err)
+	}
+
+	if latestGcsObj != nil && sr.Size == int64(latestGcsObj.Size) && sr.DirtyThreshold == sr.Size {
+		return nil, nil
+	}
+
+	req := gcs.NewCreateObjectRequest(latestGcsObj, f.Name().GcsObjectName(), sr.Mtime, f.config.GcsRetries.ChunkTransferTimeoutSecs)
+	o, err := ul.CreateObjectFromFile(ctx, req, f.content.Name())
+	if err != nil {
+		return nil, fmt.Errorf("CreateObjectFromFile: %w", err)
+	}
+
+	return o, nil
+}
+
+// If conflict copies are enabled and err says that the backing object was
+// clobbered, write our contents and metadata to a new sibling object (see
+// ConflictCopyName) rather than losing them, and return nil. Otherwise return
+// err unchanged.
+//
+// The inode is left pointing at the generation it was based on, so that it is
+// replaced by one for the other writer's object on the next lookup.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) writeConflictCopyOr(ctx context.Context, err error) error {
+	var clobberedErr *gcsfuse_errors.FileClobberedError
+	if f.config.FileSystem.PreconditionErrors != PreconditionErrorsConflictCopy || f.content == nil || !errors.As(err, &clobberedErr) {
+		return err
+	}
+
+	host, hostErr := os.Hostname()
+	if hostErr != nil || host == "" {
+		host = "unknown"
+	}
+
+	sr, statErr := f.content.Stat()
+	if statErr != nil {
+		return fmt.Errorf("Stat: %w", statErr)
+	}
+
+	// The copy carries the metadata we would have written, including extended
+	// attributes and POSIX attributes not yet applied to the object.
+	metadata := make(map[string]string)
+	for k, v := range f.effectiveMetadata() {
+		metadata[k] = v
+	}
+	if sr.Mtime != nil {
+		metadata[FileMtimeMetadataKey] = sr.Mtime.UTC().Format(time.RFC3339Nano)
+	}
+
+	// Never overwrite an existing object, e.g. a copy left by an earlier
+	// conflict over the same generation.
+	var o *gcs.Object
+	var createErr error
+	for attempt := 0; attempt < maxConflictCopyAttempts; attempt++ {
+		var zero int64
+		o, createErr = f.bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+			Name:                   ConflictCopyName(f.Name().GcsObjectName(), host, f.src.Generation, attempt),
+			Contents:               io.NewSectionReader(f.content, 0, sr.Size),
+			Metadata:               metadata,
+			GenerationPrecondition: &zero,
+		})
+
+		var preconditionErr *gcs.PreconditionError
+		if !errors.As(createErr, &preconditionErr) {
+			break
+		}
+	}
+	if createErr != nil {
+		return fmt.Errorf("writing conflict copy after %v: %w", err, createErr)
+	}
+
+	logger.Warnf("%q was modified concurrently; wrote our contents to %q instead.", f.Name().GcsObjectName(), o.Name)
+	f.metricHandle.ConflictCopyCount(ctx, 1, nil)
+
+	// Our contents and metadata now live in the conflict copy.
+	f.content.Destroy()
+	f.content = nil
+	f.pendingMetadata = nil
+
+	return nil
+}
+
 // Flush writes out contents to GCS. If this fails due to the generation
 // having been clobbered, failure is propagated back to the calling
 // function as an error.
@@ -876,9 +1434,15 @@ func (f *FileInode) Flush(ctx context.Context) (err error) {
 	// Flush using the appropriate method based on whether we're using a
 	// buffered write handler.
 	if f.bwh != nil {
-		return f.flushUsingBufferedWriteHandler()
+		err = f.flushUsingBufferedWriteHandler()
+	} else {
+		err = f.syncUsingContent(ctx)
 	}
-	return f.syncUsingContent(ctx)
+	if err != nil {
+		return
+	}
+
+	return f.syncPendingMetadata(ctx)
 }
 
 func (f *FileInode) updateInodeStateAfterSync(minObj *gcs.MinObject) {
@@ -940,6 +1504,52 @@ func (f *FileInode) Truncate(
 	return
 }
 
+// Fallocate preallocates the given range of the file, with semantics matching
+// fallocate(2). Only mode 0 and FALLOC_FL_KEEP_SIZE are supported.
+//
+// LOCKS_REQUIRED(f.mu)
+func (f *FileInode) Fallocate(
+	ctx context.Context,
+	mode uint32,
+	offset int64,
+	length int64) (err error) {
+	if mode&^unix.FALLOC_FL_KEEP_SIZE != 0 {
+		return syscall.EOPNOTSUPP
+	}
+
+	err = f.initBufferedWriteHandlerIfEligible(ctx)
+	if err != nil {
+		return err
+	}
+
+	if f.bwh != nil {
+		// Reserving space has no visible effect on a streamed object, and neither
+		// does preallocating a range that has already been written.
+		if mode&unix.FALLOC_FL_KEEP_SIZE != 0 || offset+length <= f.bwh.WriteFileInfo().TotalSize {
+			return nil
+		}
+
+		// Fall back to temp file, as for out-of-order writes.
+		logger.Infof("Preallocation past the end of the file detected. Falling back to temporary file on disk.")
+		err = f.flushUsingBufferedWriteHandler()
+		if err != nil {
+			return fmt.Errorf("could not finalize what has been written so far: %w", err)
+		}
+	}
+
+	// Make sure f.content != nil.
+	err = f.ensureContent(ctx)
+	if err != nil {
+		err = fmt.Errorf("ensureContent: %w", err)
+		return
+	}
+
+	// Call through.
+	err = f.content.Fallocate(mode, offset, length)
+
+	return
+}
+
 // Ensures cache content on read if content cache enabled
 func (f *FileInode) CacheEnsureContent(ctx context.Context) (err error) {
 	if f.localFileCache {
@@ -961,7 +1571,10 @@ func (f *FileInode) CreateBufferedOrTempWriter(ctx context.Context) (err error)
 
 	// Creating a file with no contents. The contents will be updated with
 	// writeFile operations.
-	f.content, err = f.contentCache.NewTempFile(io.NopCloser(strings.NewReader("")))
+	f.content, err = f.newContent(io.NopCloser(strings.NewReader("")))
+	if err != nil {
+		return
+	}
 	// Setting the initial mtime to creation time.
 	f.content.SetMtime(f.mtimeClock.Now())
 	return
@@ -974,7 +1587,7 @@ func (f *FileInode) initBufferedWriteHandlerIfEligible(ctx context.Context) erro
 	}
 
 	tempFileInUse := f.content != nil
-	if f.src.Size != 0 || !f.config.Write.EnableStreamingWrites || tempFileInUse {
+	if f.src.Size != 0 || !f.StreamingWritesEnabled() || tempFileInUse {
 		// bwh should not be initialized under these conditions.
 		return nil
 	}
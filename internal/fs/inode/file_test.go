@@ -22,10 +22,12 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
@@ -41,6 +43,7 @@ import (
 	"github.com/stretchr/testify/suite"
 	"golang.org/x/net/context"
 	"golang.org/x/sync/semaphore"
+	"golang.org/x/sys/unix"
 )
 
 ////////////////////////////////////////////////////////////////////////
@@ -151,7 +154,8 @@ func (t *FileTest) createInodeWithLocalParam(fileName string, local bool) {
 		&t.clock,
 		local,
 		&cfg.Config{},
-		semaphore.NewWeighted(math.MaxInt64))
+		semaphore.NewWeighted(math.MaxInt64),
+		common.NewNoopMetrics())
 
 	t.in.Lock()
 }
@@ -195,6 +199,26 @@ func (t *FileTest) TestSourceGenerationIsAuthoritativeReturnsFalseAfterWrite() {
 	assert.False(t.T(), t.in.SourceGenerationIsAuthoritative())
 }
 
+func (t *FileTest) TestIsDirty() {
+	assert.False(t.T(), t.in.IsDirty())
+
+	assert.NoError(t.T(), t.in.Write(t.ctx, []byte("taco"), 0))
+	assert.True(t.T(), t.in.IsDirty())
+
+	_, err := t.in.Sync(t.ctx)
+	require.NoError(t.T(), err)
+	assert.False(t.T(), t.in.IsDirty())
+}
+
+func (t *FileTest) TestIsDirtyForLocalFile() {
+	t.createInodeWithLocalParam("test", true)
+	require.NoError(t.T(), t.in.CreateBufferedOrTempWriter(t.ctx))
+	assert.True(t.T(), t.in.IsDirty())
+
+	require.NoError(t.T(), t.in.Flush(t.ctx))
+	assert.False(t.T(), t.in.IsDirty())
+}
+
 func (t *FileTest) TestSyncPendingBufferedWritesReturnsNilAndNoOpForNonStreamingWrites() {
 	contents, err := storageutil.ReadObject(t.ctx, t.bucket, t.in.Name().GcsObjectName())
 	require.NoError(t.T(), err)
@@ -1046,6 +1070,93 @@ func (t *FileTest) TestTruncateDownwardWhenStreamingWritesAreEnabled() {
 	}
 }
 
+func (t *FileTest) TestFallocateExtendsFile() {
+	err := t.in.Fallocate(t.ctx, 0, 2, 8)
+	require.NoError(t.T(), err)
+
+	attrs, err := t.in.Attributes(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(10), attrs.Size)
+	// The extension is zero-filled when synced.
+	_, err = t.in.Sync(t.ctx)
+	require.NoError(t.T(), err)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, t.in.Name().GcsObjectName())
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.initialContents+strings.Repeat("\x00", 6), string(contents))
+}
+
+func (t *FileTest) TestFallocateKeepSize() {
+	err := t.in.Fallocate(t.ctx, unix.FALLOC_FL_KEEP_SIZE, 0, 1<<20)
+	require.NoError(t.T(), err)
+
+	attrs, err := t.in.Attributes(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(len(t.initialContents)), attrs.Size)
+}
+
+func (t *FileTest) TestFallocateUnsupportedMode() {
+	err := t.in.Fallocate(t.ctx, unix.FALLOC_FL_KEEP_SIZE|unix.FALLOC_FL_PUNCH_HOLE, 0, 2)
+
+	assert.ErrorIs(t.T(), err, syscall.EOPNOTSUPP)
+	assert.Nil(t.T(), t.in.content)
+}
+
+func (t *FileTest) TestFallocateWithinWrittenRangeWhenStreamingWritesAreEnabled() {
+	tbl := []struct {
+		name   string
+		mode   uint32
+		length int64
+	}{
+		{
+			name:   "WithinWrittenRange",
+			mode:   0,
+			length: 2,
+		},
+		{
+			name:   "KeepSize",
+			mode:   unix.FALLOC_FL_KEEP_SIZE,
+			length: 10,
+		},
+	}
+	for _, tc := range tbl {
+		t.Run(tc.name, func() {
+			t.createInodeWithLocalParam("test", true)
+			t.in.config = &cfg.Config{Write: *getWriteConfig()}
+			require.NoError(t.T(), t.in.CreateBufferedOrTempWriter(t.ctx))
+			require.NoError(t.T(), t.in.Write(t.ctx, []byte("hi"), 0))
+
+			err := t.in.Fallocate(t.ctx, tc.mode, 0, tc.length)
+
+			require.NoError(t.T(), err)
+			// The inode keeps streaming.
+			assert.NotNil(t.T(), t.in.bwh)
+			assert.Nil(t.T(), t.in.content)
+			assert.Equal(t.T(), int64(2), t.in.bwh.WriteFileInfo().TotalSize)
+		})
+	}
+}
+
+func (t *FileTest) TestFallocatePastWrittenRangeWhenStreamingWritesAreEnabled() {
+	t.createInodeWithLocalParam("test", true)
+	t.in.config = &cfg.Config{Write: *getWriteConfig()}
+	require.NoError(t.T(), t.in.CreateBufferedOrTempWriter(t.ctx))
+	require.NoError(t.T(), t.in.Write(t.ctx, []byte("hi"), 0))
+
+	err := t.in.Fallocate(t.ctx, 0, 0, 10)
+
+	require.NoError(t.T(), err)
+	// What had been streamed was finalized, and the inode fell back to a temp
+	// file.
+	assert.Nil(t.T(), t.in.bwh)
+	assert.NotNil(t.T(), t.in.content)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, t.in.Name().GcsObjectName())
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "hi", string(contents))
+	attrs, err := t.in.Attributes(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(10), attrs.Size)
+}
+
 func (t *FileTest) TestSyncFlush_Clobbered() {
 	testcases := []struct {
 		name     string
@@ -1111,6 +1222,69 @@ func (t *FileTest) TestSyncFlush_Clobbered() {
 	}
 }
 
+func (t *FileTest) TestSyncFlush_ClobberedWritesConflictCopy() {
+	t.in.config = &cfg.Config{FileSystem: cfg.FileSystemConfig{PreconditionErrors: PreconditionErrorsConflictCopy}}
+	err := t.in.Truncate(t.ctx, 2)
+	require.NoError(t.T(), err)
+	// Clobber the backing object.
+	newObj, err := storageutil.CreateObject(
+		t.ctx,
+		t.bucket,
+		t.in.Name().GcsObjectName(),
+		[]byte("burrito"))
+	require.NoError(t.T(), err)
+
+	gcsSynced, err := t.in.Sync(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.True(t.T(), gcsSynced)
+	assert.Nil(t.T(), t.in.content)
+	// The other writer's object is left alone.
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: t.in.Name().GcsObjectName()})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), newObj.Generation, m.Generation)
+	// Our contents are in the conflict copy.
+	host, err := os.Hostname()
+	require.NoError(t.T(), err)
+	contents, err := storageutil.ReadObject(
+		t.ctx,
+		t.bucket,
+		ConflictCopyName(t.in.Name().GcsObjectName(), host, t.backingObj.Generation, 0))
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.initialContents[:2], string(contents))
+}
+
+func (t *FileTest) TestSyncFlush_ConflictCopyKeepsMetadataAndExistingCopies() {
+	t.in.config = &cfg.Config{FileSystem: cfg.FileSystemConfig{PreconditionErrors: PreconditionErrorsConflictCopy}}
+	err := t.in.Truncate(t.ctx, 2)
+	require.NoError(t.T(), err)
+	value := "salsa"
+	t.in.pendingMetadata = map[string]*string{"user.sauce": &value}
+	host, err := os.Hostname()
+	require.NoError(t.T(), err)
+	// An earlier conflict copy of the same generation exists already.
+	earlierName := ConflictCopyName(t.in.Name().GcsObjectName(), host, t.backingObj.Generation, 0)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, earlierName, []byte("enchilada"))
+	require.NoError(t.T(), err)
+	// Clobber the backing object.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, t.in.Name().GcsObjectName(), []byte("burrito"))
+	require.NoError(t.T(), err)
+
+	_, err = t.in.Sync(t.ctx)
+
+	require.NoError(t.T(), err)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, earlierName)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "enchilada", string(contents))
+	copyName := ConflictCopyName(t.in.Name().GcsObjectName(), host, t.backingObj.Generation, 1)
+	contents, err = storageutil.ReadObject(t.ctx, t.bucket, copyName)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.initialContents[:2], string(contents))
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: copyName})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "salsa", m.Metadata["user.sauce"])
+}
+
 func (t *FileTest) TestOpenReader_ThrowsFileClobberedError() {
 	// Modify the file locally.
 	err := t.in.Truncate(t.ctx, 2)
@@ -0,0 +1,92 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+)
+
+// Hard links are emulated with two kinds of objects. Each link is a zero-byte
+// pointer object tagged with HardLinkMetadataKey, whose value is the name of
+// a content object shared by all links to the file. The content object lives
+// under HardLinkContentPrefix, and records the number of links pointing at it
+// under LinkCountMetadataKey. All links to a file resolve to the single inode
+// of the content object.
+const (
+	HardLinkMetadataKey   = "gcsfuse_hardlink_target"
+	LinkCountMetadataKey  = "gcsfuse_nlink"
+	HardLinkContentPrefix = ".gcsfuse_links/"
+)
+
+// IsHardLink Does the supplied object represent a hard link pointer?
+func IsHardLink(m *gcs.MinObject) bool {
+	if m == nil {
+		return false
+	}
+
+	_, ok := m.Metadata[HardLinkMetadataKey]
+	return ok
+}
+
+// HardLinkTarget returns the name of the content object the supplied pointer
+// object refers to.
+//
+// REQUIRES: IsHardLink(m)
+func HardLinkTarget(m *gcs.MinObject) string {
+	return m.Metadata[HardLinkMetadataKey]
+}
+
+// IsHardLinkContent Does the supplied name refer to a hard link content object?
+func IsHardLinkContent(name Name) bool {
+	return strings.HasPrefix(name.objectName, HardLinkContentPrefix)
+}
+
+// NewHardLinkContentName returns the name of the content object with the given
+// object name, in the same bucket as the supplied link.
+func NewHardLinkContentName(link Name, contentObjectName string) Name {
+	return NewDescendantName(link, contentObjectName)
+}
+
+// NewHardLinkContentObjectName chooses a fresh object name for the content of
+// a file that is about to be hard linked for the first time.
+func NewHardLinkContentObjectName() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	return HardLinkContentPrefix + hex.EncodeToString(b[:]), nil
+}
+
+// Return the link count recorded in the supplied content object metadata.
+// Objects that aren't hard link content have a single link.
+func linkCount(metadata map[string]string) uint32 {
+	v, ok := metadata[LinkCountMetadataKey]
+	if !ok {
+		return 1
+	}
+
+	n, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 1
+	}
+
+	return uint32(n)
+}
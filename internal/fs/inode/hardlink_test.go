@@ -0,0 +1,147 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/contentcache"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestIsHardLink(t *testing.T) {
+	assert.False(t, IsHardLink(nil))
+	assert.False(t, IsHardLink(&gcs.MinObject{}))
+	assert.True(t, IsHardLink(&gcs.MinObject{Metadata: map[string]string{HardLinkMetadataKey: "x"}}))
+}
+
+func TestLinkCount(t *testing.T) {
+	assert.Equal(t, uint32(1), linkCount(nil))
+	assert.Equal(t, uint32(1), linkCount(map[string]string{LinkCountMetadataKey: "many"}))
+	assert.Equal(t, uint32(3), linkCount(map[string]string{LinkCountMetadataKey: "3"}))
+}
+
+func TestNewHardLinkContentObjectName(t *testing.T) {
+	a, err := NewHardLinkContentObjectName()
+	require.NoError(t, err)
+	b, err := NewHardLinkContentObjectName()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(a, HardLinkContentPrefix))
+	assert.True(t, IsHardLinkContent(NewHardLinkContentName(NewRootName(""), a)))
+	assert.NotEqual(t, a, b)
+}
+
+////////////////////////////////////////////////////////////////////////
+// FileInode
+////////////////////////////////////////////////////////////////////////
+
+// Replace t.in with an inode for the supplied hard link content object.
+func (t *FileTest) createContentInode(contentObjectName string) {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: contentObjectName})
+	require.NoError(t.T(), err)
+	syncerBucket := gcsx.NewSyncerBucket(1, ChunkTransferTimeoutSecs, ".gcsfuse_tmp/", t.bucket)
+
+	t.in.Unlock()
+	t.in = NewFileInode(
+		fileInodeID+1,
+		NewHardLinkContentName(NewRootName(""), contentObjectName),
+		m,
+		fuseops.InodeAttributes{Uid: uid, Gid: gid, Mode: fileMode},
+		&syncerBucket,
+		false, // localFileCache
+		contentcache.New("", &t.clock),
+		&t.clock,
+		false,
+		&cfg.Config{},
+		semaphore.NewWeighted(math.MaxInt64),
+		common.NewNoopMetrics())
+	t.in.Lock()
+}
+
+func (t *FileTest) TestShareContentForHardLinkConvertsFile() {
+	contentObjectName, err := t.in.ShareContentForHardLink(t.ctx)
+	require.NoError(t.T(), err)
+
+	// The original object is now a pointer.
+	m := t.statBackingObject()
+	assert.True(t.T(), IsHardLink(m))
+	assert.Equal(t.T(), contentObjectName, HardLinkTarget(m))
+	assert.Equal(t.T(), uint64(0), m.Size)
+
+	// The content object holds the data and two links.
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, contentObjectName)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.initialContents, string(contents))
+	t.createContentInode(contentObjectName)
+	assert.Equal(t.T(), uint32(2), t.in.LinkCount())
+	attrs, err := t.in.Attributes(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint32(2), attrs.Nlink)
+	assert.Equal(t.T(), uint64(len(t.initialContents)), attrs.Size)
+}
+
+func (t *FileTest) TestShareContentForHardLinkIncrementsLinkCount() {
+	contentObjectName, err := t.in.ShareContentForHardLink(t.ctx)
+	require.NoError(t.T(), err)
+	t.createContentInode(contentObjectName)
+
+	name, err := t.in.ShareContentForHardLink(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), contentObjectName, name)
+	assert.Equal(t.T(), uint32(3), t.in.LinkCount())
+	assert.Equal(t.T(), "3", t.statBackingObject().Metadata[LinkCountMetadataKey])
+}
+
+func (t *FileTest) TestShareContentForHardLinkClobbered() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, t.in.Name().GcsObjectName(), []byte("burrito"))
+	require.NoError(t.T(), err)
+
+	_, err = t.in.ShareContentForHardLink(t.ctx)
+
+	assert.Error(t.T(), err)
+	assert.False(t.T(), IsHardLink(t.statBackingObject()))
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: HardLinkContentPrefix})
+	require.NoError(t.T(), err)
+	assert.Empty(t.T(), listing.MinObjects)
+}
+
+func (t *FileTest) TestDropLinkDeletesContentWithLastLink() {
+	contentObjectName, err := t.in.ShareContentForHardLink(t.ctx)
+	require.NoError(t.T(), err)
+	t.createContentInode(contentObjectName)
+
+	require.NoError(t.T(), t.in.DropLink(t.ctx))
+	assert.Equal(t.T(), uint32(1), t.in.LinkCount())
+	assert.False(t.T(), t.in.IsUnlinked())
+
+	require.NoError(t.T(), t.in.DropLink(t.ctx))
+	assert.True(t.T(), t.in.IsUnlinked())
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: contentObjectName})
+	var notFoundErr *gcs.NotFoundError
+	assert.True(t.T(), errors.As(err, &notFoundErr))
+}
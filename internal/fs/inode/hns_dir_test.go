@@ -107,6 +107,10 @@ func (t *hnsDirTest) resetDirInodeWithTypeCacheConfigs(implicitDirs, enableNonex
 		&t.fixedTime,
 		typeCacheMaxSizeMB,
 		true,
+		NoNameNormalization,
+		nil,
+		"",
+		metadata.TypeCacheOptions{},
 	)
 
 	d := t.in.(*dirInode)
@@ -136,6 +140,10 @@ func (t *hnsDirTest) createDirInode(dirInodeName string) DirInode {
 		&t.fixedTime,
 		4,
 		false,
+		NoNameNormalization,
+		nil,
+		"",
+		metadata.TypeCacheOptions{},
 	)
 }
 
@@ -362,7 +370,7 @@ func (t *HNSDirTest) TestRenameFileWithGivenName() {
 	t.mockBucket.On("MoveObject", t.ctx, &moveObjectReq).Return(&newObj, nil)
 
 	// Attempt to rename the file.
-	f, err := t.in.RenameFile(t.ctx, &oldObj, path.Join(dirInodeName, renameFileName))
+	f, err := t.in.RenameFile(t.ctx, &oldObj, path.Join(dirInodeName, renameFileName), nil)
 
 	t.mockBucket.AssertExpectations(t.T())
 	// Verify the renamed file exists.
@@ -389,7 +397,7 @@ func (t *HNSDirTest) TestRenameFileWithNonExistentSourceFile() {
 	t.mockBucket.On("MoveObject", t.ctx, &moveObjectReq).Return(nil, &gcs.NotFoundError{})
 
 	// Attempt to rename the file.
-	f, err := t.in.RenameFile(t.ctx, &oldObj, newObjName)
+	f, err := t.in.RenameFile(t.ctx, &oldObj, newObjName, nil)
 
 	t.mockBucket.AssertExpectations(t.T())
 	assert.True(t.T(), errors.As(err, &notFoundErr))
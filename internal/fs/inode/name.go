@@ -16,6 +16,7 @@ package inode
 
 import (
 	"fmt"
+	"path"
 	"strings"
 )
 
@@ -31,11 +32,64 @@ type Name struct {
 	bucketName string
 	// The gcs object's name in its bucket.
 	objectName string
+	// Whether the components of the local name are encoded, so that objects
+	// whose names have components that can't appear in a local path are
+	// exposed too. See encodeNameComponent.
+	encoded bool
 }
 
 // NewRootName creates a Name for the root directory of a gcs bucket
 func NewRootName(bucketName string) Name {
-	return Name{bucketName, ""}
+	return Name{bucketName: bucketName}
+}
+
+// NewEncodedRootName is like NewRootName, but the local names of the
+// descendants of the root are encoded, so that objects whose names contain
+// empty, "." or ".." components are exposed too.
+func NewEncodedRootName(bucketName string) Name {
+	return Name{bucketName: bucketName, encoded: true}
+}
+
+// The escape character of encoded name components.
+const nameEscape = "%"
+
+// Return true if the supplied name component is, after any number of
+// escape characters, one of those that need escaping. An empty component can
+// only be that of a directory.
+func needsEscaping(component string, isDir bool) bool {
+	rest := strings.TrimLeft(component, nameEscape)
+	if rest == "." || rest == ".." {
+		return true
+	}
+
+	return isDir && rest == ""
+}
+
+// Return the local name for a component of an object name. Empty, "." and
+// ".." components can't appear in a local path, so are escaped by prefixing
+// them with the escape character. So that the encoding is reversible,
+// components that would otherwise look escaped, such as "%.", are escaped
+// too; no other names are changed.
+//
+// The encodings of a directory and a file with the same name never collide,
+// but those of an empty directory component and of a file named after the
+// escape character are both "%". That collision is resolved like any other
+// between a file and a directory: see ConflictingFileNameSuffix.
+func encodeNameComponent(component string, isDir bool) string {
+	if needsEscaping(component, isDir) {
+		return nameEscape + component
+	}
+
+	return component
+}
+
+// Invert encodeNameComponent.
+func decodeNameComponent(local string, isDir bool) string {
+	if strings.HasPrefix(local, nameEscape) && needsEscaping(local, isDir) {
+		return strings.TrimPrefix(local, nameEscape)
+	}
+
+	return local
 }
 
 // NewDirName creates a new inode name for a directory.
@@ -46,10 +100,11 @@ func NewDirName(parentName Name, dirName string) Name {
 			parentName,
 			dirName))
 	}
-	if dirName[len(dirName)-1] != '/' {
-		dirName = dirName + "/"
+	dirName = strings.TrimSuffix(dirName, "/")
+	if parentName.encoded {
+		dirName = decodeLocalName(dirName, true)
 	}
-	return Name{parentName.bucketName, parentName.objectName + dirName}
+	return parentName.child(dirName + "/")
 }
 
 // NewFileName creates a new inode name for a file.
@@ -60,13 +115,41 @@ func NewFileName(parentName Name, fileName string) Name {
 			parentName,
 			fileName))
 	}
-	return Name{parentName.bucketName, parentName.objectName + fileName}
+	if parentName.encoded {
+		fileName = decodeLocalName(fileName, false)
+	}
+	return parentName.child(fileName)
+}
+
+func (name Name) child(base string) Name {
+	return Name{
+		bucketName: name.bucketName,
+		objectName: name.objectName + base,
+		encoded:    name.encoded,
+	}
+}
+
+// Return the local name of the direct child of a directory whose object name,
+// or prefix, is supplied. Without encoding, that is the last component of the
+// name, so objects with unsupported names turn up under other names.
+func (name Name) childLocalName(childObjectName string) string {
+	if !name.encoded {
+		return path.Base(childObjectName) // ie. "bar" from "foo/bar/" or "foo/bar"
+	}
+
+	base := strings.TrimPrefix(childObjectName, name.objectName)
+	isDir := strings.HasSuffix(base, "/")
+	return encodeNameComponent(strings.TrimSuffix(base, "/"), isDir)
 }
 
 // NewDescendant creates a new inode name for an object as a descendant of
 // another inode.
 func NewDescendantName(ancestor Name, descendantObjectName string) Name {
-	return Name{ancestor.bucketName, descendantObjectName}
+	return Name{
+		bucketName: ancestor.bucketName,
+		objectName: descendantObjectName,
+		encoded:    ancestor.encoded,
+	}
 }
 
 // IsBucketRoot returns true if the name represents of a root directory
@@ -93,10 +176,47 @@ func (name Name) GcsObjectName() string {
 
 // LocalName returns the name of the directory or file in the local file system.
 func (name Name) LocalName() string {
+	localName := name.objectName
+	if name.encoded {
+		localName = encodeObjectName(localName)
+	}
+
 	if name.bucketName == "" {
-		return name.objectName
+		return localName
 	}
-	return name.bucketName + "/" + name.objectName
+	return name.bucketName + "/" + localName
+}
+
+// Encode each component of an object name. All but the last are those of
+// directories, and the last is empty for a directory.
+func encodeObjectName(objectName string) string {
+	if objectName == "" {
+		return ""
+	}
+
+	components := strings.Split(objectName, "/")
+	last := len(components) - 1
+	for i, c := range components[:last] {
+		components[i] = encodeNameComponent(c, true)
+	}
+	if components[last] != "" {
+		components[last] = encodeNameComponent(components[last], false)
+	}
+
+	return strings.Join(components, "/")
+}
+
+// Invert encodeObjectName for a relative local path, whose last component is
+// that of a directory or not as supplied.
+func decodeLocalName(localName string, isDir bool) string {
+	components := strings.Split(localName, "/")
+	last := len(components) - 1
+	for i, c := range components[:last] {
+		components[i] = decodeNameComponent(c, true)
+	}
+	components[last] = decodeNameComponent(components[last], isDir)
+
+	return strings.Join(components, "/")
 }
 
 // String returns LocalName.
@@ -0,0 +1,97 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NameNormalization says how a directory matches a name it is asked to look
+// up against the names of its children when there is no exact match. Data
+// written from macOS and Windows often mixes Unicode normalization forms and
+// relies on names being case-insensitive.
+type NameNormalization int
+
+const (
+	// Names must match exactly.
+	NoNameNormalization NameNormalization = iota
+
+	// Names match if their NFC forms do.
+	NormalizeUnicode
+
+	// Names match if their NFC forms do, ignoring case.
+	NormalizeUnicodeAndCase
+)
+
+// Return the normalized form of the supplied name, under which it is indexed.
+func (n NameNormalization) normalize(name string) string {
+	switch n {
+	case NormalizeUnicode:
+		return norm.NFC.String(name)
+
+	case NormalizeUnicodeAndCase:
+		// Case folding may leave a string denormalized, so normalize on both
+		// sides of it. Casers are stateful, so one is needed for each call.
+		return norm.NFC.String(cases.Fold().String(norm.NFD.String(name)))
+	}
+
+	return name
+}
+
+// The local names of the children of a directory, keyed by their normalized
+// forms.
+type normalizedIndex map[string][]string
+
+func (index normalizedIndex) add(n NameNormalization, name string) {
+	key := n.normalize(name)
+	for _, existing := range index[key] {
+		// Files and directories can share a name.
+		if existing == name {
+			return
+		}
+	}
+
+	index[key] = append(index[key], name)
+}
+
+func (index normalizedIndex) remove(n NameNormalization, name string) {
+	key := n.normalize(name)
+	names := index[key]
+	for i, existing := range names {
+		if existing == name {
+			names = append(names[:i:i], names[i+1:]...)
+			break
+		}
+	}
+
+	if len(names) == 0 {
+		delete(index, key)
+	} else {
+		index[key] = names
+	}
+}
+
+// Return the names of the children matching the supplied name, other than
+// the name itself.
+func (index normalizedIndex) matches(n NameNormalization, name string) (matches []string) {
+	for _, existing := range index[n.normalize(name)] {
+		if existing != name {
+			matches = append(matches, existing)
+		}
+	}
+
+	return
+}
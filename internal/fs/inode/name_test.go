@@ -106,3 +106,49 @@ func TestNameAsMapKey(t *testing.T) {
 	_, ok := count[bar]
 	ExpectFalse(ok)
 }
+
+func TestEncodedName(t *testing.T) {
+	root := inode.NewEncodedRootName("bucketx")
+	ExpectEq("bucketx/", root.LocalName())
+
+	// An empty directory component.
+	empty := inode.NewDirName(root, "%")
+	ExpectTrue(empty.IsDir())
+	ExpectEq("/", empty.GcsObjectName())
+	ExpectEq("bucketx/%/", empty.LocalName())
+	ExpectTrue(empty.IsDirectChildOf(root))
+
+	// Dot components.
+	dot := inode.NewFileName(empty, "%.")
+	ExpectEq("/.", dot.GcsObjectName())
+	ExpectEq("bucketx/%/%.", dot.LocalName())
+	ExpectTrue(dot.IsDirectChildOf(empty))
+
+	dotDot := inode.NewDirName(root, "%..")
+	ExpectEq("../", dotDot.GcsObjectName())
+	ExpectEq("bucketx/%../", dotDot.LocalName())
+
+	// Names that merely look escaped are escaped too.
+	escaped := inode.NewFileName(root, "%%.")
+	ExpectEq("%.", escaped.GcsObjectName())
+	ExpectEq("bucketx/%%.", escaped.LocalName())
+
+	escapedDir := inode.NewDirName(root, "%%")
+	ExpectEq("%/", escapedDir.GcsObjectName())
+	ExpectEq("bucketx/%%/", escapedDir.LocalName())
+
+	// A file can't have an empty name, so "%" is its own.
+	percent := inode.NewFileName(root, "%")
+	ExpectEq("%", percent.GcsObjectName())
+	ExpectEq("bucketx/%", percent.LocalName())
+
+	// Other names are left alone.
+	plain := inode.NewFileName(root, "a%.b")
+	ExpectEq("a%.b", plain.GcsObjectName())
+	ExpectEq("bucketx/a%.b", plain.LocalName())
+
+	// Descendants are encoded component by component.
+	descendant := inode.NewDescendantName(root, "a//./b")
+	ExpectEq("bucketx/a/%/%./b", descendant.LocalName())
+	ExpectEq("a//./b", inode.NewFileName(root, "a/%/%./b").GcsObjectName())
+}
@@ -0,0 +1,165 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/jacobsa/fuse/fuseops"
+	"golang.org/x/net/context"
+)
+
+// GCS object metadata keys under which POSIX attributes are persisted when
+// the file system is configured to do so. The mode holds the permission bits
+// (including setuid, setgid and sticky) in octal, uid and gid are decimal, and
+// atimes are UTC in the format defined by time.RFC3339Nano, like
+// FileMtimeMetadataKey.
+const (
+	ModeMetadataKey  = "gcsfuse_mode"
+	UidMetadataKey   = "gcsfuse_uid"
+	GidMetadataKey   = "gcsfuse_gid"
+	AtimeMetadataKey = "gcsfuse_atime"
+)
+
+// The mode bits that are persisted. The file type is always derived from the
+// kind of inode.
+const persistedModeBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// PosixAttributes is a set of changes to the POSIX attributes of an inode. Nil
+// fields are left untouched.
+type PosixAttributes struct {
+	Mode  *os.FileMode
+	Uid   *uint32
+	Gid   *uint32
+	Atime *time.Time
+}
+
+// IsEmpty returns true if no attribute is to be changed.
+func (p PosixAttributes) IsEmpty() bool {
+	return p.Mode == nil && p.Uid == nil && p.Gid == nil && p.Atime == nil
+}
+
+// ChangesOwnershipOrMode returns true if the mode, uid or gid is to be
+// changed.
+func (p PosixAttributes) ChangesOwnershipOrMode() bool {
+	return p.Mode != nil || p.Uid != nil || p.Gid != nil
+}
+
+// Return the metadata updates that persist the attributes.
+func (p PosixAttributes) metadata() map[string]*string {
+	m := make(map[string]*string)
+	if p.Mode != nil {
+		v := strconv.FormatUint(uint64(unixModeBits(*p.Mode)), 8)
+		m[ModeMetadataKey] = &v
+	}
+	if p.Uid != nil {
+		v := strconv.FormatUint(uint64(*p.Uid), 10)
+		m[UidMetadataKey] = &v
+	}
+	if p.Gid != nil {
+		v := strconv.FormatUint(uint64(*p.Gid), 10)
+		m[GidMetadataKey] = &v
+	}
+	if p.Atime != nil {
+		v := p.Atime.UTC().Format(time.RFC3339Nano)
+		m[AtimeMetadataKey] = &v
+	}
+	return m
+}
+
+// An inode whose POSIX attributes can be persisted in GCS.
+type PosixAttributesInode interface {
+	Inode
+
+	// Persist the given attribute changes in the metadata of the backing object.
+	// Returns syscall.ENOTSUP if the inode has no backing object to persist
+	// them in.
+	SetPosixAttributes(ctx context.Context, p PosixAttributes) (err error)
+}
+
+// Convert os.FileMode permission and special bits to their unix encoding.
+func unixModeBits(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= syscall.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= syscall.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= syscall.S_ISVTX
+	}
+	return bits
+}
+
+// The inverse of unixModeBits.
+func fileModeBits(bits uint32) os.FileMode {
+	mode := os.FileMode(bits) & os.ModePerm
+	if bits&syscall.S_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if bits&syscall.S_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if bits&syscall.S_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// ApplyPosixMetadata overrides the mode, ownership and atime in attrs with the
+// values persisted in the supplied object metadata, if any. Malformed values
+// are logged and ignored.
+func ApplyPosixMetadata(attrs *fuseops.InodeAttributes, metadata map[string]string) {
+	if v, ok := metadata[ModeMetadataKey]; ok {
+		bits, err := strconv.ParseUint(v, 8, 32)
+		if err != nil {
+			logger.Warnf("Ignoring malformed %s %q: %v", ModeMetadataKey, v, err)
+		} else {
+			attrs.Mode = attrs.Mode&^persistedModeBits | fileModeBits(uint32(bits))
+		}
+	}
+
+	if v, ok := metadata[UidMetadataKey]; ok {
+		uid, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			logger.Warnf("Ignoring malformed %s %q: %v", UidMetadataKey, v, err)
+		} else {
+			attrs.Uid = uint32(uid)
+		}
+	}
+
+	if v, ok := metadata[GidMetadataKey]; ok {
+		gid, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			logger.Warnf("Ignoring malformed %s %q: %v", GidMetadataKey, v, err)
+		} else {
+			attrs.Gid = uint32(gid)
+		}
+	}
+
+	if v, ok := metadata[AtimeMetadataKey]; ok {
+		atime, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			logger.Warnf("Ignoring malformed %s %q: %v", AtimeMetadataKey, v, err)
+		} else {
+			attrs.Atime = atime
+		}
+	}
+}
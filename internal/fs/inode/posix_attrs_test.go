@@ -0,0 +1,155 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+func TestPosixAttributesRoundTrip(t *testing.T) {
+	mode := os.FileMode(0750) | os.ModeSetgid | os.ModeSticky
+	uid := uint32(1001)
+	gid := uint32(2002)
+	atime := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	p := PosixAttributes{Mode: &mode, Uid: &uid, Gid: &gid, Atime: &atime}
+
+	metadata := make(map[string]string)
+	for k, v := range p.metadata() {
+		metadata[k] = *v
+	}
+	attrs := fuseops.InodeAttributes{Mode: os.ModeDir | 0755, Uid: 1, Gid: 2}
+	ApplyPosixMetadata(&attrs, metadata)
+
+	assert.Equal(t, "3750", metadata[ModeMetadataKey])
+	assert.Equal(t, os.ModeDir|mode, attrs.Mode)
+	assert.Equal(t, uid, attrs.Uid)
+	assert.Equal(t, gid, attrs.Gid)
+	assert.True(t, atime.Equal(attrs.Atime))
+}
+
+func TestApplyPosixMetadataIgnoresMalformedValues(t *testing.T) {
+	attrs := fuseops.InodeAttributes{Mode: 0644, Uid: 1, Gid: 2}
+
+	ApplyPosixMetadata(&attrs, map[string]string{
+		ModeMetadataKey:  "rwx",
+		UidMetadataKey:   "-1",
+		GidMetadataKey:   "root",
+		AtimeMetadataKey: "yesterday",
+	})
+
+	assert.Equal(t, fuseops.InodeAttributes{Mode: 0644, Uid: 1, Gid: 2}, attrs)
+}
+
+////////////////////////////////////////////////////////////////////////
+// FileInode
+////////////////////////////////////////////////////////////////////////
+
+func (t *FileTest) enablePosixAttributes() {
+	t.in.config = &cfg.Config{FileSystem: cfg.FileSystemConfig{PersistPosixAttributes: true}}
+}
+
+func (t *FileTest) TestSetPosixAttributesPersistsInMetadata() {
+	t.enablePosixAttributes()
+	mode := os.FileMode(0600)
+	owner := uint32(1001)
+	group := uint32(2002)
+
+	err := t.in.SetPosixAttributes(t.ctx, PosixAttributes{Mode: &mode, Uid: &owner, Gid: &group})
+	require.NoError(t.T(), err)
+
+	m := t.statBackingObject()
+	assert.Equal(t.T(), "600", m.Metadata[ModeMetadataKey])
+	assert.Equal(t.T(), "1001", m.Metadata[UidMetadataKey])
+	assert.Equal(t.T(), "2002", m.Metadata[GidMetadataKey])
+	assert.Equal(t.T(), m.MetaGeneration, t.in.SourceGeneration().Metadata)
+	attrs, err := t.in.Attributes(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), mode, attrs.Mode)
+	assert.Equal(t.T(), owner, attrs.Uid)
+	assert.Equal(t.T(), group, attrs.Gid)
+}
+
+func (t *FileTest) TestAttributesIgnorePersistedValuesWhenDisabled() {
+	mode := os.FileMode(0600)
+	owner := uint32(1001)
+	err := t.in.SetPosixAttributes(t.ctx, PosixAttributes{Mode: &mode, Uid: &owner})
+	require.NoError(t.T(), err)
+
+	attrs, err := t.in.Attributes(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), fileMode, attrs.Mode)
+	assert.Equal(t.T(), uint32(uid), attrs.Uid)
+}
+
+func (t *FileTest) TestSetAtimeIsReflectedInAttributes() {
+	t.enablePosixAttributes()
+	atime := t.clock.Now().Add(time.Hour).UTC()
+
+	err := t.in.SetPosixAttributes(t.ctx, PosixAttributes{Atime: &atime})
+	require.NoError(t.T(), err)
+
+	attrs, err := t.in.Attributes(t.ctx)
+	require.NoError(t.T(), err)
+	assert.True(t.T(), atime.Equal(attrs.Atime))
+	assert.False(t.T(), atime.Equal(attrs.Mtime))
+}
+
+func (t *FileTest) TestSetPosixAttributesOnLocalFileIsAppliedOnFlush() {
+	t.createInodeWithLocalParam("test", true)
+	t.enablePosixAttributes()
+	require.NoError(t.T(), t.in.CreateBufferedOrTempWriter(t.ctx))
+	mode := os.FileMode(0700)
+
+	err := t.in.SetPosixAttributes(t.ctx, PosixAttributes{Mode: &mode})
+	require.NoError(t.T(), err)
+	attrs, err := t.in.Attributes(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), mode, attrs.Mode)
+
+	require.NoError(t.T(), t.in.Flush(t.ctx))
+	assert.Equal(t.T(), "700", t.statBackingObject().Metadata[ModeMetadataKey])
+}
+
+func (t *FileTest) TestSetPosixAttributesClobbered() {
+	t.enablePosixAttributes()
+	lang := "fr"
+	_, err := t.bucket.UpdateObject(
+		t.ctx,
+		&gcs.UpdateObjectRequest{
+			Name:            t.in.Name().GcsObjectName(),
+			ContentLanguage: &lang,
+		})
+	require.NoError(t.T(), err)
+	owner := uint32(1001)
+
+	err = t.in.SetPosixAttributes(t.ctx, PosixAttributes{Uid: &owner})
+
+	assert.Error(t.T(), err)
+	_, ok := t.statBackingObject().Metadata[UidMetadataKey]
+	assert.False(t.T(), ok)
+}
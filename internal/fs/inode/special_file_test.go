@@ -0,0 +1,110 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"os"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+func TestSpecialFileRoundTrip(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mode       os.FileMode
+		rdev       uint32
+		direntType fuseutil.DirentType
+	}{
+		{
+			name:       "Fifo",
+			mode:       os.ModeNamedPipe,
+			direntType: fuseutil.DT_FIFO,
+		},
+		{
+			name:       "Socket",
+			mode:       os.ModeSocket,
+			direntType: fuseutil.DT_Socket,
+		},
+		{
+			name:       "CharDevice",
+			mode:       os.ModeDevice | os.ModeCharDevice,
+			rdev:       0x0103,
+			direntType: fuseutil.DT_Char,
+		},
+		{
+			name:       "BlockDevice",
+			mode:       os.ModeDevice,
+			rdev:       0x0801,
+			direntType: fuseutil.DT_Block,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.True(t, IsSpecialFileMode(tc.mode|0600))
+			m := &gcs.MinObject{
+				Name:     "foo",
+				Metadata: specialFileMetadata(tc.mode|0600, tc.rdev),
+			}
+
+			in := NewSpecialFileInode(
+				fuseops.RootInodeID+1,
+				NewFileName(NewRootName(""), "foo"),
+				m,
+				fuseops.InodeAttributes{Uid: uid, Gid: gid, Mode: 0640},
+				nil)
+			attrs, err := in.Attributes(context.Background())
+
+			assert.NoError(t, err)
+			assert.True(t, IsSpecialFile(m))
+			assert.Equal(t, tc.direntType, SpecialFileDirentType(m))
+			assert.Equal(t, tc.mode|0640, attrs.Mode)
+			assert.Equal(t, tc.rdev, attrs.Rdev)
+			assert.Equal(t, uint32(1), attrs.Nlink)
+			assert.Equal(t, uint32(uid), attrs.Uid)
+		})
+	}
+}
+
+func TestIsSpecialFile(t *testing.T) {
+	assert.False(t, IsSpecialFile(nil))
+	assert.False(t, IsSpecialFile(&gcs.MinObject{}))
+	assert.False(t, IsSpecialFileMode(0644))
+	assert.False(t, IsSpecialFileMode(os.ModeDir|0755))
+}
+
+func TestSpecialFileWithUnknownNodeType(t *testing.T) {
+	m := &gcs.MinObject{
+		Name:     "foo",
+		Metadata: map[string]string{NodeTypeMetadataKey: "door", RdevMetadataKey: "zero"},
+	}
+
+	in := NewSpecialFileInode(
+		fuseops.RootInodeID+1,
+		NewFileName(NewRootName(""), "foo"),
+		m,
+		fuseops.InodeAttributes{Mode: 0640},
+		nil)
+	attrs, err := in.Attributes(context.Background())
+
+	assert.NoError(t, err)
+	assert.Equal(t, os.ModeNamedPipe|0640, attrs.Mode)
+	assert.Equal(t, uint32(0), attrs.Rdev)
+}
@@ -0,0 +1,190 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+)
+
+// Extended attributes in the "user." namespace are backed one-to-one by the
+// custom metadata of the GCS object, e.g. "user.owner" is stored under the
+// metadata key "owner". Attributes in the "gcs." namespace are read-only,
+// reflect properties of the backing object and are not included in listings.
+const (
+	UserXattrPrefix = "user."
+	GcsXattrPrefix  = "gcs."
+)
+
+// Custom metadata keys with these prefixes are used by gcsfuse and gsutil for
+// their own bookkeeping (e.g. FileMtimeMetadataKey and SymlinkMetadataKey).
+// They are never exposed as extended attributes and can't be written through
+// them.
+var reservedMetadataKeyPrefixes = []string{
+	"gcsfuse_",
+	"goog-reserved-",
+}
+
+// An inode that exposes extended attributes.
+type XattrInode interface {
+	Inode
+
+	// Return the value of the extended attribute with the given name, or
+	// fuse.ENOATTR if there is no such attribute.
+	GetXattr(ctx context.Context, name string) (value string, err error)
+
+	// Return the names of the listable extended attributes, sorted.
+	ListXattr(ctx context.Context) (names []string, err error)
+
+	// Set the given extended attribute, honouring the setxattr(2) flags.
+	SetXattr(ctx context.Context, name string, value []byte, flags uint32) (err error)
+
+	// Remove the given extended attribute, or return fuse.ENOATTR if there is
+	// no such attribute.
+	RemoveXattr(ctx context.Context, name string) (err error)
+}
+
+func isReservedMetadataKey(key string) bool {
+	for _, prefix := range reservedMetadataKeyPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the custom metadata key backing the supplied user xattr name. Names
+// outside of the user namespace are not supported, and reserved keys may not
+// be touched.
+func metadataKeyForXattr(name string) (key string, err error) {
+	if !strings.HasPrefix(name, UserXattrPrefix) {
+		if strings.HasPrefix(name, GcsXattrPrefix) {
+			err = syscall.EPERM
+			return
+		}
+		err = syscall.ENOTSUP
+		return
+	}
+
+	key = strings.TrimPrefix(name, UserXattrPrefix)
+	if key == "" {
+		err = fuse.EINVAL
+		return
+	}
+
+	if isReservedMetadataKey(key) {
+		err = syscall.EPERM
+		return
+	}
+
+	return
+}
+
+// Check that the supplied value can be stored as a custom metadata value. GCS
+// treats an empty value as a deletion, so empty values can't be stored.
+func validateXattrValue(value []byte) error {
+	if len(value) == 0 || !utf8.Valid(value) {
+		return fuse.EINVAL
+	}
+	return nil
+}
+
+// Check the setxattr(2) flags against whether the attribute already exists.
+func checkXattrFlags(flags uint32, exists bool) error {
+	if flags&unix.XATTR_CREATE != 0 && exists {
+		return fuse.EEXIST
+	}
+	if flags&unix.XATTR_REPLACE != 0 && !exists {
+		return fuse.ENOATTR
+	}
+	return nil
+}
+
+// Return the sorted names of the user xattrs backed by the given metadata.
+func userXattrNames(metadata map[string]string) (names []string) {
+	for key := range metadata {
+		if isReservedMetadataKey(key) {
+			continue
+		}
+		names = append(names, UserXattrPrefix+key)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Return the value of the named read-only gcs xattr for the given object, or
+// fuse.ENOATTR if the object doesn't have that property.
+func gcsXattr(
+	name string,
+	m *gcs.MinObject,
+	e *gcs.ExtendedObjectAttributes) (value string, err error) {
+	switch strings.TrimPrefix(name, GcsXattrPrefix) {
+	case "generation":
+		value = strconv.FormatInt(m.Generation, 10)
+	case "metageneration":
+		value = strconv.FormatInt(m.MetaGeneration, 10)
+	case "content_encoding":
+		value = m.ContentEncoding
+	case "crc32c":
+		if m.CRC32C != nil {
+			var b [4]byte
+			binary.BigEndian.PutUint32(b[:], *m.CRC32C)
+			value = base64.StdEncoding.EncodeToString(b[:])
+		}
+	case "md5":
+		if e != nil && e.MD5 != nil {
+			value = base64.StdEncoding.EncodeToString(e.MD5[:])
+		}
+	case "storage_class":
+		if e != nil {
+			value = e.StorageClass
+		}
+	case "content_type":
+		if e != nil {
+			value = e.ContentType
+		}
+	case "content_language":
+		if e != nil {
+			value = e.ContentLanguage
+		}
+	case "cache_control":
+		if e != nil {
+			value = e.CacheControl
+		}
+	case "content_disposition":
+		if e != nil {
+			value = e.ContentDisposition
+		}
+	case "custom_time":
+		if e != nil {
+			value = e.CustomTime
+		}
+	}
+
+	if value == "" {
+		err = fuse.ENOATTR
+	}
+	return
+}
@@ -0,0 +1,242 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package inode
+
+import (
+	"errors"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs/gcsfuse_errors"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+////////////////////////////////////////////////////////////////////////
+// Helpers
+////////////////////////////////////////////////////////////////////////
+
+func TestMetadataKeyForXattr(t *testing.T) {
+	testCases := []struct {
+		name        string
+		expectedKey string
+		expectedErr error
+	}{
+		{"user.owner", "owner", nil},
+		{"user.a.b", "a.b", nil},
+		{"user.", "", fuse.EINVAL},
+		{"user.gcsfuse_mtime", "", syscall.EPERM},
+		{"user.goog-reserved-file-mtime", "", syscall.EPERM},
+		{"gcs.generation", "", syscall.EPERM},
+		{"security.selinux", "", syscall.ENOTSUP},
+		{"trusted.foo", "", syscall.ENOTSUP},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			key, err := metadataKeyForXattr(tc.name)
+
+			assert.Equal(t, tc.expectedErr, err)
+			assert.Equal(t, tc.expectedKey, key)
+		})
+	}
+}
+
+func TestUserXattrNamesHidesReservedKeys(t *testing.T) {
+	metadata := map[string]string{
+		"owner":                    "alice",
+		"color":                    "blue",
+		FileMtimeMetadataKey:       "2024-01-01T00:00:00Z",
+		SymlinkMetadataKey:         "target",
+		"goog-reserved-file-mtime": "1704067200",
+	}
+
+	assert.Equal(t, []string{"user.color", "user.owner"}, userXattrNames(metadata))
+}
+
+func TestGcsXattr(t *testing.T) {
+	crc := uint32(0x01020304)
+	md5 := [16]byte{1}
+	m := &gcs.MinObject{Generation: 12, MetaGeneration: 3, CRC32C: &crc}
+	e := &gcs.ExtendedObjectAttributes{StorageClass: "STANDARD", MD5: &md5}
+
+	value, err := gcsXattr("gcs.generation", m, e)
+	require.NoError(t, err)
+	assert.Equal(t, "12", value)
+	value, err = gcsXattr("gcs.metageneration", m, e)
+	require.NoError(t, err)
+	assert.Equal(t, "3", value)
+	value, err = gcsXattr("gcs.crc32c", m, e)
+	require.NoError(t, err)
+	assert.Equal(t, "AQIDBA==", value)
+	value, err = gcsXattr("gcs.md5", m, e)
+	require.NoError(t, err)
+	assert.Equal(t, "AQAAAAAAAAAAAAAAAAAAAA==", value)
+	value, err = gcsXattr("gcs.storage_class", m, e)
+	require.NoError(t, err)
+	assert.Equal(t, "STANDARD", value)
+	_, err = gcsXattr("gcs.content_language", m, e)
+	assert.Equal(t, fuse.ENOATTR, err)
+	_, err = gcsXattr("gcs.unknown", m, e)
+	assert.Equal(t, fuse.ENOATTR, err)
+}
+
+////////////////////////////////////////////////////////////////////////
+// FileInode
+////////////////////////////////////////////////////////////////////////
+
+func (t *FileTest) statBackingObject() *gcs.MinObject {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: t.in.Name().GcsObjectName()})
+	require.NoError(t.T(), err)
+	return m
+}
+
+func (t *FileTest) TestSetXattrUpdatesObjectMetadata() {
+	err := t.in.SetXattr(t.ctx, "user.owner", []byte("alice"), 0)
+	require.NoError(t.T(), err)
+
+	m := t.statBackingObject()
+	assert.Equal(t.T(), "alice", m.Metadata["owner"])
+	assert.Equal(t.T(), m.MetaGeneration, t.in.SourceGeneration().Metadata)
+	assert.Same(t.T(), &t.in.src, t.in.MRDWrapper.GetMinObject())
+	value, err := t.in.GetXattr(t.ctx, "user.owner")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "alice", value)
+	names, err := t.in.ListXattr(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), []string{"user.owner"}, names)
+}
+
+func (t *FileTest) TestSetXattrHonoursFlags() {
+	err := t.in.SetXattr(t.ctx, "user.owner", []byte("alice"), unix.XATTR_REPLACE)
+	assert.Equal(t.T(), fuse.ENOATTR, err)
+
+	err = t.in.SetXattr(t.ctx, "user.owner", []byte("alice"), unix.XATTR_CREATE)
+	require.NoError(t.T(), err)
+
+	err = t.in.SetXattr(t.ctx, "user.owner", []byte("bob"), unix.XATTR_CREATE)
+	assert.Equal(t.T(), fuse.EEXIST, err)
+
+	err = t.in.SetXattr(t.ctx, "user.owner", []byte("bob"), unix.XATTR_REPLACE)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "bob", t.statBackingObject().Metadata["owner"])
+}
+
+func (t *FileTest) TestSetXattrRejectsReservedAndInvalidNames() {
+	assert.Equal(t.T(), syscall.EPERM, t.in.SetXattr(t.ctx, "user.gcsfuse_mtime", []byte("x"), 0))
+	assert.Equal(t.T(), syscall.EPERM, t.in.SetXattr(t.ctx, "gcs.generation", []byte("1"), 0))
+	assert.Equal(t.T(), syscall.ENOTSUP, t.in.SetXattr(t.ctx, "security.selinux", []byte("x"), 0))
+	assert.Equal(t.T(), fuse.EINVAL, t.in.SetXattr(t.ctx, "user.owner", []byte{0xff, 0xfe}, 0))
+	assert.Equal(t.T(), fuse.EINVAL, t.in.SetXattr(t.ctx, "user.owner", []byte{}, 0))
+	assert.Equal(t.T(), 0, len(t.statBackingObject().Metadata))
+}
+
+func (t *FileTest) TestGetXattrHidesReservedKeys() {
+	err := t.in.SetMtime(t.ctx, t.clock.Now())
+	require.NoError(t.T(), err)
+
+	_, err = t.in.GetXattr(t.ctx, "user."+FileMtimeMetadataKey)
+	assert.Equal(t.T(), fuse.ENOATTR, err)
+	names, err := t.in.ListXattr(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Empty(t.T(), names)
+}
+
+func (t *FileTest) TestRemoveXattr() {
+	require.NoError(t.T(), t.in.SetXattr(t.ctx, "user.owner", []byte("alice"), 0))
+
+	err := t.in.RemoveXattr(t.ctx, "user.owner")
+	require.NoError(t.T(), err)
+
+	_, ok := t.statBackingObject().Metadata["owner"]
+	assert.False(t.T(), ok)
+	_, err = t.in.GetXattr(t.ctx, "user.owner")
+	assert.Equal(t.T(), fuse.ENOATTR, err)
+	assert.Equal(t.T(), fuse.ENOATTR, t.in.RemoveXattr(t.ctx, "user.owner"))
+}
+
+func (t *FileTest) TestGetGcsXattr() {
+	value, err := t.in.GetXattr(t.ctx, "gcs.generation")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), strconv.FormatInt(t.backingObj.Generation, 10), value)
+	_, err = t.in.GetXattr(t.ctx, "gcs.crc32c")
+	require.NoError(t.T(), err)
+
+	// gcs attributes are not listed.
+	names, err := t.in.ListXattr(t.ctx)
+	require.NoError(t.T(), err)
+	assert.Empty(t.T(), names)
+}
+
+func (t *FileTest) TestSetXattrClobbered() {
+	// Update the backing object behind the inode's back.
+	lang := "fr"
+	_, err := t.bucket.UpdateObject(
+		t.ctx,
+		&gcs.UpdateObjectRequest{
+			Name:            t.in.Name().GcsObjectName(),
+			ContentLanguage: &lang,
+		})
+	require.NoError(t.T(), err)
+
+	err = t.in.SetXattr(t.ctx, "user.owner", []byte("alice"), 0)
+
+	var clobberedErr *gcsfuse_errors.FileClobberedError
+	assert.True(t.T(), errors.As(err, &clobberedErr))
+	assert.Equal(t.T(), 0, len(t.statBackingObject().Metadata))
+}
+
+func (t *FileTest) TestSetXattrOnLocalFileIsAppliedOnFlush() {
+	t.createInodeWithLocalParam("test", true)
+	require.NoError(t.T(), t.in.CreateBufferedOrTempWriter(t.ctx))
+	require.NoError(t.T(), t.in.Write(t.ctx, []byte("tacos"), 0))
+
+	require.NoError(t.T(), t.in.SetXattr(t.ctx, "user.owner", []byte("alice"), 0))
+	require.NoError(t.T(), t.in.SetXattr(t.ctx, "user.color", []byte("blue"), 0))
+	require.NoError(t.T(), t.in.RemoveXattr(t.ctx, "user.color"))
+
+	// The attributes are visible before the object exists.
+	value, err := t.in.GetXattr(t.ctx, "user.owner")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "alice", value)
+	_, err = t.in.GetXattr(t.ctx, "gcs.generation")
+	assert.Equal(t.T(), fuse.ENOATTR, err)
+
+	err = t.in.Flush(t.ctx)
+	require.NoError(t.T(), err)
+
+	assert.False(t.T(), t.in.IsLocal())
+	assert.Nil(t.T(), t.in.pendingMetadata)
+	m := t.statBackingObject()
+	assert.Equal(t.T(), "alice", m.Metadata["owner"])
+	_, ok := m.Metadata["color"]
+	assert.False(t.T(), ok)
+	assert.Equal(t.T(), m.MetaGeneration, t.in.SourceGeneration().Metadata)
+}
+
+func (t *FileTest) TestSetXattrOnDirtyFileSurvivesSync() {
+	require.NoError(t.T(), t.in.Write(t.ctx, []byte("burrito"), 0))
+	require.NoError(t.T(), t.in.SetXattr(t.ctx, "user.owner", []byte("alice"), 0))
+
+	gcsSynced, err := t.in.Sync(t.ctx)
+	require.NoError(t.T(), err)
+	assert.True(t.T(), gcsSynced)
+
+	assert.Equal(t.T(), "alice", t.statBackingObject().Metadata["owner"])
+}
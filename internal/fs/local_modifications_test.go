@@ -33,6 +33,7 @@ import (
 	"unicode"
 	"unicode/utf8"
 
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
 	"github.com/googlecloudplatform/gcsfuse/v2/tools/integration_tests/util/operations"
@@ -506,6 +507,107 @@ func (t *MknodTest) NonExistentParent() {
 	ExpectEq(syscall.ENOENT, err)
 }
 
+func (t *MknodTest) Fifo() {
+	// mknod(2) only works for root on OS X.
+	if runtime.GOOS == "darwin" {
+		return
+	}
+
+	var err error
+	p := path.Join(mntDir, "foo")
+
+	// Create
+	err = syscall.Mkfifo(p, 0600)
+	AssertEq(nil, err)
+
+	// Stat
+	fi, err := os.Stat(p)
+	AssertEq(nil, err)
+
+	ExpectEq(path.Base(p), fi.Name())
+	ExpectEq(os.ModeNamedPipe|filePerms, fi.Mode())
+
+	// The node type should be recorded in GCS.
+	m, _, err := bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "foo"})
+	AssertEq(nil, err)
+	ExpectEq(0, m.Size)
+	ExpectEq("fifo", m.Metadata["gcsfuse_node_type"])
+}
+
+func (t *MknodTest) Socket() {
+	// mknod(2) only works for root on OS X.
+	if runtime.GOOS == "darwin" {
+		return
+	}
+
+	var err error
+	p := path.Join(mntDir, "foo")
+
+	// Create
+	err = syscall.Mknod(p, syscall.S_IFSOCK|0600, 0)
+	AssertEq(nil, err)
+
+	// Stat
+	fi, err := os.Stat(p)
+	AssertEq(nil, err)
+	ExpectEq(os.ModeSocket|filePerms, fi.Mode())
+
+	// ReadDir
+	entries, err := os.ReadDir(mntDir)
+	AssertEq(nil, err)
+	AssertEq(1, len(entries))
+	ExpectEq(os.ModeSocket, entries[0].Type())
+}
+
+func (t *MknodTest) FifoCreatedInGcs() {
+	var err error
+
+	// Create an object that looks like a named pipe.
+	_, err = bucket.CreateObject(
+		ctx,
+		&gcs.CreateObjectRequest{
+			Name:     "foo",
+			Contents: strings.NewReader(""),
+			Metadata: map[string]string{"gcsfuse_node_type": "fifo"},
+		})
+	AssertEq(nil, err)
+
+	// Stat
+	fi, err := os.Lstat(path.Join(mntDir, "foo"))
+	AssertEq(nil, err)
+	ExpectEq(os.ModeNamedPipe|filePerms, fi.Mode())
+}
+
+func (t *MknodTest) RenameAndUnlinkFifo() {
+	// mknod(2) only works for root on OS X.
+	if runtime.GOOS == "darwin" {
+		return
+	}
+
+	var err error
+	oldPath := path.Join(mntDir, "foo")
+	newPath := path.Join(mntDir, "bar")
+	AssertEq(nil, syscall.Mkfifo(oldPath, 0600))
+
+	// Rename
+	err = os.Rename(oldPath, newPath)
+	AssertEq(nil, err)
+
+	_, err = os.Lstat(oldPath)
+	ExpectTrue(os.IsNotExist(err), "err: %v", err)
+	fi, err := os.Lstat(newPath)
+	AssertEq(nil, err)
+	ExpectEq(os.ModeNamedPipe|filePerms, fi.Mode())
+
+	// Unlink
+	err = os.Remove(newPath)
+	AssertEq(nil, err)
+
+	_, _, err = bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: "bar"})
+	var notFoundErr *gcs.NotFoundError
+	ExpectTrue(errors.As(err, &notFoundErr))
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Modes
 ////////////////////////////////////////////////////////////////////////
@@ -2556,6 +2658,30 @@ func (t *RenameTest) DirectoryContainingDirectories() {
 	ExpectTrue(files[0].IsDir())
 }
 
+func (t *RenameTest) DirectoryLeavesNoRenameJournal() {
+	var err error
+
+	// Create a directory containing a file.
+	oldPath := path.Join(mntDir, "foo")
+	err = os.Mkdir(oldPath, 0700)
+	AssertEq(nil, err)
+	err = os.WriteFile(path.Join(oldPath, "baz"), []byte("taco"), 0400)
+	AssertEq(nil, err)
+
+	// Rename it.
+	newPath := path.Join(mntDir, "bar")
+	err = os.Rename(oldPath, newPath)
+	AssertEq(nil, err)
+
+	// The journal recording the moves has been deleted.
+	listing, err := bucket.ListObjects(ctx, &gcs.ListObjectsRequest{Prefix: ".gcsfuse_tmp/" + gcsx.RenameJournalDir})
+	AssertEq(nil, err)
+	ExpectEq(0, len(listing.MinObjects))
+	contents, err := os.ReadFile(path.Join(newPath, "baz"))
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+}
+
 func (t *RenameTest) EmptyDirectory() {
 	var err error
 
@@ -0,0 +1,172 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The kernel only forwards lock requests for mounts that negotiate them, so
+// these tests call the file system ops directly rather than going through a
+// mount.
+
+package fs_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+)
+
+type LocksTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcs.Bucket
+	fs     fuseutil.FileSystem
+}
+
+func TestLocksSuite(t *testing.T) {
+	suite.Run(t, new(LocksTest))
+}
+
+func (t *LocksTest) SetupTest() {
+	var err error
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	serverCfg := &fs.ServerConfig{
+		CacheClock: &clock,
+		BucketManager: &fakeBucketManager{
+			buckets:                  map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			chunkTransferTimeoutSecs: 10,
+			tmpObjectPrefix:          ".gcsfuse_tmp/",
+		},
+		BucketName:           t.bucket.Name(),
+		RenameDirLimit:       RenameDirLimit,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		NewConfig: &cfg.Config{
+			FileCache:  defaultFileCacheConfig(),
+			FileSystem: cfg.FileSystemConfig{EnableLocks: true},
+			MetadataCache: cfg.MetadataCacheConfig{
+				StatCacheMaxSizeMb: 32,
+				TtlSecs:            60,
+				TypeCacheMaxSizeMb: 4,
+			},
+		},
+		MetricHandle: common.NewNoopMetrics(),
+		FilePerms:    filePerms,
+		DirPerms:     dirPerms,
+	}
+
+	t.fs, err = fs.NewFileSystem(t.ctx, serverCfg)
+	require.NoError(t.T(), err)
+}
+
+func (t *LocksTest) TearDownTest() {
+	t.fs.Destroy()
+}
+
+// Create a file under the root, returning its inode and an open handle.
+func (t *LocksTest) createFile(name string) (fuseops.InodeID, fuseops.HandleID) {
+	op := &fuseops.CreateFileOp{
+		Parent: fuseops.RootInodeID,
+		Name:   name,
+		Mode:   filePerms,
+	}
+	require.NoError(t.T(), t.fs.CreateFile(t.ctx, op))
+
+	return op.Entry.Child, op.Handle
+}
+
+func (t *LocksTest) setLk(in fuseops.InodeID, h fuseops.HandleID, owner uint64, lockType uint32) error {
+	return t.fs.SetLk(t.ctx, &fuseops.SetLkOp{
+		Inode:  in,
+		Handle: h,
+		Owner:  owner,
+		Lock:   fuseops.FileLock{Type: lockType},
+	})
+}
+
+func (t *LocksTest) TestConflictingLock() {
+	in, h := t.createFile("foo")
+	require.NoError(t.T(), t.setLk(in, h, 1, unix.F_WRLCK))
+
+	err := t.setLk(in, h, 2, unix.F_RDLCK)
+
+	assert.ErrorIs(t.T(), err, syscall.EWOULDBLOCK)
+}
+
+func (t *LocksTest) TestUnlockThenLock() {
+	in, h := t.createFile("foo")
+	require.NoError(t.T(), t.setLk(in, h, 1, unix.F_WRLCK))
+	require.NoError(t.T(), t.setLk(in, h, 1, unix.F_UNLCK))
+
+	err := t.setLk(in, h, 2, unix.F_WRLCK)
+
+	assert.NoError(t.T(), err)
+}
+
+func (t *LocksTest) TestReleaseHandleReleasesLocks() {
+	in, h := t.createFile("foo")
+	require.NoError(t.T(), t.setLk(in, h, 1, unix.F_WRLCK))
+
+	require.NoError(t.T(), t.fs.ReleaseFileHandle(t.ctx, &fuseops.ReleaseFileHandleOp{Handle: h}))
+
+	openOp := &fuseops.OpenFileOp{Inode: in}
+	require.NoError(t.T(), t.fs.OpenFile(t.ctx, openOp))
+	assert.NoError(t.T(), t.setLk(in, openOp.Handle, 2, unix.F_WRLCK))
+}
+
+func (t *LocksTest) TestGetLkReportsConflict() {
+	in, h := t.createFile("foo")
+	require.NoError(t.T(), t.setLk(in, h, 1, unix.F_WRLCK))
+
+	op := &fuseops.GetLkOp{
+		Inode:  in,
+		Handle: h,
+		Owner:  2,
+		Lock:   fuseops.FileLock{Type: unix.F_RDLCK},
+	}
+	err := t.fs.GetLk(t.ctx, op)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint32(unix.F_WRLCK), op.Lock.Type)
+}
+
+func (t *LocksTest) TestGetLkReportsNoConflictForOwner() {
+	in, h := t.createFile("foo")
+	require.NoError(t.T(), t.setLk(in, h, 1, unix.F_WRLCK))
+
+	op := &fuseops.GetLkOp{
+		Inode:  in,
+		Handle: h,
+		Owner:  1,
+		Lock:   fuseops.FileLock{Type: unix.F_WRLCK},
+	}
+	err := t.fs.GetLk(t.ctx, op)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint32(unix.F_UNLCK), op.Lock.Type)
+}
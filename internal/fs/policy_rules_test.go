@@ -0,0 +1,134 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fs_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/policy"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type PolicyRulesTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcs.Bucket
+	fs     fuseutil.FileSystem
+}
+
+func TestPolicyRulesSuite(t *testing.T) {
+	suite.Run(t, new(PolicyRulesTest))
+}
+
+func (t *PolicyRulesTest) SetupTest() {
+	var err error
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+
+	readOnly := true
+	var zero int64
+	rules, err := policy.NewRules([]policy.Rule{
+		{Glob: "*.ro", Overrides: policy.Overrides{ReadOnly: &readOnly}},
+		{Glob: "*.tmp", Overrides: policy.Overrides{StatCacheTtlSecs: &zero}},
+	})
+	require.NoError(t.T(), err)
+
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	serverCfg := &fs.ServerConfig{
+		CacheClock: &clock,
+		BucketManager: &fakeBucketManager{
+			buckets:                  map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			chunkTransferTimeoutSecs: 10,
+			tmpObjectPrefix:          ".gcsfuse_tmp/",
+		},
+		BucketName:             t.bucket.Name(),
+		RenameDirLimit:         RenameDirLimit,
+		SequentialReadSizeMb:   SequentialReadSizeMb,
+		InodeAttributeCacheTTL: time.Minute,
+		NewConfig: &cfg.Config{
+			FileCache: defaultFileCacheConfig(),
+			MetadataCache: cfg.MetadataCacheConfig{
+				StatCacheMaxSizeMb: 32,
+				TtlSecs:            60,
+				TypeCacheMaxSizeMb: 4,
+			},
+		},
+		MetricHandle: common.NewNoopMetrics(),
+		FilePerms:    filePerms,
+		DirPerms:     dirPerms,
+		PolicyRules:  rules,
+	}
+
+	t.fs, err = fs.NewFileSystem(t.ctx, serverCfg)
+	require.NoError(t.T(), err)
+}
+
+func (t *PolicyRulesTest) TearDownTest() {
+	t.fs.Destroy()
+}
+
+func (t *PolicyRulesTest) lookUp(name string) *fuseops.LookUpInodeOp {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, name, []byte("taco"))
+	require.NoError(t.T(), err)
+	op := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: name}
+	require.NoError(t.T(), t.fs.LookUpInode(t.ctx, op))
+
+	return op
+}
+
+func (t *PolicyRulesTest) TestCreateReadOnlyFile() {
+	err := t.fs.CreateFile(t.ctx, &fuseops.CreateFileOp{
+		Parent: fuseops.RootInodeID,
+		Name:   "foo.ro",
+		Mode:   filePerms,
+	})
+
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+}
+
+func (t *PolicyRulesTest) TestOpenReadOnlyFile() {
+	lookUpOp := t.lookUp("foo.ro")
+
+	err := t.fs.OpenFile(t.ctx, &fuseops.OpenFileOp{Inode: lookUpOp.Entry.Child, OpenFlags: syscall.O_RDWR})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	err = t.fs.OpenFile(t.ctx, &fuseops.OpenFileOp{Inode: lookUpOp.Entry.Child, OpenFlags: syscall.O_RDONLY})
+	assert.NoError(t.T(), err)
+}
+
+func (t *PolicyRulesTest) TestStatCacheTTL() {
+	before := time.Now()
+
+	volatile := t.lookUp("foo.tmp")
+	other := t.lookUp("foo")
+
+	assert.True(t.T(), volatile.Entry.AttributesExpiration.IsZero())
+	assert.True(t.T(), other.Entry.AttributesExpiration.After(before))
+}
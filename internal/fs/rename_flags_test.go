@@ -0,0 +1,189 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// os.Rename has no way to pass renameat2 flags, so these tests call the file
+// system ops directly rather than going through a mount.
+
+package fs_test
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
+)
+
+type RenameFlagsTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcs.Bucket
+	fs     fuseutil.FileSystem
+}
+
+func TestRenameFlagsSuite(t *testing.T) {
+	suite.Run(t, new(RenameFlagsTest))
+}
+
+func (t *RenameFlagsTest) SetupTest() {
+	var err error
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	serverCfg := &fs.ServerConfig{
+		CacheClock: &clock,
+		BucketManager: &fakeBucketManager{
+			buckets:                  map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			chunkTransferTimeoutSecs: 10,
+			tmpObjectPrefix:          ".gcsfuse_tmp/",
+		},
+		BucketName:           t.bucket.Name(),
+		RenameDirLimit:       RenameDirLimit,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		NewConfig: &cfg.Config{
+			FileCache: defaultFileCacheConfig(),
+			MetadataCache: cfg.MetadataCacheConfig{
+				StatCacheMaxSizeMb: 32,
+				TtlSecs:            60,
+				TypeCacheMaxSizeMb: 4,
+			},
+		},
+		MetricHandle: common.NewNoopMetrics(),
+		FilePerms:    filePerms,
+		DirPerms:     dirPerms,
+	}
+
+	t.fs, err = fs.NewFileSystem(t.ctx, serverCfg)
+	require.NoError(t.T(), err)
+}
+
+func (t *RenameFlagsTest) TearDownTest() {
+	t.fs.Destroy()
+}
+
+func (t *RenameFlagsTest) createObject(name string, contents string) {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, name, []byte(contents))
+	require.NoError(t.T(), err)
+}
+
+func (t *RenameFlagsTest) readObject(name string) string {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, name)
+	require.NoError(t.T(), err)
+	return string(contents)
+}
+
+func (t *RenameFlagsTest) rename(oldName string, newName string, flags uint32) error {
+	return t.fs.Rename(t.ctx, &fuseops.RenameOp{
+		OldParent: fuseops.RootInodeID,
+		OldName:   oldName,
+		NewParent: fuseops.RootInodeID,
+		NewName:   newName,
+		Flags:     flags,
+	})
+}
+
+func (t *RenameFlagsTest) TestNoReplace_TargetMissing() {
+	t.createObject("foo", "taco")
+
+	err := t.rename("foo", "bar", unix.RENAME_NOREPLACE)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", t.readObject("bar"))
+	_, err = storageutil.ReadObject(t.ctx, t.bucket, "foo")
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *RenameFlagsTest) TestNoReplace_TargetExists() {
+	t.createObject("foo", "taco")
+	t.createObject("bar", "burrito")
+
+	err := t.rename("foo", "bar", unix.RENAME_NOREPLACE)
+
+	assert.ErrorIs(t.T(), err, syscall.EEXIST)
+	assert.Equal(t.T(), "taco", t.readObject("foo"))
+	assert.Equal(t.T(), "burrito", t.readObject("bar"))
+}
+
+func (t *RenameFlagsTest) TestNoReplace_TargetDirExists() {
+	t.createObject("foo/", "")
+	t.createObject("bar/", "")
+
+	err := t.rename("foo", "bar", unix.RENAME_NOREPLACE)
+
+	assert.ErrorIs(t.T(), err, syscall.EEXIST)
+	assert.Equal(t.T(), "", t.readObject("foo/"))
+}
+
+func (t *RenameFlagsTest) TestExchange_Files() {
+	t.createObject("foo", "taco")
+	t.createObject("bar", "burrito")
+
+	err := t.rename("foo", "bar", unix.RENAME_EXCHANGE)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "burrito", t.readObject("foo"))
+	assert.Equal(t.T(), "taco", t.readObject("bar"))
+}
+
+func (t *RenameFlagsTest) TestExchange_TargetMissing() {
+	t.createObject("foo", "taco")
+
+	err := t.rename("foo", "bar", unix.RENAME_EXCHANGE)
+
+	assert.ErrorIs(t.T(), err, syscall.ENOENT)
+	assert.Equal(t.T(), "taco", t.readObject("foo"))
+}
+
+func (t *RenameFlagsTest) TestExchange_DirsInFlatBucket() {
+	t.createObject("foo/", "")
+	t.createObject("bar/", "")
+
+	err := t.rename("foo", "bar", unix.RENAME_EXCHANGE)
+
+	assert.ErrorIs(t.T(), err, syscall.ENOTSUP)
+}
+
+func (t *RenameFlagsTest) TestExchange_FileAndDir() {
+	t.createObject("foo", "taco")
+	t.createObject("bar/", "")
+
+	err := t.rename("foo", "bar", unix.RENAME_EXCHANGE)
+
+	assert.ErrorIs(t.T(), err, syscall.ENOTSUP)
+}
+
+func (t *RenameFlagsTest) TestBothFlags() {
+	t.createObject("foo", "taco")
+	t.createObject("bar", "burrito")
+
+	err := t.rename("foo", "bar", unix.RENAME_NOREPLACE|unix.RENAME_EXCHANGE)
+
+	assert.ErrorIs(t.T(), err, syscall.EINVAL)
+}
@@ -31,10 +31,15 @@ func NewServer(ctx context.Context, cfg *ServerConfig) (fuse.Server, error) {
 		return nil, fmt.Errorf("create file system: %w", err)
 	}
 
-	fs = wrappers.WithErrorMapping(fs, cfg.NewConfig.FileSystem.PreconditionErrors)
+	// Clobbered writes are reported unless precondition errors are turned off.
+	// With conflict copies, they are reported when no copy could be written.
+	fs = wrappers.WithErrorMapping(fs, cfg.NewConfig.FileSystem.PreconditionErrors != "false")
 	if newcfg.IsTracingEnabled(cfg.NewConfig) {
 		fs = wrappers.WithTracing(fs)
 	}
 	fs = wrappers.WithMonitoring(fs, cfg.MetricHandle)
+	if notifier, ok := cfg.Notifier.(*fuse.Notifier); ok {
+		return fuseutil.NewFileSystemServerWithNotifier(fs, notifier), nil
+	}
 	return fuseutil.NewFileSystemServer(fs), nil
 }
@@ -44,7 +44,7 @@ type staleFileHandleCommon struct {
 func commonServerConfig() *cfg.Config {
 	return &cfg.Config{
 		FileSystem: cfg.FileSystemConfig{
-			PreconditionErrors: true,
+			PreconditionErrors: "true",
 		},
 		MetadataCache: cfg.MetadataCacheConfig{
 			TtlSecs: 0,
@@ -0,0 +1,151 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Usage is refreshed in the background, so these tests call StatFS directly
+// and wait for the first listing rather than going through a mount.
+
+package fs_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+const statFSBlockSize = 1 << 17
+
+type StatFSTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcs.Bucket
+}
+
+func TestStatFSSuite(t *testing.T) {
+	suite.Run(t, new(StatFSTest))
+}
+
+func (t *StatFSTest) SetupTest() {
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+}
+
+func (t *StatFSTest) newFileSystem(fsConfig cfg.FileSystemConfig) fuseutil.FileSystem {
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	serverCfg := &fs.ServerConfig{
+		CacheClock: &clock,
+		BucketManager: &fakeBucketManager{
+			buckets:                  map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			chunkTransferTimeoutSecs: 10,
+			tmpObjectPrefix:          ".gcsfuse_tmp/",
+		},
+		BucketName:           t.bucket.Name(),
+		RenameDirLimit:       RenameDirLimit,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		NewConfig: &cfg.Config{
+			FileCache: defaultFileCacheConfig(),
+			MetadataCache: cfg.MetadataCacheConfig{
+				StatCacheMaxSizeMb: 32,
+				TtlSecs:            60,
+				TypeCacheMaxSizeMb: 4,
+			},
+			FileSystem: fsConfig,
+		},
+		MetricHandle: common.NewNoopMetrics(),
+		FilePerms:    filePerms,
+		DirPerms:     dirPerms,
+	}
+
+	server, err := fs.NewFileSystem(t.ctx, serverCfg)
+	require.NoError(t.T(), err)
+	t.T().Cleanup(server.Destroy)
+
+	return server
+}
+
+func (t *StatFSTest) statFS(server fuseutil.FileSystem) *fuseops.StatFSOp {
+	op := &fuseops.StatFSOp{}
+	require.NoError(t.T(), server.StatFS(t.ctx, op))
+	return op
+}
+
+func (t *StatFSTest) TestDefaults() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("taco"))
+	require.NoError(t.T(), err)
+	server := t.newFileSystem(cfg.FileSystemConfig{})
+
+	op := t.statFS(server)
+
+	assert.Equal(t.T(), uint32(statFSBlockSize), op.BlockSize)
+	assert.Equal(t.T(), uint64(1<<33), op.Blocks)
+	assert.Equal(t.T(), op.Blocks, op.BlocksFree)
+	assert.Equal(t.T(), op.Blocks, op.BlocksAvailable)
+	assert.Equal(t.T(), uint64(1<<50), op.Inodes)
+	assert.Equal(t.T(), op.Inodes, op.InodesFree)
+}
+
+func (t *StatFSTest) TestCapacityAndUsage() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte(strings.Repeat("x", statFSBlockSize+1)))
+	require.NoError(t.T(), err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, "dir/", nil)
+	require.NoError(t.T(), err)
+	server := t.newFileSystem(cfg.FileSystemConfig{
+		CapacityMb:               1,
+		UsageRefreshIntervalSecs: 60,
+	})
+
+	var op *fuseops.StatFSOp
+	assert.Eventually(t.T(), func() bool {
+		op = t.statFS(server)
+		return op.InodesFree != op.Inodes
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t.T(), uint64(8), op.Blocks)
+	assert.Equal(t.T(), uint64(6), op.BlocksFree)
+	assert.Equal(t.T(), op.BlocksFree, op.BlocksAvailable)
+	assert.Equal(t.T(), op.Inodes-2, op.InodesFree)
+}
+
+func (t *StatFSTest) TestUsageExceedingCapacity() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte(strings.Repeat("x", 10*statFSBlockSize)))
+	require.NoError(t.T(), err)
+	server := t.newFileSystem(cfg.FileSystemConfig{
+		CapacityMb:               1,
+		UsageRefreshIntervalSecs: 60,
+	})
+
+	var op *fuseops.StatFSOp
+	assert.Eventually(t.T(), func() bool {
+		op = t.statFS(server)
+		return op.InodesFree != op.Inodes
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t.T(), uint64(8), op.Blocks)
+	assert.Equal(t.T(), uint64(0), op.BlocksFree)
+	assert.Equal(t.T(), uint64(0), op.BlocksAvailable)
+}
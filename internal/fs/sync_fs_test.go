@@ -0,0 +1,148 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The kernel only sends FUSE_SYNCFS for some transports, so these tests call
+// the file system ops directly rather than going through a mount.
+
+package fs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/fs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/fuse/fuseops"
+	"github.com/jacobsa/fuse/fuseutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type SyncFSTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcs.Bucket
+	fs     fuseutil.FileSystem
+}
+
+func TestSyncFSSuite(t *testing.T) {
+	suite.Run(t, new(SyncFSTest))
+}
+
+func (t *SyncFSTest) SetupTest() {
+	var err error
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+
+	var clock timeutil.SimulatedClock
+	clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+	serverCfg := &fs.ServerConfig{
+		CacheClock: &clock,
+		BucketManager: &fakeBucketManager{
+			buckets:                  map[string]gcs.Bucket{t.bucket.Name(): t.bucket},
+			chunkTransferTimeoutSecs: 10,
+			tmpObjectPrefix:          ".gcsfuse_tmp/",
+		},
+		BucketName:           t.bucket.Name(),
+		RenameDirLimit:       RenameDirLimit,
+		SequentialReadSizeMb: SequentialReadSizeMb,
+		NewConfig: &cfg.Config{
+			FileCache: defaultFileCacheConfig(),
+			MetadataCache: cfg.MetadataCacheConfig{
+				StatCacheMaxSizeMb: 32,
+				TtlSecs:            60,
+				TypeCacheMaxSizeMb: 4,
+			},
+		},
+		MetricHandle: common.NewNoopMetrics(),
+		FilePerms:    filePerms,
+		DirPerms:     dirPerms,
+	}
+
+	t.fs, err = fs.NewFileSystem(t.ctx, serverCfg)
+	require.NoError(t.T(), err)
+}
+
+func (t *SyncFSTest) TearDownTest() {
+	t.fs.Destroy()
+}
+
+// Create a file with the given name under the root, write the supplied
+// contents to it and return its inode.
+func (t *SyncFSTest) createAndWrite(name string, contents string) fuseops.InodeID {
+	createOp := &fuseops.CreateFileOp{
+		Parent: fuseops.RootInodeID,
+		Name:   name,
+		Mode:   filePerms,
+	}
+	require.NoError(t.T(), t.fs.CreateFile(t.ctx, createOp))
+
+	writeOp := &fuseops.WriteFileOp{
+		Inode:  createOp.Entry.Child,
+		Handle: createOp.Handle,
+		Data:   []byte(contents),
+	}
+	require.NoError(t.T(), t.fs.WriteFile(t.ctx, writeOp))
+
+	return createOp.Entry.Child
+}
+
+func (t *SyncFSTest) TestSyncsAllDirtyFiles() {
+	t.createAndWrite("foo", "taco")
+	t.createAndWrite("bar", "burrito")
+	// Nothing has been written to the bucket yet.
+	_, err := storageutil.ReadObject(t.ctx, t.bucket, "foo")
+	require.Error(t.T(), err)
+
+	err = t.fs.SyncFS(t.ctx, &fuseops.SyncFSOp{})
+
+	require.NoError(t.T(), err)
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "foo")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+	contents, err = storageutil.ReadObject(t.ctx, t.bucket, "bar")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "burrito", string(contents))
+}
+
+func (t *SyncFSTest) TestNoDirtyFiles() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("taco"))
+	require.NoError(t.T(), err)
+	lookUpOp := &fuseops.LookUpInodeOp{Parent: fuseops.RootInodeID, Name: "foo"}
+	require.NoError(t.T(), t.fs.LookUpInode(t.ctx, lookUpOp))
+
+	err = t.fs.SyncFS(t.ctx, &fuseops.SyncFSOp{})
+
+	require.NoError(t.T(), err)
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "foo"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), int64(1), m.MetaGeneration)
+}
+
+func (t *SyncFSTest) TestCancelledContext() {
+	t.createAndWrite("foo", "taco")
+	ctx, cancel := context.WithCancel(t.ctx)
+	cancel()
+
+	err := t.fs.SyncFS(ctx, &fuseops.SyncFSOp{})
+
+	assert.ErrorIs(t.T(), err, context.Canceled)
+}
@@ -405,3 +405,21 @@ func (em *errorMapping) SyncFS(
 	err := em.wrapped.SyncFS(ctx, op)
 	return em.mapError("SyncFS", err)
 }
+
+func (em *errorMapping) GetLk(
+	ctx context.Context,
+	op *fuseops.GetLkOp) error {
+	defer em.handlePanic()
+
+	err := em.wrapped.GetLk(ctx, op)
+	return em.mapError("GetLk", err)
+}
+
+func (em *errorMapping) SetLk(
+	ctx context.Context,
+	op *fuseops.SetLkOp) error {
+	defer em.handlePanic()
+
+	err := em.wrapped.SetLk(ctx, op)
+	return em.mapError("SetLk", err)
+}
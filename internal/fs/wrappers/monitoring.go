@@ -385,3 +385,11 @@ func (fs *monitoring) Fallocate(ctx context.Context, op *fuseops.FallocateOp) er
 func (fs *monitoring) SyncFS(ctx context.Context, op *fuseops.SyncFSOp) error {
 	return fs.invokeWrapped(ctx, "SyncFS", func(ctx context.Context) error { return fs.wrapped.SyncFS(ctx, op) })
 }
+
+func (fs *monitoring) GetLk(ctx context.Context, op *fuseops.GetLkOp) error {
+	return fs.invokeWrapped(ctx, "GetLk", func(ctx context.Context) error { return fs.wrapped.GetLk(ctx, op) })
+}
+
+func (fs *monitoring) SetLk(ctx context.Context, op *fuseops.SetLkOp) error {
+	return fs.invokeWrapped(ctx, "SetLk", func(ctx context.Context) error { return fs.wrapped.SetLk(ctx, op) })
+}
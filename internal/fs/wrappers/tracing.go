@@ -174,3 +174,11 @@ func (fs *tracing) Fallocate(ctx context.Context, op *fuseops.FallocateOp) error
 func (fs *tracing) SyncFS(ctx context.Context, op *fuseops.SyncFSOp) error {
 	return fs.invokeWrapped(ctx, "SyncFS", func(ctx context.Context) error { return fs.wrapped.SyncFS(ctx, op) })
 }
+
+func (fs *tracing) GetLk(ctx context.Context, op *fuseops.GetLkOp) error {
+	return fs.invokeWrapped(ctx, "GetLk", func(ctx context.Context) error { return fs.wrapped.GetLk(ctx, op) })
+}
+
+func (fs *tracing) SetLk(ctx context.Context, op *fuseops.SetLkOp) error {
+	return fs.invokeWrapped(ctx, "SetLk", func(ctx context.Context) error { return fs.wrapped.SetLk(ctx, op) })
+}
@@ -19,13 +19,18 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/canned"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/monitor"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/policy"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/ratelimit"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/caching"
@@ -40,6 +45,8 @@ type BucketConfig struct {
 	EgressBandwidthLimitBytesPerSecond float64
 	OpRateLimitHz                      float64
 	StatCacheMaxSizeMB                 uint64
+	// The eviction policy of the stat cache; see lru.NewPolicy.
+	StatCacheEvictionPolicy string
 	// Config for TTL of entries for existing file in stat cache
 	StatCacheTTL time.Duration
 	// Config for TTL of entries for non-existing file in stat cache
@@ -65,14 +72,56 @@ type BucketConfig struct {
 	AppendThreshold          int64
 	ChunkTransferTimeoutSecs int64
 	TmpObjectPrefix          string
+
+	// If non-zero, mount a read-only view of the bucket as it was at this time.
+	// The bucket must have object versioning enabled.
+	SnapshotTime time.Time
+
+	// Expose the noncurrent generations of each object in a virtual directory
+	// named after it. See NewVersionsBucket.
+	EnableVersionsDir bool
+
+	// Expose recently deleted objects under TrashDir. See NewTrashBucket.
+	EnableTrashDir bool
+
+	// If set, keep all changes in a local bucket in a subdirectory of this
+	// directory named after the bucket, layered over it in a union, rather
+	// than writing them to GCS. Files are copied up straight into it, see
+	// UpperLayer. See CommitUpperLayer.
+	LocalUpperDir string
+
+	// If non-nil, per-path rules whose read-only and content type settings are
+	// applied to the objects they match, see NewPolicyBucket, and whose stat
+	// cache TTLs apply to the stat cache.
+	PolicyRules *policy.Rules
+
+	// If non-nil, stat cache entries are also kept here, so that they survive
+	// the mount. See metadata.NewDiskBackedStatCache.
+	MetadataDiskCache *metadata.DiskCache
+
+	// If non-nil, look-ups in the stat cache are reported here.
+	MetricHandle common.MetricHandle
+}
+
+// LocalUpperLayerDir returns the directory holding the local upper layer for
+// the named bucket.
+func LocalUpperLayerDir(localUpperDir string, bucketName string) string {
+	return filepath.Join(localUpperDir, bucketName)
 }
 
 // BucketManager manages the lifecycle of buckets.
 type BucketManager interface {
+	// Sets up the named bucket. A name made of several bucket names joined by
+	// UnionBucketSeparator sets up a union of them, the first taking
+	// precedence; see NewUnionBucket.
 	SetUpBucket(
 		ctx context.Context,
 		name string, isMultibucketMount bool, metricHandle common.MetricHandle) (b SyncerBucket, err error)
 
+	// Erases any stat cache entry for the named object in the named bucket, so
+	// that the next stat of the object goes to GCS.
+	InvalidateStatCache(bucketName string, objectName string)
+
 	// Shuts down the bucket manager and its buckets
 	ShutDown()
 }
@@ -82,6 +131,12 @@ type bucketManager struct {
 	storageHandle   storage.StorageHandle
 	sharedStatCache *lru.Cache
 
+	// The stat cache of each bucket set up so far, keyed by bucket name.
+	//
+	// GUARDED_BY(statCachesMu)
+	statCaches   map[string]metadata.StatCache
+	statCachesMu sync.Mutex
+
 	// Garbage collector
 	gcCtx                 context.Context
 	stopGarbageCollecting func()
@@ -90,13 +145,24 @@ type bucketManager struct {
 func NewBucketManager(config BucketConfig, storageHandle storage.StorageHandle) BucketManager {
 	var c *lru.Cache
 	if config.StatCacheMaxSizeMB > 0 {
-		c = lru.NewCache(util.MiBsToBytes(config.StatCacheMaxSizeMB))
+		maxSize := util.MiBsToBytes(config.StatCacheMaxSizeMB)
+		policy, err := lru.NewPolicy(config.StatCacheEvictionPolicy, maxSize)
+		if err != nil {
+			// The mount rejects unknown policies before getting here.
+			logger.Warnf("Using LRU eviction for the stat cache: %v", err)
+			policy, _ = lru.NewPolicy(lru.LRUPolicy, maxSize)
+		}
+		c = lru.NewCacheWithPolicy(maxSize, policy)
+		if config.MetricHandle != nil {
+			c.SetLookUpObserver(common.CacheLookUpRecorder(config.MetricHandle, "stat", config.StatCacheEvictionPolicy))
+		}
 	}
 
 	bm := &bucketManager{
 		config:          config,
 		storageHandle:   storageHandle,
 		sharedStatCache: c,
+		statCaches:      make(map[string]metadata.StatCache),
 	}
 	bm.gcCtx, bm.stopGarbageCollecting = context.WithCancel(context.Background())
 	return bm
@@ -156,13 +222,14 @@ func setUpRateLimiting(
 	return
 }
 
-func (bm *bucketManager) SetUpBucket(
+// Set up the stack of wrappers for a single bucket, up to but not including
+// those dealing with content types and temporary objects.
+func (bm *bucketManager) setUpBucket(
 	ctx context.Context,
 	name string,
 	isMultibucketMount bool,
 	metricHandle common.MetricHandle,
-) (sb SyncerBucket, err error) {
-	var b gcs.Bucket
+) (b gcs.Bucket, err error) {
 	// Set up the appropriate backing bucket.
 	if name == canned.FakeBucketName {
 		b = canned.MakeFakeBucket(ctx)
@@ -182,13 +249,26 @@ func (bm *bucketManager) SetUpBucket(
 	// Enable gcs logs.
 	b = storage.NewDebugBucket(b)
 
+	// Pin to a point in time, if requested.
+	if !bm.config.SnapshotTime.IsZero() {
+		b = NewSnapshotBucket(bm.config.SnapshotTime, b)
+	}
+
 	// Limit to a requested prefix of the bucket, if any.
-	if bm.config.OnlyDir != "" {
-		b, err = NewPrefixBucket(path.Clean(bm.config.OnlyDir)+"/", b)
-		if err != nil {
-			err = fmt.Errorf("NewPrefixBucket: %w", err)
-			return
-		}
+	if b, err = NewOnlyDirBucket(bm.config.OnlyDir, b); err != nil {
+		return
+	}
+
+	// Expose old generations, if requested. A snapshot already shows the
+	// bucket as it was, and has no old generations of its own. Both come after
+	// any prefix, so that they are relative to the root of the mount.
+	if bm.config.EnableVersionsDir && bm.config.SnapshotTime.IsZero() {
+		b = NewVersionsBucket(b)
+	}
+
+	// Expose deleted objects, if requested.
+	if bm.config.EnableTrashDir && bm.config.SnapshotTime.IsZero() {
+		b = NewTrashBucket(b)
 	}
 
 	// Enable rate limiting, if requested.
@@ -212,17 +292,109 @@ func (bm *bucketManager) SetUpBucket(
 			statCache = metadata.NewStatCacheBucketView(bm.sharedStatCache, "")
 		}
 
-		b = caching.NewFastStatBucket(
+		if bm.config.MetadataDiskCache != nil {
+			statCache = metadata.NewDiskBackedStatCache(statCache, bm.config.MetadataDiskCache, name, OnlyDirPrefix(bm.config.OnlyDir))
+		}
+
+		bm.statCachesMu.Lock()
+		bm.statCaches[name] = statCache
+		bm.statCachesMu.Unlock()
+
+		// Per-path rules can override the TTL for the names they match.
+		var ttlFor func(string, time.Duration) time.Duration
+		if bm.config.PolicyRules != nil {
+			ttlFor = func(name string, ttl time.Duration) time.Duration {
+				return bm.config.PolicyRules.Match(name).StatCacheTTL(ttl)
+			}
+		}
+
+		b = caching.NewFastStatBucketWithPerNameTTL(
 			bm.config.StatCacheTTL,
+			ttlFor,
 			statCache,
 			timeutil.RealClock(),
 			b,
 			bm.config.NegativeStatCacheTTL)
 	}
 
+	return
+}
+
+// Return an error if the supplied bucket can't be a layer of a union bucket,
+// which doesn't merge the folders of hierarchical buckets.
+func checkUnionLayer(b gcs.Bucket) error {
+	if b.BucketType().Hierarchical {
+		return fmt.Errorf("hierarchical bucket %q can't be a layer of a union", b.Name())
+	}
+
+	return nil
+}
+
+// Set up a union of the named buckets, the first of which is the upper layer.
+func (bm *bucketManager) setUpUnionBucket(
+	ctx context.Context,
+	names []string,
+	metricHandle common.MetricHandle,
+) (b gcs.Bucket, err error) {
+	layers := make([]gcs.Bucket, len(names))
+	for i, name := range names {
+		// The layers share the stat cache, so key their entries by bucket name
+		// as in a multi-bucket mount.
+		layers[i], err = bm.setUpBucket(ctx, name, true, metricHandle)
+		if err != nil {
+			err = fmt.Errorf("layer %q: %w", name, err)
+			return
+		}
+
+		if err = checkUnionLayer(layers[i]); err != nil {
+			return
+		}
+	}
+
+	b = NewUnionBucket(bm.config.TmpObjectPrefix, layers[0], layers[1:]...)
+	return
+}
+
+func (bm *bucketManager) SetUpBucket(
+	ctx context.Context,
+	name string,
+	isMultibucketMount bool,
+	metricHandle common.MetricHandle,
+) (sb SyncerBucket, err error) {
+	var b gcs.Bucket
+	if layers := strings.Split(name, UnionBucketSeparator); len(layers) > 1 {
+		b, err = bm.setUpUnionBucket(ctx, layers, metricHandle)
+	} else {
+		b, err = bm.setUpBucket(ctx, name, isMultibucketMount, metricHandle)
+	}
+	if err != nil {
+		return
+	}
+
+	// Keep changes on local disk, if requested.
+	if bm.config.LocalUpperDir != "" {
+		if err = checkUnionLayer(b); err != nil {
+			return
+		}
+
+		var local gcs.Bucket
+		local, err = storage.NewLocalBucket(LocalUpperLayerDir(bm.config.LocalUpperDir, name))
+		if err != nil {
+			err = fmt.Errorf("NewLocalBucket: %w", err)
+			return
+		}
+
+		b = NewUnionBucket(bm.config.TmpObjectPrefix, local, b)
+	}
+
 	// Enable content type awareness
 	b = NewContentTypeBucket(b)
 
+	// Apply per-path rules, which take precedence over guessed content types.
+	if bm.config.PolicyRules != nil {
+		b = NewPolicyBucket(b, bm.config.PolicyRules)
+	}
+
 	// Enable Syncer
 	if bm.config.TmpObjectPrefix == "" {
 		err = errors.New("you must set TmpObjectPrefix")
@@ -246,12 +418,44 @@ func (bm *bucketManager) SetUpBucket(
 		}
 	}
 
+	// A snapshot can't be modified, so there is nothing to clean up.
+	if !bm.config.SnapshotTime.IsZero() {
+		return
+	}
+
+	// Journals left by renames and exchanges interrupted by a crash can't be
+	// told apart from those of renames still in progress on other mounts, so
+	// they are only reported here, and recovered by the repair-renames command.
+	// Failing to look for them shouldn't prevent mounting.
+	journals, journalsErr := CountJournals(ctx, sb, bm.config.TmpObjectPrefix)
+	if journalsErr != nil {
+		logger.Warnf("Failed to look for interrupted renames in bucket %q: %v", name, journalsErr)
+	} else if journals > 0 {
+		logger.Warnf("Found %d renames or exchanges in bucket %q that are in progress elsewhere or were interrupted; "+
+			"once no other mount is using the bucket, run \"gcsfuse repair-renames %s\" to finish them.", journals, name, name)
+	}
+
 	// Periodically garbage collect temporary objects
 	go garbageCollect(bm.gcCtx, bm.config.TmpObjectPrefix, sb)
 
 	return
 }
 
+func (bm *bucketManager) InvalidateStatCache(bucketName string, objectName string) {
+	// The stat caches of a union are those of its layers.
+	for _, name := range strings.Split(bucketName, UnionBucketSeparator) {
+		bm.statCachesMu.Lock()
+		statCache, ok := bm.statCaches[name]
+		bm.statCachesMu.Unlock()
+
+		// Each operation on the shared cache is atomic, so the entry can be
+		// erased without holding the lock of the bucket that owns it.
+		if ok {
+			statCache.Erase(objectName)
+		}
+	}
+}
+
 func (bm *bucketManager) ShutDown() {
 	bm.stopGarbageCollecting()
 }
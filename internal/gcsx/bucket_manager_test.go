@@ -23,6 +23,8 @@ import (
 	"cloud.google.com/go/storage/control/apiv2/controlpb"
 	"github.com/googlecloudplatform/gcsfuse/v2/cfg"
 	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/lru"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/cache/metadata"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage"
 	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
 	. "github.com/jacobsa/ogletest"
@@ -186,3 +188,24 @@ func (t *BucketManagerTest) TestSetUpBucketMethodWhenBucketDoesNotExist_IsMultiB
 	ExpectTrue(strings.Contains(err.Error(), "error in iterating through objects: storage: bucket doesn't exist"))
 	ExpectNe(nil, bucket.Syncer)
 }
+
+func (t *BucketManagerTest) TestInvalidateStatCacheOfUnion() {
+	sharedStatCache := lru.NewCache(1024 * 1024)
+	bm := bucketManager{
+		statCaches: map[string]metadata.StatCache{
+			"upper": metadata.NewStatCacheBucketView(sharedStatCache, "upper"),
+			"lower": metadata.NewStatCacheBucketView(sharedStatCache, "lower"),
+		},
+	}
+	expiration := time.Now().Add(time.Hour)
+	for _, sc := range bm.statCaches {
+		sc.Insert(&gcs.MinObject{Name: "foo", Generation: 1}, expiration)
+	}
+
+	bm.InvalidateStatCache("upper"+UnionBucketSeparator+"lower", "foo")
+
+	for _, sc := range bm.statCaches {
+		hit, _ := sc.LookUp("foo", time.Now())
+		ExpectFalse(hit)
+	}
+}
@@ -67,3 +67,17 @@ func (b contentTypeBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs
 	// Pass on the request.
 	return b.Bucket.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
 }
+
+func (b contentTypeBucket) StagingDir() string {
+	return stagingDir(b.Bucket)
+}
+
+func (b contentTypeBucket) CreateObjectFromFile(ctx context.Context, req *gcs.CreateObjectRequest, filePath string) (*gcs.Object, error) {
+	// Guess a content type if necessary.
+	if req.ContentType == "" {
+		req.ContentType = mime.TypeByExtension(path.Ext(req.Name))
+	}
+
+	// Pass on the request.
+	return createObjectFromFile(ctx, b.Bucket, req, filePath)
+}
@@ -0,0 +1,568 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"golang.org/x/net/context"
+)
+
+// GCS can't swap two names atomically, so an exchange sets one of them aside
+// under a temporary name, moves the other into its place, and then moves the
+// set aside one into the place of the other. Every step is preconditioned on
+// what was there before, so a concurrent modification makes the exchange fail
+// instead of losing data.
+//
+// The temporary names live under exchangeDir within the temporary object
+// prefix, which garbage collection leaves alone. Before setting anything
+// aside, the exchange is recorded in a journal object next to the temporary
+// name, and the journal is deleted once nothing is left under that name. If
+// we are interrupted part way through, RecoverExchanges uses the journal to
+// put the set aside object or folder back.
+const exchangeDir = "exchange/"
+
+// The suffix of the name of the journal object of an exchange, appended to its
+// temporary name. A folder's journal sits next to it rather than inside it, so
+// that the journal isn't renamed along with the folder.
+const exchangeJournalSuffix = ".journal"
+
+// Does the supplied name, within exchangeDir, name an exchange journal rather
+// than a temporary object or something inside a set aside folder?
+func isExchangeJournal(tmpObjectPrefix string, name string) bool {
+	rest, ok := strings.CutPrefix(name, tmpObjectPrefix+exchangeDir)
+	return ok && !strings.Contains(rest, "/") && strings.HasSuffix(rest, exchangeJournalSuffix)
+}
+
+// exchangeJournal records a planned exchange.
+type exchangeJournal struct {
+	// The names and generations of the objects or folders to exchange. Folders
+	// have no generations.
+	A           string `json:"a"`
+	AGeneration int64  `json:"a_generation"`
+	B           string `json:"b"`
+	BGeneration int64  `json:"b_generation"`
+
+	// The name b is set aside under.
+	Tmp string `json:"tmp"`
+
+	// Set if the objects are moved rather than copied.
+	Move bool `json:"move"`
+
+	// Set if A and B name folders in a hierarchical bucket.
+	Folders bool `json:"folders"`
+}
+
+// Return a random suffix for temporary names.
+func randomNameSuffix() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("rand.Read: %w", err)
+	}
+
+	return hex.EncodeToString(b[:]), nil
+}
+
+// Write the supplied journal to the bucket, returning the name of the journal
+// object.
+func writeExchangeJournal(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	journal *exchangeJournal) (name string, err error) {
+	contents, err := json.Marshal(journal)
+	if err != nil {
+		err = fmt.Errorf("json.Marshal: %w", err)
+		return
+	}
+
+	name = strings.TrimSuffix(journal.Tmp, "/") + exchangeJournalSuffix
+	var preconditionZero int64
+	_, err = bucket.CreateObject(
+		ctx,
+		&gcs.CreateObjectRequest{
+			Name:                   name,
+			Contents:               bytes.NewReader(contents),
+			GenerationPrecondition: &preconditionZero,
+		})
+	if err != nil {
+		err = fmt.Errorf("CreateObject(%q): %w", name, err)
+	}
+
+	return
+}
+
+// Copy or, if move is set, move the supplied generation of src to dstName,
+// which must have the given generation (zero meaning that it must not exist).
+func transferObject(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	src *gcs.MinObject,
+	dstName string,
+	dstGeneration int64,
+	move bool) (o *gcs.Object, err error) {
+	if move {
+		o, err = bucket.MoveObject(
+			ctx,
+			&gcs.MoveObjectRequest{
+				SrcName:                       src.Name,
+				DstName:                       dstName,
+				SrcGeneration:                 src.Generation,
+				SrcMetaGenerationPrecondition: &src.MetaGeneration,
+				DstGenerationPrecondition:     &dstGeneration,
+			})
+		if err != nil {
+			err = fmt.Errorf("MoveObject(%q, %q): %w", src.Name, dstName, err)
+		}
+		return
+	}
+
+	o, err = bucket.CopyObject(
+		ctx,
+		&gcs.CopyObjectRequest{
+			SrcName:                       src.Name,
+			DstName:                       dstName,
+			SrcGeneration:                 src.Generation,
+			SrcMetaGenerationPrecondition: &src.MetaGeneration,
+			DstGenerationPrecondition:     &dstGeneration,
+		})
+	if err != nil {
+		err = fmt.Errorf("CopyObject(%q, %q): %w", src.Name, dstName, err)
+	}
+	return
+}
+
+// ExchangeObjects swaps the names of the supplied generations of two objects.
+// When move is set the objects are moved with MoveObject, which only buckets
+// with atomic object renames support; otherwise they are copied, and the
+// temporary copy deleted afterwards.
+func ExchangeObjects(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	tmpObjectPrefix string,
+	a *gcs.MinObject,
+	b *gcs.MinObject,
+	move bool) (err error) {
+	suffix, err := randomNameSuffix()
+	if err != nil {
+		return
+	}
+
+	journal := &exchangeJournal{
+		A:           a.Name,
+		AGeneration: a.Generation,
+		B:           b.Name,
+		BGeneration: b.Generation,
+		Tmp:         tmpObjectPrefix + exchangeDir + suffix,
+		Move:        move,
+	}
+	journalName, err := writeExchangeJournal(ctx, bucket, journal)
+	if err != nil {
+		return
+	}
+
+	// The journal is only deleted once nothing is left under the temporary
+	// name; otherwise it is left for RecoverExchanges.
+	var settled bool
+	defer func() {
+		if settled {
+			deleteExchangeObject(ctx, bucket, journalName, 0)
+		} else {
+			logger.Warnf("Exchange of %q and %q left unfinished; see %q", a.Name, b.Name, journalName)
+		}
+	}()
+
+	// Set b aside.
+	tmp, err := transferObject(ctx, bucket, b, journal.Tmp, 0, move)
+	if err != nil {
+		// Nothing has changed, unless the request took effect regardless.
+		left, statErr := statObject(ctx, bucket, journal.Tmp)
+		settled = statErr == nil && left == nil
+		return
+	}
+
+	// Put a in place of b. A move has vacated b's name already.
+	bGeneration := b.Generation
+	if move {
+		bGeneration = 0
+	}
+	newB, err := transferObject(ctx, bucket, a, b.Name, bGeneration, move)
+	if err != nil {
+		if move {
+			settled = restoreObject(ctx, bucket, tmp, b.Name, 0, true)
+		} else {
+			settled = deleteExchangeObject(ctx, bucket, tmp.Name, tmp.Generation)
+		}
+		return
+	}
+
+	// Put b in place of a. A move has vacated a's name already.
+	aGeneration := a.Generation
+	if move {
+		aGeneration = 0
+	}
+	if _, err = transferObject(ctx, bucket, tmpMinObject(tmp), a.Name, aGeneration, move); err != nil {
+		// b's contents only survive in the temporary object now.
+		if move {
+			settled = restoreObject(ctx, bucket, newB, a.Name, 0, true) &&
+				restoreObject(ctx, bucket, tmp, b.Name, 0, true)
+		} else {
+			settled = restoreObject(ctx, bucket, tmp, b.Name, newB.Generation, false)
+		}
+		return
+	}
+
+	settled = move || deleteExchangeObject(ctx, bucket, tmp.Name, tmp.Generation)
+	return
+}
+
+// Put an object back under the supplied name after a failed exchange, deleting
+// the source if it was copied, and return whether that succeeded. Failures are
+// logged rather than returned, since the caller already has an error to
+// report; the set aside object is left under the temporary name, for
+// RecoverExchanges, when it can't be restored.
+func restoreObject(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	src *gcs.Object,
+	name string,
+	generation int64,
+	move bool) bool {
+	if _, err := transferObject(ctx, bucket, tmpMinObject(src), name, generation, move); err != nil {
+		logger.Warnf("Failed to restore %q from %q: %v", name, src.Name, err)
+		return false
+	}
+
+	if !move {
+		return deleteExchangeObject(ctx, bucket, src.Name, src.Generation)
+	}
+	return true
+}
+
+// Delete the supplied generation of an object written by an exchange, zero
+// meaning the latest, and return whether that succeeded.
+func deleteExchangeObject(ctx context.Context, bucket gcs.Bucket, name string, generation int64) bool {
+	err := bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: name, Generation: generation})
+	if err != nil {
+		logger.Warnf("Failed to delete %q after an exchange: %v", name, err)
+		return false
+	}
+	return true
+}
+
+func tmpMinObject(o *gcs.Object) *gcs.MinObject {
+	return &gcs.MinObject{
+		Name:           o.Name,
+		Generation:     o.Generation,
+		MetaGeneration: o.MetaGeneration,
+	}
+}
+
+// ExchangeFolders swaps the names of two folders in a hierarchical bucket,
+// setting a aside under the temporary object prefix, so that it never shows
+// up in a listing of its parent.
+func ExchangeFolders(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	tmpObjectPrefix string,
+	a string,
+	b string) (err error) {
+	suffix, err := randomNameSuffix()
+	if err != nil {
+		return
+	}
+
+	// Hierarchical buckets only create the parents of objects implicitly, so
+	// the folder to set a aside in must be created up front.
+	if err = ensureFolder(ctx, bucket, tmpObjectPrefix+exchangeDir); err != nil {
+		return
+	}
+
+	journal := &exchangeJournal{
+		A:       a,
+		B:       b,
+		Tmp:     tmpObjectPrefix + exchangeDir + suffix + "/",
+		Folders: true,
+	}
+	journalName, err := writeExchangeJournal(ctx, bucket, journal)
+	if err != nil {
+		return
+	}
+
+	var settled bool
+	defer func() {
+		if settled {
+			deleteExchangeObject(ctx, bucket, journalName, 0)
+		} else {
+			logger.Warnf("Exchange of %q and %q left unfinished; see %q", a, b, journalName)
+		}
+	}()
+
+	if _, err = bucket.RenameFolder(ctx, a, journal.Tmp); err != nil {
+		err = fmt.Errorf("RenameFolder(%q, %q): %w", a, journal.Tmp, err)
+		settled = true
+		return
+	}
+
+	if _, err = bucket.RenameFolder(ctx, b, a); err != nil {
+		err = fmt.Errorf("RenameFolder(%q, %q): %w", b, a, err)
+		if _, restoreErr := bucket.RenameFolder(ctx, journal.Tmp, a); restoreErr != nil {
+			logger.Warnf("Failed to restore %q from %q: %v", a, journal.Tmp, restoreErr)
+			return
+		}
+		settled = true
+		return
+	}
+
+	if _, err = bucket.RenameFolder(ctx, journal.Tmp, b); err != nil {
+		err = fmt.Errorf("RenameFolder(%q, %q): %w", journal.Tmp, b, err)
+		return
+	}
+
+	settled = true
+	return
+}
+
+// Create the named folder unless it exists already.
+func ensureFolder(ctx context.Context, bucket gcs.Bucket, name string) (err error) {
+	_, err = bucket.GetFolder(ctx, name)
+	var notFoundErr *gcs.NotFoundError
+	if !errors.As(err, &notFoundErr) {
+		if err != nil {
+			err = fmt.Errorf("GetFolder(%q): %w", name, err)
+		}
+		return
+	}
+
+	if _, err = bucket.CreateFolder(ctx, name); err != nil {
+		err = fmt.Errorf("CreateFolder(%q): %w", name, err)
+	}
+	return
+}
+
+// RecoverExchanges resolves the exchanges left unfinished in the bucket,
+// putting whatever was set aside back under one of the exchanged names.
+// Journals written less than minAge ago are skipped, since the exchanges they
+// describe may still be in progress on another mount, as are those whose
+// names have both been rewritten since, which are logged and left for the
+// user to sort out.
+func RecoverExchanges(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	tmpObjectPrefix string,
+	minAge time.Duration) (recovered int, err error) {
+	listing, err := listJournals(ctx, bucket, tmpObjectPrefix+exchangeDir)
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	for _, o := range listing {
+		if !isExchangeJournal(tmpObjectPrefix, o.Name) {
+			continue
+		}
+
+		if now.Sub(o.Updated) < minAge {
+			logger.Infof("Skipping exchange journal %q written %v ago", o.Name, now.Sub(o.Updated))
+			continue
+		}
+
+		var resolved bool
+		if resolved, err = recoverExchange(ctx, bucket, o.Name); err != nil {
+			err = fmt.Errorf("recover exchange %q: %w", o.Name, err)
+			return
+		}
+
+		if resolved {
+			recovered++
+		}
+	}
+
+	return
+}
+
+// Read the journal with the supplied name, put back whatever the exchange it
+// describes left under the temporary name, then delete it.
+func recoverExchange(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	name string) (resolved bool, err error) {
+	contents, err := storageutil.ReadObject(ctx, bucket, name)
+	if err != nil {
+		err = fmt.Errorf("ReadObject: %w", err)
+		return
+	}
+
+	var journal exchangeJournal
+	if err = json.Unmarshal(contents, &journal); err != nil {
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+
+	if journal.Folders {
+		resolved, err = recoverFolderExchange(ctx, bucket, &journal)
+	} else {
+		resolved, err = recoverObjectExchange(ctx, bucket, &journal)
+	}
+	if err != nil || !resolved {
+		return
+	}
+
+	err = bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: name})
+	if err != nil {
+		err = fmt.Errorf("DeleteObject(%q): %w", name, err)
+	}
+
+	return
+}
+
+// Work out how far the exchange of two objects got from the generations now
+// under their names, and finish or undo it accordingly.
+func recoverObjectExchange(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	journal *exchangeJournal) (resolved bool, err error) {
+	tmp, err := statObject(ctx, bucket, journal.Tmp)
+	if err != nil || tmp == nil {
+		// Nothing was set aside, or it has been put back already.
+		resolved = err == nil
+		return
+	}
+
+	a, err := statObject(ctx, bucket, journal.A)
+	if err != nil {
+		return
+	}
+	b, err := statObject(ctx, bucket, journal.B)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case b == nil:
+		// b was moved aside, but a wasn't put in its place.
+		logger.Infof("Restoring %q from %q", journal.B, tmp.Name)
+		err = restoreExchangedObject(ctx, bucket, tmp, journal.B, 0, journal.Move)
+
+	case b.Generation == journal.BGeneration:
+		// b was copied aside, but not replaced.
+		err = deleteObjectGeneration(ctx, bucket, tmp)
+
+	case a == nil || a.Generation == journal.AGeneration:
+		// a was put in place of b, but b wasn't put in place of a.
+		var aGeneration int64
+		if a != nil {
+			aGeneration = a.Generation
+		}
+		logger.Infof("Finishing exchange of %q and %q", journal.A, journal.B)
+		err = restoreExchangedObject(ctx, bucket, tmp, journal.A, aGeneration, journal.Move)
+
+	case a.CRC32C != nil && tmp.CRC32C != nil && *a.CRC32C == *tmp.CRC32C:
+		// b was copied in place of a, but its copy wasn't deleted.
+		err = deleteObjectGeneration(ctx, bucket, tmp)
+
+	default:
+		logger.Warnf("Not recovering exchange of %q and %q: both were rewritten after it began; the original %q is in %q",
+			journal.A, journal.B, journal.B, tmp.Name)
+		return
+	}
+
+	resolved = err == nil
+	return
+}
+
+// Put a set aside object under the supplied name, which must have the given
+// generation, deleting the set aside object if it was copied.
+func restoreExchangedObject(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	tmp *gcs.MinObject,
+	name string,
+	generation int64,
+	move bool) (err error) {
+	if _, err = transferObject(ctx, bucket, tmp, name, generation, move); err != nil {
+		return
+	}
+
+	if !move {
+		err = deleteObjectGeneration(ctx, bucket, tmp)
+	}
+	return
+}
+
+func deleteObjectGeneration(ctx context.Context, bucket gcs.Bucket, o *gcs.MinObject) (err error) {
+	err = bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: o.Name, Generation: o.Generation})
+	if err != nil {
+		err = fmt.Errorf("DeleteObject(%q): %w", o.Name, err)
+	}
+	return
+}
+
+// Put a set aside folder back under whichever of the exchanged names is free,
+// preferring its own.
+func recoverFolderExchange(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	journal *exchangeJournal) (resolved bool, err error) {
+	tmpExists, err := folderExists(ctx, bucket, journal.Tmp)
+	if err != nil || !tmpExists {
+		resolved = err == nil
+		return
+	}
+
+	for _, name := range []string{journal.A, journal.B} {
+		var exists bool
+		if exists, err = folderExists(ctx, bucket, name); err != nil {
+			return
+		}
+		if exists {
+			continue
+		}
+
+		logger.Infof("Restoring %q from %q", name, journal.Tmp)
+		if _, err = bucket.RenameFolder(ctx, journal.Tmp, name); err != nil {
+			err = fmt.Errorf("RenameFolder(%q, %q): %w", journal.Tmp, name, err)
+			return
+		}
+
+		resolved = true
+		return
+	}
+
+	logger.Warnf("Not recovering exchange of %q and %q: both exist; the original %q is in %q",
+		journal.A, journal.B, journal.A, journal.Tmp)
+	return
+}
+
+func folderExists(ctx context.Context, bucket gcs.Bucket, name string) (bool, error) {
+	_, err := bucket.GetFolder(ctx, name)
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("GetFolder(%q): %w", name, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,258 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+const exchangeTmpObjectPrefix = ".gcsfuse_tmp/"
+
+type ExchangeTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcs.Bucket
+}
+
+func TestExchange(t *testing.T) {
+	suite.Run(t, new(ExchangeTest))
+}
+
+func (t *ExchangeTest) SetupTest() {
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+}
+
+func (t *ExchangeTest) createObject(name string, contents string) *gcs.MinObject {
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, name, []byte(contents))
+	require.NoError(t.T(), err)
+	return storageutil.ConvertObjToMinObject(o)
+}
+
+func (t *ExchangeTest) readObject(name string) string {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, name)
+	require.NoError(t.T(), err)
+	return string(contents)
+}
+
+func (t *ExchangeTest) listTmpObjects() []*gcs.MinObject {
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: exchangeTmpObjectPrefix})
+	require.NoError(t.T(), err)
+	return listing.MinObjects
+}
+
+func (t *ExchangeTest) listJournals() (names []string) {
+	for _, o := range t.listTmpObjects() {
+		if strings.HasSuffix(o.Name, ".journal") {
+			names = append(names, o.Name)
+		}
+	}
+	return
+}
+
+// A bucket whose copies and moves fail once the supplied number of them have
+// succeeded, as though we had crashed part way through an exchange.
+type interruptedBucket struct {
+	gcs.Bucket
+	transfersLeft int
+}
+
+func (b *interruptedBucket) transfer() error {
+	if b.transfersLeft == 0 {
+		return errors.New("interrupted")
+	}
+	b.transfersLeft--
+	return nil
+}
+
+func (b *interruptedBucket) CopyObject(ctx context.Context, req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	if err := b.transfer(); err != nil {
+		return nil, err
+	}
+	return b.Bucket.CopyObject(ctx, req)
+}
+
+func (b *interruptedBucket) MoveObject(ctx context.Context, req *gcs.MoveObjectRequest) (*gcs.Object, error) {
+	if err := b.transfer(); err != nil {
+		return nil, err
+	}
+	return b.Bucket.MoveObject(ctx, req)
+}
+
+// A bucket that records, for each folder rename, whether anything existed
+// under the destination beforehand.
+type folderRenameRecordingBucket struct {
+	gcs.Bucket
+	destinationExisted []bool
+}
+
+func (b *folderRenameRecordingBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	_, err := b.GetFolder(ctx, destinationFolderId)
+	existed := err == nil
+	listing, err := b.ListObjects(ctx, &gcs.ListObjectsRequest{Prefix: destinationFolderId, MaxResults: 1})
+	if err != nil {
+		return nil, err
+	}
+	existed = existed || len(listing.MinObjects) > 0
+	b.destinationExisted = append(b.destinationExisted, existed)
+
+	return b.Bucket.RenameFolder(ctx, folderName, destinationFolderId)
+}
+
+func (t *ExchangeTest) TestExchangeObjects_Copy() {
+	a := t.createObject("a", "taco")
+	b := t.createObject("b", "burrito")
+
+	err := gcsx.ExchangeObjects(t.ctx, t.bucket, exchangeTmpObjectPrefix, a, b, false)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "burrito", t.readObject("a"))
+	assert.Equal(t.T(), "taco", t.readObject("b"))
+	assert.Empty(t.T(), t.listTmpObjects())
+}
+
+func (t *ExchangeTest) TestExchangeObjects_Move() {
+	a := t.createObject("a", "taco")
+	b := t.createObject("b", "burrito")
+
+	err := gcsx.ExchangeObjects(t.ctx, t.bucket, exchangeTmpObjectPrefix, a, b, true)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "burrito", t.readObject("a"))
+	assert.Equal(t.T(), "taco", t.readObject("b"))
+	assert.Empty(t.T(), t.listTmpObjects())
+}
+
+func (t *ExchangeTest) TestExchangeObjects_SourceRewritten() {
+	a := t.createObject("a", "taco")
+	b := t.createObject("b", "burrito")
+	// Rewrite a after its generation was read.
+	t.createObject("a", "enchilada")
+
+	err := gcsx.ExchangeObjects(t.ctx, t.bucket, exchangeTmpObjectPrefix, a, b, false)
+
+	assert.Error(t.T(), err)
+	assert.Equal(t.T(), "enchilada", t.readObject("a"))
+	assert.Equal(t.T(), "burrito", t.readObject("b"))
+	assert.Empty(t.T(), t.listTmpObjects())
+}
+
+func (t *ExchangeTest) TestRecoverExchanges_NothingToRecover() {
+	t.createObject("a", "taco")
+
+	recovered, err := gcsx.RecoverExchanges(t.ctx, t.bucket, exchangeTmpObjectPrefix, 0)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), 0, recovered)
+	assert.Equal(t.T(), "taco", t.readObject("a"))
+}
+
+func (t *ExchangeTest) TestRecoverExchanges_CopyInterruptedAfterReplacingB() {
+	a := t.createObject("a", "taco")
+	b := t.createObject("b", "burrito")
+	// Neither putting b in place of a nor restoring it succeeds.
+	interrupted := &interruptedBucket{Bucket: t.bucket, transfersLeft: 2}
+	err := gcsx.ExchangeObjects(t.ctx, interrupted, exchangeTmpObjectPrefix, a, b, false)
+	require.Error(t.T(), err)
+	require.Len(t.T(), t.listJournals(), 1)
+
+	recovered, err := gcsx.RecoverExchanges(t.ctx, t.bucket, exchangeTmpObjectPrefix, 0)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), 1, recovered)
+	assert.Equal(t.T(), "burrito", t.readObject("a"))
+	assert.Equal(t.T(), "taco", t.readObject("b"))
+	assert.Empty(t.T(), t.listTmpObjects())
+}
+
+func (t *ExchangeTest) TestRecoverExchanges_MoveInterruptedAfterSettingBAside() {
+	a := t.createObject("a", "taco")
+	b := t.createObject("b", "burrito")
+	// Neither putting a in place of b nor restoring b succeeds.
+	interrupted := &interruptedBucket{Bucket: t.bucket, transfersLeft: 1}
+	err := gcsx.ExchangeObjects(t.ctx, interrupted, exchangeTmpObjectPrefix, a, b, true)
+	require.Error(t.T(), err)
+	require.Len(t.T(), t.listJournals(), 1)
+
+	recovered, err := gcsx.RecoverExchanges(t.ctx, t.bucket, exchangeTmpObjectPrefix, 0)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), 1, recovered)
+	assert.Equal(t.T(), "taco", t.readObject("a"))
+	assert.Equal(t.T(), "burrito", t.readObject("b"))
+	assert.Empty(t.T(), t.listTmpObjects())
+}
+
+func (t *ExchangeTest) TestRecoverExchanges_SkipsRecentJournals() {
+	a := t.createObject("a", "taco")
+	b := t.createObject("b", "burrito")
+	interrupted := &interruptedBucket{Bucket: t.bucket, transfersLeft: 1}
+	err := gcsx.ExchangeObjects(t.ctx, interrupted, exchangeTmpObjectPrefix, a, b, true)
+	require.Error(t.T(), err)
+
+	recovered, err := gcsx.RecoverExchanges(t.ctx, t.bucket, exchangeTmpObjectPrefix, time.Hour)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), 0, recovered)
+	assert.Len(t.T(), t.listJournals(), 1)
+}
+
+func (t *ExchangeTest) TestExchangeFolders() {
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{Hierarchical: true})
+	for _, name := range []string{"dir/", "dir/a/", "dir/b/"} {
+		_, err := t.bucket.CreateFolder(t.ctx, name)
+		require.NoError(t.T(), err)
+	}
+	t.createObject("dir/a/x", "taco")
+	t.createObject("dir/b/y", "burrito")
+
+	recording := &folderRenameRecordingBucket{Bucket: t.bucket}
+
+	err := gcsx.ExchangeFolders(t.ctx, recording, exchangeTmpObjectPrefix, "dir/a/", "dir/b/")
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "burrito", t.readObject("dir/a/y"))
+	assert.Equal(t.T(), "taco", t.readObject("dir/b/x"))
+	assert.Empty(t.T(), t.listJournals())
+	// The folder to set a aside in didn't exist before a was renamed to it.
+	require.NotEmpty(t.T(), recording.destinationExisted)
+	assert.False(t.T(), recording.destinationExisted[0])
+	// The journal wasn't renamed along with the folder.
+	_, err = storageutil.ReadObject(t.ctx, t.bucket, "dir/b/.journal")
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: "dir/b/"})
+	require.NoError(t.T(), err)
+	for _, o := range listing.MinObjects {
+		assert.False(t.T(), strings.HasSuffix(o.Name, ".journal"), o.Name)
+	}
+	// Nothing was set aside next to the exchanged folders.
+	listing, err = t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: "dir/", Delimiter: "/"})
+	require.NoError(t.T(), err)
+	assert.ElementsMatch(t.T(), []string{"dir/a/", "dir/b/"}, listing.CollapsedRuns)
+}
@@ -16,6 +16,7 @@ package gcsx
 
 import (
 	"fmt"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -57,6 +58,15 @@ func garbageCollectOnce(
 				continue
 			}
 
+			// Rename journals, and whatever exchanges have set aside, must survive
+			// until they have been recovered. Lock objects are held for as long
+			// as their leases are renewed.
+			if strings.HasPrefix(o.Name, tmpObjectPrefix+RenameJournalDir) ||
+				strings.HasPrefix(o.Name, tmpObjectPrefix+exchangeDir) ||
+				strings.HasPrefix(o.Name, tmpObjectPrefix+LockDir) {
+				continue
+			}
+
 			select {
 			case <-ctx.Done():
 				err = ctx.Err()
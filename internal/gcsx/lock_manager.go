@@ -0,0 +1,371 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"golang.org/x/net/context"
+)
+
+// Advisory locks are shared between mounts on different hosts as lease
+// objects under LockDir within the temporary object prefix, one per locked
+// file. The holders of a lease and their expiry times are kept in the custom
+// metadata of the lease object, and every change to it is preconditioned on
+// the generation that was read, so concurrent acquirers can't both succeed.
+// Holders renew their leases periodically; a lease whose holders have all
+// expired, e.g. because their host crashed, is free to be taken over. Lease
+// objects that are no longer renewed are eventually deleted by the garbage
+// collection of temporary objects.
+const LockDir = "locks/"
+
+// The metadata key holding the lease record.
+const lockMetadataKey = "gcsfuse_lock"
+
+// How many times to retry an update that lost a race with another holder.
+const lockUpdateAttempts = 5
+
+// ErrLockConflict is returned when a lock is held by someone else.
+var ErrLockConflict = errors.New("lock is held by another owner")
+
+var errLockReleased = errors.New("lock was released")
+
+// The lease record of a lock object.
+type leaseRecord struct {
+	Exclusive bool `json:"exclusive"`
+
+	// The expiry times of the holders, keyed by holder ID.
+	Holders map[string]time.Time `json:"holders"`
+}
+
+// Drop the holders whose leases expired before now.
+func (r *leaseRecord) dropExpired(now time.Time) {
+	for h, expiry := range r.Holders {
+		if expiry.Before(now) {
+			delete(r.Holders, h)
+		}
+	}
+}
+
+// Return true if the supplied holder may take the lease, in the supplied mode.
+func (r *leaseRecord) admits(holder string, exclusive bool) bool {
+	for h := range r.Holders {
+		if h == holder {
+			continue
+		}
+
+		if exclusive || r.Exclusive {
+			return false
+		}
+	}
+
+	return true
+}
+
+type lockKey struct {
+	name  string
+	owner uint64
+}
+
+// LockManager takes whole-file advisory locks on behalf of the lock owners of
+// this mount, using lease objects in the bucket.
+//
+// Safe for concurrent access.
+type LockManager struct {
+	/////////////////////////
+	// Dependencies
+	/////////////////////////
+
+	bucket gcs.Bucket
+	clock  timeutil.Clock
+
+	/////////////////////////
+	// Constant data
+	/////////////////////////
+
+	tmpObjectPrefix string
+	ttl             time.Duration
+
+	// Distinguishes the lock owners of this mount from those of other mounts.
+	mountID string
+
+	/////////////////////////
+	// Mutable state
+	/////////////////////////
+
+	mu sync.Mutex
+
+	// The locks held by the owners of this mount, and whether they are
+	// exclusive.
+	//
+	// GUARDED_BY(mu)
+	held map[lockKey]bool
+}
+
+// NewLockManager creates a lock manager whose leases last for the supplied
+// TTL unless renewed.
+func NewLockManager(
+	bucket gcs.Bucket,
+	tmpObjectPrefix string,
+	ttl time.Duration,
+	clock timeutil.Clock) (*LockManager, error) {
+	mountID, err := randomNameSuffix()
+	if err != nil {
+		return nil, err
+	}
+
+	return &LockManager{
+		bucket:          bucket,
+		clock:           clock,
+		tmpObjectPrefix: tmpObjectPrefix,
+		ttl:             ttl,
+		mountID:         mountID,
+		held:            make(map[lockKey]bool),
+	}, nil
+}
+
+func (m *LockManager) lockObjectName(name string) string {
+	return m.tmpObjectPrefix + LockDir + name
+}
+
+func (m *LockManager) holderID(owner uint64) string {
+	return fmt.Sprintf("%s/%x", m.mountID, owner)
+}
+
+// Return the lease record of the named lock object along with its generation,
+// which is zero if it doesn't exist.
+func (m *LockManager) readLease(ctx context.Context, objectName string) (r *leaseRecord, generation int64, err error) {
+	r = &leaseRecord{Holders: make(map[string]time.Time)}
+	o, _, err := m.bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: objectName, ForceFetchFromGcs: true})
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		err = nil
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("StatObject(%q): %w", objectName, err)
+		return
+	}
+
+	generation = o.Generation
+	if value, ok := o.Metadata[lockMetadataKey]; ok {
+		if err = json.Unmarshal([]byte(value), r); err != nil {
+			err = fmt.Errorf("json.Unmarshal(%q): %w", objectName, err)
+			return
+		}
+	}
+
+	if r.Holders == nil {
+		r.Holders = make(map[string]time.Time)
+	}
+	r.dropExpired(m.clock.Now())
+	return
+}
+
+// Replace the lease record of the named lock object, provided it still has
+// the supplied generation. An empty record deletes the object.
+func (m *LockManager) writeLease(ctx context.Context, objectName string, r *leaseRecord, generation int64) (err error) {
+	if len(r.Holders) == 0 {
+		if generation == 0 {
+			return
+		}
+
+		err = m.bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: objectName, Generation: generation})
+		if err != nil {
+			err = fmt.Errorf("DeleteObject(%q): %w", objectName, err)
+		}
+		return
+	}
+
+	value, err := json.Marshal(r)
+	if err != nil {
+		err = fmt.Errorf("json.Marshal: %w", err)
+		return
+	}
+
+	_, err = m.bucket.CreateObject(
+		ctx,
+		&gcs.CreateObjectRequest{
+			Name:                   objectName,
+			Contents:               strings.NewReader(""),
+			Metadata:               map[string]string{lockMetadataKey: string(value)},
+			GenerationPrecondition: &generation,
+		})
+	if err != nil {
+		err = fmt.Errorf("CreateObject(%q): %w", objectName, err)
+	}
+
+	return
+}
+
+// Apply the supplied change to the lease record of the named lock object,
+// retrying if another holder changes it in the meantime.
+func (m *LockManager) updateLease(ctx context.Context, objectName string, change func(r *leaseRecord) error) (err error) {
+	for attempt := 0; ; attempt++ {
+		var r *leaseRecord
+		var generation int64
+		r, generation, err = m.readLease(ctx, objectName)
+		if err != nil {
+			return
+		}
+
+		if err = change(r); err != nil {
+			return
+		}
+
+		err = m.writeLease(ctx, objectName, r, generation)
+		var preconditionErr *gcs.PreconditionError
+		var notFoundErr *gcs.NotFoundError
+		if (errors.As(err, &preconditionErr) || errors.As(err, &notFoundErr)) && attempt+1 < lockUpdateAttempts {
+			continue
+		}
+
+		return
+	}
+}
+
+// Lock takes a shared or exclusive lock on the named object for the supplied
+// owner, converting any lock the owner already holds. It returns
+// ErrLockConflict if the lock is held by another owner.
+func (m *LockManager) Lock(ctx context.Context, name string, owner uint64, exclusive bool) (err error) {
+	holder := m.holderID(owner)
+	err = m.updateLease(ctx, m.lockObjectName(name), func(r *leaseRecord) error {
+		if !r.admits(holder, exclusive) {
+			return ErrLockConflict
+		}
+
+		r.Exclusive = exclusive
+		r.Holders[holder] = m.clock.Now().Add(m.ttl)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	m.mu.Lock()
+	m.held[lockKey{name: name, owner: owner}] = exclusive
+	m.mu.Unlock()
+	return
+}
+
+// Unlock releases the lock held by the supplied owner on the named object, if
+// any.
+func (m *LockManager) Unlock(ctx context.Context, name string, owner uint64) (err error) {
+	key := lockKey{name: name, owner: owner}
+	m.mu.Lock()
+	_, ok := m.held[key]
+	delete(m.held, key)
+	m.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	holder := m.holderID(owner)
+	err = m.updateLease(ctx, m.lockObjectName(name), func(r *leaseRecord) error {
+		delete(r.Holders, holder)
+		return nil
+	})
+	return
+}
+
+// Test returns whether the supplied owner could take the lock on the named
+// object in the supplied mode and, if not, whether the conflicting lock is
+// exclusive.
+func (m *LockManager) Test(ctx context.Context, name string, owner uint64, exclusive bool) (free bool, conflictExclusive bool, err error) {
+	r, _, err := m.readLease(ctx, m.lockObjectName(name))
+	if err != nil {
+		return
+	}
+
+	free = r.admits(m.holderID(owner), exclusive)
+	conflictExclusive = !free && r.Exclusive
+	return
+}
+
+// Renew extends the leases of all the locks held by the owners of this mount.
+// Locks that turn out to have been lost, because their leases expired and
+// were taken over, are dropped.
+func (m *LockManager) Renew(ctx context.Context) {
+	m.mu.Lock()
+	held := make(map[lockKey]bool, len(m.held))
+	for k, exclusive := range m.held {
+		held[k] = exclusive
+	}
+	m.mu.Unlock()
+
+	for k, exclusive := range held {
+		holder := m.holderID(k.owner)
+		err := m.updateLease(ctx, m.lockObjectName(k.name), func(r *leaseRecord) error {
+			// Don't resurrect a lock released since the snapshot was taken.
+			m.mu.Lock()
+			_, stillHeld := m.held[k]
+			m.mu.Unlock()
+			if !stillHeld {
+				return errLockReleased
+			}
+
+			if !r.admits(holder, exclusive) {
+				return ErrLockConflict
+			}
+
+			r.Exclusive = exclusive
+			r.Holders[holder] = m.clock.Now().Add(m.ttl)
+			return nil
+		})
+
+		if errors.Is(err, errLockReleased) {
+			continue
+		}
+
+		if errors.Is(err, ErrLockConflict) {
+			logger.Warnf("Lost lock on %q: its lease expired and was taken over", k.name)
+			m.mu.Lock()
+			delete(m.held, k)
+			m.mu.Unlock()
+			continue
+		}
+
+		if err != nil {
+			logger.Warnf("Renewing lock on %q failed: %v", k.name, err)
+		}
+	}
+}
+
+// Run renews the leases three times per TTL until the context is cancelled.
+func (m *LockManager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+
+		m.Renew(ctx)
+	}
+}
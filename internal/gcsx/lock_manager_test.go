@@ -0,0 +1,160 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+const (
+	lockTmpObjectPrefix = ".gcsfuse_tmp/"
+	lockTTL             = 30 * time.Second
+)
+
+type LockManagerTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcs.Bucket
+	clock  timeutil.SimulatedClock
+
+	// Two mounts of the same bucket.
+	m1 *gcsx.LockManager
+	m2 *gcsx.LockManager
+}
+
+func TestLockManager(t *testing.T) {
+	suite.Run(t, new(LockManagerTest))
+}
+
+func (t *LockManagerTest) SetupTest() {
+	var err error
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+	t.clock.SetTime(time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local))
+
+	t.m1, err = gcsx.NewLockManager(t.bucket, lockTmpObjectPrefix, lockTTL, &t.clock)
+	require.NoError(t.T(), err)
+	t.m2, err = gcsx.NewLockManager(t.bucket, lockTmpObjectPrefix, lockTTL, &t.clock)
+	require.NoError(t.T(), err)
+}
+
+func (t *LockManagerTest) lockObjectExists() bool {
+	_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: lockTmpObjectPrefix + gcsx.LockDir + "foo"})
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return false
+	}
+	require.NoError(t.T(), err)
+	return true
+}
+
+func (t *LockManagerTest) TestExclusiveConflictsAcrossMounts() {
+	require.NoError(t.T(), t.m1.Lock(t.ctx, "foo", 1, true))
+
+	err := t.m2.Lock(t.ctx, "foo", 1, true)
+
+	assert.ErrorIs(t.T(), err, gcsx.ErrLockConflict)
+	assert.ErrorIs(t.T(), t.m2.Lock(t.ctx, "foo", 1, false), gcsx.ErrLockConflict)
+}
+
+func (t *LockManagerTest) TestExclusiveConflictsAcrossOwners() {
+	require.NoError(t.T(), t.m1.Lock(t.ctx, "foo", 1, true))
+
+	err := t.m1.Lock(t.ctx, "foo", 2, true)
+
+	assert.ErrorIs(t.T(), err, gcsx.ErrLockConflict)
+}
+
+func (t *LockManagerTest) TestSharedLocksCoexist() {
+	require.NoError(t.T(), t.m1.Lock(t.ctx, "foo", 1, false))
+
+	require.NoError(t.T(), t.m2.Lock(t.ctx, "foo", 1, false))
+
+	assert.ErrorIs(t.T(), t.m2.Lock(t.ctx, "foo", 2, true), gcsx.ErrLockConflict)
+}
+
+func (t *LockManagerTest) TestUnlockFreesLock() {
+	require.NoError(t.T(), t.m1.Lock(t.ctx, "foo", 1, true))
+
+	require.NoError(t.T(), t.m1.Unlock(t.ctx, "foo", 1))
+
+	assert.False(t.T(), t.lockObjectExists())
+	assert.NoError(t.T(), t.m2.Lock(t.ctx, "foo", 1, true))
+}
+
+func (t *LockManagerTest) TestUpgradeOwnLock() {
+	require.NoError(t.T(), t.m1.Lock(t.ctx, "foo", 1, false))
+
+	require.NoError(t.T(), t.m1.Lock(t.ctx, "foo", 1, true))
+
+	assert.ErrorIs(t.T(), t.m2.Lock(t.ctx, "foo", 1, false), gcsx.ErrLockConflict)
+}
+
+func (t *LockManagerTest) TestExpiredLeaseCanBeTakenOver() {
+	require.NoError(t.T(), t.m1.Lock(t.ctx, "foo", 1, true))
+
+	t.clock.AdvanceTime(lockTTL + time.Second)
+
+	assert.NoError(t.T(), t.m2.Lock(t.ctx, "foo", 1, true))
+}
+
+func (t *LockManagerTest) TestRenewKeepsLease() {
+	require.NoError(t.T(), t.m1.Lock(t.ctx, "foo", 1, true))
+	t.clock.AdvanceTime(lockTTL / 2)
+
+	t.m1.Renew(t.ctx)
+	t.clock.AdvanceTime(lockTTL/2 + time.Second)
+
+	assert.ErrorIs(t.T(), t.m2.Lock(t.ctx, "foo", 1, true), gcsx.ErrLockConflict)
+}
+
+func (t *LockManagerTest) TestRenewDropsLostLock() {
+	require.NoError(t.T(), t.m1.Lock(t.ctx, "foo", 1, true))
+	t.clock.AdvanceTime(lockTTL + time.Second)
+	require.NoError(t.T(), t.m2.Lock(t.ctx, "foo", 1, true))
+
+	t.m1.Renew(t.ctx)
+
+	// The lock was lost, so m1 doesn't release m2's lease on unlocking.
+	require.NoError(t.T(), t.m1.Unlock(t.ctx, "foo", 1))
+	assert.ErrorIs(t.T(), t.m1.Lock(t.ctx, "foo", 1, true), gcsx.ErrLockConflict)
+}
+
+func (t *LockManagerTest) TestTest() {
+	free, _, err := t.m2.Test(t.ctx, "foo", 1, true)
+	require.NoError(t.T(), err)
+	assert.True(t.T(), free)
+
+	require.NoError(t.T(), t.m1.Lock(t.ctx, "foo", 1, false))
+
+	free, conflictExclusive, err := t.m2.Test(t.ctx, "foo", 1, true)
+	require.NoError(t.T(), err)
+	assert.False(t.T(), free)
+	assert.False(t.T(), conflictExclusive)
+	free, _, err = t.m2.Test(t.ctx, "foo", 1, false)
+	require.NoError(t.T(), err)
+	assert.True(t.T(), free)
+}
@@ -0,0 +1,166 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"fmt"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/policy"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// NewPolicyBucket creates a wrapper bucket that applies the bucket-level
+// settings of the supplied per-path rules: objects that a rule makes
+// read-only can't be created, modified or deleted, and new objects are given
+// the content type set by a rule unless the request already has one.
+func NewPolicyBucket(b gcs.Bucket, rules *policy.Rules) gcs.Bucket {
+	return policyBucket{Bucket: b, rules: rules}
+}
+
+type policyBucket struct {
+	gcs.Bucket
+	rules *policy.Rules
+}
+
+// Fail with EROFS if any of the named objects is read-only.
+func (b policyBucket) checkWritable(op string, names ...string) error {
+	for _, name := range names {
+		if policy.Bool(b.rules.Match(name).ReadOnly, false) {
+			return fmt.Errorf("%s(%q): read-only by rule: %w", op, name, syscall.EROFS)
+		}
+	}
+
+	return nil
+}
+
+func (b policyBucket) CreateObject(ctx context.Context, req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	if err := b.checkWritable("CreateObject", req.Name); err != nil {
+		return nil, err
+	}
+
+	// The request belongs to the caller, who may reuse it, so it is copied
+	// before being filled in.
+	if req.ContentType == "" {
+		r := *req
+		r.ContentType = b.rules.ContentType(req.Name)
+		req = &r
+	}
+
+	return b.Bucket.CreateObject(ctx, req)
+}
+
+func (b policyBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	if err := b.checkWritable("CreateObjectChunkWriter", req.Name); err != nil {
+		return nil, err
+	}
+
+	if req.ContentType == "" {
+		r := *req
+		r.ContentType = b.rules.ContentType(req.Name)
+		req = &r
+	}
+
+	return b.Bucket.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+}
+
+func (b policyBucket) StagingDir() string {
+	return stagingDir(b.Bucket)
+}
+
+func (b policyBucket) CreateObjectFromFile(ctx context.Context, req *gcs.CreateObjectRequest, path string) (*gcs.Object, error) {
+	if err := b.checkWritable("CreateObjectFromFile", req.Name); err != nil {
+		return nil, err
+	}
+
+	if req.ContentType == "" {
+		r := *req
+		r.ContentType = b.rules.ContentType(req.Name)
+		req = &r
+	}
+
+	return createObjectFromFile(ctx, b.Bucket, req, path)
+}
+
+func (b policyBucket) ComposeObjects(ctx context.Context, req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	if err := b.checkWritable("ComposeObjects", req.DstName); err != nil {
+		return nil, err
+	}
+
+	if req.ContentType == "" {
+		r := *req
+		r.ContentType = b.rules.ContentType(req.DstName)
+		req = &r
+	}
+
+	return b.Bucket.ComposeObjects(ctx, req)
+}
+
+func (b policyBucket) CopyObject(ctx context.Context, req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	if err := b.checkWritable("CopyObject", req.DstName); err != nil {
+		return nil, err
+	}
+
+	return b.Bucket.CopyObject(ctx, req)
+}
+
+func (b policyBucket) MoveObject(ctx context.Context, req *gcs.MoveObjectRequest) (*gcs.Object, error) {
+	if err := b.checkWritable("MoveObject", req.SrcName, req.DstName); err != nil {
+		return nil, err
+	}
+
+	return b.Bucket.MoveObject(ctx, req)
+}
+
+func (b policyBucket) UpdateObject(ctx context.Context, req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	if err := b.checkWritable("UpdateObject", req.Name); err != nil {
+		return nil, err
+	}
+
+	return b.Bucket.UpdateObject(ctx, req)
+}
+
+func (b policyBucket) DeleteObject(ctx context.Context, req *gcs.DeleteObjectRequest) error {
+	if err := b.checkWritable("DeleteObject", req.Name); err != nil {
+		return err
+	}
+
+	return b.Bucket.DeleteObject(ctx, req)
+}
+
+func (b policyBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	if err := b.checkWritable("CreateFolder", folderName); err != nil {
+		return nil, err
+	}
+
+	return b.Bucket.CreateFolder(ctx, folderName)
+}
+
+func (b policyBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	if err := b.checkWritable("DeleteFolder", folderName); err != nil {
+		return err
+	}
+
+	return b.Bucket.DeleteFolder(ctx, folderName)
+}
+
+func (b policyBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	if err := b.checkWritable("RenameFolder", folderName, destinationFolderId); err != nil {
+		return nil, err
+	}
+
+	return b.Bucket.RenameFolder(ctx, folderName, destinationFolderId)
+}
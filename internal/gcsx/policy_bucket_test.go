@@ -0,0 +1,112 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/policy"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type PolicyBucketTest struct {
+	suite.Suite
+	ctx     context.Context
+	wrapped gcs.Bucket
+	bucket  gcs.Bucket
+}
+
+func TestPolicyBucket(t *testing.T) {
+	suite.Run(t, new(PolicyBucketTest))
+}
+
+func (t *PolicyBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.wrapped = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+
+	readOnly := true
+	contentType := "text/x-log"
+	rules, err := policy.NewRules([]policy.Rule{
+		{Prefix: "archive/", Overrides: policy.Overrides{ReadOnly: &readOnly}},
+		{Glob: "*.log", Overrides: policy.Overrides{ContentType: &contentType}},
+	})
+	require.NoError(t.T(), err)
+	t.bucket = gcsx.NewPolicyBucket(t.wrapped, rules)
+
+	_, err = storageutil.CreateObject(t.ctx, t.wrapped, "archive/foo", []byte("taco"))
+	require.NoError(t.T(), err)
+}
+
+func (t *PolicyBucketTest) TestReadOnlyObjectsCanBeRead() {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "archive/foo")
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "taco", string(contents))
+}
+
+func (t *PolicyBucketTest) TestReadOnlyObjectsCantBeModified() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "archive/bar", nil)
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	err = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "archive/foo"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	_, err = t.bucket.MoveObject(t.ctx, &gcs.MoveObjectRequest{SrcName: "archive/foo", DstName: "foo"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	// Copying out is fine.
+	_, err = t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: "archive/foo", DstName: "foo"})
+	assert.NoError(t.T(), err)
+}
+
+func (t *PolicyBucketTest) TestContentType() {
+	o, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:     "dir/app.log",
+		Contents: bytes.NewReader(nil),
+	})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "text/x-log", o.ContentType)
+
+	// An explicit type wins.
+	o, err = t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:        "other.log",
+		Contents:    bytes.NewReader(nil),
+		ContentType: "text/plain",
+	})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "text/plain", o.ContentType)
+}
+
+func (t *PolicyBucketTest) TestContentTypeLeavesRequestAlone() {
+	req := &gcs.CreateObjectRequest{
+		Name:     "app.log",
+		Contents: bytes.NewReader(nil),
+	}
+
+	_, err := t.bucket.CreateObject(t.ctx, req)
+
+	require.NoError(t.T(), err)
+	assert.Empty(t.T(), req.ContentType)
+}
@@ -16,6 +16,8 @@ package gcsx
 
 import (
 	"errors"
+	"fmt"
+	"path"
 	"strings"
 	"unicode/utf8"
 
@@ -45,6 +47,31 @@ func NewPrefixBucket(
 	return
 }
 
+// OnlyDirPrefix returns the prefix that NewPrefixBucket is given for the
+// supplied --only-dir, or the empty string if it is empty.
+func OnlyDirPrefix(onlyDir string) string {
+	if onlyDir == "" {
+		return ""
+	}
+
+	return path.Clean(onlyDir) + "/"
+}
+
+// NewOnlyDirBucket limits the supplied bucket to the supplied --only-dir, as
+// a mount does, returning it unchanged if onlyDir is empty.
+func NewOnlyDirBucket(onlyDir string, b gcs.Bucket) (gcs.Bucket, error) {
+	if onlyDir == "" {
+		return b, nil
+	}
+
+	prefixed, err := NewPrefixBucket(OnlyDirPrefix(onlyDir), b)
+	if err != nil {
+		return nil, fmt.Errorf("NewPrefixBucket: %w", err)
+	}
+
+	return prefixed, nil
+}
+
 type prefixBucket struct {
 	prefix  string
 	wrapped gcs.Bucket
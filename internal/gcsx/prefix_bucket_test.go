@@ -776,3 +776,18 @@ func TestMoveObject(t *testing.T) {
 	assert.True(t, errors.As(err, &notFoundErr))
 	assert.Nil(t, m)
 }
+
+func (t *PrefixBucketTest) Test_NewOnlyDirBucket() {
+	_, err := storageutil.CreateObject(t.ctx, t.wrapped, "some/dir/taco", []byte("burrito"))
+	require.NoError(t.T(), err)
+
+	unchanged, err := gcsx.NewOnlyDirBucket("", t.wrapped)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), t.wrapped, unchanged)
+
+	b, err := gcsx.NewOnlyDirBucket("some/dir/../dir/", t.wrapped)
+	require.NoError(t.T(), err)
+	contents, err := storageutil.ReadObject(t.ctx, b, "taco")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "burrito", string(contents))
+}
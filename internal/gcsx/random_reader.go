@@ -268,6 +268,13 @@ func (rr *randomReader) tryReadingFromFileCache(ctx context.Context,
 				// False and there doesn't already exist file in cache.
 				isSeq = false
 				return 0, false, nil
+			} else if strings.Contains(err.Error(), cacheutil.SharedCacheBusyErrMsg) {
+				// Fall back to GCS while another process sharing the cache
+				// directory downloads the object.
+				return 0, false, nil
+			} else if strings.Contains(err.Error(), cacheutil.CacheAdmissionRejectedErrMsg) {
+				// The object isn't used often enough to displace what is cached.
+				return 0, false, nil
 			}
 
 			return 0, false, fmt.Errorf("tryReadingFromFileCache: while creating CacheHandle instance: %w", err)
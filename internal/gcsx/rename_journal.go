@@ -0,0 +1,430 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"golang.org/x/net/context"
+)
+
+// Directory renames in flat buckets move the descendants one object at a time,
+// so a crash part way through leaves the tree split between the old and the
+// new names. To make them recoverable, the planned moves are first recorded
+// in a journal object under RenameJournalDir within the temporary object
+// prefix, and the journal is deleted once the rename has finished. Journals
+// left behind are resolved by RecoverRenames, which either finishes the
+// rename (rolling it forward) or undoes it (rolling it back). A journal
+// doesn't say whether its rename is still in progress on some mount, and a
+// slow one may take arbitrarily long, so recovery is never automatic: it must
+// be asked for once no mount is renaming in the bucket.
+const RenameJournalDir = "rename_journal/"
+
+// Values of the common.RenamePhase metric attribute.
+const (
+	RenamePhaseRename       = "rename"
+	RenamePhaseRollForward  = "roll_forward"
+	RenamePhaseRollBackward = "roll_back"
+)
+
+// RenameJournalMove records the move of a single object.
+type RenameJournalMove struct {
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+
+	// The generation of the source object at the time the rename was planned.
+	// Objects rewritten since then are not ours to move.
+	Generation int64 `json:"generation"`
+}
+
+// RenameJournal records a planned directory rename.
+type RenameJournal struct {
+	// The names of the backing objects of the old and new directories.
+	OldDir string `json:"old_dir"`
+	NewDir string `json:"new_dir"`
+
+	// Set if the old directory has no backing object, so there is nothing to
+	// delete once the descendants have been moved.
+	OldDirImplicit bool `json:"old_dir_implicit"`
+
+	// Set if the backing object of the new directory was created by the rename,
+	// and so must be deleted when rolling it back.
+	CreatedNewDir bool `json:"created_new_dir"`
+
+	Moves []RenameJournalMove `json:"moves"`
+}
+
+// BeginRename writes the supplied journal to the bucket, returning the name of
+// the journal object. The caller must pass the name to CommitRename once the
+// rename has finished.
+func BeginRename(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	tmpObjectPrefix string,
+	journal *RenameJournal) (name string, err error) {
+	contents, err := json.Marshal(journal)
+	if err != nil {
+		err = fmt.Errorf("json.Marshal: %w", err)
+		return
+	}
+
+	var b [16]byte
+	if _, err = rand.Read(b[:]); err != nil {
+		err = fmt.Errorf("rand.Read: %w", err)
+		return
+	}
+
+	name = tmpObjectPrefix + RenameJournalDir + hex.EncodeToString(b[:])
+	var preconditionZero int64
+	_, err = bucket.CreateObject(
+		ctx,
+		&gcs.CreateObjectRequest{
+			Name:                   name,
+			Contents:               bytes.NewReader(contents),
+			GenerationPrecondition: &preconditionZero,
+		})
+	if err != nil {
+		err = fmt.Errorf("CreateObject(%q): %w", name, err)
+		return
+	}
+
+	return
+}
+
+// CommitRename deletes the journal object written by BeginRename.
+func CommitRename(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	name string) (err error) {
+	err = bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: name})
+	if err != nil {
+		err = fmt.Errorf("DeleteObject(%q): %w", name, err)
+	}
+
+	return
+}
+
+// RecoverRenames resolves the rename journals left in the bucket by renames
+// that didn't finish, rolling each of them forward or, if rollBack is set,
+// back. Journals written less than minAge ago are skipped, since the renames
+// they describe may still be in progress on another mount.
+func RecoverRenames(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	tmpObjectPrefix string,
+	minAge time.Duration,
+	rollBack bool,
+	metricHandle common.MetricHandle) (recovered int, err error) {
+	listing, err := listJournals(ctx, bucket, tmpObjectPrefix+RenameJournalDir)
+	if err != nil {
+		return
+	}
+
+	phase := RenamePhaseRollForward
+	if rollBack {
+		phase = RenamePhaseRollBackward
+	}
+
+	now := time.Now()
+	for _, o := range listing {
+		if now.Sub(o.Updated) < minAge {
+			logger.Infof("Skipping rename journal %q written %v ago", o.Name, now.Sub(o.Updated))
+			continue
+		}
+
+		if err = recoverRename(ctx, bucket, o.Name, rollBack, metricHandle); err != nil {
+			err = fmt.Errorf("recover rename %q: %w", o.Name, err)
+			return
+		}
+
+		recovered++
+		metricHandle.RenameJournalRecoveryCount(ctx, 1, []common.MetricAttr{{Key: common.RenamePhase, Value: phase}})
+	}
+
+	return
+}
+
+// CountJournals returns the number of rename and exchange journals in the
+// bucket, i.e. of renames and exchanges that are either in progress or were
+// interrupted.
+func CountJournals(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	tmpObjectPrefix string) (count int, err error) {
+	renames, err := listJournals(ctx, bucket, tmpObjectPrefix+RenameJournalDir)
+	if err != nil {
+		return
+	}
+	count = len(renames)
+
+	exchanges, err := listJournals(ctx, bucket, tmpObjectPrefix+exchangeDir)
+	if err != nil {
+		return
+	}
+	for _, o := range exchanges {
+		if isExchangeJournal(tmpObjectPrefix, o.Name) {
+			count++
+		}
+	}
+
+	return
+}
+
+// Return the records for the objects under the supplied prefix.
+func listJournals(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	prefix string) (journals []*gcs.MinObject, err error) {
+	req := &gcs.ListObjectsRequest{
+		Prefix: prefix,
+	}
+
+	for {
+		var listing *gcs.Listing
+		listing, err = bucket.ListObjects(ctx, req)
+		if err != nil {
+			err = fmt.Errorf("ListObjects: %w", err)
+			return
+		}
+
+		journals = append(journals, listing.MinObjects...)
+		if listing.ContinuationToken == "" {
+			return
+		}
+
+		req.ContinuationToken = listing.ContinuationToken
+	}
+}
+
+// Read the journal with the supplied name, roll the rename it describes
+// forward or back, then delete it.
+func recoverRename(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	name string,
+	rollBack bool,
+	metricHandle common.MetricHandle) (err error) {
+	contents, err := storageutil.ReadObject(ctx, bucket, name)
+	if err != nil {
+		err = fmt.Errorf("ReadObject: %w", err)
+		return
+	}
+
+	var journal RenameJournal
+	if err = json.Unmarshal(contents, &journal); err != nil {
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+
+	startTime := time.Now()
+	var moved int
+	if rollBack {
+		logger.Infof("Rolling back rename of %q to %q (%d objects)", journal.OldDir, journal.NewDir, len(journal.Moves))
+		moved, err = rollBackRename(ctx, bucket, &journal, metricHandle)
+	} else {
+		logger.Infof("Rolling forward rename of %q to %q (%d objects)", journal.OldDir, journal.NewDir, len(journal.Moves))
+		moved, err = rollForwardRename(ctx, bucket, &journal, metricHandle)
+	}
+
+	if err != nil {
+		logger.Warnf("Recovering rename of %q to %q failed after moving %d objects in %v, with error: %v",
+			journal.OldDir, journal.NewDir, moved, time.Since(startTime), err)
+		return
+	}
+
+	logger.Infof("Recovered rename of %q to %q after moving %d objects in %v.",
+		journal.OldDir, journal.NewDir, moved, time.Since(startTime))
+
+	err = CommitRename(ctx, bucket, name)
+	return
+}
+
+// Move every source object that is still in place to its destination, then
+// delete the backing object of the old directory.
+func rollForwardRename(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	journal *RenameJournal,
+	metricHandle common.MetricHandle) (moved int, err error) {
+	var conflicts int
+	for _, m := range journal.Moves {
+		var src *gcs.MinObject
+		src, err = statObject(ctx, bucket, m.Src)
+		if err != nil {
+			return
+		}
+
+		switch {
+		case src == nil:
+			// Already moved.
+			continue
+
+		case src.Generation != m.Generation:
+			logger.Warnf("Not moving %q to %q: it was rewritten after the rename began", m.Src, m.Dst)
+			conflicts++
+			continue
+		}
+
+		if err = moveObject(ctx, bucket, src, m.Dst); err != nil {
+			return
+		}
+
+		moved++
+		metricHandle.RenameObjectMoveCount(ctx, 1, []common.MetricAttr{{Key: common.RenamePhase, Value: RenamePhaseRollForward}})
+	}
+
+	// Leave the old directory in place if it still holds objects we didn't
+	// move, rather than turning it into an implicit one.
+	if journal.OldDirImplicit || conflicts > 0 {
+		return
+	}
+
+	err = bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: journal.OldDir})
+	if err != nil {
+		err = fmt.Errorf("DeleteObject(%q): %w", journal.OldDir, err)
+	}
+
+	return
+}
+
+// Move every destination object whose source is gone back to the source
+// name, delete the copies whose source is still in place, then delete the
+// backing object of the new directory if the rename created it.
+func rollBackRename(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	journal *RenameJournal,
+	metricHandle common.MetricHandle) (moved int, err error) {
+	for _, m := range journal.Moves {
+		var dst *gcs.MinObject
+		dst, err = statObject(ctx, bucket, m.Dst)
+		if err != nil {
+			return
+		}
+
+		if dst == nil {
+			// Never copied.
+			continue
+		}
+
+		var src *gcs.MinObject
+		src, err = statObject(ctx, bucket, m.Src)
+		if err != nil {
+			return
+		}
+
+		// The copy was made but the source wasn't deleted yet, so the copy is
+		// all there is to undo.
+		if src != nil {
+			err = bucket.DeleteObject(
+				ctx,
+				&gcs.DeleteObjectRequest{
+					Name:       dst.Name,
+					Generation: dst.Generation,
+				})
+			if err != nil {
+				err = fmt.Errorf("DeleteObject(%q): %w", dst.Name, err)
+				return
+			}
+
+			continue
+		}
+
+		if err = moveObject(ctx, bucket, dst, m.Src); err != nil {
+			return
+		}
+
+		moved++
+		metricHandle.RenameObjectMoveCount(ctx, 1, []common.MetricAttr{{Key: common.RenamePhase, Value: RenamePhaseRollBackward}})
+	}
+
+	if !journal.CreatedNewDir {
+		return
+	}
+
+	err = bucket.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: journal.NewDir})
+	if err != nil {
+		err = fmt.Errorf("DeleteObject(%q): %w", journal.NewDir, err)
+	}
+
+	return
+}
+
+// Return the record for the latest generation of the named object, or nil if
+// it doesn't exist.
+func statObject(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	name string) (m *gcs.MinObject, err error) {
+	m, _, err = bucket.StatObject(ctx, &gcs.StatObjectRequest{Name: name})
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		m = nil
+		err = nil
+		return
+	}
+
+	if err != nil {
+		err = fmt.Errorf("StatObject(%q): %w", name, err)
+	}
+
+	return
+}
+
+// Copy the supplied generation of an object to dstName, then delete it.
+func moveObject(
+	ctx context.Context,
+	bucket gcs.Bucket,
+	src *gcs.MinObject,
+	dstName string) (err error) {
+	_, err = bucket.CopyObject(
+		ctx,
+		&gcs.CopyObjectRequest{
+			SrcName:                       src.Name,
+			SrcGeneration:                 src.Generation,
+			SrcMetaGenerationPrecondition: &src.MetaGeneration,
+			DstName:                       dstName,
+		})
+	if err != nil {
+		err = fmt.Errorf("CopyObject(%q, %q): %w", src.Name, dstName, err)
+		return
+	}
+
+	err = bucket.DeleteObject(
+		ctx,
+		&gcs.DeleteObjectRequest{
+			Name:                       src.Name,
+			Generation:                 src.Generation,
+			MetaGenerationPrecondition: &src.MetaGeneration,
+		})
+	if err != nil {
+		err = fmt.Errorf("DeleteObject(%q): %w", src.Name, err)
+		return
+	}
+
+	logger.Tracef("Moved %q to %q", src.Name, dstName)
+	return
+}
@@ -0,0 +1,211 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/common"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+const renameJournalTmpObjectPrefix = ".gcsfuse_tmp/"
+
+type RenameJournalTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcs.Bucket
+}
+
+func TestRenameJournal(t *testing.T) {
+	suite.Run(t, new(RenameJournalTest))
+}
+
+func (t *RenameJournalTest) SetupTest() {
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+}
+
+func (t *RenameJournalTest) createObject(name string, contents string) *gcs.Object {
+	o, err := storageutil.CreateObject(t.ctx, t.bucket, name, []byte(contents))
+	require.NoError(t.T(), err)
+	return o
+}
+
+// Return the contents of the named object, or nil if it doesn't exist.
+func (t *RenameJournalTest) readObject(name string) []byte {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, name)
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil
+	}
+	require.NoError(t.T(), err)
+	return contents
+}
+
+func (t *RenameJournalTest) move(src string, dst string) {
+	_, err := t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: src, DstName: dst})
+	require.NoError(t.T(), err)
+	require.NoError(t.T(), t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: src}))
+}
+
+func (t *RenameJournalTest) listJournals() []string {
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{
+		Prefix: renameJournalTmpObjectPrefix + gcsx.RenameJournalDir,
+	})
+	require.NoError(t.T(), err)
+
+	var names []string
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+	}
+	return names
+}
+
+// Set up the objects for a rename of a/ to b/ and journal it, returning the
+// journal object name.
+func (t *RenameJournalTest) beginRename() string {
+	t.createObject("a/", "")
+	x := t.createObject("a/x", "taco")
+	y := t.createObject("a/y", "burrito")
+	t.createObject("b/", "")
+
+	name, err := gcsx.BeginRename(t.ctx, t.bucket, renameJournalTmpObjectPrefix, &gcsx.RenameJournal{
+		OldDir:        "a/",
+		NewDir:        "b/",
+		CreatedNewDir: true,
+		Moves: []gcsx.RenameJournalMove{
+			{Src: "a/x", Dst: "b/x", Generation: x.Generation},
+			{Src: "a/y", Dst: "b/y", Generation: y.Generation},
+		},
+	})
+	require.NoError(t.T(), err)
+	return name
+}
+
+func (t *RenameJournalTest) recover(rollBack bool) int {
+	recovered, err := gcsx.RecoverRenames(t.ctx, t.bucket, renameJournalTmpObjectPrefix, 0, rollBack, common.NewNoopMetrics())
+	require.NoError(t.T(), err)
+	return recovered
+}
+
+func (t *RenameJournalTest) TestBeginAndCommitRename() {
+	name := t.beginRename()
+
+	assert.True(t.T(), strings.HasPrefix(name, renameJournalTmpObjectPrefix+gcsx.RenameJournalDir))
+	assert.Equal(t.T(), []string{name}, t.listJournals())
+
+	require.NoError(t.T(), gcsx.CommitRename(t.ctx, t.bucket, name))
+	assert.Empty(t.T(), t.listJournals())
+}
+
+func (t *RenameJournalTest) TestNothingToRecover() {
+	assert.Equal(t.T(), 0, t.recover(false))
+}
+
+func (t *RenameJournalTest) TestRollForward() {
+	t.beginRename()
+	// Crash after moving the first object.
+	t.move("a/x", "b/x")
+
+	recovered := t.recover(false)
+
+	assert.Equal(t.T(), 1, recovered)
+	assert.Nil(t.T(), t.readObject("a/"))
+	assert.Nil(t.T(), t.readObject("a/x"))
+	assert.Nil(t.T(), t.readObject("a/y"))
+	assert.Equal(t.T(), "taco", string(t.readObject("b/x")))
+	assert.Equal(t.T(), "burrito", string(t.readObject("b/y")))
+	assert.Empty(t.T(), t.listJournals())
+}
+
+func (t *RenameJournalTest) TestRollForwardLeavesRewrittenSource() {
+	t.beginRename()
+	t.createObject("a/y", "enchilada")
+
+	recovered := t.recover(false)
+
+	assert.Equal(t.T(), 1, recovered)
+	assert.Equal(t.T(), "taco", string(t.readObject("b/x")))
+	assert.Equal(t.T(), "enchilada", string(t.readObject("a/y")))
+	assert.Nil(t.T(), t.readObject("b/y"))
+	// The old directory still has contents, so it is kept.
+	assert.NotNil(t.T(), t.readObject("a/"))
+}
+
+func (t *RenameJournalTest) TestRollBack() {
+	t.beginRename()
+	t.move("a/x", "b/x")
+
+	recovered := t.recover(true)
+
+	assert.Equal(t.T(), 1, recovered)
+	assert.NotNil(t.T(), t.readObject("a/"))
+	assert.Equal(t.T(), "taco", string(t.readObject("a/x")))
+	assert.Equal(t.T(), "burrito", string(t.readObject("a/y")))
+	assert.Nil(t.T(), t.readObject("b/"))
+	assert.Nil(t.T(), t.readObject("b/x"))
+	assert.Nil(t.T(), t.readObject("b/y"))
+	assert.Empty(t.T(), t.listJournals())
+}
+
+func (t *RenameJournalTest) TestRollBackDeletesCopyOfUnmovedSource() {
+	t.beginRename()
+	// Crash after copying the first object, but before deleting the source.
+	_, err := t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: "a/x", DstName: "b/x"})
+	require.NoError(t.T(), err)
+
+	t.recover(true)
+
+	assert.Equal(t.T(), "taco", string(t.readObject("a/x")))
+	assert.Nil(t.T(), t.readObject("b/x"))
+}
+
+func (t *RenameJournalTest) TestSkipsRecentJournals() {
+	name := t.beginRename()
+
+	recovered, err := gcsx.RecoverRenames(t.ctx, t.bucket, renameJournalTmpObjectPrefix, time.Hour, false, common.NewNoopMetrics())
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), 0, recovered)
+	assert.Equal(t.T(), []string{name}, t.listJournals())
+	assert.Equal(t.T(), "taco", string(t.readObject("a/x")))
+}
+
+func (t *RenameJournalTest) TestCountJournals() {
+	journals, err := gcsx.CountJournals(t.ctx, t.bucket, renameJournalTmpObjectPrefix)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), 0, journals)
+
+	t.beginRename()
+	t.beginRename()
+	// Other temporary objects aren't journals.
+	t.createObject(renameJournalTmpObjectPrefix+"some_tmp_object", "taco")
+
+	journals, err = gcsx.CountJournals(t.ctx, t.bucket, renameJournalTmpObjectPrefix)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), 2, journals)
+}
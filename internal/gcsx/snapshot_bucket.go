@@ -0,0 +1,310 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// NewSnapshotBucket creates a read-only view of a versioned bucket as it was
+// at the supplied time. For each name, the newest generation created no later
+// than that time is visible, unless it had already been deleted by then.
+// Reads that don't ask for a particular generation are pinned to the visible
+// one, and all mutations fail with EROFS.
+//
+// Collapsed runs in listings are those of all versions, so a directory whose
+// objects were all created later shows up as an empty directory.
+func NewSnapshotBucket(t time.Time, b gcs.Bucket) gcs.Bucket {
+	return snapshotBucket{Bucket: b, time: t}
+}
+
+type snapshotBucket struct {
+	gcs.Bucket
+	time time.Time
+}
+
+// The versions of a name can straddle pages of a listing, so the candidate
+// for the last name of a page is carried over to the next in the continuation
+// token handed out.
+type snapshotContinuation struct {
+	Token string `json:"token"`
+
+	Name      string         `json:"name"`
+	Candidate *gcs.MinObject `json:"candidate,omitempty"`
+	Deleted   time.Time      `json:"deleted"`
+}
+
+func encodeSnapshotContinuation(c *snapshotContinuation) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeSnapshotContinuation(token string) (c *snapshotContinuation, err error) {
+	c = new(snapshotContinuation)
+	if token == "" {
+		return
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		err = fmt.Errorf("malformed continuation token: %w", err)
+		return
+	}
+
+	if err = json.Unmarshal(b, c); err != nil {
+		err = fmt.Errorf("malformed continuation token: %w", err)
+		return
+	}
+
+	return
+}
+
+func (b snapshotBucket) readOnly(op string) error {
+	return fmt.Errorf("%s in a snapshot of bucket %q: %w", op, b.Name(), syscall.EROFS)
+}
+
+// Return the version of the named object visible in the snapshot.
+func (b snapshotBucket) statVisible(ctx context.Context, name string) (m *gcs.MinObject, err error) {
+	// Versions come sorted by name then generation, and no name with the
+	// object's name as a prefix comes before it, so stop at the first other
+	// name. Collapse the contents of a directory of the same name into a
+	// single entry.
+	req := &gcs.ListObjectsRequest{
+		Prefix:    name,
+		Delimiter: "/",
+		Versions:  true,
+	}
+
+	var deleted time.Time
+	for done := false; !done; {
+		var listing *gcs.Listing
+		listing, err = b.Bucket.ListObjects(ctx, req)
+		if err != nil {
+			return
+		}
+
+		if len(listing.VersionLifetimes) != len(listing.MinObjects) {
+			err = fmt.Errorf("listing of bucket %q has no version lifetimes", b.Name())
+			return
+		}
+
+		done = listing.ContinuationToken == ""
+		for i, o := range listing.MinObjects {
+			if o.Name != name {
+				done = true
+				break
+			}
+
+			if lifetime := listing.VersionLifetimes[i]; !lifetime.Created.After(b.time) {
+				m, deleted = o, lifetime.Deleted
+			}
+		}
+
+		req.ContinuationToken = listing.ContinuationToken
+	}
+
+	if m == nil || (!deleted.IsZero() && !deleted.After(b.time)) {
+		m = nil
+		err = &gcs.NotFoundError{
+			Err: fmt.Errorf("object %q not found at %v", name, b.time),
+		}
+	}
+
+	return
+}
+
+func (b snapshotBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	carry, err := decodeSnapshotContinuation(req.ContinuationToken)
+	if err != nil {
+		return
+	}
+
+	mReq := new(gcs.ListObjectsRequest)
+	*mReq = *req
+	mReq.Versions = true
+	mReq.ContinuationToken = carry.Token
+
+	versions, err := b.Bucket.ListObjects(ctx, mReq)
+	if err != nil {
+		return
+	}
+
+	if len(versions.VersionLifetimes) != len(versions.MinObjects) {
+		err = fmt.Errorf("listing of bucket %q has no version lifetimes", b.Name())
+		return
+	}
+
+	listing = &gcs.Listing{
+		CollapsedRuns: versions.CollapsedRuns,
+	}
+
+	// Versions come sorted by name then generation, so the candidate for a
+	// name is its last version created no later than the snapshot.
+	name, candidate, deleted := carry.Name, carry.Candidate, carry.Deleted
+	emit := func() {
+		if candidate != nil && (deleted.IsZero() || deleted.After(b.time)) {
+			listing.MinObjects = append(listing.MinObjects, candidate)
+		}
+	}
+
+	for i, o := range versions.MinObjects {
+		if o.Name != name {
+			emit()
+			name, candidate, deleted = o.Name, nil, time.Time{}
+		}
+
+		lifetime := versions.VersionLifetimes[i]
+		if !lifetime.Created.After(b.time) {
+			candidate, deleted = o, lifetime.Deleted
+		}
+	}
+
+	if versions.ContinuationToken == "" {
+		emit()
+		return
+	}
+
+	listing.ContinuationToken, err = encodeSnapshotContinuation(&snapshotContinuation{
+		Token:     versions.ContinuationToken,
+		Name:      name,
+		Candidate: candidate,
+		Deleted:   deleted,
+	})
+
+	return
+}
+
+func (b snapshotBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, extendedAttrs *gcs.ExtendedObjectAttributes, err error) {
+	m, err = b.statVisible(ctx, req.Name)
+	if err != nil {
+		return
+	}
+
+	// Extended attributes aren't listed, so fetch those of the visible
+	// generation.
+	if req.ReturnExtendedObjectAttributes {
+		_, extendedAttrs, err = b.Bucket.StatObject(ctx, &gcs.StatObjectRequest{
+			Name:                           m.Name,
+			ForceFetchFromGcs:              true,
+			ReturnExtendedObjectAttributes: true,
+			Generation:                     m.Generation,
+		})
+		if err != nil {
+			m = nil
+			return
+		}
+	}
+
+	return
+}
+
+func (b snapshotBucket) NewReaderWithReadHandle(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (gcs.StorageReader, error) {
+	if req.Generation == 0 {
+		m, err := b.statVisible(ctx, req.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		mReq := new(gcs.ReadObjectRequest)
+		*mReq = *req
+		mReq.Generation = m.Generation
+		req = mReq
+	}
+
+	return b.Bucket.NewReaderWithReadHandle(ctx, req)
+}
+
+func (b snapshotBucket) NewMultiRangeDownloader(
+	ctx context.Context,
+	req *gcs.MultiRangeDownloaderRequest) (gcs.MultiRangeDownloader, error) {
+	if req.Generation == 0 {
+		m, err := b.statVisible(ctx, req.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		mReq := new(gcs.MultiRangeDownloaderRequest)
+		*mReq = *req
+		mReq.Generation = m.Generation
+		req = mReq
+	}
+
+	return b.Bucket.NewMultiRangeDownloader(ctx, req)
+}
+
+func (b snapshotBucket) CreateObject(ctx context.Context, req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	return nil, b.readOnly("CreateObject")
+}
+
+func (b snapshotBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	return nil, b.readOnly("CreateObjectChunkWriter")
+}
+
+func (b snapshotBucket) FinalizeUpload(ctx context.Context, writer gcs.Writer) (*gcs.MinObject, error) {
+	return nil, b.readOnly("FinalizeUpload")
+}
+
+func (b snapshotBucket) FlushPendingWrites(ctx context.Context, writer gcs.Writer) (int64, error) {
+	return 0, b.readOnly("FlushPendingWrites")
+}
+
+func (b snapshotBucket) CopyObject(ctx context.Context, req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	return nil, b.readOnly("CopyObject")
+}
+
+func (b snapshotBucket) ComposeObjects(ctx context.Context, req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	return nil, b.readOnly("ComposeObjects")
+}
+
+func (b snapshotBucket) UpdateObject(ctx context.Context, req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	return nil, b.readOnly("UpdateObject")
+}
+
+func (b snapshotBucket) DeleteObject(ctx context.Context, req *gcs.DeleteObjectRequest) error {
+	return b.readOnly("DeleteObject")
+}
+
+func (b snapshotBucket) MoveObject(ctx context.Context, req *gcs.MoveObjectRequest) (*gcs.Object, error) {
+	return nil, b.readOnly("MoveObject")
+}
+
+func (b snapshotBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	return b.readOnly("DeleteFolder")
+}
+
+func (b snapshotBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	return nil, b.readOnly("RenameFolder")
+}
+
+func (b snapshotBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return nil, b.readOnly("CreateFolder")
+}
@@ -0,0 +1,252 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// A bucket listing a fixed set of versions and soft-deleted objects, a page of
+// the given size at a time. Everything else goes to the wrapped bucket.
+type versionedBucket struct {
+	gcs.Bucket
+	versions  []*gcs.MinObject
+	lifetimes []gcs.VersionLifetime
+	pageSize  int
+
+	softDeleted          []*gcs.MinObject
+	softDeletedLifetimes []gcs.VersionLifetime
+
+	// The object and generation asked for by the last read.
+	readName       string
+	readGeneration int64
+
+	// The last copy requested.
+	copied *gcs.CopyObjectRequest
+
+	// The number of pages listed.
+	listed int
+}
+
+func (b *versionedBucket) ListObjects(ctx context.Context, req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	b.listed++
+	versions, lifetimes := b.versions, b.lifetimes
+	if req.SoftDeleted {
+		versions, lifetimes = b.softDeleted, b.softDeletedLifetimes
+	} else if !req.Versions {
+		return nil, errors.New("versions not requested")
+	}
+
+	start := 0
+	if req.ContinuationToken != "" {
+		start, _ = strconv.Atoi(req.ContinuationToken)
+	}
+
+	listing := &gcs.Listing{}
+	i := start
+	for ; i < len(versions) && len(listing.MinObjects) < b.pageSize; i++ {
+		rest, ok := strings.CutPrefix(versions[i].Name, req.Prefix)
+		if !ok {
+			continue
+		}
+
+		if j := strings.Index(rest, "/"); req.Delimiter != "" && j >= 0 {
+			run := req.Prefix + rest[:j+1]
+			if n := len(listing.CollapsedRuns); n == 0 || listing.CollapsedRuns[n-1] != run {
+				listing.CollapsedRuns = append(listing.CollapsedRuns, run)
+			}
+			continue
+		}
+
+		listing.MinObjects = append(listing.MinObjects, versions[i])
+		listing.VersionLifetimes = append(listing.VersionLifetimes, lifetimes[i])
+	}
+
+	if i < len(versions) {
+		listing.ContinuationToken = strconv.Itoa(i)
+	}
+
+	return listing, nil
+}
+
+func (b *versionedBucket) CopyObject(ctx context.Context, req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	b.copied = req
+	return &gcs.Object{Name: req.DstName, Generation: req.SrcGeneration}, nil
+}
+
+// Stats of a particular generation report it as the content type.
+func (b *versionedBucket) StatObject(ctx context.Context, req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	if req.Generation == 0 {
+		return b.Bucket.StatObject(ctx, req)
+	}
+
+	return &gcs.MinObject{Name: req.Name, Generation: req.Generation},
+		&gcs.ExtendedObjectAttributes{ContentType: strconv.FormatInt(req.Generation, 10)},
+		nil
+}
+
+func (b *versionedBucket) NewReaderWithReadHandle(ctx context.Context, req *gcs.ReadObjectRequest) (gcs.StorageReader, error) {
+	b.readName = req.Name
+	b.readGeneration = req.Generation
+	return nil, errors.New("not implemented")
+}
+
+type SnapshotBucketTest struct {
+	suite.Suite
+	ctx       context.Context
+	snapshot  time.Time
+	versioned *versionedBucket
+	bucket    gcs.Bucket
+}
+
+func TestSnapshotBucket(t *testing.T) {
+	suite.Run(t, new(SnapshotBucketTest))
+}
+
+func (t *SnapshotBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.snapshot = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.versioned = &versionedBucket{
+		Bucket:   fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{}),
+		pageSize: 100,
+	}
+	t.bucket = gcsx.NewSnapshotBucket(t.snapshot, t.versioned)
+
+	// Versions in listing order: by name, then generation.
+	t.addVersion("a", 1, -2*time.Hour, -time.Hour)
+	t.addVersion("a", 2, -time.Hour, 0)
+	t.addVersion("b", 3, time.Hour, 0)
+	t.addVersion("c", 4, -2*time.Hour, -time.Hour)
+	t.addVersion("d", 5, -2*time.Hour, time.Hour)
+	t.addVersion("d", 6, time.Hour, 0)
+}
+
+// Add a version created and, unless deleted is zero, deleted at the supplied
+// offsets from the snapshot time.
+func (t *SnapshotBucketTest) addVersion(name string, generation int64, created time.Duration, deleted time.Duration) {
+	lifetime := gcs.VersionLifetime{Created: t.snapshot.Add(created)}
+	if deleted != 0 {
+		lifetime.Deleted = t.snapshot.Add(deleted)
+	}
+
+	t.versioned.versions = append(t.versioned.versions, &gcs.MinObject{Name: name, Generation: generation})
+	t.versioned.lifetimes = append(t.versioned.lifetimes, lifetime)
+}
+
+// List everything visible, returning name/generation pairs.
+func (t *SnapshotBucketTest) listAll() map[string]int64 {
+	visible := make(map[string]int64)
+	req := &gcs.ListObjectsRequest{}
+	for {
+		listing, err := t.bucket.ListObjects(t.ctx, req)
+		require.NoError(t.T(), err)
+
+		for _, o := range listing.MinObjects {
+			_, dup := visible[o.Name]
+			require.False(t.T(), dup, o.Name)
+			visible[o.Name] = o.Generation
+		}
+
+		if listing.ContinuationToken == "" {
+			return visible
+		}
+		req.ContinuationToken = listing.ContinuationToken
+	}
+}
+
+func (t *SnapshotBucketTest) TestListObjects() {
+	visible := t.listAll()
+
+	// a: the replacement of the first version. b: created later. c: deleted
+	// before. d: deleted after.
+	assert.Equal(t.T(), map[string]int64{"a": 2, "d": 5}, visible)
+}
+
+func (t *SnapshotBucketTest) TestListObjects_VersionsStraddlePages() {
+	t.versioned.pageSize = 1
+
+	visible := t.listAll()
+
+	assert.Equal(t.T(), map[string]int64{"a": 2, "d": 5}, visible)
+}
+
+func (t *SnapshotBucketTest) TestStatObject() {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "d"})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), int64(5), m.Generation)
+}
+
+func (t *SnapshotBucketTest) TestStatObject_ListsOnlyUpToOtherNames() {
+	t.versioned.pageSize = 1
+
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "a"})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), int64(2), m.Generation)
+	// The third page holds the version of "b".
+	assert.Equal(t.T(), 3, t.versioned.listed)
+}
+
+func (t *SnapshotBucketTest) TestStatObject_ExtendedAttributesOfVisibleGeneration() {
+	m, extendedAttrs, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{
+		Name:                           "d",
+		ForceFetchFromGcs:              true,
+		ReturnExtendedObjectAttributes: true,
+	})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), int64(5), m.Generation)
+	require.NotNil(t.T(), extendedAttrs)
+	assert.Equal(t.T(), "5", extendedAttrs.ContentType)
+}
+
+func (t *SnapshotBucketTest) TestStatObject_NotYetCreated() {
+	_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "b"})
+
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *SnapshotBucketTest) TestReadsArePinned() {
+	_, _ = t.bucket.NewReaderWithReadHandle(t.ctx, &gcs.ReadObjectRequest{Name: "d"})
+
+	assert.Equal(t.T(), int64(5), t.versioned.readGeneration)
+}
+
+func (t *SnapshotBucketTest) TestMutationsFail() {
+	_, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{Name: "e", Contents: strings.NewReader("")})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	err = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "a"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	_, err = t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: "a", DstName: "e"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+}
@@ -21,6 +21,8 @@ import (
 type SyncerBucket struct {
 	gcs.Bucket
 	Syncer
+
+	tmpObjectPrefix string
 }
 
 // NewSyncerBucket creates a SyncerBucket, which can be used either as
@@ -32,5 +34,21 @@ func NewSyncerBucket(
 	bucket gcs.Bucket,
 ) SyncerBucket {
 	syncer := NewSyncer(appendThreshold, chunkTransferTimeoutSecs, tmpObjectPrefix, bucket)
-	return SyncerBucket{bucket, syncer}
+	return SyncerBucket{bucket, syncer, tmpObjectPrefix}
+}
+
+// TmpObjectPrefix returns the prefix under which temporary objects are written
+// to the bucket.
+func (sb *SyncerBucket) TmpObjectPrefix() string {
+	return sb.tmpObjectPrefix
+}
+
+// UpperLayer returns the bucket as an UpperLayer if it has a local upper
+// layer, or nil otherwise.
+func (sb *SyncerBucket) UpperLayer() UpperLayer {
+	if ul, ok := sb.Bucket.(UpperLayer); ok && ul.StagingDir() != "" {
+		return ul
+	}
+
+	return nil
 }
@@ -15,14 +15,17 @@
 package gcsx
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"math"
 	"os"
+	"syscall"
 	"time"
 
 	"github.com/jacobsa/fuse/fsutil"
 	"github.com/jacobsa/timeutil"
+	"golang.org/x/sys/unix"
 )
 
 // TempFile is a temporary file that keeps track of the lowest offset at which
@@ -39,6 +42,12 @@ type TempFile interface {
 	io.WriterAt
 	Truncate(n int64) (err error)
 
+	// Semantics matching fallocate(2), except that only mode 0 (which extends
+	// the file if the range ends past its size) and FALLOC_FL_KEEP_SIZE are
+	// supported. Other modes return syscall.EOPNOTSUPP. May invalidate the seek
+	// position.
+	Fallocate(mode uint32, offset int64, length int64) (err error)
+
 	// Retrieve the file name
 	Name() string
 
@@ -100,6 +109,32 @@ func NewTempFile(
 	return
 }
 
+// NewStagedTempFile creates a temp file like NewTempFile, except that it is a
+// named file in dir, so that it can be handed over to an UpperLayer with that
+// directory as its staging directory. The file is removed when the temp file
+// is destroyed, unless it has been moved meanwhile.
+func NewStagedTempFile(
+	source io.ReadCloser,
+	dir string,
+	clock timeutil.Clock) (tf TempFile, err error) {
+	f, err := os.CreateTemp(dir, stagedTempFilePrefix)
+	if err != nil {
+		err = fmt.Errorf("CreateTemp: %w", err)
+		return
+	}
+
+	tf = &tempFile{
+		source:          source,
+		state:           fileIncomplete,
+		clock:           clock,
+		f:               f,
+		dirtyThreshold:  0,
+		removeOnDestroy: true,
+	}
+
+	return
+}
+
 // NewCacheFile creates a wrapper temp file whose initial contents are given by the
 // supplied source. dir is a directory on whose file system the file will live,
 // or the system default temporary location if empty.
@@ -142,6 +177,9 @@ func RecoverCacheFile(
 	return
 }
 
+// The prefix of the names of files created by NewStagedTempFile.
+const stagedTempFilePrefix = ".staged-"
+
 type fileState string
 
 const (
@@ -178,6 +216,9 @@ type tempFile struct {
 	//
 	// INVARIANT: mtime == nil => Stat().DirtyThreshold == Stat().Size
 	mtime *time.Time
+
+	// Set for named files, which are removed by Destroy.
+	removeOnDestroy bool
 }
 
 ////////////////////////////////////////////////////////////////////////
@@ -222,6 +263,9 @@ func (tf *tempFile) Destroy() {
 	tf.state = fileDestroyed
 	// Throw away the file (for anonymous files).
 	tf.f.Close()
+	if tf.removeOnDestroy {
+		os.Remove(tf.f.Name())
+	}
 
 	tf.f = nil
 }
@@ -305,6 +349,49 @@ func (tf *tempFile) Truncate(n int64) error {
 	return tf.f.Truncate(n)
 }
 
+func (tf *tempFile) Fallocate(mode uint32, offset int64, length int64) error {
+	err := tf.ensureComplete()
+	if err != nil {
+		return fmt.Errorf("cannot Fallocate incomplete file: %w", err)
+	}
+
+	if mode&^unix.FALLOC_FL_KEEP_SIZE != 0 {
+		return syscall.EOPNOTSUPP
+	}
+
+	size, err := tf.f.Seek(0, 2)
+	if err != nil {
+		return fmt.Errorf("seek: %w", err)
+	}
+
+	// Call through. Not every file system that may host the temp file supports
+	// fallocate, in which case we settle for extending the file without
+	// reserving its blocks.
+	err = unix.Fallocate(int(tf.f.Fd()), mode, offset, length)
+	if errors.Is(err, syscall.EOPNOTSUPP) {
+		err = nil
+		if mode&unix.FALLOC_FL_KEEP_SIZE == 0 && offset+length > size {
+			err = tf.f.Truncate(offset + length)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Only an allocation that extends the file modifies its contents.
+	if mode&unix.FALLOC_FL_KEEP_SIZE == 0 && offset+length > size {
+		tf.dirtyThreshold = minInt64(tf.dirtyThreshold, size)
+
+		tf.state = fileDirty
+
+		newMtime := tf.clock.Now()
+		tf.mtime = &newMtime
+	}
+
+	return nil
+}
+
 func (tf *tempFile) SetMtime(mtime time.Time) {
 	tf.mtime = &mtime
 }
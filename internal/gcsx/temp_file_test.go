@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"syscall"
 	"testing"
 	"time"
 
@@ -26,6 +27,7 @@ import (
 	. "github.com/jacobsa/ogletest"
 	"github.com/jacobsa/timeutil"
 	"golang.org/x/net/context"
+	"golang.org/x/sys/unix"
 )
 
 func TestTempFile(t *testing.T) { RunTests(t) }
@@ -104,6 +106,12 @@ func (tf *checkingTempFile) Truncate(n int64) error {
 	return tf.wrapped.Truncate(n)
 }
 
+func (tf *checkingTempFile) Fallocate(mode uint32, offset int64, length int64) error {
+	tf.wrapped.CheckInvariants()
+	defer tf.wrapped.CheckInvariants()
+	return tf.wrapped.Fallocate(mode, offset, length)
+}
+
 func (tf *checkingTempFile) SetMtime(mtime time.Time) {
 	tf.wrapped.CheckInvariants()
 	defer tf.wrapped.CheckInvariants()
@@ -236,6 +244,65 @@ func (t *TempFileTest) Truncate() {
 	ExpectEq(expected, string(actual))
 }
 
+func (t *TempFileTest) Fallocate_Extend() {
+	// Call
+	err := t.tf.Fallocate(0, 4, int64(initialContentSize))
+	ExpectEq(nil, err)
+
+	// Check Stat.
+	sr, err := t.tf.Stat()
+
+	AssertEq(nil, err)
+	ExpectEq(initialContentSize+4, sr.Size)
+	ExpectEq(initialContentSize, sr.DirtyThreshold)
+	ExpectThat(sr.Mtime, Pointee(timeutil.TimeEq(t.clock.Now())))
+
+	// Read back.
+	expected := initialContent + "\x00\x00\x00\x00"
+
+	actual, err := readAll(&t.tf)
+	AssertEq(nil, err)
+	ExpectEq(expected, string(actual))
+}
+
+func (t *TempFileTest) Fallocate_WithinFile() {
+	// Call
+	err := t.tf.Fallocate(0, 0, 2)
+	ExpectEq(nil, err)
+
+	// Nothing should have changed.
+	sr, err := t.tf.Stat()
+
+	AssertEq(nil, err)
+	ExpectEq(initialContentSize, sr.Size)
+	ExpectEq(initialContentSize, sr.DirtyThreshold)
+	ExpectEq(nil, sr.Mtime)
+}
+
+func (t *TempFileTest) Fallocate_KeepSize() {
+	// Call
+	err := t.tf.Fallocate(unix.FALLOC_FL_KEEP_SIZE, 4, 1<<20)
+	ExpectEq(nil, err)
+
+	// Nothing should have changed.
+	sr, err := t.tf.Stat()
+
+	AssertEq(nil, err)
+	ExpectEq(initialContentSize, sr.Size)
+	ExpectEq(initialContentSize, sr.DirtyThreshold)
+	ExpectEq(nil, sr.Mtime)
+
+	actual, err := readAll(&t.tf)
+	AssertEq(nil, err)
+	ExpectEq(initialContent, string(actual))
+}
+
+func (t *TempFileTest) Fallocate_UnsupportedMode() {
+	err := t.tf.Fallocate(unix.FALLOC_FL_KEEP_SIZE|unix.FALLOC_FL_PUNCH_HOLE, 0, 2)
+
+	ExpectEq(syscall.EOPNOTSUPP, err)
+}
+
 func (t *TempFileTest) SetMtime() {
 	mtime := time.Date(2015, 4, 5, 2, 15, 0, 0, time.Local)
 	AssertThat(mtime, Not(timeutil.TimeEq(t.clock.Now())))
@@ -0,0 +1,463 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// TrashDir is the name of the virtual directory at the root of the bucket
+// holding recently deleted objects.
+const TrashDir = ".trash/"
+
+// NewTrashBucket creates a wrapper bucket that exposes the objects deleted
+// from a bucket with object versioning or a soft delete policy under TrashDir,
+// at their original names. An object is in the trash if it has no live
+// generation but has a noncurrent or soft-deleted one; the latest such
+// generation is the one shown. TrashDir is not listed, but can be looked up by
+// name.
+//
+// The trash is read-only, except that an object can be restored by copying or
+// moving it from the trash to its original name, which brings back the deleted
+// generation. Noncurrent generations can be read in place, but soft-deleted
+// ones must be restored first.
+//
+// Directories within the trash are those of every prefix that has ever held
+// an object, so may turn out to be empty.
+func NewTrashBucket(b gcs.Bucket) gcs.Bucket {
+	return trashBucket{b}
+}
+
+type trashBucket struct {
+	gcs.Bucket
+}
+
+// A deleted object, under its original name.
+type trashEntry struct {
+	*gcs.MinObject
+	softDeleted bool
+}
+
+// If the supplied name lies within the trash, return the original name it
+// stands for.
+func trashObjectName(name string) (objectName string, ok bool) {
+	return strings.CutPrefix(name, TrashDir)
+}
+
+func isTrashName(names ...string) bool {
+	for _, name := range names {
+		if _, ok := trashObjectName(name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b trashBucket) readOnly(op string, name string) error {
+	return fmt.Errorf("%s(%q): the trash is read-only: %w", op, name, syscall.EROFS)
+}
+
+// Return the deleted objects directly within the supplied prefix, keyed by
+// name, along with the prefixes of subdirectories.
+func (b trashBucket) listTrash(ctx context.Context, prefix string) (entries map[string]trashEntry, runs []string, err error) {
+	entries = make(map[string]trashEntry)
+	live := make(map[string]bool)
+	runSet := make(map[string]bool)
+
+	for _, softDeleted := range []bool{false, true} {
+		req := &gcs.ListObjectsRequest{
+			Prefix:      prefix,
+			Delimiter:   "/",
+			Versions:    !softDeleted,
+			SoftDeleted: softDeleted,
+		}
+
+		for {
+			var listing *gcs.Listing
+			listing, err = b.Bucket.ListObjects(ctx, req)
+			if err != nil {
+				return
+			}
+
+			if len(listing.VersionLifetimes) != len(listing.MinObjects) {
+				err = fmt.Errorf("listing of bucket %q has no version lifetimes", b.Name())
+				return
+			}
+
+			for i, o := range listing.MinObjects {
+				switch {
+				case o.Name == prefix:
+					continue
+
+				case strings.HasSuffix(o.Name, "/"):
+					runSet[o.Name] = true
+
+				case !softDeleted && listing.VersionLifetimes[i].Deleted.IsZero():
+					live[o.Name] = true
+
+				case o.Generation > entries[o.Name].generation():
+					entries[o.Name] = trashEntry{MinObject: o, softDeleted: softDeleted}
+				}
+			}
+
+			for _, run := range listing.CollapsedRuns {
+				runSet[run] = true
+			}
+
+			if listing.ContinuationToken == "" {
+				break
+			}
+
+			req.ContinuationToken = listing.ContinuationToken
+		}
+	}
+
+	for name := range live {
+		delete(entries, name)
+	}
+
+	for run := range runSet {
+		runs = append(runs, run)
+	}
+	sort.Strings(runs)
+
+	return
+}
+
+func (e trashEntry) generation() int64 {
+	if e.MinObject == nil {
+		return 0
+	}
+
+	return e.Generation
+}
+
+// Return the deleted object with the supplied original name.
+func (b trashBucket) lookUpTrash(ctx context.Context, objectName string) (e trashEntry, err error) {
+	entries, _, err := b.listTrash(ctx, objectName)
+	if err != nil {
+		return
+	}
+
+	e, ok := entries[objectName]
+	if !ok {
+		err = &gcs.NotFoundError{Err: fmt.Errorf("object %q not found in the trash", objectName)}
+	}
+
+	return
+}
+
+func trashDirObject(name string) *gcs.MinObject {
+	return &gcs.MinObject{
+		Name:           name,
+		Generation:     1,
+		MetaGeneration: 1,
+	}
+}
+
+// Return whether the trash directory for the supplied prefix exists.
+func (b trashBucket) trashDirExists(ctx context.Context, prefix string) (bool, error) {
+	if prefix == "" {
+		return true, nil
+	}
+
+	entries, runs, err := b.listTrash(ctx, prefix)
+	return len(entries) > 0 || len(runs) > 0, err
+}
+
+func (b trashBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, extendedAttrs *gcs.ExtendedObjectAttributes, err error) {
+	objectName, ok := trashObjectName(req.Name)
+	if !ok {
+		return b.Bucket.StatObject(ctx, req)
+	}
+
+	if objectName == "" || strings.HasSuffix(objectName, "/") {
+		var exists bool
+		exists, err = b.trashDirExists(ctx, objectName)
+		if err != nil {
+			return
+		}
+
+		if !exists {
+			err = &gcs.NotFoundError{Err: fmt.Errorf("object %q not found", req.Name)}
+			return
+		}
+
+		m = trashDirObject(req.Name)
+	} else {
+		var e trashEntry
+		e, err = b.lookUpTrash(ctx, objectName)
+		if err != nil {
+			return
+		}
+
+		renamed := *e.MinObject
+		renamed.Name = req.Name
+		m = &renamed
+	}
+
+	if req.ReturnExtendedObjectAttributes {
+		extendedAttrs = &gcs.ExtendedObjectAttributes{}
+	}
+
+	return
+}
+
+func (b trashBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	prefix, ok := trashObjectName(folderName)
+	if !ok {
+		return b.Bucket.GetFolder(ctx, folderName)
+	}
+
+	exists, err := b.trashDirExists(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return nil, &gcs.NotFoundError{Err: fmt.Errorf("folder %q not found", folderName)}
+	}
+
+	return &gcs.Folder{Name: folderName}, nil
+}
+
+// Listings of the trash come in a single page, and always as if delimited by
+// slashes.
+func (b trashBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	prefix, ok := trashObjectName(req.Prefix)
+	if !ok {
+		return b.Bucket.ListObjects(ctx, req)
+	}
+
+	entries, runs, err := b.listTrash(ctx, prefix)
+	if err != nil {
+		return
+	}
+
+	listing = &gcs.Listing{}
+	for _, e := range entries {
+		renamed := *e.MinObject
+		renamed.Name = TrashDir + e.Name
+		listing.MinObjects = append(listing.MinObjects, &renamed)
+	}
+
+	// Report subdirectories both as explicit directories and as runs, as
+	// flat and hierarchical buckets respectively expect.
+	for _, run := range runs {
+		listing.MinObjects = append(listing.MinObjects, trashDirObject(TrashDir+run))
+		listing.CollapsedRuns = append(listing.CollapsedRuns, TrashDir+run)
+	}
+
+	sort.Slice(listing.MinObjects, func(i, j int) bool {
+		return listing.MinObjects[i].Name < listing.MinObjects[j].Name
+	})
+
+	return
+}
+
+// Return the deleted generation that reads of the supplied trash name are
+// served from.
+func (b trashBucket) readTarget(ctx context.Context, name string) (e trashEntry, err error) {
+	objectName, _ := trashObjectName(name)
+	e, err = b.lookUpTrash(ctx, objectName)
+	if err != nil {
+		return
+	}
+
+	if e.softDeleted {
+		err = fmt.Errorf("%q is soft-deleted and must be restored to be read: %w", objectName, syscall.EACCES)
+	}
+
+	return
+}
+
+func (b trashBucket) NewReaderWithReadHandle(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (gcs.StorageReader, error) {
+	if !isTrashName(req.Name) {
+		return b.Bucket.NewReaderWithReadHandle(ctx, req)
+	}
+
+	e, err := b.readTarget(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	mReq := new(gcs.ReadObjectRequest)
+	*mReq = *req
+	mReq.Name = e.Name
+	mReq.Generation = e.Generation
+	return b.Bucket.NewReaderWithReadHandle(ctx, mReq)
+}
+
+func (b trashBucket) NewMultiRangeDownloader(
+	ctx context.Context,
+	req *gcs.MultiRangeDownloaderRequest) (gcs.MultiRangeDownloader, error) {
+	if !isTrashName(req.Name) {
+		return b.Bucket.NewMultiRangeDownloader(ctx, req)
+	}
+
+	e, err := b.readTarget(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	mReq := new(gcs.MultiRangeDownloaderRequest)
+	*mReq = *req
+	mReq.Name = e.Name
+	mReq.Generation = e.Generation
+	return b.Bucket.NewMultiRangeDownloader(ctx, mReq)
+}
+
+// Restore the deleted object with the supplied name in the trash to its
+// original name.
+func (b trashBucket) restore(ctx context.Context, srcName string, dstName string, dstGenerationPrecondition *int64) (o *gcs.Object, err error) {
+	objectName, _ := trashObjectName(srcName)
+	if dstName != objectName {
+		err = fmt.Errorf("%q can only be restored to %q: %w", srcName, objectName, syscall.EINVAL)
+		return
+	}
+
+	e, err := b.lookUpTrash(ctx, objectName)
+	if err != nil {
+		return
+	}
+
+	return b.Bucket.CopyObject(ctx, &gcs.CopyObjectRequest{
+		SrcName:                   e.Name,
+		DstName:                   dstName,
+		SrcGeneration:             e.Generation,
+		SrcSoftDeleted:            e.softDeleted,
+		DstGenerationPrecondition: dstGenerationPrecondition,
+	})
+}
+
+func (b trashBucket) CopyObject(ctx context.Context, req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	if isTrashName(req.DstName) {
+		return nil, b.readOnly("CopyObject", req.DstName)
+	}
+
+	if isTrashName(req.SrcName) {
+		return b.restore(ctx, req.SrcName, req.DstName, req.DstGenerationPrecondition)
+	}
+
+	return b.Bucket.CopyObject(ctx, req)
+}
+
+func (b trashBucket) MoveObject(ctx context.Context, req *gcs.MoveObjectRequest) (*gcs.Object, error) {
+	if isTrashName(req.DstName) {
+		return nil, b.readOnly("MoveObject", req.DstName)
+	}
+
+	if isTrashName(req.SrcName) {
+		return b.restore(ctx, req.SrcName, req.DstName, req.DstGenerationPrecondition)
+	}
+
+	return b.Bucket.MoveObject(ctx, req)
+}
+
+// Deleting an object from the trash only succeeds once it has been restored,
+// which is how renames out of the trash finish.
+func (b trashBucket) DeleteObject(ctx context.Context, req *gcs.DeleteObjectRequest) error {
+	objectName, ok := trashObjectName(req.Name)
+	if !ok {
+		return b.Bucket.DeleteObject(ctx, req)
+	}
+
+	_, err := b.lookUpTrash(ctx, objectName)
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return b.readOnly("DeleteObject", req.Name)
+}
+
+func (b trashBucket) CreateObject(ctx context.Context, req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	if isTrashName(req.Name) {
+		return nil, b.readOnly("CreateObject", req.Name)
+	}
+
+	return b.Bucket.CreateObject(ctx, req)
+}
+
+func (b trashBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	if isTrashName(req.Name) {
+		return nil, b.readOnly("CreateObjectChunkWriter", req.Name)
+	}
+
+	return b.Bucket.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+}
+
+func (b trashBucket) ComposeObjects(ctx context.Context, req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	names := []string{req.DstName}
+	for _, src := range req.Sources {
+		names = append(names, src.Name)
+	}
+
+	if isTrashName(names...) {
+		return nil, b.readOnly("ComposeObjects", req.DstName)
+	}
+
+	return b.Bucket.ComposeObjects(ctx, req)
+}
+
+func (b trashBucket) UpdateObject(ctx context.Context, req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	if isTrashName(req.Name) {
+		return nil, b.readOnly("UpdateObject", req.Name)
+	}
+
+	return b.Bucket.UpdateObject(ctx, req)
+}
+
+func (b trashBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	if isTrashName(folderName) {
+		return nil, b.readOnly("CreateFolder", folderName)
+	}
+
+	return b.Bucket.CreateFolder(ctx, folderName)
+}
+
+func (b trashBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	if isTrashName(folderName) {
+		return b.readOnly("DeleteFolder", folderName)
+	}
+
+	return b.Bucket.DeleteFolder(ctx, folderName)
+}
+
+func (b trashBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	if isTrashName(folderName, destinationFolderId) {
+		return nil, b.readOnly("RenameFolder", folderName)
+	}
+
+	return b.Bucket.RenameFolder(ctx, folderName, destinationFolderId)
+}
@@ -0,0 +1,161 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type TrashBucketTest struct {
+	suite.Suite
+	ctx       context.Context
+	versioned *versionedBucket
+	bucket    gcs.Bucket
+}
+
+func TestTrashBucket(t *testing.T) {
+	suite.Run(t, new(TrashBucketTest))
+}
+
+func (t *TrashBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.versioned = &versionedBucket{
+		Bucket:   fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{}),
+		pageSize: 2,
+	}
+	t.bucket = gcsx.NewTrashBucket(t.versioned)
+
+	// Versions in listing order: by name, then generation.
+	t.addVersion("a/deleted", 1, true)
+	t.addVersion("a/live", 2, true)
+	t.addVersion("a/live", 3, false)
+	t.addVersion("a/sub/x", 4, true)
+	t.addVersion("b", 5, false)
+
+	t.versioned.softDeleted = append(t.versioned.softDeleted, &gcs.MinObject{Name: "a/soft", Generation: 6})
+	t.versioned.softDeletedLifetimes = append(t.versioned.softDeletedLifetimes, gcs.VersionLifetime{Deleted: time.Now()})
+}
+
+func (t *TrashBucketTest) addVersion(name string, generation int64, noncurrent bool) {
+	var lifetime gcs.VersionLifetime
+	if noncurrent {
+		lifetime.Deleted = time.Now()
+	}
+
+	t.versioned.versions = append(t.versioned.versions, &gcs.MinObject{Name: name, Generation: generation})
+	t.versioned.lifetimes = append(t.versioned.lifetimes, lifetime)
+}
+
+func (t *TrashBucketTest) TestStatObject_Root() {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: gcsx.TrashDir})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), gcsx.TrashDir, m.Name)
+}
+
+func (t *TrashBucketTest) TestListObjects() {
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: ".trash/a/", Delimiter: "/"})
+
+	require.NoError(t.T(), err)
+	var names []string
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+	}
+	assert.Equal(t.T(), []string{".trash/a/deleted", ".trash/a/soft", ".trash/a/sub/"}, names)
+	assert.Equal(t.T(), []string{".trash/a/sub/"}, listing.CollapsedRuns)
+}
+
+func (t *TrashBucketTest) TestStatObject_Deleted() {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: ".trash/a/sub/x"})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), ".trash/a/sub/x", m.Name)
+	assert.Equal(t.T(), int64(4), m.Generation)
+}
+
+func (t *TrashBucketTest) TestStatObject_Live() {
+	_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: ".trash/a/live"})
+
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *TrashBucketTest) TestReadNoncurrent() {
+	_, _ = t.bucket.NewReaderWithReadHandle(t.ctx, &gcs.ReadObjectRequest{Name: ".trash/a/deleted"})
+
+	assert.Equal(t.T(), "a/deleted", t.versioned.readName)
+	assert.Equal(t.T(), int64(1), t.versioned.readGeneration)
+}
+
+func (t *TrashBucketTest) TestReadSoftDeleted() {
+	_, err := t.bucket.NewReaderWithReadHandle(t.ctx, &gcs.ReadObjectRequest{Name: ".trash/a/soft"})
+
+	assert.ErrorIs(t.T(), err, syscall.EACCES)
+}
+
+func (t *TrashBucketTest) TestRestoreNoncurrent() {
+	_, err := t.bucket.MoveObject(t.ctx, &gcs.MoveObjectRequest{SrcName: ".trash/a/deleted", DstName: "a/deleted"})
+
+	require.NoError(t.T(), err)
+	require.NotNil(t.T(), t.versioned.copied)
+	assert.Equal(t.T(), "a/deleted", t.versioned.copied.SrcName)
+	assert.Equal(t.T(), int64(1), t.versioned.copied.SrcGeneration)
+	assert.False(t.T(), t.versioned.copied.SrcSoftDeleted)
+}
+
+func (t *TrashBucketTest) TestRestoreSoftDeleted() {
+	_, err := t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: ".trash/a/soft", DstName: "a/soft"})
+
+	require.NoError(t.T(), err)
+	require.NotNil(t.T(), t.versioned.copied)
+	assert.Equal(t.T(), int64(6), t.versioned.copied.SrcGeneration)
+	assert.True(t.T(), t.versioned.copied.SrcSoftDeleted)
+}
+
+func (t *TrashBucketTest) TestRestoreElsewhere() {
+	_, err := t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: ".trash/a/deleted", DstName: "c"})
+
+	assert.ErrorIs(t.T(), err, syscall.EINVAL)
+	assert.Nil(t.T(), t.versioned.copied)
+}
+
+func (t *TrashBucketTest) TestDeleteObject() {
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: ".trash/a/deleted"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	// Once restored, the object is no longer in the trash.
+	t.addVersion("a/deleted", 7, false)
+
+	err = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: ".trash/a/deleted"})
+	assert.NoError(t.T(), err)
+}
+
+func (t *TrashBucketTest) TestCreateObject() {
+	_, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{Name: ".trash/c", Contents: strings.NewReader("")})
+
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+}
@@ -0,0 +1,1063 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// UnionBucketSeparator separates the names of the layers of a union bucket,
+// upper layer first, e.g. "experiment+base-dataset". It can't appear in the
+// name of a real bucket.
+const UnionBucketSeparator = "+"
+
+const (
+	// WhiteoutMetadataKey marks an object in the upper layer of a union bucket
+	// that hides the object of the same name in the lower layers, and if its
+	// name ends in a slash, everything beneath it.
+	WhiteoutMetadataKey = "gcsfuse_whiteout"
+
+	// OpaqueMetadataKey marks a directory object in the upper layer of a union
+	// bucket that hides everything beneath it in the lower layers. Directories
+	// created where a deleted directory used to be are opaque, so that its
+	// old contents stay deleted.
+	OpaqueMetadataKey = "gcsfuse_opaque"
+
+	// LowerGenerationMetadataKey records, on an object in the upper layer of
+	// a union bucket, the generation of the object of the same name in the
+	// lower layers when it was first copied up, created or whited out, or 0 if
+	// there was none. Committing the upper layer (see CommitUpperLayer) is
+	// conditional on it, so that changes made below meanwhile aren't lost.
+	LowerGenerationMetadataKey = "gcsfuse_lower_generation"
+)
+
+// NewUnionBucket creates a bucket that merges the contents of several
+// buckets, called layers. An object in a layer hides any object of the same
+// name in the layers after it, so the first layer, called the upper layer,
+// takes precedence. Only the upper layer is ever modified:
+//
+//   - Objects are created in the upper layer.
+//   - An object in a lower layer is copied up to the upper layer the first
+//     time it is modified, e.g. appended to or has its metadata updated.
+//   - Deleting an object that exists in a lower layer leaves behind an empty
+//     whiteout object in the upper layer to hide it.
+//   - Objects in the upper layer record the generation of what they replace
+//     in the lower layers (see LowerGenerationMetadataKey).
+//
+// Objects whose names begin with tmpObjectPrefix exist only in the upper
+// layer. Listings of the layers are merged a page at a time. The layers must
+// be flat buckets, since the folders of hierarchical ones aren't merged.
+func NewUnionBucket(tmpObjectPrefix string, upper gcs.Bucket, lowers ...gcs.Bucket) gcs.Bucket {
+	names := []string{upper.Name()}
+	for _, l := range lowers {
+		names = append(names, l.Name())
+	}
+
+	return unionBucket{
+		Bucket:          upper,
+		name:            strings.Join(names, UnionBucketSeparator),
+		lowers:          lowers,
+		tmpObjectPrefix: tmpObjectPrefix,
+	}
+}
+
+type unionBucket struct {
+	// The upper layer.
+	gcs.Bucket
+
+	name            string
+	lowers          []gcs.Bucket
+	tmpObjectPrefix string
+}
+
+func isWhiteout(o *gcs.MinObject) bool {
+	return o.Metadata[WhiteoutMetadataKey] != ""
+}
+
+// Return true if the supplied object hides the lower layers beneath it.
+func masksLowerLayers(o *gcs.MinObject) bool {
+	return strings.HasSuffix(o.Name, "/") && (isWhiteout(o) || o.Metadata[OpaqueMetadataKey] != "")
+}
+
+func notFound(name string) error {
+	return &gcs.NotFoundError{Err: fmt.Errorf("object %q not found", name)}
+}
+
+// The state of a name in a union bucket.
+type unionEntry struct {
+	// The object of that name in the upper layer, which may be a whiteout, or
+	// nil if there is none.
+	upper *gcs.MinObject
+
+	// The object visible under that name, the layer it lives in and its
+	// extended attributes if asked for, or nil if there is none.
+	visible       *gcs.MinObject
+	layer         gcs.Bucket
+	extendedAttrs *gcs.ExtendedObjectAttributes
+}
+
+func (e *unionEntry) inUpper() bool {
+	return e.visible != nil && e.visible == e.upper
+}
+
+func (b unionBucket) Name() string {
+	return b.name
+}
+
+func (b unionBucket) upperOnly(name string) bool {
+	return b.tmpObjectPrefix != "" && strings.HasPrefix(name, b.tmpObjectPrefix)
+}
+
+// Stat the named object in a single layer, returning nil if it doesn't exist.
+func statLayer(ctx context.Context, layer gcs.Bucket, req *gcs.StatObjectRequest) (m *gcs.MinObject, extendedAttrs *gcs.ExtendedObjectAttributes, err error) {
+	m, extendedAttrs, err = layer.StatObject(ctx, req)
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		m, extendedAttrs, err = nil, nil, nil
+	}
+
+	return
+}
+
+// Return true if the lower layers are hidden at the supplied name by a
+// whiteout or opaque directory in the upper layer containing it. A name
+// ending in a slash counts as containing itself.
+func (b unionBucket) hiddenInUpper(ctx context.Context, name string) (bool, error) {
+	for i := 0; i < len(name); i++ {
+		if name[i] != '/' {
+			continue
+		}
+
+		m, _, err := statLayer(ctx, b.Bucket, &gcs.StatObjectRequest{Name: name[:i+1]})
+		if err != nil {
+			return false, err
+		}
+
+		if m != nil && masksLowerLayers(m) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Find the layer serving the named object.
+func (b unionBucket) resolve(ctx context.Context, req *gcs.StatObjectRequest) (e unionEntry, err error) {
+	e.upper, e.extendedAttrs, err = statLayer(ctx, b.Bucket, req)
+	if err != nil || e.upper != nil {
+		if e.upper != nil && !isWhiteout(e.upper) {
+			e.visible, e.layer = e.upper, b.Bucket
+		} else {
+			e.extendedAttrs = nil
+		}
+		return
+	}
+
+	hidden, err := b.hiddenInUpper(ctx, req.Name)
+	if err != nil || hidden {
+		return
+	}
+
+	for _, l := range b.lowers {
+		e.visible, e.extendedAttrs, err = statLayer(ctx, l, req)
+		if err != nil {
+			return
+		}
+
+		if e.visible != nil {
+			e.layer = l
+			return
+		}
+	}
+
+	return
+}
+
+// Return true if there is anything of the supplied name, or beneath it if it
+// is a directory name, in a lower layer.
+func (b unionBucket) inLowerLayers(ctx context.Context, name string) (bool, error) {
+	for _, l := range b.lowers {
+		if strings.HasSuffix(name, "/") {
+			listing, err := l.ListObjects(ctx, &gcs.ListObjectsRequest{Prefix: name, MaxResults: 1})
+			if err != nil {
+				return false, err
+			}
+
+			if len(listing.MinObjects) > 0 || len(listing.CollapsedRuns) > 0 {
+				return true, nil
+			}
+			continue
+		}
+
+		m, _, err := statLayer(ctx, l, &gcs.StatObjectRequest{Name: name})
+		if err != nil {
+			return false, err
+		}
+
+		if m != nil {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Translate a generation precondition on the visible object of a name into
+// one on the upper layer, which is where the write will happen. Objects in
+// lower layers don't exist in the upper layer, and whiteouts don't exist at
+// all as far as the caller is concerned.
+func upperPrecondition(e *unionEntry, name string, precondition *int64) (*int64, error) {
+	if precondition == nil {
+		return nil, nil
+	}
+
+	if *precondition == 0 {
+		if e.visible != nil {
+			return nil, &gcs.PreconditionError{Err: fmt.Errorf("object %q exists", name)}
+		}
+
+		if e.upper != nil {
+			return &e.upper.Generation, nil
+		}
+
+		return precondition, nil
+	}
+
+	if e.visible == nil || e.visible.Generation != *precondition {
+		return nil, &gcs.PreconditionError{Err: fmt.Errorf("object %q is not at generation %d", name, *precondition)}
+	}
+
+	if e.inUpper() {
+		return precondition, nil
+	}
+
+	var zero int64
+	return &zero, nil
+}
+
+// Return true if a new object of the supplied name, in place of the supplied
+// entry, must be opaque: a directory replacing a deleted one.
+func needsOpaque(e *unionEntry, name string) bool {
+	return e.upper != nil && masksLowerLayers(e.upper) && strings.HasSuffix(name, "/")
+}
+
+// Return the metadata to write for a new object in place of the supplied
+// entry.
+func upperMetadata(e *unionEntry, name string, metadata map[string]string) map[string]string {
+	if !needsOpaque(e, name) {
+		return metadata
+	}
+
+	out := map[string]string{OpaqueMetadataKey: "true"}
+	for k, v := range metadata {
+		out[k] = v
+	}
+
+	return out
+}
+
+// Return the value of LowerGenerationMetadataKey for an object replacing the
+// supplied entry in the upper layer: that of the object it replaces if that
+// is in the upper layer already, which is "" if unknown, or else the
+// generation of the visible object, or 0 if none.
+func lowerGeneration(e *unionEntry) string {
+	if e.upper != nil {
+		return e.upper.Metadata[LowerGenerationMetadataKey]
+	}
+
+	if e.visible != nil {
+		return strconv.FormatInt(e.visible.Generation, 10)
+	}
+
+	return "0"
+}
+
+// Return a copy of the supplied metadata for an object replacing the supplied
+// entry in the upper layer, with LowerGenerationMetadataKey set.
+func withLowerGeneration(e *unionEntry, metadata map[string]string) map[string]string {
+	out := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		out[k] = v
+	}
+
+	if g := lowerGeneration(e); g != "" {
+		out[LowerGenerationMetadataKey] = g
+	} else {
+		delete(out, LowerGenerationMetadataKey)
+	}
+
+	return out
+}
+
+// Copy the visible object of the supplied entry from its layer to the named
+// object in the upper layer.
+func (b unionBucket) copyUp(
+	ctx context.Context,
+	e *unionEntry,
+	dstName string,
+	metadata map[string]string,
+	precondition *int64) (*gcs.Object, error) {
+	return copyBetweenBuckets(ctx, e.layer, e.visible, e.extendedAttrs, b.Bucket, dstName, metadata, precondition)
+}
+
+// Copy the supplied object to the named object in another bucket, replacing
+// its metadata. The extended attributes of the source are fetched if nil.
+func copyBetweenBuckets(
+	ctx context.Context,
+	src gcs.Bucket,
+	m *gcs.MinObject,
+	extendedAttrs *gcs.ExtendedObjectAttributes,
+	dst gcs.Bucket,
+	dstName string,
+	metadata map[string]string,
+	precondition *int64) (o *gcs.Object, err error) {
+	if extendedAttrs == nil {
+		_, extendedAttrs, err = src.StatObject(ctx, &gcs.StatObjectRequest{Name: m.Name, ReturnExtendedObjectAttributes: true})
+		if err != nil {
+			err = fmt.Errorf("StatObject: %w", err)
+			return
+		}
+	}
+
+	r, err := src.NewReaderWithReadHandle(ctx, &gcs.ReadObjectRequest{
+		Name:       m.Name,
+		Generation: m.Generation,
+	})
+	if err != nil {
+		err = fmt.Errorf("NewReaderWithReadHandle: %w", err)
+		return
+	}
+	defer r.Close()
+
+	o, err = dst.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:                   dstName,
+		ContentType:            extendedAttrs.ContentType,
+		ContentLanguage:        extendedAttrs.ContentLanguage,
+		ContentEncoding:        m.ContentEncoding,
+		CacheControl:           extendedAttrs.CacheControl,
+		Metadata:               metadata,
+		ContentDisposition:     extendedAttrs.ContentDisposition,
+		CustomTime:             extendedAttrs.CustomTime,
+		Contents:               r,
+		GenerationPrecondition: precondition,
+	})
+	return
+}
+
+func (b unionBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	if b.upperOnly(req.Name) {
+		return b.Bucket.StatObject(ctx, req)
+	}
+
+	e, err := b.resolve(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if e.visible == nil {
+		return nil, nil, notFound(req.Name)
+	}
+
+	return e.visible, e.extendedAttrs, nil
+}
+
+// List all pages of a single layer.
+func listLayer(ctx context.Context, layer gcs.Bucket, req *gcs.ListObjectsRequest) (out *gcs.Listing, err error) {
+	lReq := *req
+	lReq.ContinuationToken = ""
+	out = &gcs.Listing{}
+	for {
+		var listing *gcs.Listing
+		listing, err = layer.ListObjects(ctx, &lReq)
+		if err != nil {
+			return
+		}
+
+		out.MinObjects = append(out.MinObjects, listing.MinObjects...)
+		out.CollapsedRuns = append(out.CollapsedRuns, listing.CollapsedRuns...)
+		if listing.ContinuationToken == "" {
+			return
+		}
+
+		lReq.ContinuationToken = listing.ContinuationToken
+	}
+}
+
+// The maximum number of objects and collapsed runs in a page of a listing of
+// a union bucket when the request doesn't say, as for GCS.
+const defaultUnionListMaxResults = 1000
+
+// The listings of the layers of a union bucket are merged in name order a
+// page at a time, so the continuation token handed out records the last name
+// returned, and for each layer the token of the page it has got to, or that
+// it has none left. Directories hiding the lower layers (see
+// masksLowerLayers) can hide names in later pages, so those containing the
+// last name are recorded too.
+type unionContinuation struct {
+	After  string   `json:"after"`
+	Tokens []string `json:"tokens"`
+	Done   []bool   `json:"done"`
+	Masks  []string `json:"masks,omitempty"`
+}
+
+func encodeUnionContinuation(c *unionContinuation) (string, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("json.Marshal: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeUnionContinuation(token string, layers int) (c *unionContinuation, err error) {
+	c = &unionContinuation{
+		Tokens: make([]string, layers),
+		Done:   make([]bool, layers),
+	}
+	if token == "" {
+		return
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		err = fmt.Errorf("malformed continuation token: %w", err)
+		return
+	}
+
+	if err = json.Unmarshal(b, c); err != nil {
+		err = fmt.Errorf("malformed continuation token: %w", err)
+		return
+	}
+
+	if len(c.Tokens) != layers || len(c.Done) != layers {
+		err = fmt.Errorf("malformed continuation token: %d layers", len(c.Tokens))
+	}
+
+	return
+}
+
+// A name in the listing of a layer, for an object, a collapsed run or both.
+type unionListEntry struct {
+	name string
+	o    *gcs.MinObject
+	run  bool
+}
+
+// Return the names in the supplied listing after the supplied one, in order.
+func listEntries(listing *gcs.Listing, after string) (entries []unionListEntry) {
+	objects, runs := listing.MinObjects, listing.CollapsedRuns
+	for len(objects) > 0 || len(runs) > 0 {
+		var e unionListEntry
+		switch {
+		case len(runs) == 0 || (len(objects) > 0 && objects[0].Name < runs[0]):
+			e = unionListEntry{name: objects[0].Name, o: objects[0]}
+			objects = objects[1:]
+		case len(objects) == 0 || runs[0] < objects[0].Name:
+			e = unionListEntry{name: runs[0], run: true}
+			runs = runs[1:]
+		default:
+			e = unionListEntry{name: runs[0], o: objects[0], run: true}
+			objects, runs = objects[1:], runs[1:]
+		}
+
+		if e.name > after {
+			entries = append(entries, e)
+		}
+	}
+
+	return
+}
+
+// The position of a listing of a union bucket in that of one of its layers.
+type layerCursor struct {
+	layer gcs.Bucket
+	req   gcs.ListObjectsRequest
+
+	// The token of the page entries come from, and of the page after it.
+	token   string
+	next    string
+	entries []unionListEntry
+
+	// Set once the layer has nothing more to list.
+	done bool
+}
+
+// Fetch pages until there are names after the supplied one to merge, or none
+// are left.
+func (c *layerCursor) fill(ctx context.Context, after string) error {
+	for !c.done && len(c.entries) == 0 {
+		c.req.ContinuationToken = c.token
+		listing, err := c.layer.ListObjects(ctx, &c.req)
+		if err != nil {
+			return fmt.Errorf("ListObjects(%q): %w", c.layer.Name(), err)
+		}
+
+		c.entries = listEntries(listing, after)
+		c.next = listing.ContinuationToken
+		if len(c.entries) == 0 {
+			c.advance()
+		}
+	}
+
+	return nil
+}
+
+// Move on to the next page.
+func (c *layerCursor) advance() {
+	c.token = c.next
+	c.done = c.next == ""
+}
+
+// Return the next name, if it is the supplied one.
+func (c *layerCursor) pop(name string) *unionListEntry {
+	if c.done || c.entries[0].name != name {
+		return nil
+	}
+
+	e := c.entries[0]
+	c.entries = c.entries[1:]
+	if len(c.entries) == 0 {
+		c.advance()
+	}
+
+	return &e
+}
+
+// Return those of the supplied names of directories that contain the
+// supplied name. Names are listed in order, so the others can't contain any
+// name listed after it.
+func containing(dirs []string, name string) (out []string) {
+	for _, d := range dirs {
+		if strings.HasPrefix(name, d) {
+			out = append(out, d)
+		}
+	}
+
+	return
+}
+
+func (b unionBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	if b.upperOnly(req.Prefix) || req.Versions || req.SoftDeleted {
+		return b.Bucket.ListObjects(ctx, req)
+	}
+
+	layers := append([]gcs.Bucket{b.Bucket}, b.lowers...)
+	c, err := decodeUnionContinuation(req.ContinuationToken, len(layers))
+	if err != nil {
+		return
+	}
+
+	// Nothing in the lower layers is visible beneath a hidden prefix.
+	if req.ContinuationToken == "" {
+		var hidden bool
+		if hidden, err = b.hiddenInUpper(ctx, req.Prefix); err != nil {
+			return
+		}
+
+		for i := 1; i < len(layers); i++ {
+			c.Done[i] = hidden
+		}
+	}
+
+	cursors := make([]*layerCursor, len(layers))
+	for i, l := range layers {
+		cursors[i] = &layerCursor{layer: l, req: *req, token: c.Tokens[i], done: c.Done[i]}
+	}
+
+	// Always see directory objects in the upper layer, since they may be
+	// whiteouts hiding a collapsed run in a lower layer.
+	cursors[0].req.IncludeTrailingDelimiter = req.Delimiter != ""
+
+	limit := req.MaxResults
+	if limit <= 0 {
+		limit = defaultUnionListMaxResults
+	}
+
+	listing = &gcs.Listing{}
+	after, masks := c.After, c.Masks
+	for len(listing.MinObjects)+len(listing.CollapsedRuns) < limit {
+		// Find the next name in any layer.
+		name, found := "", false
+		for _, cur := range cursors {
+			if err = cur.fill(ctx, after); err != nil {
+				return
+			}
+
+			if !cur.done && (!found || cur.entries[0].name < name) {
+				name, found = cur.entries[0].name, true
+			}
+		}
+
+		if !found {
+			break
+		}
+
+		after = name
+		masks = containing(masks, name)
+		var o *gcs.MinObject
+		var run, objectSeen bool
+		if e := cursors[0].pop(name); e != nil {
+			if e.o != nil {
+				objectSeen = true
+				if masksLowerLayers(e.o) {
+					masks = append(masks, name)
+				}
+
+				// Objects a delimiter away are only listed if asked for.
+				rest := strings.TrimPrefix(name, req.Prefix)
+				if !isWhiteout(e.o) && (req.IncludeTrailingDelimiter || req.Delimiter == "" || !strings.Contains(rest, req.Delimiter)) {
+					o = e.o
+				}
+			}
+
+			run = e.run && (e.o == nil || !isWhiteout(e.o))
+		}
+
+		for _, cur := range cursors[1:] {
+			e := cur.pop(name)
+			if e == nil || len(masks) > 0 {
+				continue
+			}
+
+			if e.o != nil && !objectSeen {
+				o, objectSeen = e.o, true
+			}
+
+			run = run || e.run
+		}
+
+		if o != nil {
+			listing.MinObjects = append(listing.MinObjects, o)
+		}
+
+		if run {
+			listing.CollapsedRuns = append(listing.CollapsedRuns, name)
+		}
+	}
+
+	more := false
+	for i, cur := range cursors {
+		c.Tokens[i], c.Done[i] = cur.token, cur.done
+		more = more || !cur.done
+	}
+
+	if more {
+		c.After, c.Masks = after, masks
+		listing.ContinuationToken, err = encodeUnionContinuation(c)
+	}
+
+	return
+}
+
+func (b unionBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	folder, err := b.Bucket.GetFolder(ctx, folderName)
+	var notFoundErr *gcs.NotFoundError
+	if !errors.As(err, &notFoundErr) || b.upperOnly(folderName) {
+		return folder, err
+	}
+
+	hidden, hiddenErr := b.hiddenInUpper(ctx, folderName)
+	if hiddenErr != nil {
+		return nil, hiddenErr
+	}
+
+	if hidden {
+		return nil, err
+	}
+
+	for _, l := range b.lowers {
+		folder, err = l.GetFolder(ctx, folderName)
+		if !errors.As(err, &notFoundErr) {
+			return folder, err
+		}
+	}
+
+	return nil, err
+}
+
+// Return the layer serving the named object, for reading it.
+func (b unionBucket) readLayer(ctx context.Context, name string) (gcs.Bucket, error) {
+	if b.upperOnly(name) {
+		return b.Bucket, nil
+	}
+
+	e, err := b.resolve(ctx, &gcs.StatObjectRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	if e.visible == nil {
+		return nil, notFound(name)
+	}
+
+	return e.layer, nil
+}
+
+func (b unionBucket) NewReaderWithReadHandle(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (gcs.StorageReader, error) {
+	layer, err := b.readLayer(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return layer.NewReaderWithReadHandle(ctx, req)
+}
+
+func (b unionBucket) NewMultiRangeDownloader(
+	ctx context.Context,
+	req *gcs.MultiRangeDownloaderRequest) (gcs.MultiRangeDownloader, error) {
+	layer, err := b.readLayer(ctx, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return layer.NewMultiRangeDownloader(ctx, req)
+}
+
+// Rewrite a request for a new object so that it applies to the upper layer.
+func (b unionBucket) upperCreateRequest(ctx context.Context, req *gcs.CreateObjectRequest) (*gcs.CreateObjectRequest, error) {
+	e, err := b.resolve(ctx, &gcs.StatObjectRequest{Name: req.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	precondition, err := upperPrecondition(&e, req.Name, req.GenerationPrecondition)
+	if err != nil {
+		return nil, err
+	}
+
+	upperReq := *req
+	upperReq.GenerationPrecondition = precondition
+	upperReq.Metadata = withLowerGeneration(&e, upperMetadata(&e, req.Name, req.Metadata))
+	if e.visible != nil && !e.inUpper() {
+		upperReq.MetaGenerationPrecondition = nil
+	}
+
+	return &upperReq, nil
+}
+
+func (b unionBucket) CreateObject(ctx context.Context, req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	if b.upperOnly(req.Name) {
+		return b.Bucket.CreateObject(ctx, req)
+	}
+
+	upperReq, err := b.upperCreateRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bucket.CreateObject(ctx, upperReq)
+}
+
+// StagingDir returns the staging directory of the upper layer, if it is
+// itself an UpperLayer.
+func (b unionBucket) StagingDir() string {
+	return stagingDir(b.Bucket)
+}
+
+func (b unionBucket) CreateObjectFromFile(ctx context.Context, req *gcs.CreateObjectRequest, path string) (*gcs.Object, error) {
+	if b.upperOnly(req.Name) {
+		return createObjectFromFile(ctx, b.Bucket, req, path)
+	}
+
+	upperReq, err := b.upperCreateRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return createObjectFromFile(ctx, b.Bucket, upperReq, path)
+}
+
+func (b unionBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	if b.upperOnly(req.Name) {
+		return b.Bucket.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+	}
+
+	upperReq, err := b.upperCreateRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bucket.CreateObjectChunkWriter(ctx, upperReq, chunkSize, callBack)
+}
+
+// Check that the visible object of an entry matches a source generation and
+// metageneration precondition, which the layer holding it can't check if
+// the object is copied rather than read in place.
+func checkSource(e *unionEntry, name string, generation int64, metaGenerationPrecondition *int64) error {
+	if e.visible == nil || (generation != 0 && e.visible.Generation != generation) {
+		return notFound(name)
+	}
+
+	if metaGenerationPrecondition != nil && e.visible.MetaGeneration != *metaGenerationPrecondition {
+		return &gcs.PreconditionError{Err: fmt.Errorf("object %q is not at metageneration %d", name, *metaGenerationPrecondition)}
+	}
+
+	return nil
+}
+
+func (b unionBucket) CopyObject(ctx context.Context, req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	if b.upperOnly(req.DstName) && b.upperOnly(req.SrcName) {
+		return b.Bucket.CopyObject(ctx, req)
+	}
+
+	src := unionEntry{}
+	var err error
+	if b.upperOnly(req.SrcName) {
+		src.upper, _, err = statLayer(ctx, b.Bucket, &gcs.StatObjectRequest{Name: req.SrcName})
+		src.visible, src.layer = src.upper, b.Bucket
+	} else {
+		src, err = b.resolve(ctx, &gcs.StatObjectRequest{Name: req.SrcName})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkSource(&src, req.SrcName, req.SrcGeneration, req.SrcMetaGenerationPrecondition); err != nil {
+		return nil, err
+	}
+
+	dst, err := b.resolve(ctx, &gcs.StatObjectRequest{Name: req.DstName})
+	if err != nil {
+		return nil, err
+	}
+
+	precondition, err := upperPrecondition(&dst, req.DstName, req.DstGenerationPrecondition)
+	if err != nil {
+		return nil, err
+	}
+
+	if src.inUpper() && !needsOpaque(&dst, req.DstName) {
+		upperReq := *req
+		upperReq.SrcGeneration = src.visible.Generation
+		upperReq.DstGenerationPrecondition = precondition
+		o, err := b.Bucket.CopyObject(ctx, &upperReq)
+		if err != nil {
+			return nil, err
+		}
+
+		// The copy carries the source's record of what lies beneath it.
+		return b.setLowerGeneration(ctx, o, &dst)
+	}
+
+	return b.copyUp(ctx, &src, req.DstName, withLowerGeneration(&dst, upperMetadata(&dst, req.DstName, src.visible.Metadata)), precondition)
+}
+
+// Make the record of what lies beneath the supplied new object in the upper
+// layer that of the entry it replaced.
+func (b unionBucket) setLowerGeneration(ctx context.Context, o *gcs.Object, replaced *unionEntry) (*gcs.Object, error) {
+	g := lowerGeneration(replaced)
+	if o.Metadata[LowerGenerationMetadataKey] == g {
+		return o, nil
+	}
+
+	var value *string
+	if g != "" {
+		value = &g
+	}
+
+	return b.Bucket.UpdateObject(ctx, &gcs.UpdateObjectRequest{
+		Name:       o.Name,
+		Generation: o.Generation,
+		Metadata:   map[string]*string{LowerGenerationMetadataKey: value},
+	})
+}
+
+func (b unionBucket) ComposeObjects(ctx context.Context, req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	if b.upperOnly(req.DstName) {
+		return b.Bucket.ComposeObjects(ctx, req)
+	}
+
+	dst, err := b.resolve(ctx, &gcs.StatObjectRequest{Name: req.DstName})
+	if err != nil {
+		return nil, err
+	}
+
+	precondition, err := upperPrecondition(&dst, req.DstName, req.DstGenerationPrecondition)
+	if err != nil {
+		return nil, err
+	}
+
+	upperReq := *req
+	upperReq.Sources = make([]gcs.ComposeSource, len(req.Sources))
+	upperReq.Metadata = withLowerGeneration(&dst, upperMetadata(&dst, req.DstName, req.Metadata))
+	if dst.visible != nil && !dst.inUpper() {
+		upperReq.DstMetaGenerationPrecondition = nil
+	}
+
+	// Copy up sources living in lower layers, typically the object being
+	// appended to.
+	for i, s := range req.Sources {
+		upperReq.Sources[i] = s
+		if b.upperOnly(s.Name) {
+			continue
+		}
+
+		var src unionEntry
+		src, err = b.resolve(ctx, &gcs.StatObjectRequest{Name: s.Name})
+		if err != nil {
+			return nil, err
+		}
+
+		if err = checkSource(&src, s.Name, s.Generation, nil); err != nil {
+			return nil, err
+		}
+
+		if src.inUpper() {
+			continue
+		}
+
+		var copied *gcs.Object
+		copied, err = b.copyUp(ctx, &src, s.Name, withLowerGeneration(&src, src.visible.Metadata), new(int64))
+		if err != nil {
+			return nil, fmt.Errorf("copying up %q: %w", s.Name, err)
+		}
+
+		upperReq.Sources[i].Generation = copied.Generation
+		if s.Name == req.DstName && precondition != nil {
+			precondition = &copied.Generation
+		}
+	}
+
+	upperReq.DstGenerationPrecondition = precondition
+	return b.Bucket.ComposeObjects(ctx, &upperReq)
+}
+
+func (b unionBucket) UpdateObject(ctx context.Context, req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	if b.upperOnly(req.Name) {
+		return b.Bucket.UpdateObject(ctx, req)
+	}
+
+	e, err := b.resolve(ctx, &gcs.StatObjectRequest{Name: req.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkSource(&e, req.Name, req.Generation, req.MetaGenerationPrecondition); err != nil {
+		return nil, err
+	}
+
+	if e.inUpper() {
+		return b.Bucket.UpdateObject(ctx, req)
+	}
+
+	copied, err := b.copyUp(ctx, &e, req.Name, withLowerGeneration(&e, e.visible.Metadata), new(int64))
+	if err != nil {
+		return nil, fmt.Errorf("copying up %q: %w", req.Name, err)
+	}
+
+	upperReq := *req
+	upperReq.Generation = copied.Generation
+	upperReq.MetaGenerationPrecondition = nil
+	return b.Bucket.UpdateObject(ctx, &upperReq)
+}
+
+// Create a whiteout hiding the named object, whose entry is supplied, in the
+// lower layers.
+func (b unionBucket) whiteOut(ctx context.Context, name string, e *unionEntry) error {
+	var zero int64
+	_, err := b.Bucket.CreateObject(ctx, &gcs.CreateObjectRequest{
+		Name:                   name,
+		Contents:               strings.NewReader(""),
+		Metadata:               withLowerGeneration(e, map[string]string{WhiteoutMetadataKey: "true"}),
+		GenerationPrecondition: &zero,
+	})
+	if err != nil {
+		return fmt.Errorf("creating whiteout for %q: %w", name, err)
+	}
+
+	return nil
+}
+
+func (b unionBucket) DeleteObject(ctx context.Context, req *gcs.DeleteObjectRequest) error {
+	if b.upperOnly(req.Name) {
+		return b.Bucket.DeleteObject(ctx, req)
+	}
+
+	e, err := b.resolve(ctx, &gcs.StatObjectRequest{Name: req.Name})
+	if err != nil {
+		return err
+	}
+
+	if e.inUpper() {
+		if err = b.Bucket.DeleteObject(ctx, req); err != nil {
+			return err
+		}
+	} else if e.visible != nil {
+		if err = checkSource(&e, req.Name, req.Generation, req.MetaGenerationPrecondition); err != nil {
+			return err
+		}
+	} else if e.upper != nil || !strings.HasSuffix(req.Name, "/") {
+		return notFound(req.Name)
+	}
+
+	// Implicit directories in lower layers have no object, but can still be
+	// deleted.
+	needed, err := b.inLowerLayers(ctx, req.Name)
+	if err != nil {
+		return err
+	}
+
+	if !needed {
+		if e.visible == nil {
+			return notFound(req.Name)
+		}
+		return nil
+	}
+
+	return b.whiteOut(ctx, req.Name, &e)
+}
+
+func (b unionBucket) MoveObject(ctx context.Context, req *gcs.MoveObjectRequest) (*gcs.Object, error) {
+	if b.upperOnly(req.SrcName) && b.upperOnly(req.DstName) {
+		return b.Bucket.MoveObject(ctx, req)
+	}
+
+	// Objects can only be moved within the upper layer, and must not leave
+	// anything below them visible once gone, so move by copying and deleting.
+	o, err := b.CopyObject(ctx, &gcs.CopyObjectRequest{
+		SrcName:                       req.SrcName,
+		DstName:                       req.DstName,
+		SrcGeneration:                 req.SrcGeneration,
+		SrcMetaGenerationPrecondition: req.SrcMetaGenerationPrecondition,
+		DstGenerationPrecondition:     req.DstGenerationPrecondition,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.DeleteObject(ctx, &gcs.DeleteObjectRequest{
+		Name:       req.SrcName,
+		Generation: req.SrcGeneration,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("deleting %q after copying it: %w", req.SrcName, err)
+	}
+
+	return o, nil
+}
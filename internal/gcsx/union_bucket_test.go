@@ -0,0 +1,308 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+const unionTmpObjectPrefix = ".gcsfuse_tmp/"
+
+type UnionBucketTest struct {
+	suite.Suite
+	ctx    context.Context
+	upper  gcs.Bucket
+	lower  gcs.Bucket
+	bucket gcs.Bucket
+}
+
+func TestUnionBucket(t *testing.T) {
+	suite.Run(t, new(UnionBucketTest))
+}
+
+func (t *UnionBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.upper = fake.NewFakeBucket(timeutil.RealClock(), "upper", gcs.BucketType{})
+	t.lower = fake.NewFakeBucket(timeutil.RealClock(), "lower", gcs.BucketType{})
+	t.bucket = gcsx.NewUnionBucket(unionTmpObjectPrefix, t.upper, t.lower)
+
+	require.NoError(t.T(), storageutil.CreateObjects(t.ctx, t.upper, map[string][]byte{
+		"both":      []byte("upper"),
+		"upper":     []byte("upper"),
+		"dir/upper": []byte("upper"),
+	}))
+	require.NoError(t.T(), storageutil.CreateObjects(t.ctx, t.lower, map[string][]byte{
+		"both":       []byte("lower"),
+		"lower":      []byte("lower"),
+		"dir/":       nil,
+		"dir/lower":  []byte("lower"),
+		"dir/sub/x":  []byte("lower"),
+		"lowerdir/y": []byte("lower"),
+	}))
+}
+
+func (t *UnionBucketTest) read(name string) string {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, name)
+	require.NoError(t.T(), err)
+	return string(contents)
+}
+
+func (t *UnionBucketTest) stat(b gcs.Bucket, name string) (*gcs.MinObject, error) {
+	m, _, err := b.StatObject(t.ctx, &gcs.StatObjectRequest{Name: name})
+	return m, err
+}
+
+func (t *UnionBucketTest) listPages(req *gcs.ListObjectsRequest) (names []string, runs []string, pages int) {
+	for {
+		listing, err := t.bucket.ListObjects(t.ctx, req)
+		require.NoError(t.T(), err)
+		pages++
+		require.LessOrEqual(t.T(), len(listing.MinObjects)+len(listing.CollapsedRuns), max(req.MaxResults, 1000))
+		for _, o := range listing.MinObjects {
+			names = append(names, o.Name)
+		}
+		runs = append(runs, listing.CollapsedRuns...)
+
+		if listing.ContinuationToken == "" {
+			return
+		}
+		req.ContinuationToken = listing.ContinuationToken
+	}
+}
+
+func (t *UnionBucketTest) list(prefix string) (names []string, runs []string) {
+	names, runs, _ = t.listPages(&gcs.ListObjectsRequest{Prefix: prefix, Delimiter: "/"})
+	return
+}
+
+func (t *UnionBucketTest) TestName() {
+	assert.Equal(t.T(), "upper+lower", t.bucket.Name())
+}
+
+func (t *UnionBucketTest) TestStatAndRead_UpperTakesPrecedence() {
+	assert.Equal(t.T(), "upper", t.read("both"))
+	assert.Equal(t.T(), "upper", t.read("upper"))
+	assert.Equal(t.T(), "lower", t.read("lower"))
+
+	_, err := t.stat(t.bucket, "missing")
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *UnionBucketTest) TestListObjects_MergesLayers() {
+	names, runs := t.list("")
+	assert.Equal(t.T(), []string{"both", "lower", "upper"}, names)
+	assert.Equal(t.T(), []string{"dir/", "lowerdir/"}, runs)
+
+	names, runs = t.list("dir/")
+	assert.Equal(t.T(), []string{"dir/", "dir/lower", "dir/upper"}, names)
+	assert.Equal(t.T(), []string{"dir/sub/"}, runs)
+}
+
+func (t *UnionBucketTest) TestListObjects_Pages() {
+	names, runs, pages := t.listPages(&gcs.ListObjectsRequest{Delimiter: "/", MaxResults: 2})
+
+	assert.Equal(t.T(), []string{"both", "lower", "upper"}, names)
+	assert.Equal(t.T(), []string{"dir/", "lowerdir/"}, runs)
+	assert.Equal(t.T(), 3, pages)
+}
+
+func (t *UnionBucketTest) TestListObjects_DeletedDirectoryStaysHiddenAcrossPages() {
+	require.NoError(t.T(), storageutil.CreateObjects(t.ctx, t.lower, map[string][]byte{"dir/zz": nil}))
+	require.NoError(t.T(), t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "dir/"}))
+
+	names, runs, _ := t.listPages(&gcs.ListObjectsRequest{MaxResults: 1})
+
+	assert.Equal(t.T(), []string{"both", "dir/upper", "lower", "lowerdir/y", "upper"}, names)
+	assert.Empty(t.T(), runs)
+}
+
+func (t *UnionBucketTest) TestCreateObject_PreconditionOnLowerObject() {
+	m, err := t.stat(t.bucket, "lower")
+	require.NoError(t.T(), err)
+
+	_, err = t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:                   "lower",
+		Contents:               bytes.NewReader([]byte("new")),
+		GenerationPrecondition: &m.Generation,
+	})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "new", t.read("lower"))
+	contents, err := storageutil.ReadObject(t.ctx, t.lower, "lower")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "lower", string(contents))
+}
+
+func (t *UnionBucketTest) TestCreateObject_ExistsOnlyInLowerLayer() {
+	var zero int64
+	_, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:                   "lower",
+		Contents:               bytes.NewReader(nil),
+		GenerationPrecondition: &zero,
+	})
+
+	var preconditionErr *gcs.PreconditionError
+	assert.ErrorAs(t.T(), err, &preconditionErr)
+}
+
+func (t *UnionBucketTest) TestDeleteObject_LowerObjectIsWhitedOut() {
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "lower"})
+	require.NoError(t.T(), err)
+
+	_, err = t.stat(t.bucket, "lower")
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+	names, _ := t.list("")
+	assert.Equal(t.T(), []string{"both", "upper"}, names)
+
+	// The lower layer is untouched, and the upper layer has a whiteout.
+	_, err = t.stat(t.lower, "lower")
+	assert.NoError(t.T(), err)
+	m, err := t.stat(t.upper, "lower")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "true", m.Metadata[gcsx.WhiteoutMetadataKey])
+
+	// The name can be used again.
+	var zero int64
+	_, err = t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:                   "lower",
+		Contents:               bytes.NewReader([]byte("again")),
+		GenerationPrecondition: &zero,
+	})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "again", t.read("lower"))
+}
+
+func (t *UnionBucketTest) TestDeleteObject_BothLayers() {
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "both"})
+	require.NoError(t.T(), err)
+
+	// The lower object must not show through.
+	_, err = t.stat(t.bucket, "both")
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *UnionBucketTest) TestDeleteObject_UpperOnlyLeavesNoWhiteout() {
+	err := t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "upper"})
+	require.NoError(t.T(), err)
+
+	_, err = t.stat(t.upper, "upper")
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *UnionBucketTest) TestDeletedDirectoryStaysEmptyWhenRecreated() {
+	for _, name := range []string{"dir/sub/x", "dir/sub/", "dir/lower", "dir/upper", "dir/"} {
+		_ = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: name})
+	}
+
+	_, runs := t.list("")
+	assert.Equal(t.T(), []string{"lowerdir/"}, runs)
+
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "dir/", nil)
+	require.NoError(t.T(), err)
+
+	names, runs := t.list("dir/")
+	assert.Equal(t.T(), []string{"dir/"}, names)
+	assert.Empty(t.T(), runs)
+	_, err = t.stat(t.bucket, "dir/lower")
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *UnionBucketTest) TestUpdateObject_CopiesUp() {
+	m, err := t.stat(t.bucket, "lower")
+	require.NoError(t.T(), err)
+	value := "bar"
+
+	_, err = t.bucket.UpdateObject(t.ctx, &gcs.UpdateObjectRequest{
+		Name:       "lower",
+		Generation: m.Generation,
+		Metadata:   map[string]*string{"foo": &value},
+	})
+
+	require.NoError(t.T(), err)
+	upper, err := t.stat(t.upper, "lower")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "bar", upper.Metadata["foo"])
+	assert.Equal(t.T(), "lower", t.read("lower"))
+	lower, err := t.stat(t.lower, "lower")
+	require.NoError(t.T(), err)
+	assert.Empty(t.T(), lower.Metadata["foo"])
+}
+
+func (t *UnionBucketTest) TestComposeObjects_AppendCopiesUp() {
+	m, err := t.stat(t.bucket, "lower")
+	require.NoError(t.T(), err)
+	tmp, err := storageutil.CreateObject(t.ctx, t.bucket, unionTmpObjectPrefix+"append", []byte("+tail"))
+	require.NoError(t.T(), err)
+
+	_, err = t.bucket.ComposeObjects(t.ctx, &gcs.ComposeObjectsRequest{
+		DstName:                   "lower",
+		DstGenerationPrecondition: &m.Generation,
+		Sources: []gcs.ComposeSource{
+			{Name: "lower", Generation: m.Generation},
+			{Name: tmp.Name, Generation: tmp.Generation},
+		},
+	})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "lower+tail", t.read("lower"))
+	contents, err := storageutil.ReadObject(t.ctx, t.lower, "lower")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "lower", string(contents))
+}
+
+func (t *UnionBucketTest) TestCopyObject_FromLowerLayer() {
+	_, err := t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: "lower", DstName: "copy"})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "lower", t.read("copy"))
+	_, err = t.stat(t.upper, "copy")
+	assert.NoError(t.T(), err)
+}
+
+func (t *UnionBucketTest) TestMoveObject_FromLowerLayer() {
+	_, err := t.bucket.MoveObject(t.ctx, &gcs.MoveObjectRequest{SrcName: "lower", DstName: "moved"})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "lower", t.read("moved"))
+	_, err = t.stat(t.bucket, "lower")
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *UnionBucketTest) TestTemporaryObjectsOnlyInUpperLayer() {
+	_, err := storageutil.CreateObject(t.ctx, t.lower, unionTmpObjectPrefix+"lower", nil)
+	require.NoError(t.T(), err)
+
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: unionTmpObjectPrefix})
+
+	require.NoError(t.T(), err)
+	assert.Empty(t.T(), listing.MinObjects)
+}
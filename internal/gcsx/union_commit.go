@@ -0,0 +1,205 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// ErrCommitConflict is returned, wrapped, by CommitUpperLayer when objects in
+// the bucket beneath the upper layer have changed since they were copied up.
+var ErrCommitConflict = errors.New("changed in the bucket since being copied up")
+
+// CommitUpperLayer applies the changes held in the upper layer of a union
+// bucket (see NewUnionBucket) to the bucket beneath it, then removes them
+// from the upper layer, returning the number of objects applied. New and
+// modified objects are copied down, whiteouts delete what they hide, and
+// opaque directories have their old contents deleted first. Temporary
+// objects are left where they are.
+//
+// Each change is only applied if the object it replaces is still the
+// generation recorded when it was copied up (see LowerGenerationMetadataKey).
+// Changes to objects that have been modified or created beneath the upper
+// layer meanwhile are left in the upper layer and reported, by name, in an
+// error wrapping ErrCommitConflict, once everything else is committed.
+//
+// The union must not be in use meanwhile. A commit that fails part way
+// through can be retried, since each change is only removed from the upper
+// layer once applied.
+func CommitUpperLayer(
+	ctx context.Context,
+	upper gcs.Bucket,
+	lower gcs.Bucket,
+	tmpObjectPrefix string) (committed int, err error) {
+	listing, err := listLayer(ctx, upper, &gcs.ListObjectsRequest{})
+	if err != nil {
+		err = fmt.Errorf("ListObjects: %w", err)
+		return
+	}
+
+	// Listings are in name order, so directories are cleared out before their
+	// new contents are copied into them.
+	var conflicts []string
+	for _, o := range listing.MinObjects {
+		if tmpObjectPrefix != "" && strings.HasPrefix(o.Name, tmpObjectPrefix) {
+			continue
+		}
+
+		if err = commitObject(ctx, upper, lower, o); err != nil {
+			var preconditionErr *gcs.PreconditionError
+			if errors.As(err, &preconditionErr) {
+				logger.Warnf("Not committing %q: %v", o.Name, err)
+				conflicts = append(conflicts, o.Name)
+				err = nil
+				continue
+			}
+
+			err = fmt.Errorf("committing %q: %w", o.Name, err)
+			return
+		}
+
+		err = upper.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: o.Name, Generation: o.Generation})
+		if err != nil {
+			err = fmt.Errorf("DeleteObject(%q): %w", o.Name, err)
+			return
+		}
+
+		logger.Tracef("Committed %q to bucket %q.", o.Name, lower.Name())
+		committed++
+	}
+
+	if len(conflicts) > 0 {
+		err = fmt.Errorf("%w: %s", ErrCommitConflict, strings.Join(conflicts, ", "))
+	}
+
+	return
+}
+
+// Return the generation precondition for committing the supplied object in
+// the upper layer, or nil if none was recorded. Directories are committed
+// wholesale, so have none.
+func commitPrecondition(o *gcs.MinObject) (*int64, error) {
+	v, ok := o.Metadata[LowerGenerationMetadataKey]
+	if !ok || strings.HasSuffix(o.Name, "/") {
+		return nil, nil
+	}
+
+	g, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", LowerGenerationMetadataKey, err)
+	}
+
+	return &g, nil
+}
+
+func commitObject(ctx context.Context, upper gcs.Bucket, lower gcs.Bucket, o *gcs.MinObject) error {
+	precondition, err := commitPrecondition(o)
+	if err != nil {
+		return err
+	}
+
+	if masksLowerLayers(o) {
+		if err = deletePrefix(ctx, lower, o.Name); err != nil {
+			return err
+		}
+	}
+
+	if isWhiteout(o) {
+		return deleteGeneration(ctx, lower, o.Name, precondition)
+	}
+
+	var metadata map[string]string
+	for k, v := range o.Metadata {
+		if k == OpaqueMetadataKey || k == LowerGenerationMetadataKey {
+			continue
+		}
+
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata[k] = v
+	}
+
+	_, err = copyBetweenBuckets(ctx, upper, o, nil, lower, o.Name, metadata, precondition)
+	return err
+}
+
+// Delete the named object if it is at the supplied generation, or whatever
+// generation it is at if nil. Returns a precondition error if it exists at any
+// other generation, 0 standing for none.
+func deleteGeneration(ctx context.Context, b gcs.Bucket, name string, generation *int64) error {
+	if generation == nil {
+		return deleteIgnoringNotFound(ctx, b, name)
+	}
+
+	if *generation != 0 {
+		err := b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: name, Generation: *generation})
+		var notFoundErr *gcs.NotFoundError
+		if !errors.As(err, &notFoundErr) {
+			return err
+		}
+	}
+
+	// Either there was nothing to delete, or the generation is gone, whether
+	// deleted or replaced.
+	m, _, err := statLayer(ctx, b, &gcs.StatObjectRequest{Name: name})
+	if err != nil {
+		return fmt.Errorf("StatObject(%q): %w", name, err)
+	}
+
+	if m != nil {
+		return &gcs.PreconditionError{Err: fmt.Errorf("object %q is at generation %d, not %d", name, m.Generation, *generation)}
+	}
+
+	return nil
+}
+
+// Delete every object in the bucket whose name begins with the supplied
+// prefix.
+func deletePrefix(ctx context.Context, b gcs.Bucket, prefix string) error {
+	listing, err := listLayer(ctx, b, &gcs.ListObjectsRequest{Prefix: prefix})
+	if err != nil {
+		return fmt.Errorf("ListObjects: %w", err)
+	}
+
+	for _, o := range listing.MinObjects {
+		if err = deleteIgnoringNotFound(ctx, b, o.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deleteIgnoringNotFound(ctx context.Context, b gcs.Bucket, name string) error {
+	err := b.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: name})
+	var notFoundErr *gcs.NotFoundError
+	if errors.As(err, &notFoundErr) {
+		err = nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("DeleteObject(%q): %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (t *UnionBucketTest) listAll(b gcs.Bucket) (names []string) {
+	listing, err := b.ListObjects(t.ctx, &gcs.ListObjectsRequest{})
+	require.NoError(t.T(), err)
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+	}
+
+	return
+}
+
+func (t *UnionBucketTest) TestCommitUpperLayer() {
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "new", []byte("new"))
+	require.NoError(t.T(), err)
+	require.NoError(t.T(), t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "lower"}))
+	for _, name := range []string{"dir/sub/x", "dir/sub/", "dir/lower", "dir/upper", "dir/"} {
+		_ = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: name})
+	}
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, "dir/", nil)
+	require.NoError(t.T(), err)
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, unionTmpObjectPrefix+"tmp", nil)
+	require.NoError(t.T(), err)
+	expected := t.listAll(t.bucket)
+
+	_, err = gcsx.CommitUpperLayer(t.ctx, t.upper, t.lower, unionTmpObjectPrefix)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), []string{"both", "dir/", "lowerdir/y", "new", "upper"}, t.listAll(t.lower))
+	assert.Equal(t.T(), []string{unionTmpObjectPrefix + "tmp"}, t.listAll(t.upper))
+	// The union looks the same, apart from temporary objects.
+	assert.Equal(t.T(), expected[1:], t.listAll(t.bucket))
+	assert.Equal(t.T(), "upper", t.read("both"))
+	m, _, err := t.lower.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/"})
+	require.NoError(t.T(), err)
+	assert.Empty(t.T(), m.Metadata[gcsx.OpaqueMetadataKey])
+}
+
+func (t *UnionBucketTest) TestCommitUpperLayerReportsConflicts() {
+	// Copy up an object, and modify it beneath the upper layer meanwhile.
+	_, err := storageutil.CreateObject(t.ctx, t.bucket, "lower", []byte("ours"))
+	require.NoError(t.T(), err)
+	_, err = storageutil.CreateObject(t.ctx, t.lower, "lower", []byte("theirs"))
+	require.NoError(t.T(), err)
+	// Create an object, which is created beneath the upper layer too.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, "new", []byte("ours"))
+	require.NoError(t.T(), err)
+	_, err = storageutil.CreateObject(t.ctx, t.lower, "new", []byte("theirs"))
+	require.NoError(t.T(), err)
+	// Delete an object that is left alone beneath.
+	require.NoError(t.T(), t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "lowerdir/y"}))
+
+	_, err = gcsx.CommitUpperLayer(t.ctx, t.upper, t.lower, unionTmpObjectPrefix)
+
+	assert.ErrorIs(t.T(), err, gcsx.ErrCommitConflict)
+	assert.ErrorContains(t.T(), err, "lower, new")
+	contents, err := storageutil.ReadObject(t.ctx, t.lower, "lower")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "theirs", string(contents))
+	contents, err = storageutil.ReadObject(t.ctx, t.lower, "new")
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "theirs", string(contents))
+	// The conflicting changes are kept, and the others committed.
+	assert.Contains(t.T(), t.listAll(t.upper), "lower")
+	assert.Contains(t.T(), t.listAll(t.upper), "new")
+	assert.NotContains(t.T(), t.listAll(t.lower), "lowerdir/y")
+}
@@ -0,0 +1,61 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"errors"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// UpperLayer is implemented by buckets whose changes are kept in a local
+// directory (see BucketConfig.LocalUpperDir), so that files can be copied up
+// into it directly instead of being written to a temporary file and then
+// copied again into the bucket.
+type UpperLayer interface {
+	// StagingDir returns the directory in which to write files passed to
+	// CreateObjectFromFile, or "" if the bucket has no local upper layer.
+	StagingDir() string
+
+	// CreateObjectFromFile creates an object like CreateObject, except that
+	// its contents are those of the named file in StagingDir, which is moved
+	// into the upper layer rather than copied. The file is left alone if a
+	// precondition isn't met.
+	CreateObjectFromFile(ctx context.Context, req *gcs.CreateObjectRequest, path string) (*gcs.Object, error)
+}
+
+var errNoUpperLayer = errors.New("bucket has no local upper layer")
+
+// Return the staging directory of the supplied bucket if it is an upper
+// layer, or "" otherwise. For use by wrappers passing UpperLayer on.
+func stagingDir(b gcs.Bucket) string {
+	if ul, ok := b.(UpperLayer); ok {
+		return ul.StagingDir()
+	}
+
+	return ""
+}
+
+// Call through to CreateObjectFromFile of the supplied bucket, if it is an
+// upper layer. For use by wrappers passing UpperLayer on.
+func createObjectFromFile(ctx context.Context, b gcs.Bucket, req *gcs.CreateObjectRequest, path string) (*gcs.Object, error) {
+	ul, ok := b.(UpperLayer)
+	if !ok {
+		return nil, errNoUpperLayer
+	}
+
+	return ul.CreateObjectFromFile(ctx, req, path)
+}
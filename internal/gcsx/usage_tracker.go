@@ -0,0 +1,146 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/logger"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"golang.org/x/net/context"
+	"golang.org/x/sync/errgroup"
+)
+
+// Usage is a snapshot of the space used by the objects in a bucket.
+type Usage struct {
+	// The total size in bytes of all objects.
+	Bytes uint64
+
+	// The number of objects.
+	Objects uint64
+
+	// The time at which the listing that produced the snapshot finished, or the
+	// zero time if no listing has finished yet.
+	Time time.Time
+}
+
+// UsageTracker aggregates the space used by a bucket from periodic listings of
+// all of its objects. When the bucket is a prefix bucket (e.g. for --only-dir
+// mounts), only the objects under the prefix are counted.
+//
+// Safe for concurrent access.
+type UsageTracker struct {
+	bucket gcs.Bucket
+
+	mu sync.Mutex
+
+	// GUARDED_BY(mu)
+	usage Usage
+}
+
+// NewUsageTracker creates a tracker for the supplied bucket. It reports zero
+// usage until Refresh or Run has completed a listing.
+func NewUsageTracker(bucket gcs.Bucket) *UsageTracker {
+	return &UsageTracker{
+		bucket: bucket,
+	}
+}
+
+// Usage returns the result of the most recent successful listing.
+func (t *UsageTracker) Usage() Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.usage
+}
+
+// Refresh lists the whole bucket, replacing the usage on success.
+func (t *UsageTracker) Refresh(ctx context.Context) (err error) {
+	group, ctx := errgroup.WithContext(ctx)
+
+	// List all objects.
+	minObjects := make(chan *gcs.MinObject, 100)
+	group.Go(func() (err error) {
+		defer close(minObjects)
+		err = storageutil.ListPrefix(ctx, t.bucket, "", minObjects)
+		if err != nil {
+			err = fmt.Errorf("ListPrefix: %w", err)
+			return
+		}
+
+		return
+	})
+
+	// Sum them up.
+	var usage Usage
+	group.Go(func() (err error) {
+		for o := range minObjects {
+			usage.Bytes += o.Size
+			usage.Objects++
+		}
+
+		return
+	})
+
+	err = group.Wait()
+	if err != nil {
+		return
+	}
+
+	usage.Time = time.Now()
+	t.mu.Lock()
+	t.usage = usage
+	t.mu.Unlock()
+
+	return
+}
+
+// Run refreshes the usage immediately and then with the given period, until
+// the context is cancelled. Failed refreshes are logged and leave the previous
+// usage in place.
+func (t *UsageTracker) Run(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		startTime := time.Now()
+		err := t.Refresh(ctx)
+
+		if err != nil {
+			logger.Warnf(
+				"Usage refresh for bucket %q failed after %v, with error: %v",
+				t.bucket.Name(),
+				time.Since(startTime),
+				err)
+		} else {
+			usage := t.Usage()
+			logger.Tracef(
+				"Usage refresh for bucket %q found %d objects totalling %d bytes in %v.",
+				t.bucket.Name(),
+				usage.Objects,
+				usage.Bytes,
+				time.Since(startTime))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type UsageTrackerTest struct {
+	suite.Suite
+	ctx    context.Context
+	bucket gcs.Bucket
+}
+
+func TestUsageTracker(t *testing.T) {
+	suite.Run(t, new(UsageTrackerTest))
+}
+
+func (t *UsageTrackerTest) SetupTest() {
+	t.ctx = context.Background()
+	t.bucket = fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+}
+
+func (t *UsageTrackerTest) createObjects(contents map[string]string) {
+	for name, c := range contents {
+		_, err := storageutil.CreateObject(t.ctx, t.bucket, name, []byte(c))
+		require.NoError(t.T(), err)
+	}
+}
+
+func (t *UsageTrackerTest) TestInitialUsageIsZero() {
+	t.createObjects(map[string]string{"foo": "taco"})
+
+	usage := gcsx.NewUsageTracker(t.bucket).Usage()
+
+	assert.Equal(t.T(), gcsx.Usage{}, usage)
+}
+
+func (t *UsageTrackerTest) TestRefresh() {
+	t.createObjects(map[string]string{
+		"foo":     "taco",
+		"dir/":    "",
+		"dir/bar": "burrito",
+	})
+	tracker := gcsx.NewUsageTracker(t.bucket)
+
+	err := tracker.Refresh(t.ctx)
+
+	require.NoError(t.T(), err)
+	usage := tracker.Usage()
+	assert.Equal(t.T(), uint64(len("taco")+len("burrito")), usage.Bytes)
+	assert.Equal(t.T(), uint64(3), usage.Objects)
+	assert.False(t.T(), usage.Time.IsZero())
+}
+
+func (t *UsageTrackerTest) TestRefreshOnlyCountsPrefix() {
+	t.createObjects(map[string]string{
+		"foo_bar": "taco",
+		"baz":     "burrito",
+	})
+	prefixBucket, err := gcsx.NewPrefixBucket("foo_", t.bucket)
+	require.NoError(t.T(), err)
+	tracker := gcsx.NewUsageTracker(prefixBucket)
+
+	err = tracker.Refresh(t.ctx)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(len("taco")), tracker.Usage().Bytes)
+	assert.Equal(t.T(), uint64(1), tracker.Usage().Objects)
+}
+
+func (t *UsageTrackerTest) TestRunRefreshesImmediately() {
+	t.createObjects(map[string]string{"foo": "taco"})
+	tracker := gcsx.NewUsageTracker(t.bucket)
+	ctx, cancel := context.WithCancel(t.ctx)
+	defer cancel()
+
+	go tracker.Run(ctx, time.Hour)
+
+	assert.Eventually(t.T(), func() bool {
+		return tracker.Usage().Objects == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
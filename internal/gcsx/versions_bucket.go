@@ -0,0 +1,382 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"golang.org/x/net/context"
+)
+
+// VersionsDirSuffix is appended to the name of an object to get the name of
+// the virtual directory holding its noncurrent generations.
+const VersionsDirSuffix = "@versions"
+
+// NewVersionsBucket creates a wrapper bucket that exposes the noncurrent
+// generations of each object, in buckets with object versioning enabled, as
+// the contents of a virtual directory named after the object with
+// VersionsDirSuffix appended. The directories are never listed, but can be
+// looked up by name. Each generation is a read-only object named after its
+// generation number and Updated time, e.g.
+//
+//	foo.txt@versions/1700000000000000@2023-11-14T22:13:20Z
+//
+// and reads and copies of it are served from that generation, so a version
+// can be restored by copying it over the live name. Versions can't be moved,
+// since that would delete them. Real objects whose names contain
+// VersionsDirSuffix followed by a slash are hidden: they aren't listed and
+// can't be looked up.
+func NewVersionsBucket(b gcs.Bucket) gcs.Bucket {
+	return versionsBucket{b}
+}
+
+type versionsBucket struct {
+	gcs.Bucket
+}
+
+// If the supplied name lies within a versions directory, return the name of
+// the object whose versions it holds and the remainder of the name.
+func splitVersionsName(name string) (objectName string, rest string, ok bool) {
+	i := strings.Index(name, VersionsDirSuffix+"/")
+	if i < 0 {
+		return
+	}
+
+	return name[:i], name[i+len(VersionsDirSuffix)+1:], true
+}
+
+func versionFileName(o *gcs.MinObject) string {
+	return fmt.Sprintf("%d@%s", o.Generation, o.Updated.UTC().Format(time.RFC3339))
+}
+
+// Parse the generation out of the name of a version file.
+func versionGeneration(rest string) (generation int64, ok bool) {
+	i := strings.Index(rest, "@")
+	if i < 0 {
+		return
+	}
+
+	generation, err := strconv.ParseInt(rest[:i], 10, 64)
+	ok = err == nil
+	return
+}
+
+func (b versionsBucket) readOnly(op string, name string) error {
+	return fmt.Errorf("%s(%q): versions are read-only: %w", op, name, syscall.EROFS)
+}
+
+func isVersionsName(names ...string) bool {
+	for _, name := range names {
+		if _, _, ok := splitVersionsName(name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Return the noncurrent generations of the named object, in increasing order
+// of generation, renamed to their names within its versions directory.
+func (b versionsBucket) listVersions(ctx context.Context, objectName string) (versions []*gcs.MinObject, err error) {
+	dirName := objectName + VersionsDirSuffix + "/"
+
+	// Listings come sorted by name, and no name with the object's name as a
+	// prefix comes before it, so stop at the first other name. Collapse the
+	// contents of a directory of the same name into a single entry.
+	req := &gcs.ListObjectsRequest{
+		Prefix:    objectName,
+		Delimiter: "/",
+		Versions:  true,
+	}
+
+	for {
+		var listing *gcs.Listing
+		listing, err = b.Bucket.ListObjects(ctx, req)
+		if err != nil {
+			return
+		}
+
+		if len(listing.VersionLifetimes) != len(listing.MinObjects) {
+			err = fmt.Errorf("listing of bucket %q has no version lifetimes", b.Name())
+			return
+		}
+
+		for i, o := range listing.MinObjects {
+			if o.Name != objectName {
+				break
+			}
+
+			if listing.VersionLifetimes[i].Deleted.IsZero() {
+				continue
+			}
+
+			version := *o
+			version.Name = dirName + versionFileName(o)
+			versions = append(versions, &version)
+		}
+
+		done := listing.ContinuationToken == ""
+		if n := len(listing.MinObjects); n > 0 && listing.MinObjects[n-1].Name != objectName {
+			done = true
+		}
+
+		if done {
+			break
+		}
+
+		req.ContinuationToken = listing.ContinuationToken
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Generation < versions[j].Generation })
+	return
+}
+
+func (b versionsBucket) StatObject(
+	ctx context.Context,
+	req *gcs.StatObjectRequest) (m *gcs.MinObject, extendedAttrs *gcs.ExtendedObjectAttributes, err error) {
+	objectName, rest, ok := splitVersionsName(req.Name)
+	if !ok {
+		return b.Bucket.StatObject(ctx, req)
+	}
+
+	versions, err := b.listVersions(ctx, objectName)
+	if err != nil {
+		return
+	}
+
+	if rest == "" && len(versions) > 0 {
+		// The directory exists as long as there are versions in it.
+		latest := versions[len(versions)-1]
+		m = &gcs.MinObject{
+			Name:           req.Name,
+			Generation:     1,
+			MetaGeneration: 1,
+			Updated:        latest.Updated,
+		}
+	}
+
+	for _, v := range versions {
+		if v.Name == req.Name {
+			m = v
+			break
+		}
+	}
+
+	if m == nil {
+		err = &gcs.NotFoundError{Err: fmt.Errorf("object %q not found", req.Name)}
+		return
+	}
+
+	if req.ReturnExtendedObjectAttributes {
+		extendedAttrs = &gcs.ExtendedObjectAttributes{}
+	}
+
+	return
+}
+
+func (b versionsBucket) ListObjects(
+	ctx context.Context,
+	req *gcs.ListObjectsRequest) (listing *gcs.Listing, err error) {
+	objectName, _, ok := splitVersionsName(req.Prefix)
+	if !ok {
+		if listing, err = b.Bucket.ListObjects(ctx, req); err != nil {
+			return
+		}
+
+		hideVersionsNames(listing)
+		return
+	}
+
+	versions, err := b.listVersions(ctx, objectName)
+	if err != nil {
+		return
+	}
+
+	// Version files have no slashes in their names, so there is nothing to
+	// collapse.
+	listing = &gcs.Listing{}
+	for _, v := range versions {
+		if strings.HasPrefix(v.Name, req.Prefix) && v.Name != req.Prefix {
+			listing.MinObjects = append(listing.MinObjects, v)
+		}
+	}
+
+	sort.Slice(listing.MinObjects, func(i, j int) bool { return listing.MinObjects[i].Name < listing.MinObjects[j].Name })
+	return
+}
+
+// Remove the real objects and collapsed runs shadowed by versions directories
+// from the supplied listing.
+func hideVersionsNames(listing *gcs.Listing) {
+	objects := listing.MinObjects[:0]
+	var lifetimes []gcs.VersionLifetime
+	for i, o := range listing.MinObjects {
+		if isVersionsName(o.Name) {
+			continue
+		}
+
+		objects = append(objects, o)
+		if len(listing.VersionLifetimes) > 0 {
+			lifetimes = append(lifetimes, listing.VersionLifetimes[i])
+		}
+	}
+
+	runs := listing.CollapsedRuns[:0]
+	for _, run := range listing.CollapsedRuns {
+		if !isVersionsName(run) {
+			runs = append(runs, run)
+		}
+	}
+
+	listing.MinObjects, listing.CollapsedRuns = objects, runs
+	if len(listing.VersionLifetimes) > 0 {
+		listing.VersionLifetimes = lifetimes
+	}
+}
+
+// Return the object and generation that reads of the named version file are
+// served from.
+func (b versionsBucket) versionReadTarget(name string) (objectName string, generation int64, err error) {
+	objectName, rest, _ := splitVersionsName(name)
+	generation, ok := versionGeneration(rest)
+	if !ok {
+		err = &gcs.NotFoundError{Err: fmt.Errorf("object %q not found", name)}
+	}
+
+	return
+}
+
+func (b versionsBucket) NewReaderWithReadHandle(
+	ctx context.Context,
+	req *gcs.ReadObjectRequest) (gcs.StorageReader, error) {
+	if !isVersionsName(req.Name) {
+		return b.Bucket.NewReaderWithReadHandle(ctx, req)
+	}
+
+	objectName, generation, err := b.versionReadTarget(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	mReq := new(gcs.ReadObjectRequest)
+	*mReq = *req
+	mReq.Name = objectName
+	mReq.Generation = generation
+	return b.Bucket.NewReaderWithReadHandle(ctx, mReq)
+}
+
+func (b versionsBucket) NewMultiRangeDownloader(
+	ctx context.Context,
+	req *gcs.MultiRangeDownloaderRequest) (gcs.MultiRangeDownloader, error) {
+	if !isVersionsName(req.Name) {
+		return b.Bucket.NewMultiRangeDownloader(ctx, req)
+	}
+
+	objectName, generation, err := b.versionReadTarget(req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	mReq := new(gcs.MultiRangeDownloaderRequest)
+	*mReq = *req
+	mReq.Name = objectName
+	mReq.Generation = generation
+	return b.Bucket.NewMultiRangeDownloader(ctx, mReq)
+}
+
+func (b versionsBucket) CreateObject(ctx context.Context, req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	if isVersionsName(req.Name) {
+		return nil, b.readOnly("CreateObject", req.Name)
+	}
+
+	return b.Bucket.CreateObject(ctx, req)
+}
+
+func (b versionsBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	if isVersionsName(req.Name) {
+		return nil, b.readOnly("CreateObjectChunkWriter", req.Name)
+	}
+
+	return b.Bucket.CreateObjectChunkWriter(ctx, req, chunkSize, callBack)
+}
+
+func (b versionsBucket) CopyObject(ctx context.Context, req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	if isVersionsName(req.DstName) {
+		return nil, b.readOnly("CopyObject", req.DstName)
+	}
+
+	if !isVersionsName(req.SrcName) {
+		return b.Bucket.CopyObject(ctx, req)
+	}
+
+	// Copy the generation the version stands for, e.g. to restore it.
+	objectName, generation, err := b.versionReadTarget(req.SrcName)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.SrcGeneration != 0 && req.SrcGeneration != generation {
+		return nil, &gcs.NotFoundError{Err: fmt.Errorf("object %q not found at generation %d", req.SrcName, req.SrcGeneration)}
+	}
+
+	mReq := new(gcs.CopyObjectRequest)
+	*mReq = *req
+	mReq.SrcName = objectName
+	mReq.SrcGeneration = generation
+	return b.Bucket.CopyObject(ctx, mReq)
+}
+
+func (b versionsBucket) ComposeObjects(ctx context.Context, req *gcs.ComposeObjectsRequest) (*gcs.Object, error) {
+	names := []string{req.DstName}
+	for _, src := range req.Sources {
+		names = append(names, src.Name)
+	}
+
+	if isVersionsName(names...) {
+		return nil, b.readOnly("ComposeObjects", req.DstName)
+	}
+
+	return b.Bucket.ComposeObjects(ctx, req)
+}
+
+func (b versionsBucket) UpdateObject(ctx context.Context, req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	if isVersionsName(req.Name) {
+		return nil, b.readOnly("UpdateObject", req.Name)
+	}
+
+	return b.Bucket.UpdateObject(ctx, req)
+}
+
+func (b versionsBucket) DeleteObject(ctx context.Context, req *gcs.DeleteObjectRequest) error {
+	if isVersionsName(req.Name) {
+		return b.readOnly("DeleteObject", req.Name)
+	}
+
+	return b.Bucket.DeleteObject(ctx, req)
+}
+
+func (b versionsBucket) MoveObject(ctx context.Context, req *gcs.MoveObjectRequest) (*gcs.Object, error) {
+	if isVersionsName(req.SrcName, req.DstName) {
+		return nil, b.readOnly("MoveObject", req.SrcName)
+	}
+
+	return b.Bucket.MoveObject(ctx, req)
+}
@@ -0,0 +1,203 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gcsx_test
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/gcsx"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/fake"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/jacobsa/timeutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+type VersionsBucketTest struct {
+	suite.Suite
+	ctx       context.Context
+	now       time.Time
+	versioned *versionedBucket
+	bucket    gcs.Bucket
+}
+
+func TestVersionsBucket(t *testing.T) {
+	suite.Run(t, new(VersionsBucketTest))
+}
+
+func (t *VersionsBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.now = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	t.versioned = &versionedBucket{
+		Bucket:   fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{}),
+		pageSize: 2,
+	}
+	t.bucket = gcsx.NewVersionsBucket(t.versioned)
+
+	// Versions in listing order: by name, then generation.
+	t.addVersion("dir/foo", 1, true)
+	t.addVersion("dir/foo", 2, true)
+	t.addVersion("dir/foo", 3, false)
+	t.addVersion("dir/foobar", 4, true)
+	t.addVersion("dir/qux", 5, false)
+}
+
+// Add a version, updated as many hours before now as its generation is less
+// than 10.
+func (t *VersionsBucketTest) addVersion(name string, generation int64, noncurrent bool) {
+	updated := t.now.Add(-time.Duration(10-generation) * time.Hour)
+	lifetime := gcs.VersionLifetime{Created: updated}
+	if noncurrent {
+		lifetime.Deleted = updated.Add(time.Minute)
+	}
+
+	t.versioned.versions = append(t.versioned.versions, &gcs.MinObject{
+		Name:       name,
+		Generation: generation,
+		Size:       uint64(generation),
+		Updated:    updated,
+	})
+	t.versioned.lifetimes = append(t.versioned.lifetimes, lifetime)
+}
+
+func (t *VersionsBucketTest) TestStatObject_Dir() {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/foo@versions/"})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "dir/foo@versions/", m.Name)
+}
+
+func (t *VersionsBucketTest) TestStatObject_DirWithoutNoncurrentVersions() {
+	_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/qux@versions/"})
+
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *VersionsBucketTest) TestListObjects() {
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: "dir/foo@versions/", Delimiter: "/"})
+
+	require.NoError(t.T(), err)
+	var names []string
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+	}
+	assert.Equal(
+		t.T(),
+		[]string{
+			"dir/foo@versions/1@2024-12-31T15:00:00Z",
+			"dir/foo@versions/2@2024-12-31T16:00:00Z",
+		},
+		names)
+	assert.Empty(t.T(), listing.ContinuationToken)
+}
+
+func (t *VersionsBucketTest) TestStatObject_Version() {
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/foo@versions/2@2024-12-31T16:00:00Z"})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), int64(2), m.Generation)
+	assert.Equal(t.T(), uint64(2), m.Size)
+}
+
+func (t *VersionsBucketTest) TestStatObject_ListsOnlyUpToOtherNames() {
+	_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/foo@versions/"})
+
+	require.NoError(t.T(), err)
+	// The second page ends with a version of "dir/foobar", so the versions of
+	// "dir/qux" aren't listed.
+	assert.Equal(t.T(), 2, t.versioned.listed)
+}
+
+func (t *VersionsBucketTest) TestStatObject_CurrentVersionIsNotListed() {
+	_, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/foo@versions/3@2024-12-31T17:00:00Z"})
+
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *VersionsBucketTest) TestReadsAreRedirected() {
+	_, _ = t.bucket.NewReaderWithReadHandle(t.ctx, &gcs.ReadObjectRequest{Name: "dir/foo@versions/1@2024-12-31T15:00:00Z"})
+
+	assert.Equal(t.T(), "dir/foo", t.versioned.readName)
+	assert.Equal(t.T(), int64(1), t.versioned.readGeneration)
+}
+
+func (t *VersionsBucketTest) TestMutationsFail() {
+	version := "dir/foo@versions/1@2024-12-31T15:00:00Z"
+
+	_, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{Name: "dir/foo@versions/bar", Contents: strings.NewReader("")})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	err = t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: version})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+
+	_, err = t.bucket.MoveObject(t.ctx, &gcs.MoveObjectRequest{SrcName: version, DstName: "dir/foo"})
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+}
+
+func (t *VersionsBucketTest) TestCopyObject_RestoresVersion() {
+	_, err := t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{
+		SrcName:       "dir/foo@versions/1@2024-12-31T15:00:00Z",
+		SrcGeneration: 1,
+		DstName:       "dir/foo",
+	})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "dir/foo", t.versioned.copied.SrcName)
+	assert.Equal(t.T(), int64(1), t.versioned.copied.SrcGeneration)
+	assert.Equal(t.T(), "dir/foo", t.versioned.copied.DstName)
+}
+
+func (t *VersionsBucketTest) TestCopyObject_IntoVersionsFails() {
+	_, err := t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: "dir/qux", DstName: "dir/foo@versions/bar"})
+
+	assert.ErrorIs(t.T(), err, syscall.EROFS)
+}
+
+func TestVersionsBucket_RealVersionsNamesAreHidden(t *testing.T) {
+	ctx := context.Background()
+	wrapped := fake.NewFakeBucket(timeutil.RealClock(), "some_bucket", gcs.BucketType{})
+	require.NoError(t, storageutil.CreateObjects(ctx, wrapped, map[string][]byte{
+		"foo":              nil,
+		"foo@versions/bar": nil,
+		"foo@versions":     nil,
+	}))
+	bucket := gcsx.NewVersionsBucket(wrapped)
+
+	listing, err := bucket.ListObjects(ctx, &gcs.ListObjectsRequest{Delimiter: "/"})
+
+	require.NoError(t, err)
+	var names []string
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+	}
+	assert.Equal(t, []string{"foo", "foo@versions"}, names)
+	assert.Empty(t, listing.CollapsedRuns)
+}
+
+func (t *VersionsBucketTest) TestOtherNamesPassThrough() {
+	_, err := t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{Name: "dir/foo@versions", Contents: strings.NewReader("")})
+	require.NoError(t.T(), err)
+
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "dir/foo@versions"})
+	assert.NoError(t.T(), err)
+}
@@ -0,0 +1,184 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Per-path overrides of mount-wide settings, read from a rules file.
+package policy
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/viper"
+)
+
+// Overrides holds the settings a rule can override. A nil field leaves the
+// mount-wide setting in force. FileCache can only turn the file cache off,
+// since there is none to turn on unless the mount has one.
+type Overrides struct {
+	StatCacheTtlSecs      *int64  `yaml:"stat-cache-ttl-secs"`
+	FileCache             *bool   `yaml:"file-cache"`
+	CacheFileForRangeRead *bool   `yaml:"cache-file-for-range-read"`
+	StreamingWrites       *bool   `yaml:"streaming-writes"`
+	ReadOnly              *bool   `yaml:"read-only"`
+	ContentType           *string `yaml:"content-type"`
+}
+
+// Rule applies its overrides to the objects whose names start with Prefix or
+// match Glob, exactly one of which must be set. A glob without a slash is
+// matched against the last component of the name, and otherwise against the
+// whole name, using the syntax of path.Match.
+type Rule struct {
+	Prefix string `yaml:"prefix"`
+	Glob   string `yaml:"glob"`
+
+	Overrides `yaml:",squash"`
+}
+
+func (r *Rule) matches(objectName string) bool {
+	if r.Glob == "" {
+		return strings.HasPrefix(objectName, r.Prefix)
+	}
+
+	name := strings.TrimSuffix(objectName, "/")
+	if !strings.Contains(r.Glob, "/") {
+		name = path.Base(name)
+	}
+
+	// The pattern was checked when the rules were loaded.
+	matched, _ := path.Match(r.Glob, name)
+	return matched
+}
+
+// Rules is an ordered list of rules. A nil *Rules has no rules.
+type Rules struct {
+	rules []Rule
+}
+
+// NewRules checks the supplied rules and returns them as a Rules.
+func NewRules(rules []Rule) (*Rules, error) {
+	for i, r := range rules {
+		if (r.Prefix == "") == (r.Glob == "") {
+			return nil, fmt.Errorf("rule %d: exactly one of prefix and glob must be set", i)
+		}
+
+		if _, err := path.Match(r.Glob, ""); err != nil {
+			return nil, fmt.Errorf("rule %d: glob %q: %w", i, r.Glob, err)
+		}
+
+		if r.StatCacheTtlSecs != nil && *r.StatCacheTtlSecs < -1 {
+			return nil, fmt.Errorf("rule %d: stat-cache-ttl-secs must be -1 or more", i)
+		}
+	}
+
+	return &Rules{rules: rules}, nil
+}
+
+// Load reads the YAML rules file at the given path, which holds a list of
+// rules under the key "rules".
+func Load(rulesFile string) (*Rules, error) {
+	v := viper.New()
+	v.SetConfigFile(rulesFile)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("error while reading the rules: %w", err)
+	}
+
+	var file struct {
+		Rules []Rule `yaml:"rules"`
+	}
+	if err := v.Unmarshal(&file, func(decoderConfig *mapstructure.DecoderConfig) {
+		decoderConfig.TagName = "yaml"
+		decoderConfig.ErrorUnused = true
+	}); err != nil {
+		return nil, fmt.Errorf("error while parsing the rules: %w", err)
+	}
+
+	return NewRules(file.Rules)
+}
+
+// Match returns the overrides for the named object. Every matching rule is
+// applied in order, so a later rule wins over an earlier one for the settings
+// they both set.
+func (rs *Rules) Match(objectName string) (o Overrides) {
+	if rs == nil {
+		return
+	}
+
+	for i := range rs.rules {
+		r := &rs.rules[i]
+		if !r.matches(objectName) {
+			continue
+		}
+
+		if r.StatCacheTtlSecs != nil {
+			o.StatCacheTtlSecs = r.StatCacheTtlSecs
+		}
+		if r.FileCache != nil {
+			o.FileCache = r.FileCache
+		}
+		if r.CacheFileForRangeRead != nil {
+			o.CacheFileForRangeRead = r.CacheFileForRangeRead
+		}
+		if r.StreamingWrites != nil {
+			o.StreamingWrites = r.StreamingWrites
+		}
+		if r.ReadOnly != nil {
+			o.ReadOnly = r.ReadOnly
+		}
+		if r.ContentType != nil {
+			o.ContentType = r.ContentType
+		}
+	}
+
+	return
+}
+
+// ContentType returns the content type given to new objects with the supplied
+// name, or "" if no rule sets one.
+func (rs *Rules) ContentType(objectName string) string {
+	if ct := rs.Match(objectName).ContentType; ct != nil {
+		return *ct
+	}
+
+	return ""
+}
+
+// StatCacheTTL returns the stat cache TTL, falling back to the supplied one.
+// As with the mount-wide setting, -1 means no expiry.
+func (o Overrides) StatCacheTTL(fallback time.Duration) time.Duration {
+	if o.StatCacheTtlSecs == nil {
+		return fallback
+	}
+
+	ttlSecs := *o.StatCacheTtlSecs
+	if ttlSecs == -1 {
+		ttlSecs = math.MaxInt64 / int64(time.Second)
+	}
+
+	return time.Duration(ttlSecs) * time.Second
+}
+
+// Bool returns the value of the supplied override, falling back to the
+// supplied value if it is unset.
+func Bool(override *bool, fallback bool) bool {
+	if override == nil {
+		return fallback
+	}
+
+	return *override
+}
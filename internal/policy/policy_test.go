@@ -0,0 +1,135 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/policy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rulesYAML = `
+rules:
+  - prefix: logs/
+    stat-cache-ttl-secs: 0
+    file-cache: false
+  - glob: "*.mp4"
+    cache-file-for-range-read: true
+    content-type: video/mp4
+  - glob: "logs/archive/*"
+    read-only: true
+    stat-cache-ttl-secs: -1
+`
+
+func loadRules(t *testing.T, contents string) (*policy.Rules, error) {
+	t.Helper()
+	rulesFile := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(rulesFile, []byte(contents), 0600))
+
+	return policy.Load(rulesFile)
+}
+
+func TestLoadAndMatch(t *testing.T) {
+	rules, err := loadRules(t, rulesYAML)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		objectName   string
+		fileCache    bool
+		rangeRead    bool
+		readOnly     bool
+		statCacheTTL time.Duration
+		contentType  string
+	}{
+		{
+			name:         "NoMatch",
+			objectName:   "data/a.txt",
+			fileCache:    true,
+			statCacheTTL: time.Minute,
+		},
+		{
+			name:         "Prefix",
+			objectName:   "logs/today.txt",
+			statCacheTTL: 0,
+		},
+		{
+			name:         "GlobOnBaseName",
+			objectName:   "videos/clip.mp4",
+			fileCache:    true,
+			rangeRead:    true,
+			statCacheTTL: time.Minute,
+			contentType:  "video/mp4",
+		},
+		{
+			name:         "LaterRulesWin",
+			objectName:   "logs/archive/old.mp4",
+			rangeRead:    true,
+			readOnly:     true,
+			statCacheTTL: time.Duration(1<<63 - 1).Truncate(time.Second),
+			contentType:  "video/mp4",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := rules.Match(tc.objectName)
+
+			assert.Equal(t, tc.fileCache, policy.Bool(o.FileCache, true))
+			assert.Equal(t, tc.rangeRead, policy.Bool(o.CacheFileForRangeRead, false))
+			assert.Equal(t, tc.readOnly, policy.Bool(o.ReadOnly, false))
+			assert.Equal(t, tc.statCacheTTL, o.StatCacheTTL(time.Minute))
+			assert.Equal(t, tc.contentType, rules.ContentType(tc.objectName))
+		})
+	}
+}
+
+func TestNilRulesMatchNothing(t *testing.T) {
+	var rules *policy.Rules
+
+	assert.Equal(t, policy.Overrides{}, rules.Match("foo"))
+}
+
+func TestLoad_UnknownSetting(t *testing.T) {
+	_, err := loadRules(t, "rules:\n  - prefix: a/\n    no-such-setting: true\n")
+
+	assert.Error(t, err)
+}
+
+func TestNewRules_Invalid(t *testing.T) {
+	negative := int64(-2)
+	testCases := []struct {
+		name string
+		rule policy.Rule
+	}{
+		{name: "NoPattern", rule: policy.Rule{}},
+		{name: "BothPatterns", rule: policy.Rule{Prefix: "a/", Glob: "*.txt"}},
+		{name: "BadGlob", rule: policy.Rule{Glob: "[a"}},
+		{name: "BadTTL", rule: policy.Rule{Prefix: "a/", Overrides: policy.Overrides{StatCacheTtlSecs: &negative}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := policy.NewRules([]policy.Rule{tc.rule})
+
+			assert.Error(t, err)
+		})
+	}
+}
@@ -131,9 +131,14 @@ func (bh *bucketHandle) StatObject(ctx context.Context,
 		err = gcs.GetGCSError(err)
 	}()
 
+	obj := bh.bucket.Object(req.Name)
+	if req.Generation != 0 {
+		obj = obj.Generation(req.Generation)
+	}
+
 	var attrs *storage.ObjectAttrs
 	// Retrieving object attrs through Go Storage Client.
-	attrs, err = bh.bucket.Object(req.Name).Attrs(ctx)
+	attrs, err = obj.Attrs(ctx)
 	if err != nil {
 		err = fmt.Errorf("error in fetching object attributes: %w", err)
 		return
@@ -270,6 +275,10 @@ func (bh *bucketHandle) CopyObject(ctx context.Context, req *gcs.CopyObjectReque
 		err = gcs.GetGCSError(err)
 	}()
 
+	if req.SrcSoftDeleted {
+		return bh.restoreObject(ctx, req)
+	}
+
 	srcObj := bh.bucket.Object(req.SrcName)
 	dstObj := bh.bucket.Object(req.DstName)
 
@@ -283,6 +292,10 @@ func (bh *bucketHandle) CopyObject(ctx context.Context, req *gcs.CopyObjectReque
 		srcObj = srcObj.If(storage.Conditions{MetagenerationMatch: *req.SrcMetaGenerationPrecondition})
 	}
 
+	if req.DstGenerationPrecondition != nil {
+		dstObj = dstObj.If(dstGenerationConditions(*req.DstGenerationPrecondition))
+	}
+
 	objAttrs, err := dstObj.CopierFrom(srcObj).Run(ctx)
 
 	if err != nil {
@@ -294,6 +307,53 @@ func (bh *bucketHandle) CopyObject(ctx context.Context, req *gcs.CopyObjectReque
 	return
 }
 
+// Restore the soft-deleted source generation of a copy under its own name,
+// then copy it to the destination name if that differs, deleting the restored
+// object again. In that case the restore requires the source name to be free,
+// so that it never replaces a live object there.
+func (bh *bucketHandle) restoreObject(ctx context.Context, req *gcs.CopyObjectRequest) (o *gcs.Object, err error) {
+	srcObj := bh.bucket.Object(req.SrcName).Generation(req.SrcGeneration)
+	if req.DstName != req.SrcName {
+		srcObj = srcObj.If(storage.Conditions{DoesNotExist: true})
+	} else if req.DstGenerationPrecondition != nil {
+		srcObj = srcObj.If(dstGenerationConditions(*req.DstGenerationPrecondition))
+	}
+
+	objAttrs, err := srcObj.Restore(ctx, &storage.RestoreOptions{})
+	if err != nil {
+		err = fmt.Errorf("error in restoring object: %w", err)
+		return
+	}
+
+	o = storageutil.ObjectAttrsToBucketObject(objAttrs)
+	if req.DstName == req.SrcName {
+		return
+	}
+
+	restored := o.Generation
+	o, err = bh.CopyObject(ctx, &gcs.CopyObjectRequest{
+		SrcName:                   req.SrcName,
+		DstName:                   req.DstName,
+		SrcGeneration:             restored,
+		DstGenerationPrecondition: req.DstGenerationPrecondition,
+	})
+	if err != nil {
+		return
+	}
+
+	err = bh.DeleteObject(ctx, &gcs.DeleteObjectRequest{Name: req.SrcName, Generation: restored})
+	return
+}
+
+// Return the conditions on a destination object for the supplied generation
+// precondition, where zero means that the object must not exist.
+func dstGenerationConditions(generation int64) storage.Conditions {
+	if generation == 0 {
+		return storage.Conditions{DoesNotExist: true}
+	}
+	return storage.Conditions{GenerationMatch: generation}
+}
+
 func getProjectionValue(req gcs.Projection) storage.Projection {
 	// Explicitly converting Projection Value because the ProjectionVal interface of jacobsa/gcloud and Go Client API are not coupled correctly.
 	var convertedProjection storage.Projection // Stores the Projection Value according to the Go Client API Interface.
@@ -325,7 +385,16 @@ func (bh *bucketHandle) ListObjects(ctx context.Context, req *gcs.ListObjectsReq
 		IncludeFoldersAsPrefixes: req.IncludeFoldersAsPrefixes,
 		//MaxResults: , (Field not present in storage.Query of Go Storage Library but present in ListObjectsQuery in Jacobsa code.)
 	}
-	err = query.SetAttrSelection([]string{"Name", "Size", "Generation", "Metageneration", "Updated", "Metadata", "ContentEncoding", "CRC32C"})
+	attrSelection := []string{"Name", "Size", "Generation", "Metageneration", "Updated", "Metadata", "ContentEncoding", "CRC32C"}
+	if req.Versions {
+		query.Versions = true
+		attrSelection = append(attrSelection, "Created", "Deleted")
+	}
+	if req.SoftDeleted {
+		query.SoftDeleted = true
+		attrSelection = append(attrSelection, "Created", "SoftDeleteTime")
+	}
+	err = query.SetAttrSelection(attrSelection)
 	if err != nil {
 		err = fmt.Errorf("error while setting attribute selection for List Object query :%w", err)
 		return
@@ -360,6 +429,11 @@ func (bh *bucketHandle) ListObjects(ctx context.Context, req *gcs.ListObjectsReq
 			// Converting attrs to *Object type.
 			currMinObject := storageutil.ObjectAttrsToMinObject(attrs)
 			list.MinObjects = append(list.MinObjects, currMinObject)
+			if req.Versions {
+				list.VersionLifetimes = append(list.VersionLifetimes, gcs.VersionLifetime{Created: attrs.Created, Deleted: attrs.Deleted})
+			} else if req.SoftDeleted {
+				list.VersionLifetimes = append(list.VersionLifetimes, gcs.VersionLifetime{Created: attrs.Created, Deleted: attrs.SoftDeleteTime})
+			}
 		}
 
 		// itr.next returns all the objects present in the bucket. Hence adding a
@@ -415,9 +489,12 @@ func (bh *bucketHandle) UpdateObject(ctx context.Context, req *gcs.UpdateObjectR
 	if req.Metadata != nil {
 		updateQuery.Metadata = make(map[string]string)
 		for key, element := range req.Metadata {
-			if element != nil {
-				updateQuery.Metadata[key] = *element
+			// The storage client deletes keys whose value is the empty string.
+			if element == nil {
+				updateQuery.Metadata[key] = ""
+				continue
 			}
+			updateQuery.Metadata[key] = *element
 		}
 	}
 
@@ -519,6 +596,10 @@ func (bh *bucketHandle) MoveObject(ctx context.Context, req *gcs.MoveObjectReque
 		Object:     req.DstName,
 		Conditions: nil,
 	}
+	if req.DstGenerationPrecondition != nil {
+		conds := dstGenerationConditions(*req.DstGenerationPrecondition)
+		dstMoveObject.Conditions = &conds
+	}
 
 	attrs, err := obj.Move(ctx, dstMoveObject)
 	if err != nil {
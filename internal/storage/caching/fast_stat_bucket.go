@@ -38,6 +38,23 @@ func NewFastStatBucket(
 	clock timeutil.Clock,
 	wrapped gcs.Bucket,
 	negativeCacheTTL time.Duration,
+) (b gcs.Bucket) {
+	return NewFastStatBucketWithPerNameTTL(primaryCacheTTL, nil, cache, clock, wrapped, negativeCacheTTL)
+}
+
+// NewFastStatBucketWithPerNameTTL is like NewFastStatBucket, except that the
+// TTL of a record for an existing object or folder is the one that ttlFor
+// returns for its name, given primaryCacheTTL. A record for a name that
+// doesn't exist is kept for no longer than ttlFor returns given
+// negativeCacheTTL, so that a name that is to be fresher than the rest is
+// also found sooner once created.
+func NewFastStatBucketWithPerNameTTL(
+	primaryCacheTTL time.Duration,
+	ttlFor func(name string, ttl time.Duration) time.Duration,
+	cache metadata.StatCache,
+	clock timeutil.Clock,
+	wrapped gcs.Bucket,
+	negativeCacheTTL time.Duration,
 ) (b gcs.Bucket) {
 	fsb := &fastStatBucket{
 		cache:            cache,
@@ -45,6 +62,7 @@ func NewFastStatBucket(
 		wrapped:          wrapped,
 		primaryCacheTTL:  primaryCacheTTL,
 		negativeCacheTTL: negativeCacheTTL,
+		ttlFor:           ttlFor,
 	}
 
 	b = fsb
@@ -72,21 +90,46 @@ type fastStatBucket struct {
 	primaryCacheTTL time.Duration
 	// TTL for entries for non-existing files and folders in the cache.
 	negativeCacheTTL time.Duration
+
+	// If non-nil, overrides the above TTLs for particular names.
+	ttlFor func(name string, ttl time.Duration) time.Duration
 }
 
 ////////////////////////////////////////////////////////////////////////
 // Helpers
 ////////////////////////////////////////////////////////////////////////
 
+// Return the expiration time of a record for the named object or folder,
+// inserted at the supplied time.
+func (b *fastStatBucket) expiration(now time.Time, name string) time.Time {
+	ttl := b.primaryCacheTTL
+	if b.ttlFor != nil {
+		ttl = b.ttlFor(name, ttl)
+	}
+
+	return now.Add(ttl)
+}
+
+// Return the expiration time of a negative record for the supplied name,
+// inserted at the supplied time.
+func (b *fastStatBucket) negativeExpiration(now time.Time, name string) time.Time {
+	ttl := b.negativeCacheTTL
+	if b.ttlFor != nil {
+		ttl = min(ttl, b.ttlFor(name, ttl))
+	}
+
+	return now.Add(ttl)
+}
+
 // LOCKS_EXCLUDED(b.mu)
 func (b *fastStatBucket) insertMultiple(objs []*gcs.Object) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	expiration := b.clock.Now().Add(b.primaryCacheTTL)
+	now := b.clock.Now()
 	for _, o := range objs {
 		m := storageutil.ConvertObjToMinObject(o)
-		b.cache.Insert(m, expiration)
+		b.cache.Insert(m, b.expiration(now, m.Name))
 	}
 }
 
@@ -95,9 +138,9 @@ func (b *fastStatBucket) insertMultipleMinObjects(minObjs []*gcs.MinObject) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	expiration := b.clock.Now().Add(b.primaryCacheTTL)
+	now := b.clock.Now()
 	for _, o := range minObjs {
-		b.cache.Insert(o, expiration)
+		b.cache.Insert(o, b.expiration(now, o.Name))
 	}
 }
 
@@ -116,11 +159,11 @@ func (b *fastStatBucket) insertHierarchicalListing(listing *gcs.Listing) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	expiration := b.clock.Now().Add(b.primaryCacheTTL)
+	now := b.clock.Now()
 
 	for _, o := range listing.MinObjects {
 		if !strings.HasSuffix(o.Name, "/") {
-			b.cache.Insert(o, expiration)
+			b.cache.Insert(o, b.expiration(now, o.Name))
 		}
 	}
 
@@ -132,7 +175,7 @@ func (b *fastStatBucket) insertHierarchicalListing(listing *gcs.Listing) {
 			f := &gcs.Folder{
 				Name: p,
 			}
-			b.cache.InsertFolder(f, expiration)
+			b.cache.InsertFolder(f, b.expiration(now, p))
 		}
 	}
 
@@ -152,7 +195,7 @@ func (b *fastStatBucket) insertFolder(f *gcs.Folder) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	b.cache.InsertFolder(f, b.clock.Now().Add(b.primaryCacheTTL))
+	b.cache.InsertFolder(f, b.expiration(b.clock.Now(), f.Name))
 }
 
 // LOCKS_EXCLUDED(b.mu)
@@ -160,8 +203,7 @@ func (b *fastStatBucket) addNegativeEntry(name string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	expiration := b.clock.Now().Add(b.negativeCacheTTL)
-	b.cache.AddNegativeEntry(name, expiration)
+	b.cache.AddNegativeEntry(name, b.negativeExpiration(b.clock.Now(), name))
 }
 
 // LOCKS_EXCLUDED(b.mu)
@@ -169,8 +211,7 @@ func (b *fastStatBucket) addNegativeEntryForFolder(name string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	expiration := b.clock.Now().Add(b.negativeCacheTTL)
-	b.cache.AddNegativeEntryForFolder(name, expiration)
+	b.cache.AddNegativeEntryForFolder(name, b.negativeExpiration(b.clock.Now(), name))
 }
 
 // LOCKS_EXCLUDED(b.mu)
@@ -319,6 +360,12 @@ func (b *fastStatBucket) StatObject(
 	if !req.ForceFetchFromGcs && req.ReturnExtendedObjectAttributes {
 		panic("invalid StatObjectRequest: ForceFetchFromGcs: false and ReturnExtendedObjectAttributes: true")
 	}
+	// Only the live generation is cached.
+	if req.Generation != 0 {
+		m, e, err = b.wrapped.StatObject(ctx, req)
+		return
+	}
+
 	// If fetching from gcs is enabled, directly make a call to GCS.
 	if req.ForceFetchFromGcs {
 		m, e, err = b.StatObjectFromGcs(ctx, req)
@@ -17,6 +17,7 @@ package caching_test
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -734,6 +735,72 @@ func (t *StatObjectTest) WrappedSucceeds() {
 	ExpectEq(minObj, m)
 }
 
+////////////////////////////////////////////////////////////////////////
+// Per-name TTLs
+////////////////////////////////////////////////////////////////////////
+
+type PerNameTTLTest struct {
+	fastStatBucketTest
+}
+
+func init() { RegisterTestSuite(&PerNameTTLTest{}) }
+
+func (t *PerNameTTLTest) SetUp(ti *TestInfo) {
+	t.fastStatBucketTest.SetUp(ti)
+
+	// Names under "hot/" are cached for a tenth of the usual time.
+	t.bucket = caching.NewFastStatBucketWithPerNameTTL(
+		primaryCacheTTL,
+		func(name string, ttl time.Duration) time.Duration {
+			if strings.HasPrefix(name, "hot/") {
+				return ttl / 10
+			}
+			return ttl
+		},
+		t.cache,
+		&t.clock,
+		t.wrapped,
+		negativeCacheTTL)
+}
+
+func (t *PerNameTTLTest) MatchingNameUsesItsTTL() {
+	ExpectCall(t.cache, "LookUp")(Any(), Any()).
+		WillOnce(Return(false, nil))
+	ExpectCall(t.wrapped, "StatObject")(Any(), Any()).
+		WillOnce(Return(&gcs.MinObject{Name: "hot/taco"}, nil, nil))
+	ExpectCall(t.cache, "Insert")(Any(), timeutil.TimeEq(t.clock.Now().Add(primaryCacheTTL/10)))
+
+	_, _, err := t.bucket.StatObject(context.TODO(), &gcs.StatObjectRequest{Name: "hot/taco"})
+
+	AssertEq(nil, err)
+}
+
+func (t *PerNameTTLTest) OtherNamesUseTheDefault() {
+	ExpectCall(t.cache, "LookUp")(Any(), Any()).
+		WillOnce(Return(false, nil))
+	ExpectCall(t.wrapped, "StatObject")(Any(), Any()).
+		WillOnce(Return(&gcs.MinObject{Name: "taco"}, nil, nil))
+	ExpectCall(t.cache, "Insert")(Any(), timeutil.TimeEq(t.clock.Now().Add(primaryCacheTTL)))
+
+	_, _, err := t.bucket.StatObject(context.TODO(), &gcs.StatObjectRequest{Name: "taco"})
+
+	AssertEq(nil, err)
+}
+
+func (t *PerNameTTLTest) NegativeEntryIsNoLongerThanTheRule() {
+	ExpectCall(t.cache, "LookUp")(Any(), Any()).
+		WillOnce(Return(false, nil))
+	ExpectCall(t.wrapped, "StatObject")(Any(), Any()).
+		WillOnce(Return(nil, nil, &gcs.NotFoundError{Err: errors.New("burrito")}))
+	ExpectCall(t.cache, "AddNegativeEntry")(
+		"hot/taco",
+		timeutil.TimeEq(t.clock.Now().Add(negativeCacheTTL/10)))
+
+	_, _, err := t.bucket.StatObject(context.TODO(), &gcs.StatObjectRequest{Name: "hot/taco"})
+
+	ExpectThat(err, HasSameTypeAs(&gcs.NotFoundError{}))
+}
+
 ////////////////////////////////////////////////////////////////////////
 // ListObjects
 ////////////////////////////////////////////////////////////////////////
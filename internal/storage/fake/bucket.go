@@ -552,6 +552,11 @@ func (b *bucket) ListObjects(
 	// Set up the result object.
 	listing = new(gcs.Listing)
 
+	// Nothing is kept of deleted objects.
+	if req.SoftDeleted {
+		return
+	}
+
 	// Handle defaults.
 	maxResults := req.MaxResults
 	if maxResults == 0 {
@@ -628,6 +633,11 @@ func (b *bucket) ListObjects(
 		// Otherwise, return as an object result. Make a copy to avoid handing back
 		// internal state.
 		listing.MinObjects = append(listing.MinObjects, copyMinObject(&o.metadata))
+
+		// Only the live generation of each object is kept.
+		if req.Versions {
+			listing.VersionLifetimes = append(listing.VersionLifetimes, gcs.VersionLifetime{Created: o.metadata.Updated})
+		}
 	}
 
 	// Set up a cursor for where to start the next scan if we didn't exhaust the
@@ -719,6 +729,30 @@ func (b *bucket) FinalizeUpload(ctx context.Context, w gcs.Writer) (*gcs.MinObje
 	return fakeObjectWriter.Object, nil
 }
 
+// Return a *gcs.PreconditionError if precondition is non-nil and differs from
+// the current generation of the named object, where zero means that the
+// object doesn't exist.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *bucket) checkDstGenerationPrecondition(name string, precondition *int64) error {
+	if precondition == nil {
+		return nil
+	}
+
+	var generation int64
+	if index := b.objects.find(name); index < len(b.objects) {
+		generation = b.objects[index].metadata.Generation
+	}
+
+	if generation != *precondition {
+		return &gcs.PreconditionError{
+			Err: fmt.Errorf("object %q has generation %d", name, generation),
+		}
+	}
+
+	return nil
+}
+
 // LOCKS_EXCLUDED(b.mu)
 func (b *bucket) CopyObject(
 	ctx context.Context,
@@ -768,6 +802,12 @@ func (b *bucket) CopyObject(
 		}
 	}
 
+	// Does the destination satisfy the precondition?
+	err = b.checkDstGenerationPrecondition(req.DstName, req.DstGenerationPrecondition)
+	if err != nil {
+		return
+	}
+
 	// Copy it and assign a new generation number, to ensure that the generation
 	// number for the destination name is strictly increasing.
 	dst := b.objects[srcIndex]
@@ -875,9 +915,9 @@ func (b *bucket) StatObject(ctx context.Context,
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// Does the object exist?
+	// Does the object exist? Only the live generation is kept.
 	index := b.objects.find(req.Name)
-	if index == len(b.objects) {
+	if index == len(b.objects) || (req.Generation != 0 && b.objects[index].metadata.Generation != req.Generation) {
 		err = &gcs.NotFoundError{
 			Err: fmt.Errorf("object %s not found", req.Name),
 		}
@@ -1057,6 +1097,12 @@ func (b *bucket) MoveObject(ctx context.Context, req *gcs.MoveObjectRequest) (*g
 		}
 	}
 
+	// Does the destination satisfy the precondition?
+	err = b.checkDstGenerationPrecondition(req.DstName, req.DstGenerationPrecondition)
+	if err != nil {
+		return nil, err
+	}
+
 	// Move it and assign a new generation number, to ensure that the generation
 	// number for the destination name is strictly increasing.
 	dst := b.objects[srcIndex]
@@ -1735,6 +1735,62 @@ func (t *copyTest) SrcMetaGenerationPrecondition_Satisfied() {
 	ExpectEq(nil, err)
 }
 
+func (t *copyTest) DstGenerationPrecondition_Unsatisfied() {
+	var err error
+
+	// Create a source and a destination object.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("taco"))
+	AssertEq(nil, err)
+
+	dst, err := storageutil.CreateObject(t.ctx, t.bucket, "bar", []byte("burrito"))
+	AssertEq(nil, err)
+
+	// Attempt to copy, requiring that the destination doesn't exist.
+	var precond int64
+	req := &gcs.CopyObjectRequest{
+		SrcName:                   "foo",
+		DstName:                   "bar",
+		DstGenerationPrecondition: &precond,
+	}
+
+	_, err = t.bucket.CopyObject(t.ctx, req)
+	AssertThat(err, HasSameTypeAs(&gcs.PreconditionError{}))
+
+	// The destination should be unchanged.
+	m, _, err := t.bucket.StatObject(
+		t.ctx,
+		&gcs.StatObjectRequest{Name: "bar"})
+
+	AssertEq(nil, err)
+	ExpectEq(dst.Generation, m.Generation)
+}
+
+func (t *copyTest) DstGenerationPrecondition_Satisfied() {
+	var err error
+
+	// Create a source and a destination object.
+	_, err = storageutil.CreateObject(t.ctx, t.bucket, "foo", []byte("taco"))
+	AssertEq(nil, err)
+
+	dst, err := storageutil.CreateObject(t.ctx, t.bucket, "bar", []byte("burrito"))
+	AssertEq(nil, err)
+
+	// Copy, requiring the current destination generation.
+	req := &gcs.CopyObjectRequest{
+		SrcName:                   "foo",
+		DstName:                   "bar",
+		DstGenerationPrecondition: &dst.Generation,
+	}
+
+	_, err = t.bucket.CopyObject(t.ctx, req)
+	AssertEq(nil, err)
+
+	// The destination should have been overwritten.
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, "bar")
+	AssertEq(nil, err)
+	ExpectEq("taco", string(contents))
+}
+
 ////////////////////////////////////////////////////////////////////////
 // Compose
 ////////////////////////////////////////////////////////////////////////
@@ -4293,6 +4349,18 @@ func (t *listTest) NewlyCreatedObject() {
 	ExpectEq(len("taco"), o.Size)
 }
 
+func (t *listTest) Versions_LiveObject() {
+	AssertEq(nil, t.createObject("a", "taco"))
+
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Versions: true})
+	AssertEq(nil, err)
+
+	AssertEq(1, len(listing.MinObjects))
+	AssertEq(1, len(listing.VersionLifetimes))
+	ExpectEq("a", listing.MinObjects[0].Name)
+	ExpectTrue(listing.VersionLifetimes[0].Deleted.IsZero())
+}
+
 func (t *listTest) TrivialQuery() {
 	// Create few objects.
 	AssertEq(nil, t.createObject("a", "taco"))
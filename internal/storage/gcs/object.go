@@ -108,6 +108,15 @@ type ExtendedObjectAttributes struct {
 	Acl                []*storagev1.ObjectAccessControl
 }
 
+// VersionLifetime records when a generation of an object was created and, if
+// it is noncurrent, when it was replaced or deleted.
+type VersionLifetime struct {
+	Created time.Time
+
+	// Zero for the live version.
+	Deleted time.Time
+}
+
 func (mo MinObject) HasContentEncodingGzip() bool {
 	return mo.ContentEncoding == ContentEncodingGzip
 }
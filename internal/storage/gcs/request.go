@@ -105,6 +105,12 @@ type CopyObjectRequest struct {
 	// generation is equal to the given value. Zero means the object does not
 	// exist.
 	DstGenerationPrecondition *int64
+
+	// The source generation has been soft-deleted. Such generations can't be
+	// copied directly, so it is restored under its own name first, and then
+	// moved to DstName if that differs. The latter fails with a precondition
+	// error while a live object has the source name.
+	SrcSoftDeleted bool
 }
 
 // MaxSourcesPerComposeRequest is the maximum number of sources that a
@@ -236,6 +242,10 @@ type StatObjectRequest struct {
 
 	// Controls whether StatObject response includes GCS ExtendedObjectAttributes.
 	ReturnExtendedObjectAttributes bool
+
+	// If non-zero, stat this generation of the object, which may be
+	// noncurrent, rather than the live one.
+	Generation int64
 }
 
 type Projection int64
@@ -314,6 +324,14 @@ type ListObjectsRequest struct {
 	// the current flow, default value will be full and callers can override it
 	// using this param.
 	ProjectionVal Projection
+
+	// Include the noncurrent versions of objects in versioned buckets, and
+	// report the lifetime of each version in Listing.VersionLifetimes.
+	Versions bool
+
+	// List only soft-deleted objects, in buckets with a soft delete policy,
+	// reporting when each was deleted in Listing.VersionLifetimes.
+	SoftDeleted bool
 }
 
 // Listing contains a set of objects and delimter-based collapsed runs returned
@@ -325,6 +343,12 @@ type Listing struct {
 	// (name, generation) pairs.
 	MinObjects []*MinObject
 
+	// Only set for listings of versions or soft-deleted objects (see
+	// ListObjectsRequest.Versions and ListObjectsRequest.SoftDeleted): the
+	// lifetime of each record in MinObjects, in the same order. Kept apart from
+	// MinObject to keep the records cached for ordinary listings small.
+	VersionLifetimes []VersionLifetime
+
 	// Collapsed entries for runs of names sharing a prefix followed by a
 	// delimiter. See notes on ListObjectsRequest.Delimiter.
 	//
@@ -421,4 +445,9 @@ type MoveObjectRequest struct {
 	// If non-nil, the destination object will be created/overwritten only if the
 	// current meta-generation for the source object is equal to the given value.
 	SrcMetaGenerationPrecondition *int64
+
+	// Destination object will be overwritten only if the current
+	// generation is equal to the given value. Zero means the object does not
+	// exist.
+	DstGenerationPrecondition *int64
 }
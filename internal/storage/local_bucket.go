@@ -0,0 +1,862 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	storagev2 "cloud.google.com/go/storage"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"golang.org/x/net/context"
+)
+
+// The name returned by the Name method of local buckets.
+const LocalBucketName = "local"
+
+var errLocalBucketUnsupported = errors.New("not supported by local buckets")
+
+// NewLocalBucket returns a bucket whose objects are stored as files in the
+// supplied directory, which is created if necessary. Objects written by an
+// earlier bucket over the same directory are loaded, so that the contents
+// persist across mounts, but only one bucket may use a directory at a time.
+//
+// Each object is stored as two files named after a hash of its name: one
+// holding its contents, suffixed with its generation, and a JSON file holding
+// its attributes. An object is only replaced once its attributes are, so a
+// crash never leaves a partly written object behind. The bucket has a flat
+// namespace and keeps no old generations.
+func NewLocalBucket(dir string) (gcs.Bucket, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("MkdirAll: %w", err)
+	}
+
+	b := &localBucket{
+		dir:     dir,
+		objects: make(map[string]*gcs.Object),
+	}
+
+	if err := b.load(); err != nil {
+		return nil, fmt.Errorf("loading local bucket %q: %w", dir, err)
+	}
+
+	return b, nil
+}
+
+type localBucket struct {
+	dir string
+
+	mu sync.Mutex
+
+	// The attributes of each object, keyed by name.
+	//
+	// GUARDED_BY(mu)
+	objects map[string]*gcs.Object
+
+	// GUARDED_BY(mu)
+	lastGeneration int64
+}
+
+const (
+	localAttrsSuffix = ".json"
+	localTmpPrefix   = ".tmp-"
+)
+
+func localKey(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])
+}
+
+func (b *localBucket) attrsPath(name string) string {
+	return filepath.Join(b.dir, localKey(name)+localAttrsSuffix)
+}
+
+func (b *localBucket) dataPath(name string, generation int64) string {
+	return filepath.Join(b.dir, localKey(name)+"."+strconv.FormatInt(generation, 10))
+}
+
+// Load the attributes of the objects in the directory, and remove anything
+// left behind by writes that never finished.
+func (b *localBucket) load() error {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return err
+	}
+
+	live := make(map[string]bool)
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), localAttrsSuffix) || strings.HasPrefix(e.Name(), localTmpPrefix) {
+			continue
+		}
+
+		contents, err := os.ReadFile(filepath.Join(b.dir, e.Name()))
+		if err != nil {
+			return err
+		}
+
+		o := new(gcs.Object)
+		if err = json.Unmarshal(contents, o); err != nil {
+			return fmt.Errorf("%s: %w", e.Name(), err)
+		}
+
+		b.objects[o.Name] = o
+		live[filepath.Base(b.dataPath(o.Name, o.Generation))] = true
+		b.lastGeneration = max(b.lastGeneration, o.Generation)
+	}
+
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), localAttrsSuffix) || live[e.Name()] {
+			continue
+		}
+
+		if err = os.Remove(filepath.Join(b.dir, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Return a generation number greater than any handed out so far. Like those
+// of GCS, generation numbers are timestamps in microseconds.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *localBucket) nextGenerationLocked() int64 {
+	b.lastGeneration = max(b.lastGeneration+1, time.Now().UnixMicro())
+	return b.lastGeneration
+}
+
+// A temporary file in the bucket's directory, into which an object's contents
+// are written before it is committed.
+type localTmpFile struct {
+	f    *os.File
+	crc  hash.Hash32
+	size int64
+}
+
+func (b *localBucket) newTmpFile() (*localTmpFile, error) {
+	f, err := os.CreateTemp(b.dir, localTmpPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &localTmpFile{f: f, crc: crc32.New(crc32.MakeTable(crc32.Castagnoli))}, nil
+}
+
+func (t *localTmpFile) Write(p []byte) (int, error) {
+	n, err := t.f.Write(p)
+	t.crc.Write(p[:n])
+	t.size += int64(n)
+	return n, err
+}
+
+// Flush the contents to disk and close the file.
+func (t *localTmpFile) finish() error {
+	err := t.f.Sync()
+	if closeErr := t.f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+func (t *localTmpFile) discard() {
+	t.f.Close()
+	os.Remove(t.f.Name())
+}
+
+func (b *localBucket) writeTmpFile(r io.Reader) (*localTmpFile, error) {
+	t, err := b.newTmpFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = io.Copy(t, r); err == nil {
+		err = t.finish()
+	}
+
+	if err != nil {
+		t.discard()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Make the supplied object, whose contents are in the supplied file, the live
+// generation of its name, replacing any existing one.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *localBucket) commitLocked(o *gcs.Object, contentsPath string) (err error) {
+	dataPath := b.dataPath(o.Name, o.Generation)
+	if err = os.Rename(contentsPath, dataPath); err != nil {
+		os.Remove(contentsPath)
+		return
+	}
+
+	if err = b.writeAttrsLocked(o); err != nil {
+		os.Remove(dataPath)
+		return
+	}
+
+	if existing, ok := b.objects[o.Name]; ok && existing.Generation != o.Generation {
+		os.Remove(b.dataPath(existing.Name, existing.Generation))
+	}
+
+	b.objects[o.Name] = o
+	return
+}
+
+// LOCKS_REQUIRED(b.mu)
+func (b *localBucket) writeAttrsLocked(o *gcs.Object) error {
+	contents, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+
+	t, err := b.writeTmpFile(strings.NewReader(string(contents)))
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(t.f.Name(), b.attrsPath(o.Name)); err != nil {
+		os.Remove(t.f.Name())
+	}
+
+	return err
+}
+
+// Return the live object of the supplied name, checking it against the
+// supplied generation, if non-zero, and metageneration precondition.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *localBucket) findLocked(name string, generation int64, metaGenerationPrecondition *int64) (*gcs.Object, error) {
+	o, ok := b.objects[name]
+	if !ok || (generation != 0 && o.Generation != generation) {
+		return nil, &gcs.NotFoundError{Err: fmt.Errorf("object %q not found", name)}
+	}
+
+	if metaGenerationPrecondition != nil && o.MetaGeneration != *metaGenerationPrecondition {
+		return nil, &gcs.PreconditionError{Err: fmt.Errorf("object %q has meta-generation %d", name, o.MetaGeneration)}
+	}
+
+	return o, nil
+}
+
+// LOCKS_REQUIRED(b.mu)
+func (b *localBucket) checkPreconditionsLocked(name string, generationPrecondition *int64, metaGenerationPrecondition *int64) error {
+	o, ok := b.objects[name]
+	if generationPrecondition != nil {
+		var generation int64
+		if ok {
+			generation = o.Generation
+		}
+
+		if generation != *generationPrecondition {
+			return &gcs.PreconditionError{Err: fmt.Errorf("object %q has generation %d", name, generation)}
+		}
+	}
+
+	if metaGenerationPrecondition != nil && ok && o.MetaGeneration != *metaGenerationPrecondition {
+		return &gcs.PreconditionError{Err: fmt.Errorf("object %q has meta-generation %d", name, o.MetaGeneration)}
+	}
+
+	return nil
+}
+
+func copyLocalObject(o *gcs.Object) *gcs.Object {
+	out := *o
+	if o.Metadata != nil {
+		out.Metadata = make(map[string]string, len(o.Metadata))
+		for k, v := range o.Metadata {
+			out.Metadata[k] = v
+		}
+	}
+
+	return &out
+}
+
+// LOCKS_REQUIRED(b.mu)
+func (b *localBucket) createLocked(req *gcs.CreateObjectRequest, t *localTmpFile, componentCount int64) (*gcs.Object, error) {
+	if err := b.checkPreconditionsLocked(req.Name, req.GenerationPrecondition, req.MetaGenerationPrecondition); err != nil {
+		os.Remove(t.f.Name())
+		return nil, err
+	}
+
+	crc := t.crc.Sum32()
+	o := &gcs.Object{
+		Name:               req.Name,
+		ContentType:        req.ContentType,
+		ContentLanguage:    req.ContentLanguage,
+		CacheControl:       req.CacheControl,
+		Size:               uint64(t.size),
+		ContentEncoding:    req.ContentEncoding,
+		CRC32C:             &crc,
+		Metadata:           req.Metadata,
+		Generation:         b.nextGenerationLocked(),
+		MetaGeneration:     1,
+		StorageClass:       req.StorageClass,
+		Updated:            time.Now(),
+		ComponentCount:     componentCount,
+		ContentDisposition: req.ContentDisposition,
+		CustomTime:         req.CustomTime,
+		EventBasedHold:     req.EventBasedHold,
+		Acl:                req.Acl,
+	}
+	o = copyLocalObject(o)
+
+	if err := b.commitLocked(o, t.f.Name()); err != nil {
+		return nil, err
+	}
+
+	return copyLocalObject(o), nil
+}
+
+// Copy the contents of the supplied object to a new temporary file.
+//
+// LOCKS_REQUIRED(b.mu)
+func (b *localBucket) linkTmpFileLocked(o *gcs.Object) (string, error) {
+	path := filepath.Join(b.dir, localTmpPrefix+localKey(o.Name)+"."+strconv.FormatInt(b.nextGenerationLocked(), 10))
+	return path, os.Link(b.dataPath(o.Name, o.Generation), path)
+}
+
+////////////////////////////////////////////////////////////////////////
+// Bucket interface
+////////////////////////////////////////////////////////////////////////
+
+func (b *localBucket) Name() string {
+	return LocalBucketName
+}
+
+func (b *localBucket) BucketType() gcs.BucketType {
+	return gcs.BucketType{}
+}
+
+type localReader struct {
+	io.Reader
+	io.Closer
+}
+
+func (r *localReader) ReadHandle() storagev2.ReadHandle {
+	return nil
+}
+
+func (b *localBucket) NewReaderWithReadHandle(ctx context.Context, req *gcs.ReadObjectRequest) (gcs.StorageReader, error) {
+	b.mu.Lock()
+	o, err := b.findLocked(req.Name, req.Generation, nil)
+	var f *os.File
+	if err == nil {
+		// Open while locked, so that the file isn't replaced first.
+		f, err = os.Open(b.dataPath(o.Name, o.Generation))
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	start, limit := int64(0), int64(o.Size)
+	if req.Range != nil {
+		start = min(int64(req.Range.Start), limit)
+		limit = max(min(int64(req.Range.Limit), limit), start)
+	}
+
+	return &localReader{Reader: io.NewSectionReader(f, start, limit-start), Closer: f}, nil
+}
+
+// A multi-range downloader for a local bucket, which reads each range as it
+// is added.
+type localMultiRangeDownloader struct {
+	f    *os.File
+	size int64
+
+	// The first error reading a range, returned by Close.
+	err error
+}
+
+func (d *localMultiRangeDownloader) Add(output io.Writer, offset, length int64, callback func(int64, int64, error)) {
+	var n int64
+	var err error
+	if offset < 0 || length < 0 || offset > d.size {
+		err = fmt.Errorf("range [%d, %d) out of bounds for size %d", offset, offset+length, d.size)
+	} else {
+		n, err = io.Copy(output, io.NewSectionReader(d.f, offset, min(length, d.size-offset)))
+	}
+
+	if err != nil && d.err == nil {
+		d.err = err
+	}
+
+	if callback != nil {
+		callback(offset, n, err)
+	}
+}
+
+func (d *localMultiRangeDownloader) Wait() {
+}
+
+func (d *localMultiRangeDownloader) Close() error {
+	if err := d.f.Close(); d.err == nil {
+		d.err = err
+	}
+
+	return d.err
+}
+
+func (b *localBucket) NewMultiRangeDownloader(ctx context.Context, req *gcs.MultiRangeDownloaderRequest) (gcs.MultiRangeDownloader, error) {
+	b.mu.Lock()
+	o, err := b.findLocked(req.Name, req.Generation, nil)
+	var f *os.File
+	if err == nil {
+		f, err = os.Open(b.dataPath(o.Name, o.Generation))
+	}
+	b.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &localMultiRangeDownloader{f: f, size: int64(o.Size)}, nil
+}
+
+func (b *localBucket) CreateObject(ctx context.Context, req *gcs.CreateObjectRequest) (*gcs.Object, error) {
+	// Write the contents before taking the lock, since they may be large.
+	t, err := b.writeTmpFile(req.Contents)
+	if err != nil {
+		return nil, fmt.Errorf("writing contents: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.createLocked(req, t, 1)
+}
+
+// StagingDir returns the directory in which files to be passed to
+// CreateObjectFromFile are written, so that they can be moved into the bucket
+// rather than copied. Anything left there is removed when the bucket is next
+// opened.
+func (b *localBucket) StagingDir() string {
+	return b.dir
+}
+
+// CreateObjectFromFile creates an object like CreateObject, except that its
+// contents are those of the named file in StagingDir, which is moved into the
+// bucket instead of being copied. The file is left alone if a precondition
+// isn't met.
+func (b *localBucket) CreateObjectFromFile(ctx context.Context, req *gcs.CreateObjectRequest, path string) (*gcs.Object, error) {
+	// Checksum the contents and make sure they are on disk before taking the
+	// lock, since they may be large.
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &localTmpFile{f: f, crc: crc32.New(crc32.MakeTable(crc32.Castagnoli))}
+	t.size, err = io.Copy(t.crc, f)
+	if err == nil {
+		err = t.finish()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading contents: %w", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err = b.checkPreconditionsLocked(req.Name, req.GenerationPrecondition, req.MetaGenerationPrecondition); err != nil {
+		return nil, err
+	}
+
+	return b.createLocked(req, t, 1)
+}
+
+// A writer for a local bucket, which writes to a temporary file until the
+// upload is finalized.
+type localWriter struct {
+	*localTmpFile
+	req   *gcs.CreateObjectRequest
+	attrs storagev2.ObjectAttrs
+}
+
+func (w *localWriter) Close() error {
+	return w.finish()
+}
+
+func (w *localWriter) Flush() (int64, error) {
+	return w.size, nil
+}
+
+func (w *localWriter) ObjectName() string {
+	return w.req.Name
+}
+
+func (w *localWriter) Attrs() *storagev2.ObjectAttrs {
+	return &w.attrs
+}
+
+func (b *localBucket) CreateObjectChunkWriter(ctx context.Context, req *gcs.CreateObjectRequest, chunkSize int, callBack func(bytesUploadedSoFar int64)) (gcs.Writer, error) {
+	t, err := b.newTmpFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return &localWriter{localTmpFile: t, req: req}, nil
+}
+
+func (b *localBucket) FinalizeUpload(ctx context.Context, writer gcs.Writer) (*gcs.MinObject, error) {
+	w, ok := writer.(*localWriter)
+	if !ok {
+		return nil, fmt.Errorf("could not type assert gcs.Writer to localWriter")
+	}
+
+	if err := w.Close(); err != nil {
+		w.discard()
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	o, err := b.createLocked(w.req, w.localTmpFile, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	w.attrs.Name = o.Name
+	w.attrs.Generation = o.Generation
+	w.attrs.Metageneration = o.MetaGeneration
+	w.attrs.Size = int64(o.Size)
+	return storageutil.ConvertObjToMinObject(o), nil
+}
+
+func (b *localBucket) FlushPendingWrites(ctx context.Context, writer gcs.Writer) (int64, error) {
+	return writer.Flush()
+}
+
+func (b *localBucket) CopyObject(ctx context.Context, req *gcs.CopyObjectRequest) (*gcs.Object, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	src, err := b.findLocked(req.SrcName, req.SrcGeneration, req.SrcMetaGenerationPrecondition)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = b.checkPreconditionsLocked(req.DstName, req.DstGenerationPrecondition, nil); err != nil {
+		return nil, err
+	}
+
+	return b.copyLocked(src, req.DstName)
+}
+
+// LOCKS_REQUIRED(b.mu)
+func (b *localBucket) copyLocked(src *gcs.Object, dstName string) (*gcs.Object, error) {
+	tmpPath, err := b.linkTmpFileLocked(src)
+	if err != nil {
+		return nil, err
+	}
+
+	o := copyLocalObject(src)
+	o.Name = dstName
+	o.Generation = b.nextGenerationLocked()
+	o.MetaGeneration = 1
+	o.Updated = time.Now()
+	if err = b.commitLocked(o, tmpPath); err != nil {
+		return nil, err
+	}
+
+	return copyLocalObject(o), nil
+}
+
+func (b *localBucket) ComposeObjects(ctx context.Context, req *gcs.ComposeObjectsRequest) (o *gcs.Object, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err = b.checkPreconditionsLocked(req.DstName, req.DstGenerationPrecondition, req.DstMetaGenerationPrecondition); err != nil {
+		return
+	}
+
+	t, err := b.newTmpFile()
+	if err != nil {
+		return
+	}
+
+	var componentCount int64
+	for _, s := range req.Sources {
+		var src *gcs.Object
+		src, err = b.findLocked(s.Name, s.Generation, nil)
+		if err == nil {
+			componentCount += src.ComponentCount
+			err = appendFile(t, b.dataPath(src.Name, src.Generation))
+		}
+
+		if err != nil {
+			t.discard()
+			return
+		}
+	}
+
+	if err = t.finish(); err != nil {
+		t.discard()
+		return
+	}
+
+	o, err = b.createLocked(&gcs.CreateObjectRequest{
+		Name:               req.DstName,
+		ContentType:        req.ContentType,
+		ContentLanguage:    req.ContentLanguage,
+		ContentEncoding:    req.ContentEncoding,
+		CacheControl:       req.CacheControl,
+		Metadata:           req.Metadata,
+		ContentDisposition: req.ContentDisposition,
+		CustomTime:         req.CustomTime,
+		EventBasedHold:     req.EventBasedHold,
+		StorageClass:       req.StorageClass,
+		Acl:                req.Acl,
+	}, t, componentCount)
+	return
+}
+
+func appendFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func (b *localBucket) StatObject(ctx context.Context, req *gcs.StatObjectRequest) (*gcs.MinObject, *gcs.ExtendedObjectAttributes, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	o, err := b.findLocked(req.Name, req.Generation, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var extendedAttrs *gcs.ExtendedObjectAttributes
+	if req.ReturnExtendedObjectAttributes {
+		extendedAttrs = storageutil.ConvertObjToExtendedObjectAttributes(o)
+	}
+
+	return storageutil.ConvertObjToMinObject(copyLocalObject(o)), extendedAttrs, nil
+}
+
+// ListObjects returns every matching object in a single page, regardless of
+// MaxResults.
+func (b *localBucket) ListObjects(ctx context.Context, req *gcs.ListObjectsRequest) (*gcs.Listing, error) {
+	if req.SoftDeleted {
+		return &gcs.Listing{}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var names []string
+	for name := range b.objects {
+		if strings.HasPrefix(name, req.Prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	listing := &gcs.Listing{}
+	for _, name := range names {
+		if req.Delimiter != "" {
+			rest := name[len(req.Prefix):]
+			if i := strings.Index(rest, req.Delimiter); i >= 0 {
+				run := req.Prefix + rest[:i+len(req.Delimiter)]
+				if n := len(listing.CollapsedRuns); n == 0 || listing.CollapsedRuns[n-1] != run {
+					listing.CollapsedRuns = append(listing.CollapsedRuns, run)
+				}
+
+				if name != run || !req.IncludeTrailingDelimiter {
+					continue
+				}
+			}
+		}
+
+		o := b.objects[name]
+		listing.MinObjects = append(listing.MinObjects, storageutil.ConvertObjToMinObject(copyLocalObject(o)))
+		if req.Versions {
+			listing.VersionLifetimes = append(listing.VersionLifetimes, gcs.VersionLifetime{Created: o.Updated})
+		}
+	}
+
+	return listing, nil
+}
+
+func (b *localBucket) UpdateObject(ctx context.Context, req *gcs.UpdateObjectRequest) (*gcs.Object, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	existing, err := b.findLocked(req.Name, req.Generation, req.MetaGenerationPrecondition)
+	if err != nil {
+		return nil, err
+	}
+
+	o := copyLocalObject(existing)
+	if req.ContentType != nil {
+		o.ContentType = *req.ContentType
+	}
+	if req.ContentEncoding != nil {
+		o.ContentEncoding = *req.ContentEncoding
+	}
+	if req.ContentLanguage != nil {
+		o.ContentLanguage = *req.ContentLanguage
+	}
+	if req.CacheControl != nil {
+		o.CacheControl = *req.CacheControl
+	}
+
+	for k, v := range req.Metadata {
+		if v == nil {
+			delete(o.Metadata, k)
+			continue
+		}
+
+		if o.Metadata == nil {
+			o.Metadata = make(map[string]string)
+		}
+		o.Metadata[k] = *v
+	}
+
+	o.MetaGeneration++
+	o.Updated = time.Now()
+	if err = b.writeAttrsLocked(o); err != nil {
+		return nil, err
+	}
+
+	b.objects[o.Name] = o
+	return copyLocalObject(o), nil
+}
+
+func (b *localBucket) DeleteObject(ctx context.Context, req *gcs.DeleteObjectRequest) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	o, err := b.findLocked(req.Name, req.Generation, req.MetaGenerationPrecondition)
+	if err != nil {
+		return err
+	}
+
+	return b.deleteLocked(o)
+}
+
+// LOCKS_REQUIRED(b.mu)
+func (b *localBucket) deleteLocked(o *gcs.Object) error {
+	if err := os.Remove(b.attrsPath(o.Name)); err != nil {
+		return err
+	}
+
+	delete(b.objects, o.Name)
+	os.Remove(b.dataPath(o.Name, o.Generation))
+	return nil
+}
+
+func (b *localBucket) MoveObject(ctx context.Context, req *gcs.MoveObjectRequest) (*gcs.Object, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	src, err := b.findLocked(req.SrcName, req.SrcGeneration, req.SrcMetaGenerationPrecondition)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = b.checkPreconditionsLocked(req.DstName, req.DstGenerationPrecondition, nil); err != nil {
+		return nil, err
+	}
+
+	if req.SrcName == req.DstName {
+		return copyLocalObject(src), nil
+	}
+
+	o, err := b.copyLocked(src, req.DstName)
+	if err != nil {
+		return nil, err
+	}
+
+	return o, b.deleteLocked(src)
+}
+
+func (b *localBucket) DeleteFolder(ctx context.Context, folderName string) error {
+	return fmt.Errorf("DeleteFolder: %w", errLocalBucketUnsupported)
+}
+
+func (b *localBucket) GetFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return nil, &gcs.NotFoundError{Err: fmt.Errorf("folder %q not found", folderName)}
+}
+
+// RenameFolder moves every object beneath the named folder, including its own
+// object if any, to the destination. The bucket has no folders of its own, so
+// this is only atomic with respect to other calls on the bucket.
+func (b *localBucket) RenameFolder(ctx context.Context, folderName string, destinationFolderId string) (*gcs.Folder, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for name := range b.objects {
+		if strings.HasPrefix(name, destinationFolderId) {
+			return nil, &gcs.PreconditionError{Err: fmt.Errorf("folder %q exists", destinationFolderId)}
+		}
+	}
+
+	var names []string
+	for name := range b.objects {
+		if strings.HasPrefix(name, folderName) {
+			names = append(names, name)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, &gcs.NotFoundError{Err: fmt.Errorf("folder %q not found", folderName)}
+	}
+
+	for _, name := range names {
+		src := b.objects[name]
+		if _, err := b.copyLocked(src, destinationFolderId+strings.TrimPrefix(name, folderName)); err != nil {
+			return nil, err
+		}
+
+		if err := b.deleteLocked(src); err != nil {
+			return nil, err
+		}
+	}
+
+	return &gcs.Folder{Name: destinationFolderId, UpdateTime: time.Now()}, nil
+}
+
+func (b *localBucket) CreateFolder(ctx context.Context, folderName string) (*gcs.Folder, error) {
+	return nil, fmt.Errorf("CreateFolder: %w", errLocalBucketUnsupported)
+}
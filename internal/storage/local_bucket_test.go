@@ -0,0 +1,215 @@
+// Copyright 2025 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/gcs"
+	"github.com/googlecloudplatform/gcsfuse/v2/internal/storage/storageutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type LocalBucketTest struct {
+	suite.Suite
+	ctx    context.Context
+	dir    string
+	bucket gcs.Bucket
+}
+
+func TestLocalBucket(t *testing.T) {
+	suite.Run(t, new(LocalBucketTest))
+}
+
+func (t *LocalBucketTest) SetupTest() {
+	t.ctx = context.Background()
+	t.dir = t.T().TempDir()
+	t.reopen()
+}
+
+func (t *LocalBucketTest) reopen() {
+	var err error
+	t.bucket, err = NewLocalBucket(t.dir)
+	require.NoError(t.T(), err)
+}
+
+func (t *LocalBucketTest) create(name string, contents string, precondition *int64) (*gcs.Object, error) {
+	return t.bucket.CreateObject(t.ctx, &gcs.CreateObjectRequest{
+		Name:                   name,
+		Contents:               bytes.NewReader([]byte(contents)),
+		Metadata:               map[string]string{"foo": "bar"},
+		GenerationPrecondition: precondition,
+	})
+}
+
+func (t *LocalBucketTest) read(name string) string {
+	contents, err := storageutil.ReadObject(t.ctx, t.bucket, name)
+	require.NoError(t.T(), err)
+	return string(contents)
+}
+
+func (t *LocalBucketTest) TestCreateAndRead() {
+	o, err := t.create("a/b", "taco", nil)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(4), o.Size)
+	assert.Equal(t.T(), "taco", t.read("a/b"))
+	m, _, err := t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "a/b"})
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), o.Generation, m.Generation)
+	assert.Equal(t.T(), "bar", m.Metadata["foo"])
+}
+
+func (t *LocalBucketTest) TestReadRange() {
+	_, err := t.create("a", "burrito", nil)
+	require.NoError(t.T(), err)
+
+	r, err := t.bucket.NewReaderWithReadHandle(t.ctx, &gcs.ReadObjectRequest{Name: "a", Range: &gcs.ByteRange{Start: 2, Limit: 5}})
+
+	require.NoError(t.T(), err)
+	defer r.Close()
+	buf := new(bytes.Buffer)
+	_, err = buf.ReadFrom(r)
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), "rri", buf.String())
+}
+
+func (t *LocalBucketTest) TestGenerationPreconditions() {
+	var zero int64
+	o, err := t.create("a", "taco", &zero)
+	require.NoError(t.T(), err)
+
+	_, err = t.create("a", "burrito", &zero)
+	var preconditionErr *gcs.PreconditionError
+	assert.ErrorAs(t.T(), err, &preconditionErr)
+
+	o2, err := t.create("a", "burrito", &o.Generation)
+	require.NoError(t.T(), err)
+	assert.Greater(t.T(), o2.Generation, o.Generation)
+	assert.Equal(t.T(), "burrito", t.read("a"))
+}
+
+func (t *LocalBucketTest) TestContentsPersist() {
+	_, err := t.create("a", "taco", nil)
+	require.NoError(t.T(), err)
+	_, err = t.create("b", "burrito", nil)
+	require.NoError(t.T(), err)
+	require.NoError(t.T(), t.bucket.DeleteObject(t.ctx, &gcs.DeleteObjectRequest{Name: "b"}))
+
+	t.reopen()
+
+	assert.Equal(t.T(), "taco", t.read("a"))
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "b"})
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+	// One object, as contents and attributes.
+	entries, err := os.ReadDir(t.dir)
+	require.NoError(t.T(), err)
+	assert.Len(t.T(), entries, 2)
+}
+
+func (t *LocalBucketTest) TestListObjects() {
+	for _, name := range []string{"a", "b/", "b/c", "b/d/e", "f/g"} {
+		_, err := t.create(name, "", nil)
+		require.NoError(t.T(), err)
+	}
+
+	listing, err := t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Delimiter: "/", IncludeTrailingDelimiter: true})
+
+	require.NoError(t.T(), err)
+	var names []string
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+	}
+	assert.Equal(t.T(), []string{"a", "b/"}, names)
+	assert.Equal(t.T(), []string{"b/", "f/"}, listing.CollapsedRuns)
+
+	listing, err = t.bucket.ListObjects(t.ctx, &gcs.ListObjectsRequest{Prefix: "b/", Delimiter: "/"})
+
+	require.NoError(t.T(), err)
+	names = nil
+	for _, o := range listing.MinObjects {
+		names = append(names, o.Name)
+	}
+	assert.Equal(t.T(), []string{"b/", "b/c"}, names)
+	assert.Equal(t.T(), []string{"b/d/"}, listing.CollapsedRuns)
+}
+
+func (t *LocalBucketTest) TestComposeObjects() {
+	a, err := t.create("a", "taco", nil)
+	require.NoError(t.T(), err)
+	b, err := t.create("b", "burrito", nil)
+	require.NoError(t.T(), err)
+
+	o, err := t.bucket.ComposeObjects(t.ctx, &gcs.ComposeObjectsRequest{
+		DstName:                   "a",
+		DstGenerationPrecondition: &a.Generation,
+		Sources:                   []gcs.ComposeSource{{Name: "a", Generation: a.Generation}, {Name: "b", Generation: b.Generation}},
+	})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), int64(2), o.ComponentCount)
+	assert.Equal(t.T(), "tacoburrito", t.read("a"))
+}
+
+func (t *LocalBucketTest) TestCopyAndMoveObject() {
+	_, err := t.create("a", "taco", nil)
+	require.NoError(t.T(), err)
+
+	_, err = t.bucket.CopyObject(t.ctx, &gcs.CopyObjectRequest{SrcName: "a", DstName: "b"})
+	require.NoError(t.T(), err)
+	_, err = t.bucket.MoveObject(t.ctx, &gcs.MoveObjectRequest{SrcName: "a", DstName: "c"})
+	require.NoError(t.T(), err)
+
+	assert.Equal(t.T(), "taco", t.read("b"))
+	assert.Equal(t.T(), "taco", t.read("c"))
+	_, _, err = t.bucket.StatObject(t.ctx, &gcs.StatObjectRequest{Name: "a"})
+	var notFoundErr *gcs.NotFoundError
+	assert.ErrorAs(t.T(), err, &notFoundErr)
+}
+
+func (t *LocalBucketTest) TestUpdateObject() {
+	o, err := t.create("a", "taco", nil)
+	require.NoError(t.T(), err)
+	value := "qux"
+
+	updated, err := t.bucket.UpdateObject(t.ctx, &gcs.UpdateObjectRequest{
+		Name:     "a",
+		Metadata: map[string]*string{"foo": nil, "baz": &value},
+	})
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), o.Generation, updated.Generation)
+	assert.Equal(t.T(), o.MetaGeneration+1, updated.MetaGeneration)
+	assert.Equal(t.T(), map[string]string{"baz": "qux"}, updated.Metadata)
+}
+
+func (t *LocalBucketTest) TestChunkWriter() {
+	w, err := t.bucket.CreateObjectChunkWriter(t.ctx, &gcs.CreateObjectRequest{Name: "a"}, 0, nil)
+	require.NoError(t.T(), err)
+	_, err = w.Write([]byte("taco"))
+	require.NoError(t.T(), err)
+
+	m, err := t.bucket.FinalizeUpload(t.ctx, w)
+
+	require.NoError(t.T(), err)
+	assert.Equal(t.T(), uint64(4), m.Size)
+	assert.Equal(t.T(), "taco", t.read("a"))
+}